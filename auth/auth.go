@@ -0,0 +1,112 @@
+// Package auth contains the authentication domain model and repository interface.
+package auth
+
+//go:generate mockgen -source=auth.go -destination=mocks/auth_mock.go -package=mocks
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/zechao/faceit-user-svc/errors"
+)
+
+var (
+	// ErrInvalidCredentials is returned when the email or the password is wrong,
+	// it doesn't tell which one to avoid leaking the registered emails.
+	ErrInvalidCredentials = errors.NewUnauthorized("invalid email or password")
+	// ErrInvalidToken is returned when a token is malformed, expired or revoked.
+	ErrInvalidToken = errors.NewUnauthorized("invalid or expired token")
+)
+
+// TokenType is the type of the access tokens, they are sent in the Authorization header.
+const TokenType = "Bearer"
+
+// Claims are the claims of the access tokens.
+// The subject is the user ID and SessionID is the ID of the refresh token issued with it, the access token is
+// only accepted while that refresh token is active, so revoking the refresh token revokes the access token too.
+// Roles and Scope are only set by the identity providers that manage them, Scope is a space separated list.
+type Claims struct {
+	jwt.RegisteredClaims
+	SessionID string   `json:"sid,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+}
+
+// TokenPair is the result of a login or a refresh.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+// RefreshToken represents an issued refresh token, only the hash of the token is stored.
+type RefreshToken struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	TokenHash string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	RevokedAt *time.Time
+}
+
+// TableName returns the table name for the refresh token model.
+func (RefreshToken) TableName() string {
+	return "user_svc.refresh_tokens"
+}
+
+// Active reports whether the token can still be used at now.
+func (t RefreshToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
+
+// NewRefreshToken generates a new random refresh token, and returns it with its hash.
+func NewRefreshToken() (token string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken returns the hash of the refresh token used to find it in the storage.
+// Refresh tokens are random, so a fast hash is enough.
+func HashRefreshToken(token string) string {
+	return hashSecret(token)
+}
+
+// hashSecret returns the SHA-256 hash of a random secret in hex.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Repository defines the interface for refresh token data access operations.
+type Repository interface {
+	CreateRefreshToken(ctx context.Context, t *RefreshToken) error
+	// GetRefreshTokenByHash returns the token with the hash, revoked and expired tokens included.
+	GetRefreshTokenByHash(ctx context.Context, hash string) (*RefreshToken, error)
+	// RevokeRefreshToken revokes the token, it returns errors.ErrNotfound if it was already revoked.
+	RevokeRefreshToken(ctx context.Context, id uuid.UUID, revokedAt time.Time) error
+	// SessionActive reports whether the refresh token with the id is neither revoked nor expired at now,
+	// and its user still exists and isn't deleted.
+	SessionActive(ctx context.Context, id uuid.UUID, now time.Time) (bool, error)
+}
+
+// Service defines the interface for authentication operations.
+type Service interface {
+	// Login checks the credentials of the user and issues a new token pair.
+	Login(ctx context.Context, email, password string) (*TokenPair, error)
+	// Refresh revokes the refresh token and issues a new token pair.
+	Refresh(ctx context.Context, refreshToken string) (*TokenPair, error)
+	// Logout revokes the refresh token and with it the access tokens issued with it.
+	Logout(ctx context.Context, refreshToken string) error
+	// ValidateAccessToken checks the signature and the expiration of the access token and returns its claims.
+	ValidateAccessToken(ctx context.Context, accessToken string) (*Claims, error)
+}
@@ -0,0 +1,40 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zechao/faceit-user-svc/auth"
+)
+
+func TestNewRefreshToken(t *testing.T) {
+	token, hash, err := auth.NewRefreshToken()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token)
+	assert.Equal(t, auth.HashRefreshToken(token), hash)
+	assert.NotEqual(t, token, hash, "token must not be stored in plain text")
+
+	other, _, err := auth.NewRefreshToken()
+	assert.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func TestRefreshTokenActive(t *testing.T) {
+	now := time.Now()
+	revokedAt := now.Add(-time.Minute)
+
+	tests := map[string]struct {
+		token    auth.RefreshToken
+		expected bool
+	}{
+		"active":  {token: auth.RefreshToken{ExpiresAt: now.Add(time.Hour)}, expected: true},
+		"expired": {token: auth.RefreshToken{ExpiresAt: now.Add(-time.Second)}},
+		"revoked": {token: auth.RefreshToken{ExpiresAt: now.Add(time.Hour), RevokedAt: &revokedAt}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.token.Active(now))
+		})
+	}
+}
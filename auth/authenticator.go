@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// APIKey is a static key of a service, it grants the scopes to the caller sending it.
+type APIKey struct {
+	Name   string
+	Key    string
+	Scopes []string
+}
+
+// ParseAPIKeys parses the API keys from config, the keys are separated by commas
+// and have the format name:key:scope1 scope2.
+func ParseAPIKeys(s string) ([]APIKey, error) {
+	var keys []APIKey
+	for i, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+			// the entry is not logged, it may contain the key
+			return nil, fmt.Errorf("invalid API key at position %d, expected name:key:scopes", i+1)
+		}
+		keys = append(keys, APIKey{
+			Name:   parts[0],
+			Key:    parts[1],
+			Scopes: strings.Fields(parts[2]),
+		})
+	}
+	return keys, nil
+}
+
+// AuthenticatorConfig defines the credentials accepted by the Authenticator.
+type AuthenticatorConfig struct {
+	// Issuer is the expected iss claim of the tokens.
+	Issuer string
+	// SigningKey verifies the HS256 tokens, they are rejected when it's empty.
+	SigningKey string
+	// JWKSFile is a JSON Web Key Set file with the RSA public keys verifying the RS256 tokens,
+	// they are rejected when it's empty.
+	JWKSFile string
+	// APIKeys are the static keys of the services.
+	APIKeys []APIKey
+	// Sessions are the refresh tokens issued by this service, the access tokens with a session ID are only
+	// accepted while it's active. The session isn't checked when it's nil.
+	Sessions Repository
+}
+
+// Authenticator authenticates the callers by access token or API key.
+type Authenticator struct {
+	issuer   string
+	hmacKey  []byte
+	rsaKeys  map[string]*rsa.PublicKey
+	apiKeys  map[string]APIKey
+	sessions Repository
+	now      func() time.Time
+}
+
+// NewAuthenticator creates a new Authenticator with the keys of the config.
+func NewAuthenticator(cfg AuthenticatorConfig) (*Authenticator, error) {
+	a := &Authenticator{
+		issuer:   cfg.Issuer,
+		apiKeys:  make(map[string]APIKey, len(cfg.APIKeys)),
+		sessions: cfg.Sessions,
+		now:      time.Now,
+	}
+	if cfg.SigningKey != "" {
+		if len(cfg.SigningKey) < minHMACKeyLength {
+			return nil, fmt.Errorf("HS256 signing key must be at least %d characters long", minHMACKeyLength)
+		}
+		a.hmacKey = []byte(cfg.SigningKey)
+	}
+	if cfg.JWKSFile != "" {
+		keys, err := loadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		a.rsaKeys = keys
+	}
+	for _, k := range cfg.APIKeys {
+		// keys are indexed by hash, so the plain keys don't stay in memory
+		a.apiKeys[hashSecret(k.Key)] = APIKey{Name: k.Name, Scopes: k.Scopes}
+	}
+	return a, nil
+}
+
+// AuthenticateToken verifies the access token and returns the identity of the user.
+// It returns ErrInvalidToken if the token is not valid, or if its session was revoked by a logout or a refresh,
+// or its user was deleted.
+func (a *Authenticator) AuthenticateToken(ctx context.Context, accessToken string) (*Identity, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(accessToken, &claims, a.key,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(a.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(a.now),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+	if err := a.checkSession(ctx, claims.SessionID); err != nil {
+		return nil, err
+	}
+	return &Identity{
+		Kind:    UserIdentity,
+		Subject: claims.Subject,
+		Roles:   claims.Roles,
+		Scopes:  strings.Fields(claims.Scope),
+	}, nil
+}
+
+// AuthenticateAPIKey returns the identity of the service owning the API key.
+// It returns ErrInvalidToken if the key is unknown.
+func (a *Authenticator) AuthenticateAPIKey(key string) (*Identity, error) {
+	apiKey, ok := a.apiKeys[hashSecret(key)]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	return &Identity{
+		Kind:    ServiceIdentity,
+		Subject: apiKey.Name,
+		Scopes:  apiKey.Scopes,
+	}, nil
+}
+
+// checkSession returns ErrInvalidToken if the session of the token isn't active anymore.
+// The tokens without session, issued by other identity providers, aren't checked.
+func (a *Authenticator) checkSession(ctx context.Context, sessionID string) error {
+	if a.sessions == nil || sessionID == "" {
+		return nil
+	}
+	id, err := uuid.Parse(sessionID)
+	if err != nil {
+		return fmt.Errorf("%w: invalid session", ErrInvalidToken)
+	}
+	active, err := a.sessions.SessionActive(ctx, id, a.now())
+	if err != nil {
+		return fmt.Errorf("failed to check session: %w", err)
+	}
+	if !active {
+		return fmt.Errorf("%w: session revoked", ErrInvalidToken)
+	}
+	return nil
+}
+
+// key returns the key verifying the token, depending on its algorithm and kid header.
+func (a *Authenticator) key(token *jwt.Token) (any, error) {
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		if a.hmacKey == nil {
+			return nil, fmt.Errorf("HS256 tokens are not accepted")
+		}
+		return a.hmacKey, nil
+	case jwt.SigningMethodRS256.Alg():
+		kid, _ := token.Header["kid"].(string)
+		if key, ok := a.rsaKeys[kid]; ok {
+			return key, nil
+		}
+		// a token without kid is accepted when there is a single key
+		if kid == "" && len(a.rsaKeys) == 1 {
+			for _, key := range a.rsaKeys {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown RS256 key %q", kid)
+	}
+	return nil, fmt.Errorf("unsupported signing method %s", token.Method.Alg())
+}
+
+// jwk is a JSON Web Key, only the RSA fields are read.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// loadJWKS reads the RSA signing keys of the JSON Web Key Set file, indexed by kid.
+func loadJWKS(file string) (map[string]*rsa.PublicKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") || (k.Alg != "" && k.Alg != jwt.SigningMethodRS256.Alg()) {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus of JWKS key %q: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent of JWKS key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS %s has no RS256 signing keys", file)
+	}
+	return keys, nil
+}
@@ -0,0 +1,370 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zechao/faceit-user-svc/auth"
+	"github.com/zechao/faceit-user-svc/auth/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+// writeJWKS writes a JSON Web Key Set with the public key under the kid and returns the file path.
+func writeJWKS(t *testing.T, kid string, key *rsa.PublicKey) string {
+	data, err := json.Marshal(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(file, data, 0o600))
+	return file
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, key any, kid string, claims auth.Claims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestAuthenticateToken(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	authenticator, err := auth.NewAuthenticator(auth.AuthenticatorConfig{
+		Issuer:     "user-svc",
+		SigningKey: testSigningKey,
+		JWKSFile:   writeJWKS(t, "key-1", &rsaKey.PublicKey),
+	})
+	require.NoError(t, err)
+
+	userID := uuid.NewString()
+	claims := func(modify func(c *auth.Claims)) auth.Claims {
+		c := auth.Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "user-svc",
+				Subject:   userID,
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+			Roles: []string{auth.RoleAdmin},
+			Scope: "service read",
+		}
+		if modify != nil {
+			modify(&c)
+		}
+		return c
+	}
+
+	tests := map[string]struct {
+		token     string
+		expectErr bool
+	}{
+		"success HS256": {
+			token: signToken(t, jwt.SigningMethodHS256, []byte(testSigningKey), "", claims(nil)),
+		},
+		"success RS256 with kid": {
+			token: signToken(t, jwt.SigningMethodRS256, rsaKey, "key-1", claims(nil)),
+		},
+		"success RS256 without kid and single key": {
+			token: signToken(t, jwt.SigningMethodRS256, rsaKey, "", claims(nil)),
+		},
+		"fail by unknown kid": {
+			token:     signToken(t, jwt.SigningMethodRS256, rsaKey, "key-2", claims(nil)),
+			expectErr: true,
+		},
+		"fail by wrong RSA key": {
+			token:     signToken(t, jwt.SigningMethodRS256, otherKey, "key-1", claims(nil)),
+			expectErr: true,
+		},
+		"fail by wrong HMAC key": {
+			token:     signToken(t, jwt.SigningMethodHS256, []byte("another-signing-key-with-32-chars!!"), "", claims(nil)),
+			expectErr: true,
+		},
+		"fail by unsupported method": {
+			token:     signToken(t, jwt.SigningMethodHS512, []byte(testSigningKey), "", claims(nil)),
+			expectErr: true,
+		},
+		"fail by expired token": {
+			token: signToken(t, jwt.SigningMethodHS256, []byte(testSigningKey), "", claims(func(c *auth.Claims) {
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+			})),
+			expectErr: true,
+		},
+		"fail by missing expiration": {
+			token: signToken(t, jwt.SigningMethodHS256, []byte(testSigningKey), "", claims(func(c *auth.Claims) {
+				c.ExpiresAt = nil
+			})),
+			expectErr: true,
+		},
+		"fail by wrong issuer": {
+			token: signToken(t, jwt.SigningMethodHS256, []byte(testSigningKey), "", claims(func(c *auth.Claims) {
+				c.Issuer = "another"
+			})),
+			expectErr: true,
+		},
+		"fail by missing subject": {
+			token: signToken(t, jwt.SigningMethodHS256, []byte(testSigningKey), "", claims(func(c *auth.Claims) {
+				c.Subject = ""
+			})),
+			expectErr: true,
+		},
+		"fail by malformed token": {
+			token:     "not a token",
+			expectErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			identity, err := authenticator.AuthenticateToken(context.Background(), tt.token)
+			if tt.expectErr {
+				assert.ErrorIs(t, err, auth.ErrInvalidToken)
+				assert.Nil(t, identity)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, auth.UserIdentity, identity.Kind)
+			assert.Equal(t, userID, identity.Subject)
+			assert.True(t, identity.IsAdmin())
+			assert.True(t, identity.IsUser(userID))
+			assert.Equal(t, []string{"service", "read"}, identity.Scopes)
+		})
+	}
+}
+
+func TestAuthenticateTokenWithoutKeys(t *testing.T) {
+	authenticator, err := auth.NewAuthenticator(auth.AuthenticatorConfig{Issuer: "user-svc"})
+	require.NoError(t, err)
+
+	token := signToken(t, jwt.SigningMethodHS256, []byte(testSigningKey), "", auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "user-svc",
+			Subject:   uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+	_, err = authenticator.AuthenticateToken(context.Background(), token)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+}
+
+func TestAuthenticateTokenIssuedByTokenIssuer(t *testing.T) {
+	issuer, err := auth.NewTokenIssuer(testIssuerConfig)
+	require.NoError(t, err)
+	authenticator, err := auth.NewAuthenticator(auth.AuthenticatorConfig{Issuer: "user-svc", SigningKey: testSigningKey})
+	require.NoError(t, err)
+
+	userID := uuid.New()
+	token, _, err := issuer.Issue(userID, uuid.New(), time.Now())
+	require.NoError(t, err)
+
+	identity, err := authenticator.AuthenticateToken(context.Background(), token)
+	require.NoError(t, err)
+	assert.True(t, identity.IsUser(userID.String()))
+	assert.False(t, identity.IsAdmin())
+}
+
+func TestAuthenticateTokenSession(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	claims := func(sid string) auth.Claims {
+		return auth.Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "user-svc",
+				Subject:   uuid.NewString(),
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+			SessionID: sid,
+		}
+	}
+
+	tests := map[string]struct {
+		token      string
+		setupMocks func(sessions *mocks.MockRepository)
+		expectErr  error
+	}{
+		"success with active session": {
+			token: signToken(t, jwt.SigningMethodHS256, []byte(testSigningKey), "", claims(sessionID.String())),
+			setupMocks: func(sessions *mocks.MockRepository) {
+				sessions.EXPECT().SessionActive(ctx, sessionID, gomock.Any()).Return(true, nil)
+			},
+		},
+		"success without session": {
+			token:      signToken(t, jwt.SigningMethodHS256, []byte(testSigningKey), "", claims("")),
+			setupMocks: func(sessions *mocks.MockRepository) {},
+		},
+		"fail by revoked session": {
+			token: signToken(t, jwt.SigningMethodHS256, []byte(testSigningKey), "", claims(sessionID.String())),
+			setupMocks: func(sessions *mocks.MockRepository) {
+				sessions.EXPECT().SessionActive(ctx, sessionID, gomock.Any()).Return(false, nil)
+			},
+			expectErr: auth.ErrInvalidToken,
+		},
+		"fail by invalid session": {
+			token:      signToken(t, jwt.SigningMethodHS256, []byte(testSigningKey), "", claims("not a uuid")),
+			setupMocks: func(sessions *mocks.MockRepository) {},
+			expectErr:  auth.ErrInvalidToken,
+		},
+		"fail by repository error": {
+			token: signToken(t, jwt.SigningMethodHS256, []byte(testSigningKey), "", claims(sessionID.String())),
+			setupMocks: func(sessions *mocks.MockRepository) {
+				sessions.EXPECT().SessionActive(ctx, sessionID, gomock.Any()).Return(false, assert.AnError)
+			},
+			expectErr: assert.AnError,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			sessions := mocks.NewMockRepository(ctrl)
+			tt.setupMocks(sessions)
+			authenticator, err := auth.NewAuthenticator(auth.AuthenticatorConfig{
+				Issuer:     "user-svc",
+				SigningKey: testSigningKey,
+				Sessions:   sessions,
+			})
+			require.NoError(t, err)
+
+			identity, err := authenticator.AuthenticateToken(ctx, tt.token)
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				assert.Nil(t, identity)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, auth.UserIdentity, identity.Kind)
+		})
+	}
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	tests := map[string]struct {
+		cfg       func() auth.AuthenticatorConfig
+		expectErr bool
+	}{
+		"success without keys": {
+			cfg: func() auth.AuthenticatorConfig { return auth.AuthenticatorConfig{} },
+		},
+		"fail by short HS256 key": {
+			cfg: func() auth.AuthenticatorConfig {
+				return auth.AuthenticatorConfig{SigningKey: "short"}
+			},
+			expectErr: true,
+		},
+		"fail by missing JWKS file": {
+			cfg: func() auth.AuthenticatorConfig {
+				return auth.AuthenticatorConfig{JWKSFile: filepath.Join(t.TempDir(), "missing.json")}
+			},
+			expectErr: true,
+		},
+		"fail by JWKS without RSA keys": {
+			cfg: func() auth.AuthenticatorConfig {
+				file := filepath.Join(t.TempDir(), "jwks.json")
+				require.NoError(t, os.WriteFile(file, []byte(`{"keys":[{"kty":"EC","kid":"ec"}]}`), 0o600))
+				return auth.AuthenticatorConfig{JWKSFile: file}
+			},
+			expectErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := auth.NewAuthenticator(tt.cfg())
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	keys, err := auth.ParseAPIKeys("billing:billing-secret:service, backoffice:backoffice-secret:service admin")
+	require.NoError(t, err)
+	authenticator, err := auth.NewAuthenticator(auth.AuthenticatorConfig{APIKeys: keys})
+	require.NoError(t, err)
+
+	identity, err := authenticator.AuthenticateAPIKey("billing-secret")
+	require.NoError(t, err)
+	assert.Equal(t, auth.ServiceIdentity, identity.Kind)
+	assert.Equal(t, "billing", identity.Subject)
+	assert.True(t, identity.HasScope(auth.ScopeService))
+	assert.False(t, identity.IsAdmin())
+
+	identity, err = authenticator.AuthenticateAPIKey("backoffice-secret")
+	require.NoError(t, err)
+	assert.True(t, identity.IsAdmin())
+	// a service is never a user, even if its name looks like an ID
+	assert.False(t, identity.IsUser("backoffice"))
+
+	_, err = authenticator.AuthenticateAPIKey("unknown")
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	tests := map[string]struct {
+		input     string
+		expected  []auth.APIKey
+		expectErr bool
+	}{
+		"success empty": {
+			input: "",
+		},
+		"success multiple keys": {
+			input: "billing:secret-1:service,backoffice:secret-2:service admin",
+			expected: []auth.APIKey{
+				{Name: "billing", Key: "secret-1", Scopes: []string{"service"}},
+				{Name: "backoffice", Key: "secret-2", Scopes: []string{"service", "admin"}},
+			},
+		},
+		"success key without scopes": {
+			input:    "billing:secret-1:",
+			expected: []auth.APIKey{{Name: "billing", Key: "secret-1", Scopes: []string{}}},
+		},
+		"fail by missing scopes separator": {
+			input:     "billing:secret-1",
+			expectErr: true,
+		},
+		"fail by empty key": {
+			input:     "billing::service",
+			expectErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			keys, err := auth.ParseAPIKeys(tt.input)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, keys)
+		})
+	}
+}
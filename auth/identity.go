@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"context"
+	"slices"
+)
+
+const (
+	// RoleAdmin is the role of the users allowed to manage every user.
+	RoleAdmin = "admin"
+	// ScopeAdmin is the scope of the callers allowed to manage every user.
+	ScopeAdmin = "admin"
+	// ScopeService is the scope of the services allowed to read every user.
+	ScopeService = "service"
+)
+
+// IdentityKind tells whether the caller is a user or a service.
+type IdentityKind string
+
+const (
+	// UserIdentity is a user authenticated with an access token, its subject is the user ID.
+	UserIdentity IdentityKind = "user"
+	// ServiceIdentity is a service authenticated with an API key, its subject is the key name.
+	ServiceIdentity IdentityKind = "service"
+)
+
+// Identity represents the authenticated caller of a request.
+type Identity struct {
+	Kind    IdentityKind
+	Subject string
+	Roles   []string
+	Scopes  []string
+}
+
+// HasRole reports whether the identity has the role.
+func (i Identity) HasRole(role string) bool {
+	return slices.Contains(i.Roles, role)
+}
+
+// HasScope reports whether the identity has any of the scopes.
+func (i Identity) HasScope(scopes ...string) bool {
+	return slices.ContainsFunc(scopes, func(scope string) bool {
+		return slices.Contains(i.Scopes, scope)
+	})
+}
+
+// IsAdmin reports whether the identity is allowed to manage every user.
+func (i Identity) IsAdmin() bool {
+	return i.HasRole(RoleAdmin) || i.HasScope(ScopeAdmin)
+}
+
+// IsUser reports whether the identity is the user with the ID.
+func (i Identity) IsUser(id string) bool {
+	return i.Kind == UserIdentity && i.Subject == id
+}
+
+// identityKey is the context key of the identity, a distinct type so it can't collide with other keys.
+type identityKey struct{}
+
+// ContextWithIdentity returns a new context with the caller identity.
+func ContextWithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext retrieves the caller identity from the context.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok
+}
@@ -0,0 +1,40 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zechao/faceit-user-svc/auth"
+	"github.com/zechao/faceit-user-svc/tracing"
+)
+
+func TestIdentityFromContext(t *testing.T) {
+	ctx := context.Background()
+	_, ok := auth.IdentityFromContext(ctx)
+	assert.False(t, ok)
+
+	identity := &auth.Identity{Kind: auth.UserIdentity, Subject: "user-id"}
+	res, ok := auth.IdentityFromContext(auth.ContextWithIdentity(ctx, identity))
+	assert.True(t, ok)
+	assert.Equal(t, identity, res)
+}
+
+func TestIdentityKeepsTracingID(t *testing.T) {
+	// the identity is set after the tracing ID by the middlewares, its key must not hide it
+	identity := &auth.Identity{Kind: auth.UserIdentity, Subject: "user-id"}
+	ctx := auth.ContextWithIdentity(tracing.ContextWithTracingID(context.Background(), "trace-id"), identity)
+
+	tracingID, ok := tracing.FromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "trace-id", tracingID)
+	res, ok := auth.IdentityFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, identity, res)
+
+	// and the other way around
+	ctx = tracing.ContextWithTracingID(auth.ContextWithIdentity(context.Background(), identity), "trace-id")
+	res, ok = auth.IdentityFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, identity, res)
+}
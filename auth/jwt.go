@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// minHMACKeyLength is the min length of the HS256 secret, shorter secrets can be brute forced.
+const minHMACKeyLength = 32
+
+// IssuerConfig defines how the access tokens are signed.
+type IssuerConfig struct {
+	// Issuer is the iss claim of the tokens.
+	Issuer string
+	// SigningMethod is HS256 or RS256.
+	SigningMethod string
+	// SigningKey is the secret of HS256.
+	SigningKey string
+	// PrivateKeyFile is the PEM file with the RSA private key of RS256.
+	PrivateKeyFile string
+	// KeyID is sent in the kid header, so verifiers can pick the public key from a JWKS.
+	KeyID string
+	// TTL is how long the access tokens are valid.
+	TTL time.Duration
+}
+
+// TokenIssuer signs and verifies the access tokens.
+type TokenIssuer struct {
+	method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+	keyID     string
+	issuer    string
+	ttl       time.Duration
+}
+
+// NewTokenIssuer creates a new TokenIssuer with the keys of the config.
+func NewTokenIssuer(cfg IssuerConfig) (*TokenIssuer, error) {
+	issuer := &TokenIssuer{
+		keyID:  cfg.KeyID,
+		issuer: cfg.Issuer,
+		ttl:    cfg.TTL,
+	}
+	switch cfg.SigningMethod {
+	case jwt.SigningMethodHS256.Alg():
+		if len(cfg.SigningKey) < minHMACKeyLength {
+			return nil, fmt.Errorf("HS256 signing key must be at least %d characters long", minHMACKeyLength)
+		}
+		issuer.method = jwt.SigningMethodHS256
+		issuer.signKey = []byte(cfg.SigningKey)
+		issuer.verifyKey = []byte(cfg.SigningKey)
+	case jwt.SigningMethodRS256.Alg():
+		pem, err := os.ReadFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read RS256 private key: %w", err)
+		}
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RS256 private key: %w", err)
+		}
+		issuer.method = jwt.SigningMethodRS256
+		issuer.signKey = key
+		issuer.verifyKey = &key.PublicKey
+	default:
+		return nil, fmt.Errorf("unsupported signing method %q", cfg.SigningMethod)
+	}
+	return issuer, nil
+}
+
+// Issue signs a new access token of the user for the session, and returns it with its expiration.
+func (i *TokenIssuer) Issue(userID, sessionID uuid.UUID, now time.Time) (string, time.Time, error) {
+	expiresAt := now.Add(i.ttl)
+	token := jwt.NewWithClaims(i.method, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    i.issuer,
+			Subject:   userID.String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		SessionID: sessionID.String(),
+	})
+	if i.keyID != "" {
+		token.Header["kid"] = i.keyID
+	}
+	signed, err := token.SignedString(i.signKey)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign access token: %w", err)
+	}
+	return signed, expiresAt, nil
+}
+
+// Parse verifies the signature, the issuer and the expiration of the access token at now, and returns its claims.
+// It returns ErrInvalidToken if the token is not valid.
+func (i *TokenIssuer) Parse(accessToken string, now time.Time) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(accessToken, &claims, func(*jwt.Token) (any, error) {
+		return i.verifyKey, nil
+	},
+		jwt.WithValidMethods([]string{i.method.Alg()}),
+		jwt.WithIssuer(i.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(func() time.Time { return now }),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return &claims, nil
+}
@@ -0,0 +1,205 @@
+package auth_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zechao/faceit-user-svc/auth"
+)
+
+const testSigningKey = "test-signing-key-with-32-characters!"
+
+var testIssuerConfig = auth.IssuerConfig{
+	Issuer:        "user-svc",
+	SigningMethod: "HS256",
+	SigningKey:    testSigningKey,
+	TTL:           15 * time.Minute,
+}
+
+// writeRSAKey writes a new RSA private key in PEM format and returns the file path.
+func writeRSAKey(t *testing.T) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "key.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	require.NoError(t, os.WriteFile(file, data, 0o600))
+	return file
+}
+
+func TestNewTokenIssuer(t *testing.T) {
+	tests := map[string]struct {
+		cfg       func() auth.IssuerConfig
+		expectErr bool
+	}{
+		"success HS256": {
+			cfg: func() auth.IssuerConfig { return testIssuerConfig },
+		},
+		"success RS256": {
+			cfg: func() auth.IssuerConfig {
+				cfg := testIssuerConfig
+				cfg.SigningMethod = "RS256"
+				cfg.PrivateKeyFile = writeRSAKey(t)
+				return cfg
+			},
+		},
+		"fail by short HS256 key": {
+			cfg: func() auth.IssuerConfig {
+				cfg := testIssuerConfig
+				cfg.SigningKey = "short"
+				return cfg
+			},
+			expectErr: true,
+		},
+		"fail by missing RS256 key file": {
+			cfg: func() auth.IssuerConfig {
+				cfg := testIssuerConfig
+				cfg.SigningMethod = "RS256"
+				cfg.PrivateKeyFile = filepath.Join(t.TempDir(), "missing.pem")
+				return cfg
+			},
+			expectErr: true,
+		},
+		"fail by invalid RS256 key": {
+			cfg: func() auth.IssuerConfig {
+				cfg := testIssuerConfig
+				cfg.SigningMethod = "RS256"
+				cfg.PrivateKeyFile = filepath.Join(t.TempDir(), "invalid.pem")
+				require.NoError(t, os.WriteFile(cfg.PrivateKeyFile, []byte("invalid"), 0o600))
+				return cfg
+			},
+			expectErr: true,
+		},
+		"fail by unsupported method": {
+			cfg: func() auth.IssuerConfig {
+				cfg := testIssuerConfig
+				cfg.SigningMethod = "none"
+				return cfg
+			},
+			expectErr: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			issuer, err := auth.NewTokenIssuer(tt.cfg())
+			if tt.expectErr {
+				assert.Error(t, err)
+				assert.Nil(t, issuer)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, issuer)
+		})
+	}
+}
+
+func TestTokenIssuer(t *testing.T) {
+	now := time.Now()
+	userID := uuid.New()
+	sessionID := uuid.New()
+
+	rsaConfig := testIssuerConfig
+	rsaConfig.SigningMethod = "RS256"
+	rsaConfig.PrivateKeyFile = writeRSAKey(t)
+	rsaConfig.KeyID = "key-1"
+
+	for name, cfg := range map[string]auth.IssuerConfig{"HS256": testIssuerConfig, "RS256": rsaConfig} {
+		t.Run("issue and parse "+name, func(t *testing.T) {
+			issuer, err := auth.NewTokenIssuer(cfg)
+			require.NoError(t, err)
+
+			token, expiresAt, err := issuer.Issue(userID, sessionID, now)
+			require.NoError(t, err)
+			assert.Equal(t, now.Add(cfg.TTL), expiresAt)
+
+			claims, err := issuer.Parse(token, now)
+			assert.NoError(t, err)
+			assert.Equal(t, userID.String(), claims.Subject)
+			assert.Equal(t, sessionID.String(), claims.SessionID)
+			assert.Equal(t, "user-svc", claims.Issuer)
+			assert.NotEmpty(t, claims.ID)
+		})
+	}
+
+	t.Run("send key id in header", func(t *testing.T) {
+		issuer, err := auth.NewTokenIssuer(rsaConfig)
+		require.NoError(t, err)
+		token, _, err := issuer.Issue(userID, sessionID, now)
+		require.NoError(t, err)
+
+		parsed, _, err := jwt.NewParser().ParseUnverified(token, &auth.Claims{})
+		require.NoError(t, err)
+		assert.Equal(t, "key-1", parsed.Header["kid"])
+	})
+
+	t.Run("fail by expired token", func(t *testing.T) {
+		issuer, err := auth.NewTokenIssuer(testIssuerConfig)
+		require.NoError(t, err)
+		token, _, err := issuer.Issue(userID, sessionID, now)
+		require.NoError(t, err)
+
+		claims, err := issuer.Parse(token, now.Add(testIssuerConfig.TTL+time.Second))
+		assert.ErrorIs(t, err, auth.ErrInvalidToken)
+		assert.Nil(t, claims)
+	})
+
+	t.Run("fail by token signed with another key", func(t *testing.T) {
+		cfg := testIssuerConfig
+		cfg.SigningKey = "another-signing-key-with-32-characters"
+		other, err := auth.NewTokenIssuer(cfg)
+		require.NoError(t, err)
+		token, _, err := other.Issue(userID, sessionID, now)
+		require.NoError(t, err)
+
+		issuer, err := auth.NewTokenIssuer(testIssuerConfig)
+		require.NoError(t, err)
+		_, err = issuer.Parse(token, now)
+		assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	})
+
+	t.Run("fail by token of another issuer", func(t *testing.T) {
+		cfg := testIssuerConfig
+		cfg.Issuer = "other-svc"
+		other, err := auth.NewTokenIssuer(cfg)
+		require.NoError(t, err)
+		token, _, err := other.Issue(userID, sessionID, now)
+		require.NoError(t, err)
+
+		issuer, err := auth.NewTokenIssuer(testIssuerConfig)
+		require.NoError(t, err)
+		_, err = issuer.Parse(token, now)
+		assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	})
+
+	t.Run("fail by unsigned token", func(t *testing.T) {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodNone, auth.Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "user-svc",
+				Subject:   userID.String(),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+		}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+		require.NoError(t, err)
+
+		issuer, err := auth.NewTokenIssuer(testIssuerConfig)
+		require.NoError(t, err)
+		_, err = issuer.Parse(token, now)
+		assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	})
+
+	t.Run("fail by malformed token", func(t *testing.T) {
+		issuer, err := auth.NewTokenIssuer(testIssuerConfig)
+		require.NoError(t, err)
+		_, err = issuer.Parse("malformed", now)
+		assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	})
+}
@@ -4,21 +4,29 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
 	"github.com/pressly/goose"
+	"github.com/zechao/faceit-user-svc/auth"
 	"github.com/zechao/faceit-user-svc/config"
 	"github.com/zechao/faceit-user-svc/event"
+	grpcapi "github.com/zechao/faceit-user-svc/grpc"
 	api "github.com/zechao/faceit-user-svc/http"
 	"github.com/zechao/faceit-user-svc/log"
 	"github.com/zechao/faceit-user-svc/postgres"
 	"github.com/zechao/faceit-user-svc/service"
 	"github.com/zechao/faceit-user-svc/tracing"
+	"github.com/zechao/faceit-user-svc/user"
+	"google.golang.org/grpc"
 
 	"gorm.io/gorm"
 )
@@ -36,15 +44,11 @@ func main() {
 	}
 	defer natConn.Close()
 
-	eventHandler := event.NewNatsEventHandler(natConn, config.ENVs.NatsConfig.Topic)
-	//Subscribe to the event bus to simulate another service
-	eventHandler.Subscribe(func(event event.Event) {
-		data, err := json.Marshal(event)
-		if err != nil {
-			log.Printf("Failed to marshal event: %v", err)
-		}
-		log.Printf("Received event: %v", string(data))
-	})
+	publisher, stopConsumer, err := setupEventBus(natConn)
+	if err != nil {
+		log.Fatalf("failed to setup event bus: %v", err)
+	}
+	defer stopConsumer()
 
 	if config.IsProduction() {
 		gin.SetMode(gin.ReleaseMode)
@@ -64,10 +68,58 @@ func main() {
 		})
 	})
 
+	// events are written to the outbox with the user changes, and published to NATS by the relay
+	outboxStore := postgres.NewOutboxRepository(db)
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	relayDone := make(chan struct{})
+	go func() {
+		event.NewOutboxRelay(outboxStore, publisher, event.RelayConfig{
+			PollInterval: config.ENVs.OutboxConfig.PollInterval,
+			BatchSize:    config.ENVs.OutboxConfig.BatchSize,
+			Lease:        config.ENVs.OutboxConfig.Lease,
+			MaxBackoff:   config.ENVs.OutboxConfig.MaxBackoff,
+		}).Run(relayCtx)
+		close(relayDone)
+	}()
+
+	authenticator, err := setupAuthenticator(db)
+	if err != nil {
+		log.Fatalf("failed to setup authenticator: %v", err)
+	}
+	// the caller identity is set for the routes registered below
+	router.Use(api.AuthenticationMiddleware(authenticator))
+
 	userStore := postgres.NewUserRepository(db)
-	userService := service.NewUserService(userStore, eventHandler)
+	transactor := postgres.NewTransactor(db)
+	idempotencyStore := postgres.NewIdempotencyRepository(db)
+	userService := service.NewIdempotentUserService(
+		service.NewUserService(userStore, postgres.NewAuditRepository(db), transactor, event.NewOutboxEventHandler(outboxStore)),
+		idempotencyStore, transactor, config.ENVs.Idempotency.TTL,
+	)
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	defer stopPurge()
+	go purgeIdempotencyKeys(purgeCtx, idempotencyStore, config.ENVs.Idempotency.PurgeInterval)
+	if config.ENVs.Retention.Period > 0 {
+		go purgeDeletedUsers(purgeCtx, userService, config.ENVs.Retention)
+	}
 	userHandler := api.NewUserHandler(userService)
 	userHandler.RegisterRoutes(router)
+	dataExportService := service.NewDataExportService(userStore, postgres.NewActivityRepository(db), transactor)
+	api.NewDataExportHandler(dataExportService).RegisterRoutes(router)
+
+	tokenIssuer, err := auth.NewTokenIssuer(auth.IssuerConfig{
+		Issuer:         config.ENVs.AuthConfig.Issuer,
+		SigningMethod:  config.ENVs.AuthConfig.SigningMethod,
+		SigningKey:     config.ENVs.AuthConfig.SigningKey,
+		PrivateKeyFile: config.ENVs.AuthConfig.PrivateKeyFile,
+		KeyID:          config.ENVs.AuthConfig.KeyID,
+		TTL:            config.ENVs.AuthConfig.AccessTokenTTL,
+	})
+	if err != nil {
+		log.Fatalf("failed to setup token issuer: %v", err)
+	}
+	authService := service.NewAuthService(userStore, postgres.NewRefreshTokenRepository(db), transactor, tokenIssuer, config.ENVs.AuthConfig.RefreshTokenTTL)
+	api.NewAuthHandler(authService).RegisterRoutes(router)
 
 	log.Println("Listening on port:", config.ENVs.HTTPPort)
 	srv := &http.Server{
@@ -82,6 +134,28 @@ func main() {
 		}
 	}()
 
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		// recover from any panics and return an internal error
+		grpcapi.RecoveryInterceptor(),
+		// tracing interceptor to set traceID in context, must run before the logger
+		tracing.UnaryServerInterceptor(),
+		log.GRPCLoggerInterceptor(),
+		// same authentication and rules as the HTTP API
+		grpcapi.AuthInterceptor(authenticator),
+	))
+	grpcapi.NewUserServer(userService).Register(grpcServer)
+
+	log.Println("Listening grpc on port:", config.ENVs.GRPCPort)
+	lis, err := net.Listen("tcp", ":"+config.ENVs.GRPCPort)
+	if err != nil {
+		log.Fatalf("failed to listen grpc port: %v", err)
+	}
+	go func() {
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Fatalf("grpc serve: %s\n", err)
+		}
+	}()
+
 	// Wait for interrupt signal to gracefully shutdown the server with
 	// a timeout of 5 seconds.
 	quit := make(chan os.Signal, 1)
@@ -94,6 +168,10 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server Shutdown: %v", err)
 	}
+	stopGRPCServer(ctx, grpcServer)
+	// stop the relay after the servers, so the events of the last requests are still published
+	stopRelay()
+	<-relayDone
 	// catching ctx.Done(). timeout of 5 seconds.
 	select {
 	case <-ctx.Done():
@@ -102,6 +180,112 @@ func main() {
 	log.Println("Server exiting")
 }
 
+// stopGRPCServer waits for the pending calls to finish, and forces the stop if the context is done first.
+func stopGRPCServer(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Println("grpc graceful stop timeout, forcing stop")
+		server.Stop()
+	}
+}
+
+// purgeIdempotencyKeys deletes the expired idempotency keys every interval until ctx is done.
+func purgeIdempotencyKeys(ctx context.Context, store user.IdempotencyRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := store.DeleteExpiredIdempotencyRecords(ctx, time.Now().UTC())
+			if err != nil {
+				log.Error(ctx, "failed to purge idempotency keys", slog.Any("error", err))
+				continue
+			}
+			log.Info(ctx, "purged idempotency keys", slog.Int64("deleted", deleted))
+		}
+	}
+}
+
+// purgeDeletedUsers erases the users deleted for longer than the retention period every interval until ctx is done.
+func purgeDeletedUsers(ctx context.Context, svc user.Service, cfg config.RetentionConfig) {
+	ticker := time.NewTicker(cfg.PurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := svc.PurgeDeletedUsers(ctx, time.Now().UTC().Add(-cfg.Period), cfg.BatchSize)
+			if err != nil {
+				log.Error(ctx, "failed to purge deleted users", slog.Any("error", err), slog.Int("purged", purged))
+				continue
+			}
+			log.Info(ctx, "purged deleted users", slog.Int("purged", purged))
+		}
+	}
+}
+
+// setupEventBus returns the publisher used by the outbox relay, and starts a consumer
+// to simulate another service getting notified, the returned function stops it.
+func setupEventBus(natConn *nats.Conn) (event.Publisher, func(), error) {
+	natsCfg := config.ENVs.NatsConfig
+	subjects, err := event.ParseSubjectMode(natsCfg.SubjectMode)
+	if err != nil {
+		return nil, nil, err
+	}
+	encoder, err := event.NewEncoder(natsCfg.EventFormat, natsCfg.EventSource)
+	if err != nil {
+		return nil, nil, err
+	}
+	logEvent := func(event event.Event) {
+		data, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("Failed to marshal event: %v", err)
+		}
+		log.Printf("Received event: %v", string(data))
+	}
+
+	if !natsCfg.JetStream {
+		natsEventHandler := event.NewNatsEventHandler(natConn, natsCfg.Topic, subjects, encoder)
+		//Subscribe to the event bus to simulate another service
+		if err := natsEventHandler.Subscribe(subjects.AllSubjects(natsCfg.Topic), logEvent); err != nil {
+			return nil, nil, err
+		}
+		return natsEventHandler, func() {}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	jsEventHandler, err := event.NewJetStreamEventHandler(ctx, natConn, natsCfg.Topic, subjects, encoder, event.StreamConfig{
+		Name:            natsCfg.Stream,
+		Retention:       natsCfg.StreamRetention,
+		Replicas:        natsCfg.StreamReplicas,
+		MaxAge:          natsCfg.StreamMaxAge,
+		DuplicateWindow: natsCfg.StreamDuplicateWindow,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	// durable consumer to simulate another service, it continues from the last acked event after a restart
+	stop, err := jsEventHandler.Consume(context.Background(), event.ConsumerConfig{Durable: "user-svc-demo"},
+		func(_ context.Context, e event.Event) error {
+			logEvent(e)
+			return nil
+		})
+	if err != nil {
+		return nil, nil, err
+	}
+	return jsEventHandler, stop, nil
+}
+
 func setupDatabase() (*gorm.DB, error) {
 	db, err := postgres.NewPostgreStorage(config.DBConfig{
 		DBUser:     config.ENVs.DBConfig.DBUser,
@@ -126,3 +310,23 @@ func setupDatabase() (*gorm.DB, error) {
 
 	return db, nil
 }
+
+// setupAuthenticator creates the authenticator of the HTTP and gRPC APIs, it accepts the HS256 tokens
+// signed with the signing key of this service, the RS256 tokens of the JWKS file and the API keys.
+// The tokens issued by this service are rejected once their refresh token is revoked.
+func setupAuthenticator(db *gorm.DB) (*auth.Authenticator, error) {
+	apiKeys, err := auth.ParseAPIKeys(config.ENVs.AuthConfig.APIKeys)
+	if err != nil {
+		return nil, err
+	}
+	cfg := auth.AuthenticatorConfig{
+		Issuer:   config.ENVs.AuthConfig.Issuer,
+		JWKSFile: config.ENVs.AuthConfig.JWKSFile,
+		APIKeys:  apiKeys,
+		Sessions: postgres.NewRefreshTokenRepository(db),
+	}
+	if strings.EqualFold(config.ENVs.AuthConfig.SigningMethod, "HS256") {
+		cfg.SigningKey = config.ENVs.AuthConfig.SigningKey
+	}
+	return auth.NewAuthenticator(cfg)
+}
@@ -5,16 +5,22 @@ import (
 	"log/slog"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	APPEnv     string
-	HTTPPort   string
-	LogLevel   int
-	DBConfig   DBConfig
-	NatsConfig NatsConfig
+	APPEnv       string
+	HTTPPort     string
+	GRPCPort     string
+	LogLevel     int
+	DBConfig     DBConfig
+	NatsConfig   NatsConfig
+	OutboxConfig OutboxConfig
+	AuthConfig   AuthConfig
+	Idempotency  IdempotencyConfig
+	Retention    RetentionConfig
 }
 
 // Config define the configuration for the PostgreSQL connection.
@@ -32,6 +38,61 @@ type NatsConfig struct {
 	NatsHost string
 	NatsPort string
 	Topic    string
+	// SubjectMode is single to send every event to the topic, or event_type to send them to <topic>.user.created...
+	SubjectMode string
+	// EventFormat is the envelope of the events: json, cloudevents-structured or cloudevents-binary.
+	EventFormat string
+	// EventSource is the CloudEvents source of the events.
+	EventSource string
+	// JetStream enables the durable publishing to a stream, instead of the core NATS publishing.
+	JetStream             bool
+	Stream                string
+	StreamRetention       string
+	StreamReplicas        int
+	StreamMaxAge          time.Duration
+	StreamDuplicateWindow time.Duration
+}
+
+// OutboxConfig define how the outbox relay publishes the pending events.
+type OutboxConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	Lease        time.Duration
+	MaxBackoff   time.Duration
+}
+
+// IdempotencyConfig define how long the idempotency keys of the user creations are kept.
+type IdempotencyConfig struct {
+	TTL time.Duration
+	// PurgeInterval is the interval between the deletions of the expired keys.
+	PurgeInterval time.Duration
+}
+
+// RetentionConfig define how long the soft deleted users are kept before they are purged.
+type RetentionConfig struct {
+	// Period is how long a user is kept after it's deleted, 0 disables the purge.
+	Period time.Duration
+	// PurgeInterval is the interval between the purges.
+	PurgeInterval time.Duration
+	// BatchSize is the number of users purged per transaction.
+	BatchSize int
+}
+
+// AuthConfig define how the access and refresh tokens are issued.
+type AuthConfig struct {
+	Issuer string
+	// SigningMethod is HS256 or RS256, HS256 is signed with SigningKey, RS256 with the PEM key of PrivateKeyFile.
+	SigningMethod   string
+	SigningKey      string
+	PrivateKeyFile  string
+	KeyID           string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// JWKSFile has the RSA public keys accepted for RS256 tokens, it must include the key of PrivateKeyFile
+	// to accept the tokens issued by this service.
+	JWKSFile string
+	// APIKeys are the keys of the services, in the format name:key:scope1 scope2, separated by commas.
+	APIKeys string
 }
 
 var ENVs = initConfig()
@@ -51,6 +112,7 @@ func initConfig() Config {
 	return Config{
 		APPEnv:   appEnv,
 		HTTPPort: getEnv("HTTP_PORT", "8080"),
+		GRPCPort: getEnv("GRPC_PORT", "9090"),
 		LogLevel: getIntEnv("LOG_LEVEL", int(slog.LevelInfo)),
 		DBConfig: DBConfig{
 			DBUser:     getEnv("DB_USER", "user"),
@@ -64,6 +126,43 @@ func initConfig() Config {
 			NatsHost: getEnv("NATS_HOST", "localhost"),
 			NatsPort: getEnv("NATS_PORT", "4222"),
 			Topic:    getEnv("NATS_TOPIC", "user-svc"),
+
+			SubjectMode: getEnv("NATS_SUBJECT_MODE", "single"),
+			EventFormat: getEnv("NATS_EVENT_FORMAT", "json"),
+			EventSource: getEnv("NATS_EVENT_SOURCE", "/user-svc"),
+
+			JetStream:             getBoolEnv("NATS_JETSTREAM", false),
+			Stream:                getEnv("NATS_STREAM", "USER_SVC"),
+			StreamRetention:       getEnv("NATS_STREAM_RETENTION", "limits"),
+			StreamReplicas:        getIntEnv("NATS_STREAM_REPLICAS", 1),
+			StreamMaxAge:          getDurationEnv("NATS_STREAM_MAX_AGE", 7*24*time.Hour),
+			StreamDuplicateWindow: getDurationEnv("NATS_STREAM_DUPLICATE_WINDOW", 2*time.Minute),
+		},
+		OutboxConfig: OutboxConfig{
+			PollInterval: getDurationEnv("OUTBOX_POLL_INTERVAL", time.Second),
+			BatchSize:    getIntEnv("OUTBOX_BATCH_SIZE", 100),
+			Lease:        getDurationEnv("OUTBOX_LEASE", 30*time.Second),
+			MaxBackoff:   getDurationEnv("OUTBOX_MAX_BACKOFF", time.Minute),
+		},
+		AuthConfig: AuthConfig{
+			Issuer:          getEnv("JWT_ISSUER", "user-svc"),
+			SigningMethod:   getEnv("JWT_SIGNING_METHOD", "HS256"),
+			SigningKey:      getEnv("JWT_SIGNING_KEY", ""),
+			PrivateKeyFile:  getEnv("JWT_PRIVATE_KEY_FILE", ""),
+			KeyID:           getEnv("JWT_KEY_ID", ""),
+			AccessTokenTTL:  getDurationEnv("JWT_ACCESS_TOKEN_TTL", 15*time.Minute),
+			RefreshTokenTTL: getDurationEnv("JWT_REFRESH_TOKEN_TTL", 30*24*time.Hour),
+			JWKSFile:        getEnv("JWT_JWKS_FILE", ""),
+			APIKeys:         getEnv("API_KEYS", ""),
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:           getDurationEnv("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+			PurgeInterval: getDurationEnv("IDEMPOTENCY_PURGE_INTERVAL", time.Hour),
+		},
+		Retention: RetentionConfig{
+			Period:        getDurationEnv("USER_RETENTION_PERIOD", 30*24*time.Hour),
+			PurgeInterval: getDurationEnv("USER_PURGE_INTERVAL", time.Hour),
+			BatchSize:     getIntEnv("USER_PURGE_BATCH_SIZE", 100),
 		},
 	}
 
@@ -94,3 +193,25 @@ func getIntEnv(key string, fallback int) int {
 	}
 	return fallback
 }
+
+func getBoolEnv(key string, fallback bool) bool {
+	if value, ok := os.LookupEnv(key); ok {
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Panicf("invalid bool value for key %s", key)
+		}
+		return v
+	}
+	return fallback
+}
+
+func getDurationEnv(key string, fallback time.Duration) time.Duration {
+	if value, ok := os.LookupEnv(key); ok {
+		v, err := time.ParseDuration(value)
+		if err != nil {
+			log.Panicf("invalid duration value for key %s", key)
+		}
+		return v
+	}
+	return fallback
+}
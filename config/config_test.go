@@ -0,0 +1,58 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// unsetEnv removes the variables for the test, they are restored when it ends.
+func unsetEnv(t *testing.T, keys ...string) {
+	for _, key := range keys {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
+
+func TestInitConfigNats(t *testing.T) {
+	tableTest := map[string]struct {
+		env            map[string]string
+		expectedConfig NatsConfig
+	}{
+		"success default values": {
+			expectedConfig: NatsConfig{
+				SubjectMode: "single",
+				EventFormat: "json",
+				EventSource: "/user-svc",
+			},
+		},
+		"success values from env": {
+			env: map[string]string{
+				"NATS_SUBJECT_MODE": "event_type",
+				"NATS_EVENT_FORMAT": "cloudevents-binary",
+				"NATS_EVENT_SOURCE": "/billing",
+			},
+			expectedConfig: NatsConfig{
+				SubjectMode: "event_type",
+				EventFormat: "cloudevents-binary",
+				EventSource: "/billing",
+			},
+		},
+	}
+
+	for name, tc := range tableTest {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("APP_ENV", "test")
+			unsetEnv(t, "NATS_SUBJECT_MODE", "NATS_EVENT_FORMAT", "NATS_EVENT_SOURCE")
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+
+			cfg := initConfig().NatsConfig
+			assert.Equal(t, tc.expectedConfig.SubjectMode, cfg.SubjectMode)
+			assert.Equal(t, tc.expectedConfig.EventFormat, cfg.EventFormat)
+			assert.Equal(t, tc.expectedConfig.EventSource, cfg.EventSource)
+		})
+	}
+}
@@ -13,6 +13,8 @@ var (
 	ErrDuplicated = NewConflict("record already exists")
 	// ErrInvalidPayload represents an invalid payload error
 	ErrInvalidPayload = NewWrongInput("invalid payload")
+	// ErrVersionMismatch represents when a record was modified since the version expected by the caller
+	ErrVersionMismatch = NewPreconditionFailed("record version doesn't match")
 )
 
 // Error represents a custom error structure.
@@ -81,6 +83,38 @@ func NewConflict(message string) error {
 	}
 }
 
+// NewPreconditionFailed creates a new precondition failed error with specific message.
+func NewPreconditionFailed(message string) error {
+	return &Error{
+		Code:    http.StatusPreconditionFailed,
+		Message: message,
+	}
+}
+
+// NewUnprocessableEntity creates a new unprocessable entity error with specific message.
+func NewUnprocessableEntity(message string) error {
+	return &Error{
+		Code:    http.StatusUnprocessableEntity,
+		Message: message,
+	}
+}
+
+// NewUnauthorized creates a new unauthorized error with specific message.
+func NewUnauthorized(message string) error {
+	return &Error{
+		Code:    http.StatusUnauthorized,
+		Message: message,
+	}
+}
+
+// NewForbidden creates a new forbidden error with specific message.
+func NewForbidden(message string) error {
+	return &Error{
+		Code:    http.StatusForbidden,
+		Message: message,
+	}
+}
+
 // AddDetail adds a new detail to the error.
 func (e *Error) AddDetail(detail Detail) {
 	e.Details = append(e.Details, detail)
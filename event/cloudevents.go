@@ -0,0 +1,185 @@
+package event
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// CloudEventsSpecVersion is the version of the CloudEvents specification of the events.
+	CloudEventsSpecVersion = "1.0"
+	// CloudEventsTypePrefix is prepended to the subject token of the event type to build
+	// the CloudEvents type, e.g. UserCreated has the type com.faceit.user-svc.user.created.
+	CloudEventsTypePrefix = "com.faceit.user-svc."
+
+	cloudEventsContentType = "application/cloudevents+json"
+	dataContentType        = "application/json"
+	contentTypeHeader      = "Content-Type"
+	// binary mode attributes are sent in the headers with this prefix
+	cloudEventsHeaderPrefix = "ce-"
+)
+
+// cloudEvent is the CloudEvents 1.0 JSON document of the structured mode.
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Time            string          `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	TraceParent     string          `json:"traceparent,omitempty"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// CloudEventsEncoder encodes the events as CloudEvents 1.0.
+// The trace ID is sent in the traceparent extension following the W3C trace context format.
+type CloudEventsEncoder struct {
+	// Source identifies this service as the producer of the events.
+	Source string
+	// Binary sends the attributes in the NATS headers and the payload as body,
+	// otherwise the structured JSON mode is used.
+	Binary bool
+}
+
+var _ Encoder = CloudEventsEncoder{}
+
+// Encode returns the CloudEvent of e in the configured mode.
+func (c CloudEventsEncoder) Encode(e Event) ([]byte, nats.Header, error) {
+	data, err := json.Marshal(e.Payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	id := e.ID
+	if id == "" {
+		id = uuid.NewString()
+	}
+	parent, err := traceParent(e.TraceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	ce := cloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		ID:              id,
+		Source:          c.Source,
+		Type:            CloudEventsTypePrefix + eventTypeToken(e.EventType),
+		Time:            time.Unix(e.Timestamp, 0).UTC().Format(time.RFC3339),
+		DataContentType: dataContentType,
+		TraceParent:     parent,
+		Data:            data,
+	}
+
+	header := nats.Header{}
+	if !c.Binary {
+		header.Set(contentTypeHeader, cloudEventsContentType)
+		body, err := json.Marshal(ce)
+		if err != nil {
+			return nil, nil, err
+		}
+		return body, header, nil
+	}
+
+	header.Set(contentTypeHeader, ce.DataContentType)
+	header.Set(cloudEventsHeaderPrefix+"specversion", ce.SpecVersion)
+	header.Set(cloudEventsHeaderPrefix+"id", ce.ID)
+	header.Set(cloudEventsHeaderPrefix+"source", ce.Source)
+	header.Set(cloudEventsHeaderPrefix+"type", ce.Type)
+	header.Set(cloudEventsHeaderPrefix+"time", ce.Time)
+	if ce.TraceParent != "" {
+		header.Set(cloudEventsHeaderPrefix+"traceparent", ce.TraceParent)
+	}
+	return ce.Data, header, nil
+}
+
+// Decode reads the event of both CloudEvents modes. Messages without CloudEvents attributes are
+// decoded as the JSON format, so consumers can be migrated before the producer.
+func (c CloudEventsEncoder) Decode(data []byte, header nats.Header) (Event, error) {
+	var ce cloudEvent
+	switch {
+	case header.Get(cloudEventsHeaderPrefix+"specversion") != "":
+		ce = cloudEvent{
+			SpecVersion:     header.Get(cloudEventsHeaderPrefix + "specversion"),
+			ID:              header.Get(cloudEventsHeaderPrefix + "id"),
+			Source:          header.Get(cloudEventsHeaderPrefix + "source"),
+			Type:            header.Get(cloudEventsHeaderPrefix + "type"),
+			Time:            header.Get(cloudEventsHeaderPrefix + "time"),
+			DataContentType: header.Get(contentTypeHeader),
+			TraceParent:     header.Get(cloudEventsHeaderPrefix + "traceparent"),
+			Data:            data,
+		}
+	case header.Get(contentTypeHeader) == cloudEventsContentType:
+		if err := json.Unmarshal(data, &ce); err != nil {
+			return Event{}, err
+		}
+	default:
+		return JSONEncoder{}.Decode(data, header)
+	}
+
+	if ce.SpecVersion != CloudEventsSpecVersion {
+		return Event{}, fmt.Errorf("unsupported CloudEvents spec version %q", ce.SpecVersion)
+	}
+	if !strings.HasPrefix(ce.Type, CloudEventsTypePrefix) {
+		return Event{}, fmt.Errorf("unknown CloudEvents type %q", ce.Type)
+	}
+	eventTime, err := time.Parse(time.RFC3339, ce.Time)
+	if err != nil {
+		return Event{}, fmt.Errorf("invalid CloudEvents time: %w", err)
+	}
+	var payload any
+	if err := json.Unmarshal(ce.Data, &payload); err != nil {
+		return Event{}, fmt.Errorf("invalid CloudEvents data: %w", err)
+	}
+
+	return Event{
+		ID:        ce.ID,
+		TraceID:   traceIDFromParent(ce.TraceParent),
+		EventType: eventTypeFromToken(strings.TrimPrefix(ce.Type, CloudEventsTypePrefix)),
+		Timestamp: eventTime.Unix(),
+		Payload:   payload,
+	}, nil
+}
+
+// traceParent builds the W3C traceparent of the trace ID with a new parent ID.
+// Trace IDs are UUIDs, any other value is hashed to fit the 16 bytes of the trace-id field.
+func traceParent(traceID string) (string, error) {
+	if traceID == "" {
+		return "", nil
+	}
+	var traceBytes [16]byte
+	if id, err := uuid.Parse(traceID); err == nil {
+		traceBytes = id
+	} else {
+		sum := sha256.Sum256([]byte(traceID))
+		copy(traceBytes[:], sum[:])
+	}
+	var parentID [8]byte
+	if _, err := rand.Read(parentID[:]); err != nil {
+		return "", fmt.Errorf("failed to generate traceparent parent ID: %w", err)
+	}
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(traceBytes[:]), hex.EncodeToString(parentID[:])), nil
+}
+
+// traceIDFromParent returns the trace-id field of a traceparent formatted as UUID,
+// it is empty if the traceparent is not valid.
+func traceIDFromParent(traceParent string) string {
+	parts := strings.Split(traceParent, "-")
+	if len(parts) != 4 {
+		return ""
+	}
+	traceBytes, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return ""
+	}
+	id, err := uuid.FromBytes(traceBytes)
+	if err != nil {
+		return ""
+	}
+	return id.String()
+}
@@ -0,0 +1,162 @@
+package event_test
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zechao/faceit-user-svc/event"
+)
+
+var traceParentRegex = regexp.MustCompile(`^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`)
+
+func newTestEvent() event.Event {
+	return event.Event{
+		ID:        uuid.NewString(),
+		TraceID:   uuid.NewString(),
+		EventType: "UserDeleted",
+		Timestamp: time.Date(2025, 2, 28, 17, 5, 19, 0, time.UTC).Unix(),
+		Payload:   map[string]any{"id": "ef447c56-8a47-4dd0-85e4-e5393140066d"},
+	}
+}
+
+func TestNewEncoder(t *testing.T) {
+	tests := map[string]struct {
+		format    string
+		expected  event.Encoder
+		expectErr bool
+	}{
+		"json":                   {format: "json", expected: event.JSONEncoder{}},
+		"cloudevents structured": {format: "cloudevents-structured", expected: event.CloudEventsEncoder{Source: "/user-svc"}},
+		"cloudevents binary":     {format: "cloudevents-binary", expected: event.CloudEventsEncoder{Source: "/user-svc", Binary: true}},
+		"fail by unknown format": {format: "xml", expectErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			encoder, err := event.NewEncoder(tt.format, "/user-svc")
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, encoder)
+		})
+	}
+}
+
+func TestCloudEventsEncoder(t *testing.T) {
+	t.Run("encode structured mode", func(t *testing.T) {
+		e := newTestEvent()
+		data, header, err := event.CloudEventsEncoder{Source: "/user-svc"}.Encode(e)
+		require.NoError(t, err)
+		assert.Equal(t, "application/cloudevents+json", header.Get("Content-Type"))
+
+		var ce map[string]any
+		require.NoError(t, json.Unmarshal(data, &ce))
+		assert.Equal(t, "1.0", ce["specversion"])
+		assert.Equal(t, e.ID, ce["id"])
+		assert.Equal(t, "/user-svc", ce["source"])
+		assert.Equal(t, "com.faceit.user-svc.user.deleted", ce["type"])
+		assert.Equal(t, "2025-02-28T17:05:19Z", ce["time"])
+		assert.Equal(t, "application/json", ce["datacontenttype"])
+		assert.Regexp(t, traceParentRegex, ce["traceparent"])
+		assert.Equal(t, e.Payload, ce["data"])
+	})
+
+	t.Run("encode binary mode", func(t *testing.T) {
+		e := newTestEvent()
+		data, header, err := event.CloudEventsEncoder{Source: "/user-svc", Binary: true}.Encode(e)
+		require.NoError(t, err)
+
+		payload, _ := json.Marshal(e.Payload)
+		assert.JSONEq(t, string(payload), string(data))
+		assert.Equal(t, "application/json", header.Get("Content-Type"))
+		assert.Equal(t, "1.0", header.Get("ce-specversion"))
+		assert.Equal(t, e.ID, header.Get("ce-id"))
+		assert.Equal(t, "/user-svc", header.Get("ce-source"))
+		assert.Equal(t, "com.faceit.user-svc.user.deleted", header.Get("ce-type"))
+		assert.Equal(t, "2025-02-28T17:05:19Z", header.Get("ce-time"))
+		assert.Regexp(t, traceParentRegex, header.Get("ce-traceparent"))
+	})
+
+	t.Run("generate id when the event has none", func(t *testing.T) {
+		e := newTestEvent()
+		e.ID = ""
+		_, header, err := event.CloudEventsEncoder{Binary: true}.Encode(e)
+		require.NoError(t, err)
+		assert.NotEmpty(t, header.Get("ce-id"))
+	})
+
+	t.Run("hash trace ID that is not an UUID", func(t *testing.T) {
+		e := newTestEvent()
+		e.TraceID = "client-trace"
+		_, header, err := event.CloudEventsEncoder{Binary: true}.Encode(e)
+		require.NoError(t, err)
+		assert.Regexp(t, traceParentRegex, header.Get("ce-traceparent"))
+	})
+
+	t.Run("fail by payload that cannot be marshaled", func(t *testing.T) {
+		e := newTestEvent()
+		e.Payload = make(chan int)
+		_, _, err := event.CloudEventsEncoder{}.Encode(e)
+		assert.Error(t, err)
+	})
+
+	for name, encoder := range map[string]event.CloudEventsEncoder{
+		"structured": {Source: "/user-svc"},
+		"binary":     {Source: "/user-svc", Binary: true},
+	} {
+		t.Run("decode what was encoded in "+name+" mode", func(t *testing.T) {
+			e := newTestEvent()
+			data, header, err := encoder.Encode(e)
+			require.NoError(t, err)
+
+			res, err := encoder.Decode(data, header)
+			assert.NoError(t, err)
+			assert.Equal(t, e, res)
+		})
+	}
+
+	t.Run("decode json format", func(t *testing.T) {
+		e := newTestEvent()
+		data, header, err := event.JSONEncoder{}.Encode(e)
+		require.NoError(t, err)
+
+		res, err := event.CloudEventsEncoder{}.Decode(data, header)
+		assert.NoError(t, err)
+		assert.Equal(t, e, res)
+	})
+
+	t.Run("fail by unsupported spec version", func(t *testing.T) {
+		e := newTestEvent()
+		data, header, err := event.CloudEventsEncoder{Binary: true}.Encode(e)
+		require.NoError(t, err)
+		header.Set("ce-specversion", "0.3")
+
+		_, err = event.CloudEventsEncoder{}.Decode(data, header)
+		assert.Error(t, err)
+	})
+
+	t.Run("fail by unknown type", func(t *testing.T) {
+		e := newTestEvent()
+		data, header, err := event.CloudEventsEncoder{Binary: true}.Encode(e)
+		require.NoError(t, err)
+		header.Set("ce-type", "com.example.order.created")
+
+		_, err = event.CloudEventsEncoder{}.Decode(data, header)
+		assert.Error(t, err)
+	})
+
+	t.Run("fail by invalid structured document", func(t *testing.T) {
+		header := nats.Header{}
+		header.Set("Content-Type", "application/cloudevents+json")
+
+		_, err := event.CloudEventsEncoder{}.Decode([]byte("{"), header)
+		assert.Error(t, err)
+	})
+}
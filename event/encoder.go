@@ -0,0 +1,62 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Format is the envelope format of the events sent to NATS.
+type Format string
+
+const (
+	// JSONFormat sends the Event envelope as JSON, it is kept for the consumers of the first versions.
+	JSONFormat Format = "json"
+	// CloudEventsStructuredFormat sends a CloudEvents 1.0 JSON document with the attributes and the payload.
+	CloudEventsStructuredFormat Format = "cloudevents-structured"
+	// CloudEventsBinaryFormat sends the CloudEvents 1.0 attributes in the NATS headers and the payload as body.
+	CloudEventsBinaryFormat Format = "cloudevents-binary"
+)
+
+// Encoder converts the events to NATS messages and back.
+type Encoder interface {
+	Encode(e Event) ([]byte, nats.Header, error)
+	Decode(data []byte, header nats.Header) (Event, error)
+}
+
+// NewEncoder returns the encoder of the format, source identifies this service in the CloudEvents formats.
+func NewEncoder(format string, source string) (Encoder, error) {
+	switch Format(format) {
+	case JSONFormat:
+		return JSONEncoder{}, nil
+	case CloudEventsStructuredFormat:
+		return CloudEventsEncoder{Source: source}, nil
+	case CloudEventsBinaryFormat:
+		return CloudEventsEncoder{Source: source, Binary: true}, nil
+	}
+	return nil, fmt.Errorf("invalid event format %q", format)
+}
+
+// JSONEncoder encodes the Event envelope as JSON without headers.
+type JSONEncoder struct{}
+
+var _ Encoder = JSONEncoder{}
+
+// Encode returns the event as JSON.
+func (JSONEncoder) Encode(e Event) ([]byte, nats.Header, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, nil, nil
+}
+
+// Decode reads the event from JSON.
+func (JSONEncoder) Decode(data []byte, _ nats.Header) (Event, error) {
+	var e Event
+	if err := json.Unmarshal(data, &e); err != nil {
+		return Event{}, err
+	}
+	return e, nil
+}
@@ -10,7 +10,9 @@ type EventHandler interface {
 }
 
 // Event represents an event that will be sent to the event bus.
+// ID is unique per event, it is used by JetStream to drop duplicated events.
 type Event struct {
+	ID        string `json:"id,omitempty"`
 	TraceID   string `json:"trace_id"`
 	EventType string `json:"event_type"`
 	Timestamp int64  `json:"timestamp"`
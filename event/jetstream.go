@@ -0,0 +1,226 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/zechao/faceit-user-svc/log"
+	"github.com/zechao/faceit-user-svc/tracing"
+)
+
+// StreamConfig defines the JetStream stream where the events are stored.
+type StreamConfig struct {
+	// Name is the name of the stream.
+	Name string
+	// Retention is the retention policy of the stream, one of limits, interest or workqueue.
+	Retention string
+	// Replicas is the number of replicas of the stream in a clustered JetStream.
+	Replicas int
+	// MaxAge is how long the events are kept, zero keeps them forever.
+	MaxAge time.Duration
+	// DuplicateWindow is how long the stream remembers the event IDs to drop duplicates,
+	// it should be longer than the outbox relay max backoff.
+	DuplicateWindow time.Duration
+}
+
+// ConsumerConfig defines a durable pull consumer of the stream.
+type ConsumerConfig struct {
+	// Durable is the name of the consumer, consumers with the same name share the work
+	// and continue from the last acknowledged event after a restart.
+	Durable string
+	// FilterSubject limits the events delivered to the consumer, e.g. <topic>.user.deleted,
+	// every event of the topic is delivered when it's empty.
+	FilterSubject string
+	// AckWait is how long the server waits for the ack before delivering the event again.
+	AckWait time.Duration
+	// MaxDeliver is the max number of deliveries of an event, -1 or zero means unlimited.
+	MaxDeliver int
+}
+
+// ParseRetention converts the retention name used in config to the JetStream retention policy.
+func ParseRetention(retention string) (jetstream.RetentionPolicy, error) {
+	switch strings.ToLower(retention) {
+	case "", "limits":
+		return jetstream.LimitsPolicy, nil
+	case "interest":
+		return jetstream.InterestPolicy, nil
+	case "workqueue":
+		return jetstream.WorkQueuePolicy, nil
+	}
+	return 0, fmt.Errorf("invalid stream retention %q", retention)
+}
+
+// JetStreamEventHandler sends the events to a NATS JetStream stream, so they are persisted
+// and can be consumed by durable consumers even if they were offline when the event was sent.
+type JetStreamEventHandler struct {
+	js       jetstream.JetStream
+	stream   string
+	topic    string
+	subjects SubjectMode
+	encoder  Encoder
+}
+
+var (
+	_ EventHandler = (*JetStreamEventHandler)(nil)
+	_ Publisher    = (*JetStreamEventHandler)(nil)
+)
+
+// NewJetStreamEventHandler creates a new JetStreamEventHandler that publishes to the subjects of topic
+// with the messages built by encoder.
+// The stream is created if it doesn't exist, otherwise it is verified to store the subjects
+// with the configured retention.
+func NewJetStreamEventHandler(ctx context.Context, natsConn *nats.Conn, topic string, subjects SubjectMode, encoder Encoder, cfg StreamConfig) (*JetStreamEventHandler, error) {
+	retention, err := ParseRetention(cfg.Retention)
+	if err != nil {
+		return nil, err
+	}
+	js, err := jetstream.New(natsConn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	stream, err := js.Stream(ctx, cfg.Name)
+	switch {
+	case errors.Is(err, jetstream.ErrStreamNotFound):
+		_, err = js.CreateStream(ctx, jetstream.StreamConfig{
+			Name:       cfg.Name,
+			Subjects:   []string{subjects.AllSubjects(topic)},
+			Retention:  retention,
+			Replicas:   cfg.Replicas,
+			MaxAge:     cfg.MaxAge,
+			Duplicates: cfg.DuplicateWindow,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stream %s: %w", cfg.Name, err)
+		}
+		log.Info(ctx, "JetStream stream created", slog.String("stream", cfg.Name))
+	case err != nil:
+		return nil, fmt.Errorf("failed to get stream %s: %w", cfg.Name, err)
+	default:
+		if err := verifyStream(stream.CachedInfo().Config, subjects.AllSubjects(topic), retention); err != nil {
+			return nil, err
+		}
+	}
+
+	return &JetStreamEventHandler{
+		js:       js,
+		stream:   cfg.Name,
+		topic:    topic,
+		subjects: subjects,
+		encoder:  encoder,
+	}, nil
+}
+
+// verifyStream checks that an existing stream stores the subjects with the expected retention,
+// the retention can't be changed once the stream is created.
+func verifyStream(cfg jetstream.StreamConfig, subjects string, retention jetstream.RetentionPolicy) error {
+	if !slices.ContainsFunc(cfg.Subjects, func(subject string) bool {
+		return subjectCovers(subject, subjects)
+	}) {
+		return fmt.Errorf("stream %s doesn't store the subjects %s", cfg.Name, subjects)
+	}
+	if cfg.Retention != retention {
+		return fmt.Errorf("stream %s has retention %s, expected %s", cfg.Name, cfg.Retention, retention)
+	}
+	return nil
+}
+
+// SendEvent sends an event to the stream with the provided event type and payload.
+func (h *JetStreamEventHandler) SendEvent(ctx context.Context, eventType string, payload any) error {
+	traceID, ok := tracing.FromContext(ctx)
+	if !ok {
+		traceID = uuid.NewString()
+		log.Warn(ctx, "trace ID not found in context, generate new one", slog.String("trace_id", traceID))
+	}
+
+	return h.Publish(ctx, Event{
+		ID:        uuid.NewString(),
+		TraceID:   traceID,
+		EventType: eventType,
+		Timestamp: time.Now().Unix(),
+		Payload:   payload,
+	})
+}
+
+// Publish sends an already built event to the stream and waits for the ack of the server.
+// The event ID is used as message ID, so the stream drops the event if it was already
+// stored within the duplicate window, e.g. when the outbox relay retries after a lost ack.
+func (h *JetStreamEventHandler) Publish(ctx context.Context, event Event) error {
+	data, header, err := h.encoder.Encode(event)
+	if err != nil {
+		return err
+	}
+
+	var opts []jetstream.PublishOpt
+	if event.ID != "" {
+		opts = append(opts, jetstream.WithMsgID(event.ID))
+	}
+	ack, err := h.js.PublishMsg(ctx, &nats.Msg{
+		Subject: h.subjects.Subject(h.topic, event.EventType),
+		Data:    data,
+		Header:  header,
+	}, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to publish event to stream %s: %w", h.stream, err)
+	}
+	if ack.Duplicate {
+		log.Info(ctx, "duplicated event dropped by the stream", slog.String("event_id", event.ID))
+	}
+	return nil
+}
+
+// Consume creates or updates a durable pull consumer of the topic and calls handler for every event matching the filter.
+// The event is acknowledged when handler returns nil, otherwise it is delivered again later.
+// Events that can't be decoded are terminated, so they aren't delivered again.
+// The returned function stops the consumer.
+func (h *JetStreamEventHandler) Consume(ctx context.Context, cfg ConsumerConfig, handler func(ctx context.Context, event Event) error) (func(), error) {
+	filter := cfg.FilterSubject
+	if filter == "" {
+		filter = h.subjects.AllSubjects(h.topic)
+	}
+	consumer, err := h.js.CreateOrUpdateConsumer(ctx, h.stream, jetstream.ConsumerConfig{
+		Durable:       cfg.Durable,
+		FilterSubject: filter,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       cfg.AckWait,
+		MaxDeliver:    cfg.MaxDeliver,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consumer %s: %w", cfg.Durable, err)
+	}
+
+	consumeCtx, err := consumer.Consume(func(msg jetstream.Msg) {
+		event, err := h.encoder.Decode(msg.Data(), msg.Headers())
+		if err != nil {
+			log.Error(ctx, "failed to unmarshal event", slog.String("consumer", cfg.Durable), slog.Any("error", err))
+			if err := msg.Term(); err != nil {
+				log.Error(ctx, "failed to terminate event", slog.Any("error", err))
+			}
+			return
+		}
+
+		eventCtx := tracing.ContextWithTracingID(ctx, event.TraceID)
+		if err := handler(eventCtx, event); err != nil {
+			log.Warn(eventCtx, "failed to handle event", slog.String("consumer", cfg.Durable), slog.Any("error", err))
+			if err := msg.Nak(); err != nil {
+				log.Error(eventCtx, "failed to nak event", slog.Any("error", err))
+			}
+			return
+		}
+		if err := msg.Ack(); err != nil {
+			log.Error(eventCtx, "failed to ack event", slog.Any("error", err))
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume with consumer %s: %w", cfg.Durable, err)
+	}
+	return consumeCtx.Stop, nil
+}
@@ -0,0 +1,266 @@
+package event_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zechao/faceit-user-svc/event"
+	"github.com/zechao/faceit-user-svc/tracing"
+)
+
+func TestParseRetention(t *testing.T) {
+	tests := map[string]struct {
+		retention string
+		expected  jetstream.RetentionPolicy
+		expectErr bool
+	}{
+		"default to limits":       {retention: "", expected: jetstream.LimitsPolicy},
+		"limits":                  {retention: "limits", expected: jetstream.LimitsPolicy},
+		"interest":                {retention: "interest", expected: jetstream.InterestPolicy},
+		"workqueue ignoring case": {retention: "WorkQueue", expected: jetstream.WorkQueuePolicy},
+		"fail by unknown":         {retention: "forever", expectErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			res, err := event.ParseRetention(tt.retention)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, res)
+		})
+	}
+}
+
+func newTestStreamConfig() event.StreamConfig {
+	return event.StreamConfig{
+		Name:            "TEST_" + uuid.New().String()[:8],
+		Retention:       "limits",
+		Replicas:        1,
+		DuplicateWindow: time.Minute,
+	}
+}
+
+func TestNewJetStreamEventHandler(t *testing.T) {
+	ctx := context.Background()
+	nc, err := nats.Connect(natsURL)
+	require.NoError(t, err)
+	defer nc.Close()
+
+	t.Run("create the stream and verify it on the next start", func(t *testing.T) {
+		cfg := newTestStreamConfig()
+		topic := "created-" + cfg.Name
+
+		_, err := event.NewJetStreamEventHandler(ctx, nc, topic, event.EventTypeSubject, event.JSONEncoder{}, cfg)
+		assert.NoError(t, err)
+
+		_, err = event.NewJetStreamEventHandler(ctx, nc, topic, event.EventTypeSubject, event.JSONEncoder{}, cfg)
+		assert.NoError(t, err)
+	})
+
+	t.Run("fail by existing stream with other retention", func(t *testing.T) {
+		cfg := newTestStreamConfig()
+		topic := "retention-" + cfg.Name
+		_, err := event.NewJetStreamEventHandler(ctx, nc, topic, event.EventTypeSubject, event.JSONEncoder{}, cfg)
+		require.NoError(t, err)
+
+		cfg.Retention = "workqueue"
+		_, err = event.NewJetStreamEventHandler(ctx, nc, topic, event.EventTypeSubject, event.JSONEncoder{}, cfg)
+		assert.Error(t, err)
+	})
+
+	t.Run("fail by existing stream without the topic", func(t *testing.T) {
+		cfg := newTestStreamConfig()
+		_, err := event.NewJetStreamEventHandler(ctx, nc, "subject-"+cfg.Name, event.EventTypeSubject, event.JSONEncoder{}, cfg)
+		require.NoError(t, err)
+
+		_, err = event.NewJetStreamEventHandler(ctx, nc, "other-"+cfg.Name, event.EventTypeSubject, event.JSONEncoder{}, cfg)
+		assert.Error(t, err)
+	})
+
+	t.Run("fail by existing single subject stream", func(t *testing.T) {
+		cfg := newTestStreamConfig()
+		topic := "single-" + cfg.Name
+		_, err := event.NewJetStreamEventHandler(ctx, nc, topic, event.SingleSubject, event.JSONEncoder{}, cfg)
+		require.NoError(t, err)
+
+		_, err = event.NewJetStreamEventHandler(ctx, nc, topic, event.EventTypeSubject, event.JSONEncoder{}, cfg)
+		assert.Error(t, err)
+	})
+
+	t.Run("fail by invalid retention", func(t *testing.T) {
+		cfg := newTestStreamConfig()
+		cfg.Retention = "forever"
+		_, err := event.NewJetStreamEventHandler(ctx, nc, "invalid-"+cfg.Name, event.EventTypeSubject, event.JSONEncoder{}, cfg)
+		assert.Error(t, err)
+	})
+}
+
+func TestJetStreamPublish(t *testing.T) {
+	ctx := context.Background()
+	nc, err := nats.Connect(natsURL)
+	require.NoError(t, err)
+	defer nc.Close()
+	js, err := jetstream.New(nc)
+	require.NoError(t, err)
+
+	cfg := newTestStreamConfig()
+	topic := "publish-" + cfg.Name
+	handler, err := event.NewJetStreamEventHandler(ctx, nc, topic, event.EventTypeSubject, event.JSONEncoder{}, cfg)
+	require.NoError(t, err)
+
+	t.Run("store the event once when published twice with the same ID", func(t *testing.T) {
+		e := event.Event{
+			ID:        uuid.NewString(),
+			TraceID:   uuid.NewString(),
+			EventType: "test-event",
+			Timestamp: time.Now().Unix(),
+			Payload:   "data",
+		}
+
+		assert.NoError(t, handler.Publish(ctx, e))
+		assert.NoError(t, handler.Publish(ctx, e))
+
+		stream, err := js.Stream(ctx, cfg.Name)
+		require.NoError(t, err)
+		msg, err := stream.GetLastMsgForSubject(ctx, event.EventTypeSubject.Subject(topic, "test-event"))
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), msg.Sequence)
+
+		var stored event.Event
+		assert.NoError(t, json.Unmarshal(msg.Data, &stored))
+		assert.Equal(t, e.ID, stored.ID)
+		assert.Equal(t, e.TraceID, stored.TraceID)
+	})
+
+	t.Run("send event with traceID from context", func(t *testing.T) {
+		traceID := uuid.NewString()
+		err := handler.SendEvent(tracing.ContextWithTracingID(ctx, traceID), "test-event", "data")
+		assert.NoError(t, err)
+
+		stream, err := js.Stream(ctx, cfg.Name)
+		require.NoError(t, err)
+		msg, err := stream.GetLastMsgForSubject(ctx, event.EventTypeSubject.Subject(topic, "test-event"))
+		require.NoError(t, err)
+
+		var stored event.Event
+		assert.NoError(t, json.Unmarshal(msg.Data, &stored))
+		assert.NotEmpty(t, stored.ID)
+		assert.Equal(t, traceID, stored.TraceID)
+	})
+
+	t.Run("fail to marshal event", func(t *testing.T) {
+		err := handler.SendEvent(ctx, "test-event", make(chan int))
+		assert.Error(t, err)
+	})
+}
+
+func TestJetStreamConsume(t *testing.T) {
+	ctx := context.Background()
+	nc, err := nats.Connect(natsURL)
+	require.NoError(t, err)
+	defer nc.Close()
+
+	cfg := newTestStreamConfig()
+	handler, err := event.NewJetStreamEventHandler(ctx, nc, "consume-"+cfg.Name, event.EventTypeSubject, event.JSONEncoder{}, cfg)
+	require.NoError(t, err)
+
+	t.Run("deliver again the event until it is handled", func(t *testing.T) {
+		traceID := uuid.NewString()
+		received := make(chan event.Event, 2)
+		attempts := 0
+
+		stop, err := handler.Consume(ctx, event.ConsumerConfig{Durable: "test-consumer"},
+			func(ctx context.Context, e event.Event) error {
+				attempts++
+				ctxTraceID, _ := tracing.FromContext(ctx)
+				assert.Equal(t, traceID, ctxTraceID)
+				received <- e
+				if attempts == 1 {
+					return assert.AnError
+				}
+				return nil
+			})
+		require.NoError(t, err)
+		defer stop()
+
+		err = handler.SendEvent(tracing.ContextWithTracingID(ctx, traceID), "test-event", "data")
+		require.NoError(t, err)
+
+		for range 2 {
+			select {
+			case e := <-received:
+				assert.Equal(t, "test-event", e.EventType)
+			case <-time.After(10 * time.Second):
+				t.Fatal("event not received")
+			}
+		}
+	})
+
+	t.Run("deliver only the events matching the filter", func(t *testing.T) {
+		topic := "filter-" + cfg.Name
+		filterCfg := newTestStreamConfig()
+		handler, err := event.NewJetStreamEventHandler(ctx, nc, topic, event.EventTypeSubject, event.JSONEncoder{}, filterCfg)
+		require.NoError(t, err)
+		received := make(chan event.Event, 2)
+
+		stop, err := handler.Consume(ctx, event.ConsumerConfig{
+			Durable:       "test-filter-consumer",
+			FilterSubject: topic + ".user.deleted",
+		}, func(_ context.Context, e event.Event) error {
+			received <- e
+			return nil
+		})
+		require.NoError(t, err)
+		defer stop()
+
+		require.NoError(t, handler.SendEvent(ctx, "UserCreated", "created"))
+		require.NoError(t, handler.SendEvent(ctx, "UserDeleted", "deleted"))
+
+		select {
+		case e := <-received:
+			assert.Equal(t, "UserDeleted", e.EventType)
+		case <-time.After(10 * time.Second):
+			t.Fatal("event not received")
+		}
+		select {
+		case e := <-received:
+			t.Fatalf("unexpected event %s", e.EventType)
+		case <-time.After(500 * time.Millisecond):
+		}
+	})
+
+	t.Run("deliver event encoded as cloudevents binary", func(t *testing.T) {
+		topic := "cloudevents-" + cfg.Name
+		encoder := event.CloudEventsEncoder{Source: "/user-svc", Binary: true}
+		handler, err := event.NewJetStreamEventHandler(ctx, nc, topic, event.EventTypeSubject, encoder, newTestStreamConfig())
+		require.NoError(t, err)
+		received := make(chan event.Event, 1)
+
+		stop, err := handler.Consume(ctx, event.ConsumerConfig{Durable: "test-cloudevents-consumer"},
+			func(_ context.Context, e event.Event) error {
+				received <- e
+				return nil
+			})
+		require.NoError(t, err)
+		defer stop()
+
+		e := newTestEvent()
+		require.NoError(t, handler.Publish(ctx, e))
+
+		select {
+		case res := <-received:
+			assert.Equal(t, e, res)
+		case <-time.After(10 * time.Second):
+			t.Fatal("event not received")
+		}
+	})
+}
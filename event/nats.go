@@ -2,20 +2,22 @@ package event
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
+	"github.com/zechao/faceit-user-svc/log"
 	"github.com/zechao/faceit-user-svc/tracing"
 )
 
-// Event represents an event that will be sent to the event bus.
+// NatsEventHandler sends the events to the NATS topic, the subject of each event depends on the SubjectMode.
 type NatsEventHandler struct {
 	natsConn *nats.Conn
 	topic    string
+	subjects SubjectMode
+	encoder  Encoder
 }
 
 // NewNatConnection is a function type that creates a new nats connection with the provided url.
@@ -27,11 +29,14 @@ func NewNatConnection(url string) (*nats.Conn, error) {
 	return conn, nil
 }
 
-// NewNatsEventHandler creates a new NatsEventHandler with the provided nats connection and topic.
-func NewNatsEventHandler(natsConn *nats.Conn, topic string) *NatsEventHandler {
+// NewNatsEventHandler creates a new NatsEventHandler with the provided nats connection, topic, subject mode
+// and encoder of the messages.
+func NewNatsEventHandler(natsConn *nats.Conn, topic string, subjects SubjectMode, encoder Encoder) *NatsEventHandler {
 	return &NatsEventHandler{
 		natsConn: natsConn,
 		topic:    topic,
+		subjects: subjects,
+		encoder:  encoder,
 	}
 }
 
@@ -41,7 +46,7 @@ func (h *NatsEventHandler) SendEvent(ctx context.Context, eventType string, payl
 	// log if traceID not found in context, but continue to send event with new traceID
 	if !ok {
 		traceID = uuid.NewString()
-		log.Printf("TraceID not found in context, generate new traceID: %s", traceID)
+		log.Warn(ctx, "trace ID not found in context, generate new one", slog.String("trace_id", traceID))
 	}
 
 	event := Event{
@@ -51,11 +56,20 @@ func (h *NatsEventHandler) SendEvent(ctx context.Context, eventType string, payl
 		Payload:   payload,
 	}
 
-	eventBytes, err := json.Marshal(event)
+	return h.Publish(ctx, event)
+}
+
+// Publish sends an already built event to the event bus, it implements Publisher for the OutboxRelay.
+func (h *NatsEventHandler) Publish(ctx context.Context, event Event) error {
+	data, header, err := h.encoder.Encode(event)
 	if err != nil {
 		return err
 	}
-	err = h.natsConn.Publish(h.topic, eventBytes)
+	err = h.natsConn.PublishMsg(&nats.Msg{
+		Subject: h.subjects.Subject(h.topic, event.EventType),
+		Data:    data,
+		Header:  header,
+	})
 	if err != nil {
 		return err
 	}
@@ -63,18 +77,21 @@ func (h *NatsEventHandler) SendEvent(ctx context.Context, eventType string, payl
 	return nil
 }
 
-// Subscribe simulates another service subscribing to the topic and handling incoming events.
-func (h *NatsEventHandler) Subscribe(handler func(event Event)) error {
-	_, err := h.natsConn.Subscribe(h.topic, func(msg *nats.Msg) {
-		var event Event
-		if err := json.Unmarshal(msg.Data, &event); err != nil {
-			log.Printf("Failed to unmarshal event: %v", err)
+var _ Publisher = (*NatsEventHandler)(nil)
+
+// Subscribe simulates another service subscribing to the subject and handling incoming events.
+// The subject may contain wildcards, e.g. <topic>.user.* to receive all the user events.
+func (h *NatsEventHandler) Subscribe(subject string, handler func(event Event)) error {
+	_, err := h.natsConn.Subscribe(subject, func(msg *nats.Msg) {
+		event, err := h.encoder.Decode(msg.Data, msg.Header)
+		if err != nil {
+			log.Error(context.Background(), "failed to unmarshal event", slog.String("subject", msg.Subject), slog.Any("error", err))
 			return
 		}
 		handler(event)
 	})
 	if err != nil {
-		return fmt.Errorf("failed to subscribe to topic %s: %w", h.topic, err)
+		return fmt.Errorf("failed to subscribe to subject %s: %w", subject, err)
 	}
 	return nil
 }
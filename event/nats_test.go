@@ -26,6 +26,7 @@ func TestMain(m *testing.M) {
 
 	req := testcontainers.ContainerRequest{
 		Image:        "nats:latest",
+		Cmd:          []string{"-js"},
 		ExposedPorts: []string{"4222/tcp"},
 		WaitingFor:   wait.ForListeningPort("4222/tcp"),
 	}
@@ -61,7 +62,7 @@ func TestSendEvent(t *testing.T) {
 	}
 	defer nc.Close()
 
-	handler := event.NewNatsEventHandler(nc, testTopic)
+	handler := event.NewNatsEventHandler(nc, testTopic, event.SingleSubject, event.JSONEncoder{})
 
 	t.Run("successful event publish with traceID from context", func(t *testing.T) {
 		traceID := uuid.NewString()
@@ -148,6 +149,49 @@ func TestSendEvent(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestSendEventByEventTypeSubject(t *testing.T) {
+	nc, err := nats.Connect(natsURL)
+	if err != nil {
+		t.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	defer nc.Close()
+
+	handler := event.NewNatsEventHandler(nc, testTopic, event.EventTypeSubject, event.JSONEncoder{})
+
+	t.Run("successful event publish to the subject of the event type", func(t *testing.T) {
+		sub, err := nc.SubscribeSync(testTopic + ".user.deleted")
+		assert.NoError(t, err)
+
+		err = handler.SendEvent(context.Background(), "UserDeleted", "data")
+		assert.NoError(t, err)
+
+		msg, err := sub.NextMsg(5 * time.Second)
+		assert.NoError(t, err)
+		assert.Equal(t, testTopic+".user.deleted", msg.Subject)
+	})
+
+	t.Run("successful subscribe with wildcard", func(t *testing.T) {
+		received := make(chan event.Event, 2)
+		err := handler.Subscribe(testTopic+".user.*", func(e event.Event) {
+			received <- e
+		})
+		assert.NoError(t, err)
+
+		assert.NoError(t, handler.SendEvent(context.Background(), "UserCreated", "data"))
+		assert.NoError(t, handler.SendEvent(context.Background(), "UserUpdated", "data"))
+
+		for _, eventType := range []string{"UserCreated", "UserUpdated"} {
+			select {
+			case e := <-received:
+				assert.Equal(t, eventType, e.EventType)
+			case <-time.After(5 * time.Second):
+				t.Fatal("event not received")
+			}
+		}
+	})
+}
+
 func TestNewNatConnection(t *testing.T) {
 	t.Run("successful connection", func(t *testing.T) {
 		nc, err := event.NewNatConnection(natsURL)
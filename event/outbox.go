@@ -0,0 +1,219 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zechao/faceit-user-svc/log"
+	"github.com/zechao/faceit-user-svc/tracing"
+)
+
+//go:generate mockgen -source=outbox.go -destination=mocks/outbox_mock.go -package=mockevent
+
+// OutboxMessage represents an event stored in the outbox waiting to be published.
+// AggregateID is the ID of the entity the event is about, uuid.Nil if the payload isn't an Aggregate.
+type OutboxMessage struct {
+	ID          uuid.UUID
+	AggregateID uuid.UUID
+	EventType   string
+	TraceID     string
+	Payload     json.RawMessage
+	Attempts    int
+	CreatedAt   time.Time
+}
+
+// Event returns the event to be sent to the event bus, the timestamp is the time the change was made.
+// The ID of the message is kept on every attempt, so a retried event can be detected as duplicated.
+func (m OutboxMessage) Event() Event {
+	return Event{
+		ID:        m.ID.String(),
+		TraceID:   m.TraceID,
+		EventType: m.EventType,
+		Timestamp: m.CreatedAt.Unix(),
+		Payload:   m.Payload,
+	}
+}
+
+// OutboxRepository defines the storage operations of the outbox.
+type OutboxRepository interface {
+	// AddMessage stores a new message, it must take part in the transaction carried by ctx if any.
+	AddMessage(ctx context.Context, m *OutboxMessage) error
+	// ClaimPending returns up to limit pending messages in the order they were written,
+	// and hides them from other callers until leaseUntil so that concurrent relays don't publish them twice.
+	// Messages written after a failed message waiting for its retry are not returned, so they can't overtake it.
+	ClaimPending(ctx context.Context, limit int, leaseUntil time.Time) ([]OutboxMessage, error)
+	// Release ends the lease of the claimed messages, they can be claimed again right away.
+	Release(ctx context.Context, ids ...uuid.UUID) error
+	// MarkSent marks the message as published.
+	MarkSent(ctx context.Context, id uuid.UUID) error
+	// MarkFailed records the publish error and schedules the next attempt.
+	MarkFailed(ctx context.Context, id uuid.UUID, reason string, retryAt time.Time) error
+}
+
+// Publisher publishes an already built event to the event bus.
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+// OutboxEventHandler implements EventHandler by writing the events to the outbox instead of the event bus.
+// When ctx carries a transaction, the event is only stored if the transaction commits.
+type OutboxEventHandler struct {
+	outbox OutboxRepository
+}
+
+var _ EventHandler = (*OutboxEventHandler)(nil)
+
+// NewOutboxEventHandler creates a new OutboxEventHandler with the provided outbox repository.
+func NewOutboxEventHandler(outbox OutboxRepository) *OutboxEventHandler {
+	return &OutboxEventHandler{
+		outbox: outbox,
+	}
+}
+
+// SendEvent stores the event in the outbox, it will be published later by the OutboxRelay.
+func (h *OutboxEventHandler) SendEvent(ctx context.Context, eventType string, payload any) error {
+	traceID, ok := tracing.FromContext(ctx)
+	if !ok {
+		traceID = uuid.NewString()
+		log.Warn(ctx, "trace ID not found in context, generate new one", slog.String("trace_id", traceID))
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event payload: %w", err)
+	}
+
+	m := &OutboxMessage{
+		ID:        uuid.New(),
+		EventType: eventType,
+		TraceID:   traceID,
+		Payload:   payloadBytes,
+	}
+	if aggregate, ok := payload.(Aggregate); ok {
+		m.AggregateID = aggregate.AggregateID()
+	}
+	return h.outbox.AddMessage(ctx, m)
+}
+
+// RelayConfig defines how the OutboxRelay polls and retries.
+type RelayConfig struct {
+	// PollInterval is the time to wait between two polls when the outbox is drained.
+	PollInterval time.Duration
+	// BatchSize is the max number of messages claimed per poll.
+	BatchSize int
+	// Lease is how long claimed messages are hidden from other relays while being published.
+	Lease time.Duration
+	// MaxBackoff caps the exponential backoff between attempts of a failing message.
+	MaxBackoff time.Duration
+}
+
+// OutboxRelay publishes the pending outbox messages to the event bus.
+// Messages are marked as sent only after a successful publish, so every event
+// is delivered at least once, consumers must tolerate duplicates.
+type OutboxRelay struct {
+	outbox    OutboxRepository
+	publisher Publisher
+	cfg       RelayConfig
+	now       func() time.Time
+}
+
+// NewOutboxRelay creates a new OutboxRelay with the provided outbox, publisher and config.
+func NewOutboxRelay(outbox OutboxRepository, publisher Publisher, cfg RelayConfig) *OutboxRelay {
+	return &OutboxRelay{
+		outbox:    outbox,
+		publisher: publisher,
+		cfg:       cfg,
+		now: func() time.Time {
+			return time.Now().UTC()
+		},
+	}
+}
+
+// Run polls the outbox until ctx is done.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		// keep relaying while full batches are returned, there may be more pending messages
+		for {
+			n, err := r.RelayPending(ctx)
+			if err != nil {
+				log.Error(ctx, "failed to relay outbox messages", slog.Any("error", err))
+			}
+			if err != nil || n < r.cfg.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayPending publishes one batch of pending messages and returns the number of messages published.
+// It stops at the first publish failure to keep the order of the events, the failed message
+// is retried with an exponential backoff and the rest of the batch is released, the messages
+// after the failed one are only claimed again once it has been published.
+func (r *OutboxRelay) RelayPending(ctx context.Context) (int, error) {
+	msgs, err := r.outbox.ClaimPending(ctx, r.cfg.BatchSize, r.now().Add(r.cfg.Lease))
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim outbox messages: %w", err)
+	}
+
+	for i, m := range msgs {
+		msgCtx := tracing.ContextWithTracingID(ctx, m.TraceID)
+		err := r.publisher.Publish(msgCtx, m.Event())
+		if err != nil {
+			retryAt := r.now().Add(r.backoff(m.Attempts))
+			log.Warn(msgCtx, "failed to publish outbox message",
+				slog.String("message_id", m.ID.String()),
+				slog.Int("attempts", m.Attempts+1),
+				slog.Any("error", err),
+			)
+			if markErr := r.outbox.MarkFailed(ctx, m.ID, err.Error(), retryAt); markErr != nil {
+				return i, fmt.Errorf("failed to mark outbox message as failed: %w", markErr)
+			}
+			if err := r.release(ctx, msgs[i+1:]); err != nil {
+				return i, err
+			}
+			return i, nil
+		}
+
+		if err := r.outbox.MarkSent(ctx, m.ID); err != nil {
+			return i, fmt.Errorf("failed to mark outbox message as sent: %w", err)
+		}
+	}
+	return len(msgs), nil
+}
+
+// release ends the lease of the messages not published yet, otherwise they would stay hidden
+// until the lease ends and the failed message could be retried and followed by newer messages first.
+func (r *OutboxRelay) release(ctx context.Context, msgs []OutboxMessage) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.ID
+	}
+	if err := r.outbox.Release(ctx, ids...); err != nil {
+		return fmt.Errorf("failed to release outbox messages: %w", err)
+	}
+	return nil
+}
+
+// backoff returns the delay before the next attempt, it doubles on every attempt up to MaxBackoff.
+func (r *OutboxRelay) backoff(attempts int) time.Duration {
+	delay := r.cfg.PollInterval
+	for i := 0; i < attempts && delay < r.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, r.cfg.MaxBackoff)
+}
@@ -0,0 +1,312 @@
+package event_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/zechao/faceit-user-svc/event"
+	mockevent "github.com/zechao/faceit-user-svc/event/mocks"
+	"github.com/zechao/faceit-user-svc/tracing"
+	"go.uber.org/mock/gomock"
+)
+
+var (
+	errTest = errors.New("test error")
+
+	testRelayConfig = event.RelayConfig{
+		PollInterval: time.Second,
+		BatchSize:    10,
+		Lease:        30 * time.Second,
+		MaxBackoff:   time.Minute,
+	}
+)
+
+func TestOutboxEventHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	t.Run("store event with traceID from context", func(t *testing.T) {
+		outbox := mockevent.NewMockOutboxRepository(ctrl)
+		handler := event.NewOutboxEventHandler(outbox)
+		traceID := uuid.NewString()
+		ctx := tracing.ContextWithTracingID(context.Background(), traceID)
+		payload := uuid.New()
+
+		outbox.EXPECT().AddMessage(ctx, gomock.Cond(func(m *event.OutboxMessage) bool {
+			expectedPayload, _ := json.Marshal(payload)
+			return m.ID != uuid.Nil &&
+				m.TraceID == traceID &&
+				m.EventType == "test-event" &&
+				string(m.Payload) == string(expectedPayload)
+		})).Return(nil)
+
+		err := handler.SendEvent(ctx, "test-event", payload)
+		assert.NoError(t, err)
+	})
+
+	t.Run("store event with the aggregate id of the payload", func(t *testing.T) {
+		outbox := mockevent.NewMockOutboxRepository(ctrl)
+		handler := event.NewOutboxEventHandler(outbox)
+		id := uuid.New()
+
+		outbox.EXPECT().AddMessage(gomock.Any(), gomock.Cond(func(m *event.OutboxMessage) bool {
+			return m.AggregateID == id
+		})).Return(nil)
+
+		err := handler.SendEvent(context.Background(), "UserDeleted", event.NewUserDeleted(id, time.Now()))
+		assert.NoError(t, err)
+	})
+
+	t.Run("store event without aggregate id", func(t *testing.T) {
+		outbox := mockevent.NewMockOutboxRepository(ctrl)
+		handler := event.NewOutboxEventHandler(outbox)
+
+		outbox.EXPECT().AddMessage(gomock.Any(), gomock.Cond(func(m *event.OutboxMessage) bool {
+			return m.AggregateID == uuid.Nil
+		})).Return(nil)
+
+		err := handler.SendEvent(context.Background(), "test-event", "data")
+		assert.NoError(t, err)
+	})
+
+	t.Run("store event with new traceID", func(t *testing.T) {
+		outbox := mockevent.NewMockOutboxRepository(ctrl)
+		handler := event.NewOutboxEventHandler(outbox)
+
+		outbox.EXPECT().AddMessage(gomock.Any(), gomock.Cond(func(m *event.OutboxMessage) bool {
+			return m.TraceID != ""
+		})).Return(nil)
+
+		err := handler.SendEvent(context.Background(), "test-event", "data")
+		assert.NoError(t, err)
+	})
+
+	t.Run("fail by payload that cannot be marshaled", func(t *testing.T) {
+		outbox := mockevent.NewMockOutboxRepository(ctrl)
+		handler := event.NewOutboxEventHandler(outbox)
+
+		err := handler.SendEvent(context.Background(), "test-event", make(chan int))
+		assert.Error(t, err)
+	})
+
+	t.Run("fail by outbox error", func(t *testing.T) {
+		outbox := mockevent.NewMockOutboxRepository(ctrl)
+		handler := event.NewOutboxEventHandler(outbox)
+
+		outbox.EXPECT().AddMessage(gomock.Any(), gomock.Any()).Return(errTest)
+
+		err := handler.SendEvent(context.Background(), "test-event", "data")
+		assert.ErrorIs(t, err, errTest)
+	})
+}
+
+func TestOutboxRelayPending(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+
+	newMessages := func(n int) []event.OutboxMessage {
+		msgs := make([]event.OutboxMessage, n)
+		for i := range msgs {
+			msgs[i] = event.OutboxMessage{
+				ID:        uuid.New(),
+				EventType: "test-event",
+				TraceID:   uuid.NewString(),
+				Payload:   json.RawMessage(`"data"`),
+				CreatedAt: time.Now(),
+			}
+		}
+		return msgs
+	}
+
+	t.Run("publish and mark all messages as sent", func(t *testing.T) {
+		outbox := mockevent.NewMockOutboxRepository(ctrl)
+		publisher := mockevent.NewMockPublisher(ctrl)
+		relay := event.NewOutboxRelay(outbox, publisher, testRelayConfig)
+		msgs := newMessages(2)
+
+		outbox.EXPECT().ClaimPending(ctx, testRelayConfig.BatchSize, gomock.Any()).Return(msgs, nil)
+		gomock.InOrder(
+			publisher.EXPECT().Publish(gomock.Any(), msgs[0].Event()).Return(nil),
+			outbox.EXPECT().MarkSent(ctx, msgs[0].ID).Return(nil),
+			publisher.EXPECT().Publish(gomock.Any(), msgs[1].Event()).Return(nil),
+			outbox.EXPECT().MarkSent(ctx, msgs[1].ID).Return(nil),
+		)
+
+		n, err := relay.RelayPending(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, n)
+	})
+
+	t.Run("publish with the traceID of the message", func(t *testing.T) {
+		outbox := mockevent.NewMockOutboxRepository(ctrl)
+		publisher := mockevent.NewMockPublisher(ctrl)
+		relay := event.NewOutboxRelay(outbox, publisher, testRelayConfig)
+		msgs := newMessages(1)
+
+		outbox.EXPECT().ClaimPending(ctx, testRelayConfig.BatchSize, gomock.Any()).Return(msgs, nil)
+		publisher.EXPECT().Publish(gomock.Any(), msgs[0].Event()).DoAndReturn(func(ctx context.Context, e event.Event) error {
+			traceID, ok := tracing.FromContext(ctx)
+			assert.True(t, ok)
+			assert.Equal(t, msgs[0].TraceID, traceID)
+			return nil
+		})
+		outbox.EXPECT().MarkSent(ctx, msgs[0].ID).Return(nil)
+
+		_, err := relay.RelayPending(ctx)
+		assert.NoError(t, err)
+	})
+
+	t.Run("stop at first publish failure and schedule retry", func(t *testing.T) {
+		outbox := mockevent.NewMockOutboxRepository(ctrl)
+		publisher := mockevent.NewMockPublisher(ctrl)
+		relay := event.NewOutboxRelay(outbox, publisher, testRelayConfig)
+		msgs := newMessages(3)
+		msgs[1].Attempts = 2
+
+		outbox.EXPECT().ClaimPending(ctx, testRelayConfig.BatchSize, gomock.Any()).Return(msgs, nil)
+		publisher.EXPECT().Publish(gomock.Any(), msgs[0].Event()).Return(nil)
+		outbox.EXPECT().MarkSent(ctx, msgs[0].ID).Return(nil)
+		publisher.EXPECT().Publish(gomock.Any(), msgs[1].Event()).Return(errTest)
+		outbox.EXPECT().MarkFailed(ctx, msgs[1].ID, errTest.Error(), gomock.Cond(func(retryAt time.Time) bool {
+			// third attempt waits 4 poll intervals
+			delay := time.Until(retryAt)
+			return delay > 3*time.Second && delay <= 4*time.Second
+		})).Return(nil)
+		// the rest of the batch is released so it's claimed again after the failed message
+		outbox.EXPECT().Release(ctx, msgs[2].ID).Return(nil)
+
+		n, err := relay.RelayPending(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+	})
+
+	t.Run("publish in order after a failed publish", func(t *testing.T) {
+		outbox := mockevent.NewMockOutboxRepository(ctrl)
+		publisher := mockevent.NewMockPublisher(ctrl)
+		relay := event.NewOutboxRelay(outbox, publisher, testRelayConfig)
+		msgs := newMessages(3)
+
+		gomock.InOrder(
+			outbox.EXPECT().ClaimPending(ctx, testRelayConfig.BatchSize, gomock.Any()).Return(msgs, nil),
+			publisher.EXPECT().Publish(gomock.Any(), msgs[0].Event()).Return(errTest),
+			outbox.EXPECT().MarkFailed(ctx, msgs[0].ID, errTest.Error(), gomock.Any()).Return(nil),
+			outbox.EXPECT().Release(ctx, msgs[1].ID, msgs[2].ID).Return(nil),
+			// the retry claims the failed message first
+			outbox.EXPECT().ClaimPending(ctx, testRelayConfig.BatchSize, gomock.Any()).Return(msgs, nil),
+			publisher.EXPECT().Publish(gomock.Any(), msgs[0].Event()).Return(nil),
+			outbox.EXPECT().MarkSent(ctx, msgs[0].ID).Return(nil),
+			publisher.EXPECT().Publish(gomock.Any(), msgs[1].Event()).Return(nil),
+			outbox.EXPECT().MarkSent(ctx, msgs[1].ID).Return(nil),
+			publisher.EXPECT().Publish(gomock.Any(), msgs[2].Event()).Return(nil),
+			outbox.EXPECT().MarkSent(ctx, msgs[2].ID).Return(nil),
+		)
+
+		n, err := relay.RelayPending(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, n)
+
+		n, err = relay.RelayPending(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, n)
+	})
+
+	t.Run("fail by release error", func(t *testing.T) {
+		outbox := mockevent.NewMockOutboxRepository(ctrl)
+		publisher := mockevent.NewMockPublisher(ctrl)
+		relay := event.NewOutboxRelay(outbox, publisher, testRelayConfig)
+		msgs := newMessages(2)
+
+		outbox.EXPECT().ClaimPending(ctx, testRelayConfig.BatchSize, gomock.Any()).Return(msgs, nil)
+		publisher.EXPECT().Publish(gomock.Any(), msgs[0].Event()).Return(errTest)
+		outbox.EXPECT().MarkFailed(ctx, msgs[0].ID, errTest.Error(), gomock.Any()).Return(nil)
+		outbox.EXPECT().Release(ctx, msgs[1].ID).Return(errTest)
+
+		n, err := relay.RelayPending(ctx)
+		assert.ErrorIs(t, err, errTest)
+		assert.Equal(t, 0, n)
+	})
+
+	t.Run("backoff is capped", func(t *testing.T) {
+		outbox := mockevent.NewMockOutboxRepository(ctrl)
+		publisher := mockevent.NewMockPublisher(ctrl)
+		relay := event.NewOutboxRelay(outbox, publisher, testRelayConfig)
+		msgs := newMessages(1)
+		msgs[0].Attempts = 100
+
+		outbox.EXPECT().ClaimPending(ctx, testRelayConfig.BatchSize, gomock.Any()).Return(msgs, nil)
+		publisher.EXPECT().Publish(gomock.Any(), msgs[0].Event()).Return(errTest)
+		outbox.EXPECT().MarkFailed(ctx, msgs[0].ID, errTest.Error(), gomock.Cond(func(retryAt time.Time) bool {
+			return time.Until(retryAt) <= testRelayConfig.MaxBackoff
+		})).Return(nil)
+
+		n, err := relay.RelayPending(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, n)
+	})
+
+	t.Run("fail by claim error", func(t *testing.T) {
+		outbox := mockevent.NewMockOutboxRepository(ctrl)
+		publisher := mockevent.NewMockPublisher(ctrl)
+		relay := event.NewOutboxRelay(outbox, publisher, testRelayConfig)
+
+		outbox.EXPECT().ClaimPending(ctx, testRelayConfig.BatchSize, gomock.Any()).Return(nil, errTest)
+
+		n, err := relay.RelayPending(ctx)
+		assert.ErrorIs(t, err, errTest)
+		assert.Equal(t, 0, n)
+	})
+
+	t.Run("fail by mark sent error", func(t *testing.T) {
+		outbox := mockevent.NewMockOutboxRepository(ctrl)
+		publisher := mockevent.NewMockPublisher(ctrl)
+		relay := event.NewOutboxRelay(outbox, publisher, testRelayConfig)
+		msgs := newMessages(2)
+
+		outbox.EXPECT().ClaimPending(ctx, testRelayConfig.BatchSize, gomock.Any()).Return(msgs, nil)
+		publisher.EXPECT().Publish(gomock.Any(), msgs[0].Event()).Return(nil)
+		outbox.EXPECT().MarkSent(ctx, msgs[0].ID).Return(errTest)
+
+		n, err := relay.RelayPending(ctx)
+		assert.ErrorIs(t, err, errTest)
+		assert.Equal(t, 0, n)
+	})
+}
+
+func TestOutboxRelayRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	outbox := mockevent.NewMockOutboxRepository(ctrl)
+	publisher := mockevent.NewMockPublisher(ctrl)
+	cfg := testRelayConfig
+	// the ticker never fires, only the context cancel stops the relay
+	cfg.PollInterval = time.Hour
+	cfg.BatchSize = 1
+	relay := event.NewOutboxRelay(outbox, publisher, cfg)
+	msg := event.OutboxMessage{ID: uuid.New(), EventType: "test-event", Payload: json.RawMessage(`"data"`)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	// a full batch is followed by another claim without waiting for the next poll
+	outbox.EXPECT().ClaimPending(gomock.Any(), 1, gomock.Any()).Return([]event.OutboxMessage{msg}, nil)
+	publisher.EXPECT().Publish(gomock.Any(), msg.Event()).Return(nil)
+	outbox.EXPECT().MarkSent(gomock.Any(), msg.ID).Return(nil)
+	outbox.EXPECT().ClaimPending(gomock.Any(), 1, gomock.Any()).DoAndReturn(
+		func(context.Context, int, time.Time) ([]event.OutboxMessage, error) {
+			cancel()
+			return nil, nil
+		})
+
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay didn't stop after context cancel")
+	}
+}
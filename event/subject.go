@@ -0,0 +1,89 @@
+package event
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// SubjectMode defines the NATS subject where an event is sent.
+type SubjectMode string
+
+const (
+	// SingleSubject sends every event to the topic, it is kept for the consumers of the first versions.
+	SingleSubject SubjectMode = "single"
+	// EventTypeSubject sends every event to a subject derived from its type,
+	// e.g. UserDeleted is sent to <topic>.user.deleted, so consumers can subscribe only to what they need.
+	EventTypeSubject SubjectMode = "event_type"
+)
+
+// ParseSubjectMode converts the subject mode used in config to a SubjectMode.
+func ParseSubjectMode(mode string) (SubjectMode, error) {
+	switch SubjectMode(mode) {
+	case SingleSubject, EventTypeSubject:
+		return SubjectMode(mode), nil
+	}
+	return "", fmt.Errorf("invalid subject mode %q", mode)
+}
+
+// Subject returns the subject where the events of eventType are sent.
+func (m SubjectMode) Subject(topic, eventType string) string {
+	if m == SingleSubject {
+		return topic
+	}
+	return topic + "." + eventTypeToken(eventType)
+}
+
+// AllSubjects returns the subject filter matching every event of the topic.
+func (m SubjectMode) AllSubjects(topic string) string {
+	if m == SingleSubject {
+		return topic
+	}
+	return topic + ".>"
+}
+
+// eventTypeToken converts a camel case event type to lower case tokens, e.g. UserCreated to user.created.
+func eventTypeToken(eventType string) string {
+	var sb strings.Builder
+	for i, r := range eventType {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				sb.WriteByte('.')
+			}
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// eventTypeFromToken converts the lower case tokens of an event type back to camel case, e.g. user.created to UserCreated.
+func eventTypeFromToken(token string) string {
+	var sb strings.Builder
+	for _, part := range strings.Split(token, ".") {
+		if part == "" {
+			continue
+		}
+		sb.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return sb.String()
+}
+
+// subjectCovers reports whether every subject matched by filter is also matched by pattern,
+// both may contain the * and > wildcards.
+func subjectCovers(pattern, filter string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	filterTokens := strings.Split(filter, ".")
+	for i, token := range patternTokens {
+		if token == ">" {
+			return len(filterTokens) > i
+		}
+		if i >= len(filterTokens) || filterTokens[i] == ">" {
+			return false
+		}
+		if token != "*" && (filterTokens[i] == "*" || token != filterTokens[i]) {
+			return false
+		}
+	}
+	return len(patternTokens) == len(filterTokens)
+}
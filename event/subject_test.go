@@ -0,0 +1,55 @@
+package event_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zechao/faceit-user-svc/event"
+)
+
+func TestSubjectMode(t *testing.T) {
+	tests := map[string]struct {
+		mode        event.SubjectMode
+		eventType   string
+		expected    string
+		expectedAll string
+	}{
+		"single subject": {
+			mode:        event.SingleSubject,
+			eventType:   "UserCreated",
+			expected:    "user-svc",
+			expectedAll: "user-svc",
+		},
+		"event type subject": {
+			mode:        event.EventTypeSubject,
+			eventType:   "UserCreated",
+			expected:    "user-svc.user.created",
+			expectedAll: "user-svc.>",
+		},
+		"event type subject of deleted": {
+			mode:        event.EventTypeSubject,
+			eventType:   "UserDeleted",
+			expected:    "user-svc.user.deleted",
+			expectedAll: "user-svc.>",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.mode.Subject("user-svc", tt.eventType))
+			assert.Equal(t, tt.expectedAll, tt.mode.AllSubjects("user-svc"))
+		})
+	}
+}
+
+func TestParseSubjectMode(t *testing.T) {
+	mode, err := event.ParseSubjectMode("event_type")
+	assert.NoError(t, err)
+	assert.Equal(t, event.EventTypeSubject, mode)
+
+	mode, err = event.ParseSubjectMode("single")
+	assert.NoError(t, err)
+	assert.Equal(t, event.SingleSubject, mode)
+
+	_, err = event.ParseSubjectMode("topic")
+	assert.Error(t, err)
+}
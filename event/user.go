@@ -0,0 +1,143 @@
+package event
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserSchemaVersion is the schema version of the user event payloads.
+// It must be increased on every breaking change, so consumers can handle both versions while they migrate.
+const UserSchemaVersion = 1
+
+// Aggregate is implemented by the payloads of the events about a single entity. Its ID is stored
+// with the event in the outbox, so the events of an entity are found without reading the payloads.
+type Aggregate interface {
+	AggregateID() uuid.UUID
+}
+
+var (
+	_ Aggregate = UserCreated{}
+	_ Aggregate = UserUpdated{}
+	_ Aggregate = UserDeleted{}
+	_ Aggregate = UserRestored{}
+	_ Aggregate = UserErased{}
+)
+
+// UserSnapshot represents the state of a user in an event, it never contains the password.
+type UserSnapshot struct {
+	ID        uuid.UUID `json:"id"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	NickName  string    `json:"nick_name"`
+	Email     string    `json:"email"`
+	Country   string    `json:"country"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// FieldChange represents the change of a user field.
+// Before and After are omitted for sensitive fields like the password.
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// UserCreated is the payload of the UserCreated event.
+type UserCreated struct {
+	SchemaVersion int          `json:"schema_version"`
+	User          UserSnapshot `json:"user"`
+}
+
+// UserUpdated is the payload of the UserUpdated event, it only lists the fields that changed.
+type UserUpdated struct {
+	SchemaVersion int           `json:"schema_version"`
+	ID            uuid.UUID     `json:"id"`
+	Changes       []FieldChange `json:"changes"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+}
+
+// UserDeleted is the payload of the UserDeleted event.
+type UserDeleted struct {
+	SchemaVersion int       `json:"schema_version"`
+	ID            uuid.UUID `json:"id"`
+	DeletedAt     time.Time `json:"deleted_at"`
+}
+
+// UserRestored is the payload of the UserRestored event, it carries the restored user as UserCreated does.
+type UserRestored struct {
+	SchemaVersion int          `json:"schema_version"`
+	User          UserSnapshot `json:"user"`
+	RestoredAt    time.Time    `json:"restored_at"`
+}
+
+// UserErased is the payload of the UserErased event, the consumers must forget the personal data of the user.
+type UserErased struct {
+	SchemaVersion int       `json:"schema_version"`
+	ID            uuid.UUID `json:"id"`
+	ErasedAt      time.Time `json:"erased_at"`
+}
+
+// NewUserCreated creates the UserCreated payload with the current schema version.
+func NewUserCreated(u UserSnapshot) UserCreated {
+	return UserCreated{
+		SchemaVersion: UserSchemaVersion,
+		User:          u,
+	}
+}
+
+// NewUserUpdated creates the UserUpdated payload with the current schema version.
+func NewUserUpdated(id uuid.UUID, changes []FieldChange, updatedAt time.Time) UserUpdated {
+	if changes == nil {
+		changes = []FieldChange{}
+	}
+	return UserUpdated{
+		SchemaVersion: UserSchemaVersion,
+		ID:            id,
+		Changes:       changes,
+		UpdatedAt:     updatedAt,
+	}
+}
+
+// NewUserDeleted creates the UserDeleted payload with the current schema version.
+func NewUserDeleted(id uuid.UUID, deletedAt time.Time) UserDeleted {
+	return UserDeleted{
+		SchemaVersion: UserSchemaVersion,
+		ID:            id,
+		DeletedAt:     deletedAt,
+	}
+}
+
+// NewUserRestored creates the UserRestored payload with the current schema version.
+func NewUserRestored(u UserSnapshot, restoredAt time.Time) UserRestored {
+	return UserRestored{
+		SchemaVersion: UserSchemaVersion,
+		User:          u,
+		RestoredAt:    restoredAt,
+	}
+}
+
+// NewUserErased creates the UserErased payload with the current schema version.
+func NewUserErased(id uuid.UUID, erasedAt time.Time) UserErased {
+	return UserErased{
+		SchemaVersion: UserSchemaVersion,
+		ID:            id,
+		ErasedAt:      erasedAt,
+	}
+}
+
+// AggregateID implements Aggregate, it's the ID of the created user.
+func (e UserCreated) AggregateID() uuid.UUID { return e.User.ID }
+
+// AggregateID implements Aggregate, it's the ID of the updated user.
+func (e UserUpdated) AggregateID() uuid.UUID { return e.ID }
+
+// AggregateID implements Aggregate, it's the ID of the deleted user.
+func (e UserDeleted) AggregateID() uuid.UUID { return e.ID }
+
+// AggregateID implements Aggregate, it's the ID of the restored user.
+func (e UserRestored) AggregateID() uuid.UUID { return e.User.ID }
+
+// AggregateID implements Aggregate, it's the ID of the erased user.
+func (e UserErased) AggregateID() uuid.UUID { return e.ID }
@@ -0,0 +1,102 @@
+package event_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/zechao/faceit-user-svc/event"
+)
+
+func TestUserEventPayloads(t *testing.T) {
+	id := uuid.MustParse("ef447c56-8a47-4dd0-85e4-e5393140066d")
+	ts := time.Date(2025, 2, 28, 14, 22, 16, 0, time.UTC)
+
+	tests := map[string]struct {
+		payload  any
+		expected string
+	}{
+		"user created": {
+			payload: event.NewUserCreated(event.UserSnapshot{
+				ID:        id,
+				FirstName: "zechao",
+				LastName:  "jin",
+				NickName:  "zen",
+				Email:     "zechao@jin.com",
+				Country:   "ES",
+				CreatedAt: ts,
+				UpdatedAt: ts,
+			}),
+			expected: `{"schema_version":1,"user":{"id":"ef447c56-8a47-4dd0-85e4-e5393140066d","first_name":"zechao",
+				"last_name":"jin","nick_name":"zen","email":"zechao@jin.com","country":"ES",
+				"created_at":"2025-02-28T14:22:16Z","updated_at":"2025-02-28T14:22:16Z"}}`,
+		},
+		"user updated": {
+			payload: event.NewUserUpdated(id, []event.FieldChange{
+				{Field: "country", Before: "ES", After: "GB"},
+				{Field: "password"},
+			}, ts),
+			expected: `{"schema_version":1,"id":"ef447c56-8a47-4dd0-85e4-e5393140066d",
+				"changes":[{"field":"country","before":"ES","after":"GB"},{"field":"password"}],
+				"updated_at":"2025-02-28T14:22:16Z"}`,
+		},
+		"user updated without changes": {
+			payload: event.NewUserUpdated(id, nil, ts),
+			expected: `{"schema_version":1,"id":"ef447c56-8a47-4dd0-85e4-e5393140066d","changes":[],
+				"updated_at":"2025-02-28T14:22:16Z"}`,
+		},
+		"user restored": {
+			payload: event.NewUserRestored(event.UserSnapshot{
+				ID:        id,
+				FirstName: "zechao",
+				LastName:  "jin",
+				NickName:  "zen",
+				Email:     "zechao@jin.com",
+				Country:   "ES",
+				CreatedAt: ts,
+				UpdatedAt: ts,
+			}, ts),
+			expected: `{"schema_version":1,"user":{"id":"ef447c56-8a47-4dd0-85e4-e5393140066d","first_name":"zechao",
+				"last_name":"jin","nick_name":"zen","email":"zechao@jin.com","country":"ES",
+				"created_at":"2025-02-28T14:22:16Z","updated_at":"2025-02-28T14:22:16Z"},
+				"restored_at":"2025-02-28T14:22:16Z"}`,
+		},
+		"user erased": {
+			payload:  event.NewUserErased(id, ts),
+			expected: `{"schema_version":1,"id":"ef447c56-8a47-4dd0-85e4-e5393140066d","erased_at":"2025-02-28T14:22:16Z"}`,
+		},
+		"user deleted": {
+			payload:  event.NewUserDeleted(id, ts),
+			expected: `{"schema_version":1,"id":"ef447c56-8a47-4dd0-85e4-e5393140066d","deleted_at":"2025-02-28T14:22:16Z"}`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, err := json.Marshal(tt.payload)
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(data))
+		})
+	}
+}
+
+func TestUserEventAggregateID(t *testing.T) {
+	id := uuid.New()
+	ts := time.Now()
+
+	tests := map[string]event.Aggregate{
+		"user created":  event.NewUserCreated(event.UserSnapshot{ID: id}),
+		"user updated":  event.NewUserUpdated(id, nil, ts),
+		"user deleted":  event.NewUserDeleted(id, ts),
+		"user restored": event.NewUserRestored(event.UserSnapshot{ID: id}, ts),
+		"user erased":   event.NewUserErased(id, ts),
+	}
+
+	for name, payload := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, id, payload.AggregateID())
+		})
+	}
+}
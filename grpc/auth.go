@@ -0,0 +1,116 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+
+	"github.com/zechao/faceit-user-svc/auth"
+	"github.com/zechao/faceit-user-svc/grpc/pb"
+	api "github.com/zechao/faceit-user-svc/http"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// AuthorizationMetadata carries the access token of the users as Bearer token.
+	AuthorizationMetadata = "authorization"
+	// APIKeyMetadata carries the API key of the services.
+	APIKeyMetadata = "x-api-key"
+)
+
+// rule tells whether the identity is allowed to perform the request.
+type rule func(req any, identity *auth.Identity) bool
+
+// methodRules are the rules of each method, they match the rules of the http routes: anyone can create a user,
+// users can update, delete and read themselves, services can read and list every user and admins can do it all.
+// A method without rules doesn't require a caller, a method missing from the map is rejected.
+var methodRules = map[string][]rule{
+	pb.UserService_CreateUser_FullMethodName: nil,
+	pb.UserService_UpdateUser_FullMethodName: {self(), admin()},
+	pb.UserService_DeleteUser_FullMethodName: {self(), admin()},
+	pb.UserService_GetUser_FullMethodName:    {self(), scope(auth.ScopeService), admin()},
+	pb.UserService_ListUsers_FullMethodName:  {scope(auth.ScopeService), admin()},
+}
+
+// AuthInterceptor authenticates the caller by bearer token or API key like the http AuthenticationMiddleware,
+// sets its identity in the context and rejects the callers not allowed to call the method.
+// Requests without credentials continue anonymously to the methods that don't require a caller.
+func AuthInterceptor(authenticator *auth.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		identity, err := authenticate(ctx, authenticator)
+		if err != nil {
+			return nil, handlerError(ctx, err)
+		}
+		if identity != nil {
+			ctx = auth.ContextWithIdentity(ctx, identity)
+		}
+
+		if err := authorize(info.FullMethod, req, identity); err != nil {
+			return nil, handlerError(ctx, err)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// authenticate returns the identity of the credentials in the metadata, or nil if there aren't any.
+func authenticate(ctx context.Context, authenticator *auth.Authenticator) (*auth.Identity, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(AuthorizationMetadata); len(values) > 0 {
+		token, ok := strings.CutPrefix(values[0], auth.TokenType+" ")
+		if !ok {
+			return nil, auth.ErrInvalidToken
+		}
+		return authenticator.AuthenticateToken(ctx, token)
+	}
+	if values := md.Get(APIKeyMetadata); len(values) > 0 {
+		return authenticator.AuthenticateAPIKey(values[0])
+	}
+	return nil, nil
+}
+
+// authorize checks the identity against the rules of the method, any of them must allow it.
+func authorize(method string, req any, identity *auth.Identity) error {
+	rules, ok := methodRules[method]
+	if !ok {
+		return api.ErrForbidden
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	if identity == nil {
+		return api.ErrAuthenticationRequired
+	}
+	for _, allowed := range rules {
+		if allowed(req, identity) {
+			return nil
+		}
+	}
+	return api.ErrForbidden
+}
+
+// idRequest is implemented by the requests about a single user.
+type idRequest interface {
+	GetId() string
+}
+
+// self allows the users to act on themselves, the user ID is taken from the request.
+func self() rule {
+	return func(req any, identity *auth.Identity) bool {
+		r, ok := req.(idRequest)
+		return ok && identity.IsUser(r.GetId())
+	}
+}
+
+// admin allows the callers with the admin role or scope.
+func admin() rule {
+	return func(_ any, identity *auth.Identity) bool {
+		return identity.IsAdmin()
+	}
+}
+
+// scope allows the callers with any of the scopes.
+func scope(scopes ...string) rule {
+	return func(_ any, identity *auth.Identity) bool {
+		return identity.HasScope(scopes...)
+	}
+}
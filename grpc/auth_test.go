@@ -0,0 +1,233 @@
+package grpc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zechao/faceit-user-svc/auth"
+	grpcapi "github.com/zechao/faceit-user-svc/grpc"
+	"github.com/zechao/faceit-user-svc/grpc/pb"
+	"github.com/zechao/faceit-user-svc/query"
+	"github.com/zechao/faceit-user-svc/user"
+	"github.com/zechao/faceit-user-svc/user/mocks"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const testSigningKey = "test-signing-key-with-32-characters!"
+
+func signTestToken(t *testing.T, subject string, roles ...string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "user-svc",
+			Subject:   subject,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+		Roles: roles,
+	})
+	signed, err := token.SignedString([]byte(testSigningKey))
+	require.NoError(t, err)
+	return signed
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	authenticator, err := auth.NewAuthenticator(auth.AuthenticatorConfig{
+		Issuer:     "user-svc",
+		SigningKey: testSigningKey,
+		APIKeys: []auth.APIKey{
+			{Name: "billing", Key: "billing-key", Scopes: []string{auth.ScopeService}},
+			{Name: "metrics", Key: "metrics-key"},
+		},
+	})
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	mockService := mocks.NewMockService(ctrl)
+	client := setupClient(t, mockService, grpcapi.AuthInterceptor(authenticator))
+
+	userID := uuid.New()
+	otherID := uuid.New()
+	userToken := "Bearer " + signTestToken(t, userID.String())
+	adminToken := "Bearer " + signTestToken(t, uuid.NewString(), auth.RoleAdmin)
+
+	deleteUser := func(id uuid.UUID) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			_, err := client.DeleteUser(ctx, &pb.DeleteUserRequest{Id: id.String()})
+			return err
+		}
+	}
+	getUser := func(id uuid.UUID) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			_, err := client.GetUser(ctx, &pb.GetUserRequest{Id: id.String()})
+			return err
+		}
+	}
+	updateUser := func(id uuid.UUID) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			_, err := client.UpdateUser(ctx, &pb.UpdateUserRequest{Id: id.String()})
+			return err
+		}
+	}
+	listUsers := func(ctx context.Context) error {
+		_, err := client.ListUsers(ctx, &pb.ListUsersRequest{})
+		return err
+	}
+	expectList := func() {
+		mockService.EXPECT().ListUsers(gomock.Any(), gomock.Any()).Return(&query.PaginationResponse[user.User]{}, nil)
+	}
+
+	tests := map[string]struct {
+		metadata     []string
+		call         func(ctx context.Context) error
+		mockSetup    func()
+		expectedCode codes.Code
+	}{
+		"fail delete by anonymous": {
+			call:         deleteUser(userID),
+			expectedCode: codes.Unauthenticated,
+		},
+		"fail delete by invalid token": {
+			metadata:     []string{grpcapi.AuthorizationMetadata, "Bearer invalid"},
+			call:         deleteUser(userID),
+			expectedCode: codes.Unauthenticated,
+		},
+		"fail delete by token without Bearer prefix": {
+			metadata:     []string{grpcapi.AuthorizationMetadata, signTestToken(t, userID.String())},
+			call:         deleteUser(userID),
+			expectedCode: codes.Unauthenticated,
+		},
+		"fail delete by unknown API key": {
+			metadata:     []string{grpcapi.APIKeyMetadata, "unknown"},
+			call:         deleteUser(userID),
+			expectedCode: codes.Unauthenticated,
+		},
+		"fail delete another user": {
+			metadata:     []string{grpcapi.AuthorizationMetadata, userToken},
+			call:         deleteUser(otherID),
+			expectedCode: codes.PermissionDenied,
+		},
+		"fail delete by service": {
+			metadata:     []string{grpcapi.APIKeyMetadata, "billing-key"},
+			call:         deleteUser(userID),
+			expectedCode: codes.PermissionDenied,
+		},
+		"success delete self": {
+			metadata: []string{grpcapi.AuthorizationMetadata, userToken},
+			call:     deleteUser(userID),
+			mockSetup: func() {
+				mockService.EXPECT().DeleteUser(gomock.Any(), userID, gomock.Nil()).Return(nil)
+			},
+			expectedCode: codes.OK,
+		},
+		"success delete another user by admin": {
+			metadata: []string{grpcapi.AuthorizationMetadata, adminToken},
+			call:     deleteUser(otherID),
+			mockSetup: func() {
+				mockService.EXPECT().DeleteUser(gomock.Any(), otherID, gomock.Nil()).Return(nil)
+			},
+			expectedCode: codes.OK,
+		},
+		"fail update another user": {
+			metadata:     []string{grpcapi.AuthorizationMetadata, userToken},
+			call:         updateUser(otherID),
+			expectedCode: codes.PermissionDenied,
+		},
+		"fail update by service": {
+			metadata:     []string{grpcapi.APIKeyMetadata, "billing-key"},
+			call:         updateUser(userID),
+			expectedCode: codes.PermissionDenied,
+		},
+		"fail get another user": {
+			metadata:     []string{grpcapi.AuthorizationMetadata, userToken},
+			call:         getUser(otherID),
+			expectedCode: codes.PermissionDenied,
+		},
+		"success get by service": {
+			metadata: []string{grpcapi.APIKeyMetadata, "billing-key"},
+			call:     getUser(otherID),
+			mockSetup: func() {
+				mockService.EXPECT().GetUser(gomock.Any(), otherID, gomock.Nil()).Return(&testUser, nil)
+			},
+			expectedCode: codes.OK,
+		},
+		"success get self with identity in context": {
+			metadata: []string{grpcapi.AuthorizationMetadata, userToken},
+			call:     getUser(userID),
+			mockSetup: func() {
+				mockService.EXPECT().GetUser(gomock.Any(), userID, gomock.Nil()).DoAndReturn(func(ctx context.Context, _ uuid.UUID, _ []string) (*user.User, error) {
+					identity, ok := auth.IdentityFromContext(ctx)
+					assert.True(t, ok)
+					assert.True(t, identity.IsUser(userID.String()))
+					return &testUser, nil
+				})
+			},
+			expectedCode: codes.OK,
+		},
+		"fail list by anonymous": {
+			call:         listUsers,
+			expectedCode: codes.Unauthenticated,
+		},
+		"fail list by user": {
+			metadata:     []string{grpcapi.AuthorizationMetadata, userToken},
+			call:         listUsers,
+			expectedCode: codes.PermissionDenied,
+		},
+		"fail list by service without scope": {
+			metadata:     []string{grpcapi.APIKeyMetadata, "metrics-key"},
+			call:         listUsers,
+			expectedCode: codes.PermissionDenied,
+		},
+		"success list by service": {
+			metadata:     []string{grpcapi.APIKeyMetadata, "billing-key"},
+			call:         listUsers,
+			mockSetup:    expectList,
+			expectedCode: codes.OK,
+		},
+		"success list by admin": {
+			metadata:     []string{grpcapi.AuthorizationMetadata, adminToken},
+			call:         listUsers,
+			mockSetup:    expectList,
+			expectedCode: codes.OK,
+		},
+		"success create by anonymous": {
+			call: func(ctx context.Context) error {
+				_, err := client.CreateUser(ctx, &testCreateUserRequest)
+				return err
+			},
+			mockSetup: func() {
+				mockService.EXPECT().CreateUser(gomock.Any(), &testCreateUserInput).Return(&testUser, nil)
+			},
+			expectedCode: codes.OK,
+		},
+		"fail create by invalid token": {
+			metadata: []string{grpcapi.AuthorizationMetadata, "Bearer invalid"},
+			call: func(ctx context.Context) error {
+				_, err := client.CreateUser(ctx, &testCreateUserRequest)
+				return err
+			},
+			expectedCode: codes.Unauthenticated,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if tc.mockSetup != nil {
+				tc.mockSetup()
+			}
+			ctx := context.Background()
+			if len(tc.metadata) > 0 {
+				ctx = metadata.AppendToOutgoingContext(ctx, tc.metadata...)
+			}
+
+			err := tc.call(ctx)
+			assert.Equal(t, tc.expectedCode, status.Code(err))
+		})
+	}
+}
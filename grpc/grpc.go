@@ -0,0 +1,73 @@
+// Package grpc contains the gRPC server for the user service.
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/zechao/faceit-user-svc/errors"
+	"github.com/zechao/faceit-user-svc/log"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcCodes maps the http status codes used by errors.Error to gRPC status codes.
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusConflict:            codes.AlreadyExists,
+	http.StatusPreconditionFailed:  codes.FailedPrecondition,
+	http.StatusUnprocessableEntity: codes.FailedPrecondition,
+	http.StatusInternalServerError: codes.Internal,
+}
+
+// handlerError converts the error returned by the service to a gRPC status error,
+// it is the gRPC counterpart of the http handlerError.
+func handlerError(ctx context.Context, err error) error {
+	svcErr := new(errors.Error)
+	if errors.As(err, &svcErr) {
+		log.Warn(ctx, "service error", slog.Any("error", svcErr))
+		code, ok := grpcCodes[svcErr.Code]
+		if !ok {
+			code = codes.Unknown
+		}
+		st := status.New(code, svcErr.Message)
+		if len(svcErr.Details) == 0 {
+			return st.Err()
+		}
+		violations := make([]*errdetails.BadRequest_FieldViolation, len(svcErr.Details))
+		for i, d := range svcErr.Details {
+			violations[i] = &errdetails.BadRequest_FieldViolation{
+				Field:       d.Field,
+				Description: d.Description,
+			}
+		}
+		withDetails, detailErr := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+		if detailErr != nil {
+			return st.Err()
+		}
+		return withDetails.Err()
+	}
+
+	log.Error(ctx, "internal server error", slog.Any("error", err))
+	return status.Error(codes.Internal, "unexpected internal server error")
+}
+
+// RecoveryInterceptor recovers from any panic in the handler and returns an internal error,
+// it is the gRPC counterpart of gin.Recovery.
+func RecoveryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res any, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Error(ctx, "panic recovered", slog.Any("panic", r), slog.String("method", info.FullMethod))
+				err = status.Error(codes.Internal, "unexpected internal server error")
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
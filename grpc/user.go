@@ -0,0 +1,210 @@
+package grpc
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/zechao/faceit-user-svc/errors"
+	"github.com/zechao/faceit-user-svc/grpc/pb"
+	api "github.com/zechao/faceit-user-svc/http"
+	"github.com/zechao/faceit-user-svc/query"
+	"github.com/zechao/faceit-user-svc/user"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	ErrorInvalidUserID = errors.NewWrongInput("invalid user id")
+	// ErrorFieldsNotSupported is returned when a sparse fieldset is requested, the User messages are always complete.
+	ErrorFieldsNotSupported = errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+		Field:       "fields",
+		Description: "fields is not supported by the gRPC API, the users are always complete",
+	})
+)
+
+// UserServer implements pb.UserServiceServer on top of user.Service.
+// Requests are validated with the same rules as the http API.
+type UserServer struct {
+	pb.UnimplementedUserServiceServer
+	service user.Service
+}
+
+var _ pb.UserServiceServer = (*UserServer)(nil)
+
+func NewUserServer(service user.Service) *UserServer {
+	return &UserServer{
+		service: service,
+	}
+}
+
+// Register registers the user service in the given gRPC server.
+func (s *UserServer) Register(server *grpc.Server) {
+	pb.RegisterUserServiceServer(server, s)
+}
+
+// CreateUser creates a new user and returns the created user without password.
+func (s *UserServer) CreateUser(ctx context.Context, req *pb.CreateUserRequest) (*pb.User, error) {
+	createReq := api.CreateUserRequest{
+		FirstName: req.GetFirstName(),
+		LastName:  req.GetLastName(),
+		NickName:  req.GetNickName(),
+		Password:  req.GetPassword(),
+		Email:     req.GetEmail(),
+		Country:   req.GetCountry(),
+	}
+	if err := createReq.Validate(); err != nil {
+		return nil, handlerError(ctx, err)
+	}
+
+	u, err := s.service.CreateUser(ctx, &user.CreateUserInput{
+		FirstName: createReq.FirstName,
+		LastName:  createReq.LastName,
+		NickName:  createReq.NickName,
+		Password:  createReq.Password,
+		Email:     createReq.Email,
+		Country:   createReq.Country,
+	})
+	if err != nil {
+		return nil, handlerError(ctx, err)
+	}
+	return newUser(u), nil
+}
+
+// UpdateUser updates only the fields set in the request and returns the updated user.
+func (s *UserServer) UpdateUser(ctx context.Context, req *pb.UpdateUserRequest) (*pb.User, error) {
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, handlerError(ctx, ErrorInvalidUserID)
+	}
+
+	updateReq := api.UpdateUserRequest{
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		NickName:  req.NickName,
+		Password:  req.Password,
+		Email:     req.Email,
+		Country:   req.Country,
+	}
+	if err := updateReq.Validate(); err != nil {
+		return nil, handlerError(ctx, err)
+	}
+
+	u, err := s.service.UpdateUser(ctx, &user.UpdateUserInput{
+		ID:        id,
+		FirstName: updateReq.FirstName,
+		LastName:  updateReq.LastName,
+		NickName:  updateReq.NickName,
+		Password:  updateReq.Password,
+		Email:     updateReq.Email,
+		Country:   updateReq.Country,
+	})
+	if err != nil {
+		return nil, handlerError(ctx, err)
+	}
+	return newUser(u), nil
+}
+
+// DeleteUser soft deletes the user, it succeeds even if the user does not exist.
+func (s *UserServer) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*pb.DeleteUserResponse, error) {
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, handlerError(ctx, ErrorInvalidUserID)
+	}
+
+	if err := s.service.DeleteUser(ctx, id, nil); err != nil {
+		return nil, handlerError(ctx, err)
+	}
+	return &pb.DeleteUserResponse{}, nil
+}
+
+// GetUser returns the user for the given id.
+func (s *UserServer) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.User, error) {
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, handlerError(ctx, ErrorInvalidUserID)
+	}
+
+	u, err := s.service.GetUser(ctx, id, nil)
+	if err != nil {
+		return nil, handlerError(ctx, err)
+	}
+	return newUser(u), nil
+}
+
+// ListUsers lists users with pagination, sorting and filtering, the pages can be read with the cursor
+// returned in next_cursor like in the http API. Sparse fieldsets are rejected, the users are always complete.
+// The request is translated to url values so it goes through the same parsing and validation as the http API.
+func (s *UserServer) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
+	params := url.Values{}
+	if req.GetPage() != 0 {
+		params.Set("page", strconv.Itoa(int(req.GetPage())))
+	}
+	if req.GetPageSize() != 0 {
+		params.Set("page_size", strconv.Itoa(int(req.GetPageSize())))
+	}
+	if req.GetSortBy() != "" {
+		params.Set("sort_by", req.GetSortBy())
+	}
+	if req.GetSortOrder() != "" {
+		params.Set("sort_order", req.GetSortOrder())
+	}
+	if req.GetCursor() != "" {
+		params.Set("cursor", req.GetCursor())
+	}
+	if req.GetIncludeTotal() != "" {
+		params.Set("include_total", req.GetIncludeTotal())
+	}
+	for key, filter := range req.GetFilters() {
+		params[key] = filter.GetValues()
+	}
+	if params.Has("fields") {
+		return nil, handlerError(ctx, ErrorFieldsNotSupported)
+	}
+
+	q, err := query.QueryFromURL(params)
+	if err != nil {
+		return nil, handlerError(ctx, err)
+	}
+
+	listRes, err := s.service.ListUsers(ctx, *q)
+	if err != nil {
+		return nil, handlerError(ctx, err)
+	}
+
+	res := &pb.ListUsersResponse{
+		Page:       int32(listRes.Page),
+		PageSize:   int32(listRes.PageSize),
+		TotalMode:  string(listRes.TotalMode),
+		SortBy:     listRes.SortBy,
+		SortOrder:  listRes.SortOrder,
+		Filters:    make(map[string]*pb.FilterValues, len(listRes.Filters)),
+		Data:       make([]*pb.User, len(listRes.Data)),
+		NextCursor: listRes.NextCursor,
+	}
+	if listRes.TotalMode != query.TotalNone {
+		res.TotalRecords = &listRes.TotalRecords
+	}
+	for key, values := range listRes.Filters {
+		res.Filters[key] = &pb.FilterValues{Values: values}
+	}
+	for i := range listRes.Data {
+		res.Data[i] = newUser(&listRes.Data[i])
+	}
+	return res, nil
+}
+
+// newUser maps the domain user to its protobuf message, leaving the password out.
+func newUser(u *user.User) *pb.User {
+	return &pb.User{
+		Id:        u.ID.String(),
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		NickName:  u.NickName,
+		Email:     u.Email,
+		Country:   u.Country,
+		CreatedAt: timestamppb.New(u.CreatedAt),
+		UpdatedAt: timestamppb.New(u.UpdatedAt),
+	}
+}
@@ -0,0 +1,480 @@
+package grpc_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zechao/faceit-user-svc/errors"
+	grpcapi "github.com/zechao/faceit-user-svc/grpc"
+	"github.com/zechao/faceit-user-svc/grpc/pb"
+	"github.com/zechao/faceit-user-svc/query"
+	"github.com/zechao/faceit-user-svc/tracing"
+	"github.com/zechao/faceit-user-svc/user"
+	"github.com/zechao/faceit-user-svc/user/mocks"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var (
+	testUser = user.User{
+		ID:        uuid.New(),
+		FirstName: "John",
+		LastName:  "Doe",
+		NickName:  "AB123",
+		Email:     "john.doe@example.com",
+		Password:  "securepassword123",
+		Country:   "ES",
+	}
+
+	testCreateUserRequest = pb.CreateUserRequest{
+		FirstName: "John",
+		LastName:  "Doe",
+		NickName:  "AB123",
+		Email:     "john.doe@example.com",
+		Password:  "securepassword123",
+		Country:   "ES",
+	}
+
+	testCreateUserInput = user.CreateUserInput{
+		FirstName: "John",
+		LastName:  "Doe",
+		NickName:  "AB123",
+		Email:     "john.doe@example.com",
+		Password:  "securepassword123",
+		Country:   "ES",
+	}
+	errTest = errors.NewInternal("test error")
+)
+
+// setupClient starts an in memory gRPC server with the user server registered and returns a client connected to it.
+// The interceptors are chained after the recovery and tracing ones.
+func setupClient(t *testing.T, service user.Service, interceptors ...grpc.UnaryServerInterceptor) pb.UserServiceClient {
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(append([]grpc.UnaryServerInterceptor{
+		grpcapi.RecoveryInterceptor(),
+		tracing.UnaryServerInterceptor(),
+	}, interceptors...)...))
+	grpcapi.NewUserServer(service).Register(server)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(tracing.UnaryClientInterceptor()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewUserServiceClient(conn)
+}
+
+func TestCreateUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockService := mocks.NewMockService(ctrl)
+	client := setupClient(t, mockService)
+
+	tests := map[string]struct {
+		request      *pb.CreateUserRequest
+		mockSetup    func()
+		expectedCode codes.Code
+	}{
+		"fail by validation error": {
+			request: &pb.CreateUserRequest{
+				FirstName: testCreateUserRequest.FirstName,
+				Country:   "invalid",
+			},
+			expectedCode: codes.InvalidArgument,
+		},
+		"fail by duplicated user": {
+			request: &testCreateUserRequest,
+			mockSetup: func() {
+				mockService.EXPECT().CreateUser(gomock.Any(), &testCreateUserInput).Return(nil, errors.ErrDuplicated)
+			},
+			expectedCode: codes.AlreadyExists,
+		},
+		"fail by service error": {
+			request: &testCreateUserRequest,
+			mockSetup: func() {
+				mockService.EXPECT().CreateUser(gomock.Any(), &testCreateUserInput).Return(nil, errTest)
+			},
+			expectedCode: codes.Internal,
+		},
+		"success valid request": {
+			request: &testCreateUserRequest,
+			mockSetup: func() {
+				mockService.EXPECT().CreateUser(gomock.Any(), &testCreateUserInput).Return(&testUser, nil)
+			},
+			expectedCode: codes.OK,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if tt.mockSetup != nil {
+				tt.mockSetup()
+			}
+
+			res, err := client.CreateUser(context.Background(), tt.request)
+
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+			if tt.expectedCode == codes.OK {
+				assert.Equal(t, testUser.ID.String(), res.GetId())
+				assert.Equal(t, testUser.Email, res.GetEmail())
+			}
+		})
+	}
+}
+
+func TestCreateUserValidationDetails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockService := mocks.NewMockService(ctrl)
+	client := setupClient(t, mockService)
+
+	req := &pb.CreateUserRequest{
+		FirstName: testCreateUserRequest.FirstName,
+		LastName:  testCreateUserRequest.LastName,
+		NickName:  testCreateUserRequest.NickName,
+		Password:  testCreateUserRequest.Password,
+		Email:     "adas.com",
+		Country:   testCreateUserRequest.Country,
+	}
+	_, err := client.CreateUser(context.Background(), req)
+
+	st := status.Convert(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 1)
+	badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+	require.True(t, ok)
+	require.Len(t, badRequest.GetFieldViolations(), 1)
+	assert.Equal(t, "email", badRequest.GetFieldViolations()[0].GetField())
+	assert.Equal(t, "invalid email format", badRequest.GetFieldViolations()[0].GetDescription())
+}
+
+func TestUpdateUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockService := mocks.NewMockService(ctrl)
+	client := setupClient(t, mockService)
+
+	country := "GB"
+	emptyText := ""
+	tests := map[string]struct {
+		request      *pb.UpdateUserRequest
+		mockSetup    func()
+		expectedCode codes.Code
+	}{
+		"fail by wrong id": {
+			request:      &pb.UpdateUserRequest{Id: "wrong id"},
+			expectedCode: codes.InvalidArgument,
+		},
+		"fail by validation error": {
+			request:      &pb.UpdateUserRequest{Id: testUser.ID.String(), Country: &emptyText},
+			expectedCode: codes.InvalidArgument,
+		},
+		"fail by not found": {
+			request: &pb.UpdateUserRequest{Id: testUser.ID.String(), Country: &country},
+			mockSetup: func() {
+				mockService.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Return(nil, errors.ErrNotfound)
+			},
+			expectedCode: codes.NotFound,
+		},
+		"success valid request": {
+			request: &pb.UpdateUserRequest{Id: testUser.ID.String(), Country: &country},
+			mockSetup: func() {
+				mockService.EXPECT().UpdateUser(gomock.Any(), &user.UpdateUserInput{
+					ID:      testUser.ID,
+					Country: &country,
+				}).Return(&testUser, nil)
+			},
+			expectedCode: codes.OK,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if tt.mockSetup != nil {
+				tt.mockSetup()
+			}
+
+			_, err := client.UpdateUser(context.Background(), tt.request)
+
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+		})
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockService := mocks.NewMockService(ctrl)
+	client := setupClient(t, mockService)
+
+	tests := map[string]struct {
+		id           string
+		mockSetup    func()
+		expectedCode codes.Code
+	}{
+		"fail by wrong id": {
+			id:           "wrong id",
+			expectedCode: codes.InvalidArgument,
+		},
+		"fail by service error": {
+			id: testUser.ID.String(),
+			mockSetup: func() {
+				mockService.EXPECT().DeleteUser(gomock.Any(), testUser.ID, gomock.Nil()).Return(errTest)
+			},
+			expectedCode: codes.Internal,
+		},
+		"success valid request": {
+			id: testUser.ID.String(),
+			mockSetup: func() {
+				mockService.EXPECT().DeleteUser(gomock.Any(), testUser.ID, gomock.Nil()).Return(nil)
+			},
+			expectedCode: codes.OK,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if tt.mockSetup != nil {
+				tt.mockSetup()
+			}
+
+			_, err := client.DeleteUser(context.Background(), &pb.DeleteUserRequest{Id: tt.id})
+
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+		})
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockService := mocks.NewMockService(ctrl)
+	client := setupClient(t, mockService)
+
+	tests := map[string]struct {
+		id           string
+		mockSetup    func()
+		expectedCode codes.Code
+	}{
+		"fail by wrong id": {
+			id:           "wrong id",
+			expectedCode: codes.InvalidArgument,
+		},
+		"fail by not found": {
+			id: testUser.ID.String(),
+			mockSetup: func() {
+				mockService.EXPECT().GetUser(gomock.Any(), testUser.ID, gomock.Nil()).Return(nil, errors.ErrNotfound)
+			},
+			expectedCode: codes.NotFound,
+		},
+		"success valid request": {
+			id: testUser.ID.String(),
+			mockSetup: func() {
+				mockService.EXPECT().GetUser(gomock.Any(), testUser.ID, gomock.Nil()).Return(&testUser, nil)
+			},
+			expectedCode: codes.OK,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if tt.mockSetup != nil {
+				tt.mockSetup()
+			}
+
+			res, err := client.GetUser(context.Background(), &pb.GetUserRequest{Id: tt.id})
+
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+			if tt.expectedCode == codes.OK {
+				assert.Equal(t, testUser.ID.String(), res.GetId())
+			}
+		})
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockService := mocks.NewMockService(ctrl)
+	client := setupClient(t, mockService)
+
+	cursor := query.Cursor{
+		Sort:   query.Sort{{Column: "created_at", Desc: true}},
+		Values: []any{testUser.CreatedAt},
+		ID:     testUser.ID,
+	}.Encode()
+
+	tests := map[string]struct {
+		request       *pb.ListUsersRequest
+		mockSetup     func()
+		expectedCode  codes.Code
+		checkResponse func(t *testing.T, res *pb.ListUsersResponse)
+	}{
+		"fail by query error": {
+			request:      &pb.ListUsersRequest{Page: -1},
+			expectedCode: codes.InvalidArgument,
+		},
+		"fail by fields": {
+			request: &pb.ListUsersRequest{
+				Filters: map[string]*pb.FilterValues{"fields": {Values: []string{"id,email"}}},
+			},
+			expectedCode: codes.InvalidArgument,
+		},
+		"fail by unsupported filter": {
+			request: &pb.ListUsersRequest{
+				Filters: map[string]*pb.FilterValues{"a": {Values: []string{"b"}}},
+			},
+			expectedCode: codes.InvalidArgument,
+		},
+		"fail by service": {
+			request: &pb.ListUsersRequest{Page: 1, PageSize: 10},
+			mockSetup: func() {
+				mockService.EXPECT().ListUsers(gomock.Any(), gomock.Any()).Return(nil, errTest)
+			},
+			expectedCode: codes.Internal,
+		},
+		"success": {
+			request: &pb.ListUsersRequest{
+				Page:     1,
+				PageSize: 10,
+				Filters:  map[string]*pb.FilterValues{"country": {Values: []string{"ES", "GB"}}},
+			},
+			mockSetup: func() {
+				mockService.EXPECT().ListUsers(gomock.Any(), query.Query{
+					Page:         1,
+					PageSize:     10,
+					SortBy:       "created_at",
+					SortOrder:    "desc",
+					IncludeTotal: query.TotalExact,
+					Filters: query.Filters{
+						{Column: "country", Operator: query.OpIn, Values: []any{"ES", "GB"}},
+					},
+				}).Return(&query.PaginationResponse[user.User]{
+					Page:         1,
+					PageSize:     10,
+					TotalRecords: 1,
+					TotalMode:    query.TotalExact,
+					SortBy:       "created_at",
+					SortOrder:    "desc",
+					Filters:      map[string][]string{"country": {"ES", "GB"}},
+					Data:         []user.User{testUser},
+				}, nil)
+			},
+			expectedCode: codes.OK,
+			checkResponse: func(t *testing.T, res *pb.ListUsersResponse) {
+				require.NotNil(t, res.TotalRecords)
+				assert.EqualValues(t, 1, res.GetTotalRecords())
+				assert.Equal(t, string(query.TotalExact), res.GetTotalMode())
+				assert.Len(t, res.GetData(), 1)
+				assert.Equal(t, []string{"ES", "GB"}, res.GetFilters()["country"].GetValues())
+				assert.Empty(t, res.GetNextCursor())
+			},
+		},
+		"success with cursor": {
+			request: &pb.ListUsersRequest{PageSize: 1, Cursor: cursor},
+			mockSetup: func() {
+				mockService.EXPECT().ListUsers(gomock.Any(), gomock.Cond(func(q query.Query) bool {
+					return q.Cursor != nil && q.Cursor.ID == testUser.ID
+				})).Return(&query.PaginationResponse[user.User]{
+					PageSize:   1,
+					NextCursor: "next",
+					Data:       []user.User{testUser},
+				}, nil)
+			},
+			expectedCode: codes.OK,
+			checkResponse: func(t *testing.T, res *pb.ListUsersResponse) {
+				assert.Len(t, res.GetData(), 1)
+				assert.Equal(t, "next", res.GetNextCursor())
+			},
+		},
+		"success with estimated total": {
+			request: &pb.ListUsersRequest{IncludeTotal: "estimate"},
+			mockSetup: func() {
+				mockService.EXPECT().ListUsers(gomock.Any(), gomock.Cond(func(q query.Query) bool {
+					return q.IncludeTotal == query.TotalEstimate
+				})).Return(&query.PaginationResponse[user.User]{
+					TotalRecords: 100,
+					TotalMode:    query.TotalEstimate,
+				}, nil)
+			},
+			expectedCode: codes.OK,
+			checkResponse: func(t *testing.T, res *pb.ListUsersResponse) {
+				require.NotNil(t, res.TotalRecords)
+				assert.EqualValues(t, 100, res.GetTotalRecords())
+				assert.Equal(t, string(query.TotalEstimate), res.GetTotalMode())
+			},
+		},
+		"success without total": {
+			request: &pb.ListUsersRequest{IncludeTotal: "false"},
+			mockSetup: func() {
+				mockService.EXPECT().ListUsers(gomock.Any(), gomock.Cond(func(q query.Query) bool {
+					return q.IncludeTotal == query.TotalNone
+				})).Return(&query.PaginationResponse[user.User]{
+					TotalMode: query.TotalNone,
+				}, nil)
+			},
+			expectedCode: codes.OK,
+			checkResponse: func(t *testing.T, res *pb.ListUsersResponse) {
+				assert.Nil(t, res.TotalRecords)
+				assert.Equal(t, string(query.TotalNone), res.GetTotalMode())
+			},
+		},
+		"fail by invalid include_total": {
+			request:      &pb.ListUsersRequest{IncludeTotal: "maybe"},
+			expectedCode: codes.InvalidArgument,
+		},
+		"fail by cursor with page": {
+			request:      &pb.ListUsersRequest{Page: 2, Cursor: cursor},
+			expectedCode: codes.InvalidArgument,
+		},
+		"fail by invalid cursor": {
+			request:      &pb.ListUsersRequest{Cursor: "invalid"},
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if tt.mockSetup != nil {
+				tt.mockSetup()
+			}
+
+			res, err := client.ListUsers(context.Background(), tt.request)
+
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+			if tt.checkResponse != nil {
+				tt.checkResponse(t, res)
+			}
+		})
+	}
+}
+
+func TestTracingIDPropagation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockService := mocks.NewMockService(ctrl)
+	client := setupClient(t, mockService)
+
+	traceID := uuid.NewString()
+	mockService.EXPECT().GetUser(gomock.Any(), testUser.ID, gomock.Nil()).DoAndReturn(func(ctx context.Context, _ uuid.UUID, _ []string) (*user.User, error) {
+		tracingID, ok := tracing.FromContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, traceID, tracingID)
+		return &testUser, nil
+	})
+
+	var header metadata.MD
+	ctx := tracing.ContextWithTracingID(context.Background(), traceID)
+	_, err := client.GetUser(ctx, &pb.GetUserRequest{Id: testUser.ID.String()}, grpc.Header(&header))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{traceID}, header.Get(tracing.TracingIDMetadataKey))
+}
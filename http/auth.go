@@ -0,0 +1,156 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zechao/faceit-user-svc/auth"
+	"github.com/zechao/faceit-user-svc/errors"
+)
+
+type AuthHandler struct {
+	service auth.Service
+}
+
+func NewAuthHandler(service auth.Service) *AuthHandler {
+	return &AuthHandler{
+		service: service,
+	}
+}
+
+func (h *AuthHandler) RegisterRoutes(router *gin.Engine) {
+	router.POST("/auth/login", h.Login)
+	router.POST("/auth/refresh", h.Refresh)
+	router.POST("/auth/logout", h.Logout)
+}
+
+// Login checks the email and password of the user and returns a new access token and refresh token.
+func (h *AuthHandler) Login(ctx *gin.Context) {
+	var req LoginRequest
+	err := json.NewDecoder(ctx.Request.Body).Decode(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errors.ErrInvalidPayload)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		handlerError(ctx, err)
+		return
+	}
+
+	tokens, err := h.service.Login(ctx.Request.Context(), req.Email, req.Password)
+	if err != nil {
+		handlerError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, newTokenResponse(tokens))
+}
+
+// Refresh exchanges a refresh token for a new access token and refresh token, the used refresh token is revoked.
+func (h *AuthHandler) Refresh(ctx *gin.Context) {
+	var req RefreshTokenRequest
+	err := json.NewDecoder(ctx.Request.Body).Decode(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errors.ErrInvalidPayload)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		handlerError(ctx, err)
+		return
+	}
+
+	tokens, err := h.service.Refresh(ctx.Request.Context(), req.RefreshToken)
+	if err != nil {
+		handlerError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, newTokenResponse(tokens))
+}
+
+// Logout revokes the refresh token, the access tokens issued with it are rejected by the authenticator from then on.
+func (h *AuthHandler) Logout(ctx *gin.Context) {
+	var req RefreshTokenRequest
+	err := json.NewDecoder(ctx.Request.Body).Decode(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errors.ErrInvalidPayload)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		handlerError(ctx, err)
+		return
+	}
+
+	err = h.service.Logout(ctx.Request.Context(), req.RefreshToken)
+	if err != nil {
+		handlerError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// LoginRequest represents the request format for login.
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// Validate validates the fields of a LoginRequest. It returns an error if any field is invalid.
+func (r LoginRequest) Validate() error {
+	details := []errors.Detail{}
+	if r.Email == "" {
+		details = append(details, errors.Detail{
+			Field:       "email",
+			Description: "email is required",
+		})
+	}
+
+	if r.Password == "" {
+		details = append(details, errors.Detail{
+			Field:       "password",
+			Description: "password is required",
+		})
+	}
+
+	if len(details) > 0 {
+		return errors.NewWrongInput("invalid login request", details...)
+	}
+	return nil
+}
+
+// RefreshTokenRequest represents the request format for refresh and logout.
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Validate validates the fields of a RefreshTokenRequest. It returns an error if any field is invalid.
+func (r RefreshTokenRequest) Validate() error {
+	if r.RefreshToken == "" {
+		return errors.NewWrongInput("invalid refresh token request", errors.Detail{
+			Field:       "refresh_token",
+			Description: "refresh_token is required",
+		})
+	}
+	return nil
+}
+
+// TokenResponse represents the response format of login and refresh.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// newTokenResponse maps the token pair to its response format, expires_in is in seconds as in OAuth 2.0.
+func newTokenResponse(tokens *auth.TokenPair) *TokenResponse {
+	return &TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    auth.TokenType,
+		ExpiresIn:    int64(time.Until(tokens.ExpiresAt).Seconds()),
+		RefreshToken: tokens.RefreshToken,
+	}
+}
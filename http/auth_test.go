@@ -0,0 +1,304 @@
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zechao/faceit-user-svc/auth"
+	mockAuth "github.com/zechao/faceit-user-svc/auth/mocks"
+	"github.com/zechao/faceit-user-svc/errors"
+	api "github.com/zechao/faceit-user-svc/http"
+	"github.com/zechao/faceit-user-svc/service"
+	"github.com/zechao/faceit-user-svc/user"
+	"github.com/zechao/faceit-user-svc/user/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+var testTokenPair = auth.TokenPair{
+	AccessToken:  "access-token",
+	RefreshToken: "refresh-token",
+	ExpiresAt:    time.Now().Add(15 * time.Minute),
+}
+
+func TestLogin(t *testing.T) {
+	router := setupRouter()
+	ctrl := gomock.NewController(t)
+	mockService := mockAuth.NewMockService(ctrl)
+	api.NewAuthHandler(mockService).RegisterRoutes(router)
+
+	tests := map[string]struct {
+		requestBody    string
+		mockSetup      func()
+		expectedStatus int
+	}{
+		"fail by payload error": {
+			requestBody:    "invalid payload",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"fail by validation error": {
+			requestBody:    `{"email":"john.doe@example.com"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"fail by wrong password": {
+			requestBody: `{"email":"john.doe@example.com","password":"wrongpassword"}`,
+			mockSetup: func() {
+				mockService.EXPECT().Login(gomock.Any(), "john.doe@example.com", "wrongpassword").Return(nil, auth.ErrInvalidCredentials)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"fail by service error": {
+			requestBody: `{"email":"john.doe@example.com","password":"securepassword123"}`,
+			mockSetup: func() {
+				mockService.EXPECT().Login(gomock.Any(), "john.doe@example.com", "securepassword123").Return(nil, errTest)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		"success valid request": {
+			requestBody: `{"email":"john.doe@example.com","password":"securepassword123"}`,
+			mockSetup: func() {
+				mockService.EXPECT().Login(gomock.Any(), "john.doe@example.com", "securepassword123").Return(&testTokenPair, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(tt.requestBody))
+			assert.NoError(t, err)
+
+			if tt.mockSetup != nil {
+				tt.mockSetup()
+			}
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var res api.TokenResponse
+				assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+				assert.Equal(t, testTokenPair.AccessToken, res.AccessToken)
+				assert.Equal(t, testTokenPair.RefreshToken, res.RefreshToken)
+				assert.Equal(t, "Bearer", res.TokenType)
+				assert.InDelta(t, 15*60, res.ExpiresIn, 5)
+			}
+		})
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	router := setupRouter()
+	ctrl := gomock.NewController(t)
+	mockService := mockAuth.NewMockService(ctrl)
+	api.NewAuthHandler(mockService).RegisterRoutes(router)
+
+	tests := map[string]struct {
+		requestBody    string
+		mockSetup      func()
+		expectedStatus int
+	}{
+		"fail by payload error": {
+			requestBody:    "invalid payload",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"fail by missing refresh token": {
+			requestBody:    `{}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"fail by expired token": {
+			requestBody: `{"refresh_token":"expired"}`,
+			mockSetup: func() {
+				mockService.EXPECT().Refresh(gomock.Any(), "expired").Return(nil, auth.ErrInvalidToken)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"success valid request": {
+			requestBody: `{"refresh_token":"refresh-token"}`,
+			mockSetup: func() {
+				mockService.EXPECT().Refresh(gomock.Any(), "refresh-token").Return(&testTokenPair, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/auth/refresh", strings.NewReader(tt.requestBody))
+			assert.NoError(t, err)
+
+			if tt.mockSetup != nil {
+				tt.mockSetup()
+			}
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	router := setupRouter()
+	ctrl := gomock.NewController(t)
+	mockService := mockAuth.NewMockService(ctrl)
+	api.NewAuthHandler(mockService).RegisterRoutes(router)
+
+	tests := map[string]struct {
+		requestBody    string
+		mockSetup      func()
+		expectedStatus int
+	}{
+		"fail by payload error": {
+			requestBody:    "invalid payload",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"fail by missing refresh token": {
+			requestBody:    `{}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"fail by revoked token": {
+			requestBody: `{"refresh_token":"revoked"}`,
+			mockSetup: func() {
+				mockService.EXPECT().Logout(gomock.Any(), "revoked").Return(auth.ErrInvalidToken)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"success valid request": {
+			requestBody: `{"refresh_token":"refresh-token"}`,
+			mockSetup: func() {
+				mockService.EXPECT().Logout(gomock.Any(), "refresh-token").Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/auth/logout", strings.NewReader(tt.requestBody))
+			assert.NoError(t, err)
+
+			if tt.mockSetup != nil {
+				tt.mockSetup()
+			}
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+		})
+	}
+}
+
+// memoryTokenRepository is an auth.Repository keeping the refresh tokens in memory.
+type memoryTokenRepository struct {
+	mu     sync.Mutex
+	tokens map[uuid.UUID]auth.RefreshToken
+}
+
+func (r *memoryTokenRepository) CreateRefreshToken(_ context.Context, t *auth.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens[t.ID] = *t
+	return nil
+}
+
+func (r *memoryTokenRepository) GetRefreshTokenByHash(_ context.Context, hash string) (*auth.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.tokens {
+		if t.TokenHash == hash {
+			return &t, nil
+		}
+	}
+	return nil, errors.ErrNotfound
+}
+
+func (r *memoryTokenRepository) RevokeRefreshToken(_ context.Context, id uuid.UUID, revokedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.tokens[id]
+	if !ok || t.RevokedAt != nil {
+		return errors.ErrNotfound
+	}
+	t.RevokedAt = &revokedAt
+	r.tokens[id] = t
+	return nil
+}
+
+func (r *memoryTokenRepository) SessionActive(_ context.Context, id uuid.UUID, now time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.tokens[id]
+	return ok && t.Active(now), nil
+}
+
+func TestLogoutRevokesAccessToken(t *testing.T) {
+	tokenRepo := &memoryTokenRepository{tokens: map[uuid.UUID]auth.RefreshToken{}}
+	issuer, err := auth.NewTokenIssuer(auth.IssuerConfig{
+		Issuer:        "user-svc",
+		SigningMethod: "HS256",
+		SigningKey:    testSigningKey,
+		TTL:           15 * time.Minute,
+	})
+	require.NoError(t, err)
+	authenticator, err := auth.NewAuthenticator(auth.AuthenticatorConfig{
+		Issuer:     "user-svc",
+		SigningKey: testSigningKey,
+		Sessions:   tokenRepo,
+	})
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	userRepo := mocks.NewMockRepository(ctrl)
+	mockService := mocks.NewMockService(ctrl)
+	password, err := user.HashPassword("securepassword123")
+	require.NoError(t, err)
+	u := testUser
+	u.Password = password
+	userRepo.EXPECT().GetUserByEmail(gomock.Any(), u.Email).Return(&u, nil)
+	mockService.EXPECT().GetUser(gomock.Any(), u.ID, gomock.Nil()).Return(&testUser, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(api.AuthenticationMiddleware(authenticator))
+	api.NewAuthHandler(service.NewAuthService(userRepo, tokenRepo, nil, issuer, time.Hour)).RegisterRoutes(router)
+	api.NewUserHandler(mockService).RegisterRoutes(router)
+
+	serve := func(method, path, body, token string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := serve(http.MethodPost, "/auth/login", `{"email":"`+u.Email+`","password":"securepassword123"}`, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var tokens api.TokenResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &tokens))
+
+	recorder = serve(http.MethodGet, "/users/"+u.ID.String(), "", tokens.AccessToken)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = serve(http.MethodPost, "/auth/logout", `{"refresh_token":"`+tokens.RefreshToken+`"}`, "")
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+
+	// the access token issued with the revoked refresh token is rejected
+	recorder = serve(http.MethodGet, "/users/"+u.ID.String(), "", tokens.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
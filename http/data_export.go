@@ -0,0 +1,111 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/zechao/faceit-user-svc/user"
+)
+
+type DataExportHandler struct {
+	service user.DataExportService
+}
+
+func NewDataExportHandler(service user.DataExportService) *DataExportHandler {
+	return &DataExportHandler{
+		service: service,
+	}
+}
+
+// RegisterRoutes registers the data export routes, the caller identity must be set by AuthenticationMiddleware.
+// Users can export their own data, admins the data of any user.
+func (h *DataExportHandler) RegisterRoutes(router *gin.Engine) {
+	router.GET("/users/:id/export", authorize(self("id"), admin()), h.ExportUserData)
+}
+
+// ExportUserData returns everything held about the user as a JSON document, soft deleted users included.
+// It's sent as an attachment, the password hash is never part of it.
+func (h *DataExportHandler) ExportUserData(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, ErrorInvalidUserID)
+		return
+	}
+
+	export, err := h.service.ExportUserData(ctx.Request.Context(), id)
+	if err != nil {
+		handlerError(ctx, err)
+		return
+	}
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%s.json"`, id))
+	ctx.JSON(http.StatusOK, newDataExportResponse(export))
+}
+
+// DataExportResponse represents the response format of the data export of a user.
+type DataExportResponse struct {
+	User       *UserResponse     `json:"user"`
+	Version    int64             `json:"version"`
+	Deleted    bool              `json:"deleted"`
+	DeletedAt  *time.Time        `json:"deleted_at"`
+	Sessions   []SessionResponse `json:"sessions"`
+	Events     []EventResponse   `json:"events"`
+	History    []AuditResponse   `json:"history"`
+	ExportedAt time.Time         `json:"exported_at"`
+}
+
+// SessionResponse represents a refresh token issued to the user.
+type SessionResponse struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// EventResponse represents an event sent about the user.
+type EventResponse struct {
+	ID        uuid.UUID       `json:"id"`
+	EventType string          `json:"event_type"`
+	TraceID   string          `json:"trace_id"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+	SentAt    *time.Time      `json:"sent_at"`
+}
+
+// newDataExportResponse maps the data export to its response format.
+func newDataExportResponse(e *user.DataExport) *DataExportResponse {
+	res := &DataExportResponse{
+		User:       newUserResponse(&e.User),
+		Version:    e.User.Version,
+		Deleted:    e.User.DeletedAt.Valid,
+		Sessions:   make([]SessionResponse, len(e.Sessions)),
+		Events:     make([]EventResponse, len(e.Events)),
+		History:    newAuditResponses(e.Audit),
+		ExportedAt: e.ExportedAt,
+	}
+	if e.User.DeletedAt.Valid {
+		res.DeletedAt = &e.User.DeletedAt.Time
+	}
+	for i, s := range e.Sessions {
+		res.Sessions[i] = SessionResponse{
+			ID:        s.ID,
+			CreatedAt: s.CreatedAt,
+			ExpiresAt: s.ExpiresAt,
+			RevokedAt: s.RevokedAt,
+		}
+	}
+	for i, ev := range e.Events {
+		res.Events[i] = EventResponse{
+			ID:        ev.ID,
+			EventType: ev.EventType,
+			TraceID:   ev.TraceID,
+			Payload:   ev.Payload,
+			CreatedAt: ev.CreatedAt,
+			SentAt:    ev.SentAt,
+		}
+	}
+	return res
+}
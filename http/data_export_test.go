@@ -0,0 +1,120 @@
+package http_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/zechao/faceit-user-svc/errors"
+	api "github.com/zechao/faceit-user-svc/http"
+	"github.com/zechao/faceit-user-svc/user"
+	"github.com/zechao/faceit-user-svc/user/mocks"
+	"go.uber.org/mock/gomock"
+	"gorm.io/gorm"
+)
+
+func TestExportUserData(t *testing.T) {
+	router := setupRouter()
+	ctrl := gomock.NewController(t)
+	// the user routes are registered too, /users/:id/export must not conflict with them
+	api.NewUserHandler(mocks.NewMockService(ctrl)).RegisterRoutes(router)
+	mockService := mocks.NewMockDataExportService(ctrl)
+	api.NewDataExportHandler(mockService).RegisterRoutes(router)
+
+	ts := time.Date(2025, 2, 28, 14, 22, 16, 0, time.UTC)
+	deleted := testUser
+	deleted.Password = "hashedpassword"
+	deleted.Version = 2
+	deleted.CreatedAt = ts
+	deleted.UpdatedAt = ts
+	deleted.DeletedAt = gorm.DeletedAt{Time: ts, Valid: true}
+	sessionID := uuid.MustParse("0c357f95-1e88-4015-b011-9caa658cb1fe")
+	eventID := uuid.MustParse("a797919d-3cf1-47ff-9bf2-b0650cee9817")
+
+	tests := map[string]struct {
+		id             string
+		mockSetup      func()
+		expectedStatus int
+		expectedBody   string
+	}{
+		"fail by wrong id": {
+			id:             "wrong id",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"fail by not found": {
+			id: testUser.ID.String(),
+			mockSetup: func() {
+				mockService.EXPECT().ExportUserData(gomock.Any(), testUser.ID).Return(nil, errors.ErrNotfound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		"fail by service error": {
+			id: testUser.ID.String(),
+			mockSetup: func() {
+				mockService.EXPECT().ExportUserData(gomock.Any(), testUser.ID).Return(nil, errTest)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		"success deleted user": {
+			id: testUser.ID.String(),
+			mockSetup: func() {
+				mockService.EXPECT().ExportUserData(gomock.Any(), testUser.ID).Return(&user.DataExport{
+					User: deleted,
+					Sessions: []user.Session{
+						{ID: sessionID, CreatedAt: ts, ExpiresAt: ts.Add(time.Hour), RevokedAt: &ts},
+					},
+					Events: []user.EventRecord{
+						{ID: eventID, EventType: "UserDeleted", TraceID: "trace", Payload: json.RawMessage(`{"id":"1"}`), CreatedAt: ts},
+					},
+					Audit: []user.AuditEntry{
+						{ID: eventID, UserID: testUser.ID, Operation: user.AuditDelete, ActorKind: "user", ActorID: testUser.ID.String(), TraceID: "trace", CreatedAt: ts},
+					},
+					ExportedAt: ts,
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: `{
+				"user": {"id":"` + testUser.ID.String() + `","first_name":"` + testUser.FirstName + `",
+					"last_name":"` + testUser.LastName + `","nick_name":"` + testUser.NickName + `",
+					"email":"` + testUser.Email + `","country":"` + testUser.Country + `",
+					"created_at":"2025-02-28T14:22:16Z","updated_at":"2025-02-28T14:22:16Z"},
+				"version": 2,
+				"deleted": true,
+				"deleted_at": "2025-02-28T14:22:16Z",
+				"sessions": [{"id":"0c357f95-1e88-4015-b011-9caa658cb1fe","created_at":"2025-02-28T14:22:16Z",
+					"expires_at":"2025-02-28T15:22:16Z","revoked_at":"2025-02-28T14:22:16Z"}],
+				"events": [{"id":"a797919d-3cf1-47ff-9bf2-b0650cee9817","event_type":"UserDeleted","trace_id":"trace",
+					"payload":{"id":"1"},"created_at":"2025-02-28T14:22:16Z","sent_at":null}],
+				"history": [{"id":"a797919d-3cf1-47ff-9bf2-b0650cee9817","operation":"delete",
+					"actor":{"kind":"user","id":"` + testUser.ID.String() + `"},"trace_id":"trace","changes":[],
+					"created_at":"2025-02-28T14:22:16Z"}],
+				"exported_at": "2025-02-28T14:22:16Z"
+			}`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, "/users/"+tt.id+"/export", nil)
+			assert.NoError(t, err)
+
+			if tt.mockSetup != nil {
+				tt.mockSetup()
+			}
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, recorder.Body.String())
+				assert.NotContains(t, recorder.Body.String(), "hashedpassword")
+				assert.Equal(t, `attachment; filename="user-`+tt.id+`.json"`, recorder.Header().Get("Content-Disposition"))
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package http
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zechao/faceit-user-svc/log"
+	"github.com/zechao/faceit-user-svc/query"
+	"github.com/zechao/faceit-user-svc/user"
+)
+
+// exportContentTypes are the content types of the export formats.
+var exportContentTypes = map[query.ExportFormat]string{
+	query.FormatNDJSON: "application/x-ndjson",
+	query.FormatCSV:    "text/csv",
+}
+
+// ExportUsers streams every user matching the filters as NDJSON or CSV, without the passwords.
+// The users are written while they are read, so once the first user is written the status can't
+// change anymore: a failure or a cancellation after that ends the stream early and is logged.
+func (h *UserHandler) ExportUsers(ctx *gin.Context) {
+	export, err := query.ExportFromURL(ctx.Request.URL.Query())
+	if err != nil {
+		handlerError(ctx, err)
+		return
+	}
+
+	ctx.Header("Content-Type", exportContentTypes[export.Format])
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="users.%s"`, export.Format))
+	w := newExportWriter(ctx.Writer, export.Format, export.Fields)
+	err = h.service.ExportUsers(ctx.Request.Context(), *export, w.write)
+	if err == nil {
+		err = w.close()
+	}
+	if err != nil {
+		if !ctx.Writer.Written() {
+			// nothing was streamed yet, the error is returned as JSON instead of the export
+			ctx.Writer.Header().Del("Content-Type")
+			ctx.Writer.Header().Del("Content-Disposition")
+			handlerError(ctx, err)
+			return
+		}
+		log.Error(ctx.Request.Context(), "failed to export users", slog.Any("error", err))
+		ctx.Abort()
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+// exportWriter encodes the exported users in the format of the export.
+type exportWriter struct {
+	format query.ExportFormat
+	// fields is the sparse fieldset, empty for all the fields
+	fields []string
+	json   *json.Encoder
+	csv    *csv.Writer
+	header bool
+}
+
+func newExportWriter(w io.Writer, format query.ExportFormat, fields []string) *exportWriter {
+	return &exportWriter{
+		format: format,
+		fields: fields,
+		json:   json.NewEncoder(w),
+		csv:    csv.NewWriter(w),
+	}
+}
+
+// columns returns the CSV columns, the fields of the sparse fieldset or all the response fields.
+func (w *exportWriter) columns() []string {
+	if len(w.fields) == 0 {
+		return query.ResponseFields
+	}
+	return w.fields
+}
+
+// write writes the user, the CSV header is written before the first user.
+func (w *exportWriter) write(u *user.User) error {
+	if w.format == query.FormatNDJSON {
+		res := newUserResponse(u)
+		res.fields = w.fields
+		return w.json.Encode(res)
+	}
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	columns := w.columns()
+	record := make([]string, len(columns))
+	for i, f := range columns {
+		switch v := u.FieldValue(f).(type) {
+		case time.Time:
+			record[i] = v.Format(time.RFC3339Nano)
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return w.csv.Write(record)
+}
+
+// writeHeader writes the CSV header once.
+func (w *exportWriter) writeHeader() error {
+	if w.header {
+		return nil
+	}
+	w.header = true
+	return w.csv.Write(w.columns())
+}
+
+// close writes the buffered rows, and the CSV header if there wasn't any user.
+func (w *exportWriter) close() error {
+	if w.format == query.FormatNDJSON {
+		return nil
+	}
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
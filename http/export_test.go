@@ -0,0 +1,125 @@
+package http_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zechao/faceit-user-svc/errors"
+	api "github.com/zechao/faceit-user-svc/http"
+	"github.com/zechao/faceit-user-svc/query"
+	"github.com/zechao/faceit-user-svc/user"
+	"github.com/zechao/faceit-user-svc/user/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestExportUsers(t *testing.T) {
+	router := setupRouter()
+	ctrl := gomock.NewController(t)
+	mockService := mocks.NewMockService(ctrl)
+	handler := api.NewUserHandler(mockService)
+	handler.RegisterRoutes(router)
+
+	exported := testUser
+	exported.CreatedAt = time.Date(2025, 2, 28, 14, 22, 16, 0, time.UTC)
+	exported.UpdatedAt = exported.CreatedAt
+	// export calls fn with the users, as the repository does
+	export := func(users ...user.User) func(context.Context, query.Export, func(*user.User) error) error {
+		return func(_ context.Context, _ query.Export, fn func(*user.User) error) error {
+			for i := range users {
+				if err := fn(&users[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	tests := map[string]struct {
+		params              string
+		mockSetup           func()
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        string
+	}{
+		"fail by invalid format": {
+			params:         "format=xml",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"fail by service before streaming": {
+			params: "format=csv",
+			mockSetup: func() {
+				mockService.EXPECT().ExportUsers(gomock.Any(), gomock.Any(), gomock.Any()).Return(errTest)
+			},
+			expectedStatus:      http.StatusInternalServerError,
+			expectedContentType: "application/json; charset=utf-8",
+		},
+		"fail by invalid payload": {
+			mockSetup: func() {
+				mockService.EXPECT().ExportUsers(gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.ErrInvalidPayload)
+			},
+			expectedStatus:      http.StatusBadRequest,
+			expectedContentType: "application/json; charset=utf-8",
+		},
+		"success ndjson": {
+			params: "country=ES&fields=id,nick_name",
+			mockSetup: func() {
+				mockService.EXPECT().ExportUsers(gomock.Any(), query.Export{
+					Format:  query.FormatNDJSON,
+					Sort:    query.Sort{{Column: "created_at", Desc: true}, {Column: "id", Desc: true}},
+					Filters: query.Filters{{Column: "country", Operator: query.OpIn, Values: []any{"ES"}}},
+					Fields:  []string{"id", "nick_name"},
+				}, gomock.Any()).DoAndReturn(export(exported, exported))
+			},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/x-ndjson",
+			expectedBody: `{"id":"` + exported.ID.String() + `","nick_name":"AB123"}` + "\n" +
+				`{"id":"` + exported.ID.String() + `","nick_name":"AB123"}` + "\n",
+		},
+		"success csv": {
+			params: "format=csv",
+			mockSetup: func() {
+				mockService.EXPECT().ExportUsers(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(export(exported))
+			},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/csv",
+			expectedBody: "id,first_name,last_name,nick_name,email,country,created_at,updated_at\n" +
+				exported.ID.String() + ",John,Doe,AB123,john.doe@example.com,ES,2025-02-28T14:22:16Z,2025-02-28T14:22:16Z\n",
+		},
+		"success empty csv": {
+			params: "format=csv&fields=email",
+			mockSetup: func() {
+				mockService.EXPECT().ExportUsers(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(export())
+			},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/csv",
+			expectedBody:        "email\n",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, "/users/export?"+tt.params, nil)
+			assert.NoError(t, err)
+
+			if tt.mockSetup != nil {
+				tt.mockSetup()
+			}
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			if tt.expectedContentType != "" {
+				assert.Equal(t, tt.expectedContentType, recorder.Header().Get("Content-Type"))
+			}
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, recorder.Body.String())
+			}
+			assert.NotContains(t, recorder.Body.String(), testUser.Password)
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zechao/faceit-user-svc/auth"
+	"github.com/zechao/faceit-user-svc/errors"
+)
+
+const (
+	// AuthorizationHeader carries the access token of the users as Bearer token.
+	AuthorizationHeader = "Authorization"
+	// APIKeyHeader carries the API key of the services.
+	APIKeyHeader = "X-API-Key"
+)
+
+var (
+	ErrAuthenticationRequired = errors.NewUnauthorized("authentication required")
+	ErrForbidden              = errors.NewForbidden("not allowed to perform this operation")
+)
+
+// AuthenticationMiddleware is a Gin middleware that authenticates the caller by bearer token or API key,
+// and sets its identity in the request context. Requests without credentials continue anonymously,
+// the routes requiring a caller reject them, but requests with invalid credentials are rejected here.
+func AuthenticationMiddleware(authenticator *auth.Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var identity *auth.Identity
+		var err error
+		switch {
+		case c.GetHeader(AuthorizationHeader) != "":
+			token, ok := strings.CutPrefix(c.GetHeader(AuthorizationHeader), auth.TokenType+" ")
+			if !ok {
+				err = auth.ErrInvalidToken
+				break
+			}
+			identity, err = authenticator.AuthenticateToken(c.Request.Context(), token)
+		case c.GetHeader(APIKeyHeader) != "":
+			identity, err = authenticator.AuthenticateAPIKey(c.GetHeader(APIKeyHeader))
+		default:
+			c.Next()
+			return
+		}
+		if err != nil {
+			handlerError(c, err)
+			c.Abort()
+			return
+		}
+
+		c.Request = c.Request.WithContext(auth.ContextWithIdentity(c.Request.Context(), identity))
+		c.Next()
+	}
+}
+
+// rule tells whether the identity is allowed to perform the request.
+type rule func(c *gin.Context, identity *auth.Identity) bool
+
+// authorize returns a middleware that rejects the anonymous requests, and the requests
+// whose caller is not allowed by any of the rules.
+func authorize(rules ...rule) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity, ok := auth.IdentityFromContext(c.Request.Context())
+		if !ok {
+			handlerError(c, ErrAuthenticationRequired)
+			c.Abort()
+			return
+		}
+		for _, allowed := range rules {
+			if allowed(c, identity) {
+				c.Next()
+				return
+			}
+		}
+		handlerError(c, ErrForbidden)
+		c.Abort()
+	}
+}
+
+// self allows the users to act on themselves, the user ID is taken from the path parameter.
+func self(param string) rule {
+	return func(c *gin.Context, identity *auth.Identity) bool {
+		return identity.IsUser(c.Param(param))
+	}
+}
+
+// admin allows the callers with the admin role or scope.
+func admin() rule {
+	return func(_ *gin.Context, identity *auth.Identity) bool {
+		return identity.IsAdmin()
+	}
+}
+
+// scope allows the callers with any of the scopes.
+func scope(scopes ...string) rule {
+	return func(_ *gin.Context, identity *auth.Identity) bool {
+		return identity.HasScope(scopes...)
+	}
+}
@@ -0,0 +1,285 @@
+package http_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zechao/faceit-user-svc/auth"
+	api "github.com/zechao/faceit-user-svc/http"
+	"github.com/zechao/faceit-user-svc/query"
+	"github.com/zechao/faceit-user-svc/user"
+	"github.com/zechao/faceit-user-svc/user/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+const testSigningKey = "test-signing-key-with-32-characters!"
+
+func signTestToken(t *testing.T, subject string, roles ...string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "user-svc",
+			Subject:   subject,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+		Roles: roles,
+	})
+	signed, err := token.SignedString([]byte(testSigningKey))
+	require.NoError(t, err)
+	return signed
+}
+
+func TestAuthorization(t *testing.T) {
+	authenticator, err := auth.NewAuthenticator(auth.AuthenticatorConfig{
+		Issuer:     "user-svc",
+		SigningKey: testSigningKey,
+		APIKeys: []auth.APIKey{
+			{Name: "billing", Key: "billing-key", Scopes: []string{auth.ScopeService}},
+			{Name: "metrics", Key: "metrics-key"},
+		},
+	})
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(api.AuthenticationMiddleware(authenticator))
+	ctrl := gomock.NewController(t)
+	mockService := mocks.NewMockService(ctrl)
+	api.NewUserHandler(mockService).RegisterRoutes(router)
+	mockExportService := mocks.NewMockDataExportService(ctrl)
+	api.NewDataExportHandler(mockExportService).RegisterRoutes(router)
+
+	userID := uuid.New()
+	otherID := uuid.New()
+	userToken := "Bearer " + signTestToken(t, userID.String())
+	adminToken := "Bearer " + signTestToken(t, uuid.NewString(), auth.RoleAdmin)
+
+	expectDelete := func(id uuid.UUID) func() {
+		return func() {
+			mockService.EXPECT().DeleteUser(gomock.Any(), id, gomock.Nil()).Return(nil)
+		}
+	}
+	expectExport := func(id uuid.UUID) func() {
+		return func() {
+			mockExportService.EXPECT().ExportUserData(gomock.Any(), id).Return(&user.DataExport{User: testUser}, nil)
+		}
+	}
+	expectHistory := func(id uuid.UUID) func() {
+		return func() {
+			mockService.EXPECT().ListUserHistory(gomock.Any(), id, gomock.Any()).Return(&query.PaginationResponse[user.AuditEntry]{}, nil)
+		}
+	}
+	expectList := func() {
+		mockService.EXPECT().ListUsers(gomock.Any(), gomock.Any()).Return(&query.PaginationResponse[user.User]{
+			Data: []user.User{testUser},
+		}, nil)
+	}
+
+	tests := map[string]struct {
+		method         string
+		path           string
+		headers        map[string]string
+		mockSetup      func()
+		expectedStatus int
+	}{
+		"fail delete by anonymous": {
+			method:         http.MethodDelete,
+			path:           "/users/" + userID.String(),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"fail delete by invalid token": {
+			method:         http.MethodDelete,
+			path:           "/users/" + userID.String(),
+			headers:        map[string]string{api.AuthorizationHeader: "Bearer invalid"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"fail delete by token without Bearer prefix": {
+			method:         http.MethodDelete,
+			path:           "/users/" + userID.String(),
+			headers:        map[string]string{api.AuthorizationHeader: signTestToken(t, userID.String())},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"fail delete by unknown API key": {
+			method:         http.MethodDelete,
+			path:           "/users/" + userID.String(),
+			headers:        map[string]string{api.APIKeyHeader: "unknown"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"fail delete another user": {
+			method:         http.MethodDelete,
+			path:           "/users/" + otherID.String(),
+			headers:        map[string]string{api.AuthorizationHeader: userToken},
+			expectedStatus: http.StatusForbidden,
+		},
+		"fail delete by service": {
+			method:         http.MethodDelete,
+			path:           "/users/" + userID.String(),
+			headers:        map[string]string{api.APIKeyHeader: "billing-key"},
+			expectedStatus: http.StatusForbidden,
+		},
+		"success delete self": {
+			method:         http.MethodDelete,
+			path:           "/users/" + userID.String(),
+			headers:        map[string]string{api.AuthorizationHeader: userToken},
+			mockSetup:      expectDelete(userID),
+			expectedStatus: http.StatusOK,
+		},
+		"success delete another user by admin": {
+			method:         http.MethodDelete,
+			path:           "/users/" + otherID.String(),
+			headers:        map[string]string{api.AuthorizationHeader: adminToken},
+			mockSetup:      expectDelete(otherID),
+			expectedStatus: http.StatusOK,
+		},
+		"fail update another user": {
+			method:         http.MethodPatch,
+			path:           "/users/" + otherID.String(),
+			headers:        map[string]string{api.AuthorizationHeader: userToken},
+			expectedStatus: http.StatusForbidden,
+		},
+		"fail list by anonymous": {
+			method:         http.MethodGet,
+			path:           "/users",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"fail list by user": {
+			method:         http.MethodGet,
+			path:           "/users",
+			headers:        map[string]string{api.AuthorizationHeader: userToken},
+			expectedStatus: http.StatusForbidden,
+		},
+		"fail list by service without scope": {
+			method:         http.MethodGet,
+			path:           "/users",
+			headers:        map[string]string{api.APIKeyHeader: "metrics-key"},
+			expectedStatus: http.StatusForbidden,
+		},
+		"success list by service": {
+			method:         http.MethodGet,
+			path:           "/users",
+			headers:        map[string]string{api.APIKeyHeader: "billing-key"},
+			mockSetup:      expectList,
+			expectedStatus: http.StatusOK,
+		},
+		"success list by admin": {
+			method:         http.MethodGet,
+			path:           "/users",
+			headers:        map[string]string{api.AuthorizationHeader: adminToken},
+			mockSetup:      expectList,
+			expectedStatus: http.StatusOK,
+		},
+		"fail get another user": {
+			method:         http.MethodGet,
+			path:           "/users/" + otherID.String(),
+			headers:        map[string]string{api.AuthorizationHeader: userToken},
+			expectedStatus: http.StatusForbidden,
+		},
+		"fail restore self": {
+			method:         http.MethodPost,
+			path:           "/users/" + userID.String() + "/restore",
+			headers:        map[string]string{api.AuthorizationHeader: userToken},
+			expectedStatus: http.StatusForbidden,
+		},
+		"fail restore by service": {
+			method:         http.MethodPost,
+			path:           "/users/" + userID.String() + "/restore",
+			headers:        map[string]string{api.APIKeyHeader: "billing-key"},
+			expectedStatus: http.StatusForbidden,
+		},
+		"success restore by admin": {
+			method:  http.MethodPost,
+			path:    "/users/" + otherID.String() + "/restore",
+			headers: map[string]string{api.AuthorizationHeader: adminToken},
+			mockSetup: func() {
+				mockService.EXPECT().RestoreUser(gomock.Any(), otherID).Return(&testUser, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		"fail export another user": {
+			method:         http.MethodGet,
+			path:           "/users/" + otherID.String() + "/export",
+			headers:        map[string]string{api.AuthorizationHeader: userToken},
+			expectedStatus: http.StatusForbidden,
+		},
+		"fail export by service": {
+			method:         http.MethodGet,
+			path:           "/users/" + userID.String() + "/export",
+			headers:        map[string]string{api.APIKeyHeader: "billing-key"},
+			expectedStatus: http.StatusForbidden,
+		},
+		"success export self": {
+			method:         http.MethodGet,
+			path:           "/users/" + userID.String() + "/export",
+			headers:        map[string]string{api.AuthorizationHeader: userToken},
+			mockSetup:      expectExport(userID),
+			expectedStatus: http.StatusOK,
+		},
+		"success export another user by admin": {
+			method:         http.MethodGet,
+			path:           "/users/" + otherID.String() + "/export",
+			headers:        map[string]string{api.AuthorizationHeader: adminToken},
+			mockSetup:      expectExport(otherID),
+			expectedStatus: http.StatusOK,
+		},
+		"fail history of another user": {
+			method:         http.MethodGet,
+			path:           "/users/" + otherID.String() + "/history",
+			headers:        map[string]string{api.AuthorizationHeader: userToken},
+			expectedStatus: http.StatusForbidden,
+		},
+		"fail history by service": {
+			method:         http.MethodGet,
+			path:           "/users/" + userID.String() + "/history",
+			headers:        map[string]string{api.APIKeyHeader: "billing-key"},
+			expectedStatus: http.StatusForbidden,
+		},
+		"success history self": {
+			method:         http.MethodGet,
+			path:           "/users/" + userID.String() + "/history",
+			headers:        map[string]string{api.AuthorizationHeader: userToken},
+			mockSetup:      expectHistory(userID),
+			expectedStatus: http.StatusOK,
+		},
+		"success history of another user by admin": {
+			method:         http.MethodGet,
+			path:           "/users/" + otherID.String() + "/history",
+			headers:        map[string]string{api.AuthorizationHeader: adminToken},
+			mockSetup:      expectHistory(otherID),
+			expectedStatus: http.StatusOK,
+		},
+		"success get user by service": {
+			method:  http.MethodGet,
+			path:    "/users/" + otherID.String(),
+			headers: map[string]string{api.APIKeyHeader: "billing-key"},
+			mockSetup: func() {
+				mockService.EXPECT().GetUser(gomock.Any(), otherID, gomock.Nil()).Return(&testUser, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(tt.method, tt.path, nil)
+			assert.NoError(t, err)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			if tt.mockSetup != nil {
+				tt.mockSetup()
+			}
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+		})
+	}
+}
@@ -3,32 +3,67 @@ package http
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/zechao/faceit-user-svc/auth"
 	"github.com/zechao/faceit-user-svc/errors"
 	"github.com/zechao/faceit-user-svc/query"
 	"github.com/zechao/faceit-user-svc/user"
 )
 
+const (
+	// IdempotencyKeyHeader is the header of the idempotency key of the user creations.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// maxIdempotencyKeyLength is the longest idempotency key, UUIDs or similar random values are expected.
+	maxIdempotencyKeyLength = 255
+
+	// deleteModeSoft and deleteModeErase are the values of the mode parameter of the deletes.
+	deleteModeSoft  = "soft"
+	deleteModeErase = "erase"
+)
+
 var (
-	emailRegex = regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`)
+	// emailRegex matches the emails in any case, they are stored in lowercase.
+	emailRegex = regexp.MustCompile(`(?i)^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`)
 
 	ErrorInvalidUserID = errors.NewWrongInput("invalid user id")
+	// ErrInvalidIdempotencyKey is returned when the idempotency key is too long.
+	ErrInvalidIdempotencyKey = errors.NewWrongInput("invalid idempotency key", errors.Detail{
+		Field:       IdempotencyKeyHeader,
+		Description: fmt.Sprintf("Idempotency-Key must have at most %d characters", maxIdempotencyKeyLength),
+	})
+	// ErrInvalidDeleteMode is returned when the mode of a delete is unknown.
+	ErrInvalidDeleteMode = errors.NewWrongInput("invalid delete mode", errors.Detail{
+		Field:       "mode",
+		Description: "mode must be soft or erase",
+	})
 )
 
 type UserHandler struct {
 	service user.Service
 }
 
+// RegisterRoutes registers the user routes, the caller identity must be set by AuthenticationMiddleware.
+// Anybody can sign up, users can only read, modify or remove themselves unless they are admin,
+// listing every user requires the service or admin scope, and only admins restore deleted users.
+// Users can read their own history, admins the history of any user.
 func (h *UserHandler) RegisterRoutes(router *gin.Engine) {
 	router.POST("/users", h.CreateUser)
-	router.PATCH("/users/:id", h.UpdateUser)
-	router.GET("/users", h.ListUsers)
-	router.DELETE("/users/:id", h.DeleteUser)
+	router.PATCH("/users/:id", authorize(self("id"), admin()), h.UpdateUser)
+	router.GET("/users", authorize(scope(auth.ScopeService), admin()), h.ListUsers)
+	router.GET("/users/search", authorize(scope(auth.ScopeService), admin()), h.SearchUsers)
+	router.GET("/users/export", authorize(scope(auth.ScopeService), admin()), h.ExportUsers)
+	router.GET("/users/:id", authorize(self("id"), scope(auth.ScopeService), admin()), h.GetUser)
+	router.DELETE("/users/:id", authorize(self("id"), admin()), h.DeleteUser)
+	router.POST("/users/:id/restore", authorize(admin()), h.RestoreUser)
+	router.GET("/users/:id/history", authorize(self("id"), admin()), h.ListUserHistory)
 }
 
 func NewUserHandler(service user.Service) *UserHandler {
@@ -40,7 +75,14 @@ func NewUserHandler(service user.Service) *UserHandler {
 // CreateUser handles the creation of a new user and returns the created user details without password.
 // usually returning http status code 201 Created is enough to indicate that the resource was created successfully.
 // but in this case we are returning the created user details as well. which is also common practice.
+// The retries sent with the same Idempotency-Key header get the same response, without creating the user again.
 func (h *UserHandler) CreateUser(ctx *gin.Context) {
+	idempotencyKey := strings.TrimSpace(ctx.GetHeader(IdempotencyKeyHeader))
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		handlerError(ctx, ErrInvalidIdempotencyKey)
+		return
+	}
+
 	var req CreateUserRequest
 
 	err := json.NewDecoder(ctx.Request.Body).Decode(&req)
@@ -61,30 +103,31 @@ func (h *UserHandler) CreateUser(ctx *gin.Context) {
 		Password:  req.Password,
 		Email:     req.Email,
 		Country:   req.Country,
+
+		IdempotencyKey: idempotencyKey,
 	})
 	if err != nil {
 		handlerError(ctx, err)
 		return
 	}
-	res := &UserResponse{
-		ID:        user.ID,
-		FirstName: user.FirstName,
-		LastName:  user.LastName,
-		NickName:  user.NickName,
-		Email:     user.Email,
-		Country:   user.Country,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-	}
+	res := newUserResponse(user)
+	ctx.Header("ETag", etag(user.Version))
 	ctx.JSON(http.StatusCreated, res)
 }
 
+// UpdateUser updates the fields set in the request, if the If-Match header is set the user must still
+// have that ETag, otherwise it returns 412 Precondition Failed.
 func (h *UserHandler) UpdateUser(ctx *gin.Context) {
 	id, err := uuid.Parse(ctx.Param("id"))
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, ErrorInvalidUserID)
 		return
 	}
+	version, err := ifMatch(ctx)
+	if err != nil {
+		handlerError(ctx, err)
+		return
+	}
 
 	var req UpdateUserRequest
 	err = json.NewDecoder(ctx.Request.Body).Decode(&req)
@@ -100,6 +143,7 @@ func (h *UserHandler) UpdateUser(ctx *gin.Context) {
 
 	user, err := h.service.UpdateUser(ctx.Request.Context(), &user.UpdateUserInput{
 		ID:        id,
+		Version:   version,
 		FirstName: req.FirstName,
 		LastName:  req.LastName,
 		NickName:  req.NickName,
@@ -112,16 +156,33 @@ func (h *UserHandler) UpdateUser(ctx *gin.Context) {
 		return
 	}
 
-	res := &UserResponse{
-		ID:        user.ID,
-		FirstName: user.FirstName,
-		LastName:  user.LastName,
-		NickName:  user.NickName,
-		Email:     user.Email,
-		Country:   user.Country,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
+	res := newUserResponse(user)
+	ctx.Header("ETag", etag(user.Version))
+	ctx.JSON(http.StatusOK, res)
+}
+
+// GetUser returns the user details without password for the given id.
+// The fields parameter returns only the listed fields, for example fields=id,nick_name.
+func (h *UserHandler) GetUser(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, ErrorInvalidUserID)
+		return
+	}
+	fields, details := query.ParseFields(ctx.Query("fields"))
+	if len(details) > 0 {
+		handlerError(ctx, errors.NewWrongInput(query.ErrCodeInvalidParameter, details...))
+		return
+	}
+
+	user, err := h.service.GetUser(ctx.Request.Context(), id, fields)
+	if err != nil {
+		handlerError(ctx, err)
+		return
 	}
+	res := newUserResponse(user)
+	res.fields = fields
+	ctx.Header("ETag", etag(user.Version))
 	ctx.JSON(http.StatusOK, res)
 }
 
@@ -139,40 +200,49 @@ func (h *UserHandler) ListUsers(ctx *gin.Context) {
 		return
 	}
 
-	res := ListUsersResponse{
-		Page:         listRes.Page,
-		PageSize:     listRes.PageSize,
-		TotalRecords: listRes.TotalRecords,
-		SortBy:       listRes.SortBy,
-		SortOrder:    listRes.SortOrder,
-		Filters:      listRes.Filters,
-		Users:        make([]UserResponse, len(listRes.Data)),
-	}
-	for i, u := range listRes.Data {
-		res.Users[i] = UserResponse{
-			ID:        u.ID,
-			FirstName: u.FirstName,
-			LastName:  u.LastName,
-			NickName:  u.NickName,
-			Email:     u.Email,
-			Country:   u.Country,
-			CreatedAt: u.CreatedAt,
-			UpdatedAt: u.UpdatedAt,
-		}
-	}
+	ctx.JSON(http.StatusOK, newListUsersResponse(listRes))
 
-	ctx.JSON(http.StatusOK, res)
+}
+
+// SearchUsers returns the users similar to the q parameter, the most similar first.
+func (h *UserHandler) SearchUsers(ctx *gin.Context) {
+	search, err := query.SearchFromURL(ctx.Request.URL.Query())
+	if err != nil {
+		handlerError(ctx, err)
+		return
+	}
 
+	listRes, err := h.service.SearchUsers(ctx.Request.Context(), *search)
+	if err != nil {
+		handlerError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, newListUsersResponse(listRes))
 }
 
+// DeleteUser soft deletes the user, if the If-Match header is set the user must still have that ETag,
+// otherwise it returns 412 Precondition Failed. With mode=erase the user and its personal data are
+// permanently deleted instead, the user can be deleted already.
 func (h *UserHandler) DeleteUser(ctx *gin.Context) {
 	id, err := uuid.Parse(ctx.Param("id"))
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, ErrorInvalidUserID)
 		return
 	}
+	version, err := ifMatch(ctx)
+	if err != nil {
+		handlerError(ctx, err)
+		return
+	}
 
-	err = h.service.DeleteUser(ctx.Request.Context(), id)
+	switch ctx.Query("mode") {
+	case "", deleteModeSoft:
+		err = h.service.DeleteUser(ctx.Request.Context(), id, version)
+	case deleteModeErase:
+		err = h.service.EraseUser(ctx.Request.Context(), id, version)
+	default:
+		err = ErrInvalidDeleteMode
+	}
 	if err != nil {
 		handlerError(ctx, err)
 		return
@@ -181,6 +251,47 @@ func (h *UserHandler) DeleteUser(ctx *gin.Context) {
 
 }
 
+// RestoreUser restores the soft deleted user and returns it, it returns 409 if its email was
+// taken by another user since it was deleted.
+func (h *UserHandler) RestoreUser(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, ErrorInvalidUserID)
+		return
+	}
+
+	user, err := h.service.RestoreUser(ctx.Request.Context(), id)
+	if err != nil {
+		handlerError(ctx, err)
+		return
+	}
+	ctx.Header("ETag", etag(user.Version))
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// ListUserHistory returns a page of the changes made to the user, the most recent first.
+// Every entry has the caller that made the change and the trace id of its request, the password
+// values are redacted.
+func (h *UserHandler) ListUserHistory(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, ErrorInvalidUserID)
+		return
+	}
+	pagination, err := query.PaginationFromURL(ctx.Request.URL.Query())
+	if err != nil {
+		handlerError(ctx, err)
+		return
+	}
+
+	history, err := h.service.ListUserHistory(ctx.Request.Context(), id, *pagination)
+	if err != nil {
+		handlerError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, newHistoryResponse(history))
+}
+
 // CreateUserRequest represents the request format for creating a new user.
 type CreateUserRequest struct {
 	FirstName string `json:"first_name"`
@@ -331,6 +442,29 @@ func (c UpdateUserRequest) Validate() error {
 	return nil
 }
 
+// etag returns the ETag of the version of a user, it's a strong validator such as "3".
+func etag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// ifMatch returns the version required by the If-Match header, nil if it isn't set or it's *.
+// A header that isn't the ETag of a version can't match any user, so it returns errors.ErrVersionMismatch.
+func ifMatch(ctx *gin.Context) (*int64, error) {
+	header := strings.TrimSpace(ctx.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+	unquoted, err := strconv.Unquote(header)
+	if err != nil {
+		return nil, errors.ErrVersionMismatch
+	}
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil {
+		return nil, errors.ErrVersionMismatch
+	}
+	return &version, nil
+}
+
 // UserResponse represents the response format for a user. It doesn't include password, since is a sensitive information
 type UserResponse struct {
 	ID        uuid.UUID `json:"id"`
@@ -341,15 +475,143 @@ type UserResponse struct {
 	Country   string    `json:"country"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// fields is the sparse fieldset of the response, all the fields are returned when it's empty
+	fields []string
+}
+
+// MarshalJSON marshals only the fields of the sparse fieldset when it's set.
+func (r UserResponse) MarshalJSON() ([]byte, error) {
+	// the alias doesn't have the MarshalJSON method, so it's marshaled with the default encoding
+	type userResponse UserResponse
+	data, err := json.Marshal(userResponse(r))
+	if err != nil || len(r.fields) == 0 {
+		return data, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	sparse := make(map[string]json.RawMessage, len(r.fields))
+	for _, f := range r.fields {
+		if v, ok := all[f]; ok {
+			sparse[f] = v
+		}
+	}
+	return json.Marshal(sparse)
+}
+
+// newUserResponse maps the domain user to its response format, leaving the password out.
+func newUserResponse(u *user.User) *UserResponse {
+	return &UserResponse{
+		ID:        u.ID,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		NickName:  u.NickName,
+		Email:     u.Email,
+		Country:   u.Country,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+	}
+}
+
+// newListUsersResponse maps the page of users to its response format, leaving the passwords out.
+func newListUsersResponse(listRes *query.PaginationResponse[user.User]) *ListUsersResponse {
+	res := ListUsersResponse{
+		Page:         listRes.Page,
+		PageSize:     listRes.PageSize,
+		TotalRecords: listRes.TotalRecords,
+		TotalMode:    listRes.TotalMode,
+		SortBy:       listRes.SortBy,
+		SortOrder:    listRes.SortOrder,
+		Sort:         listRes.Sort,
+		Filters:      listRes.Filters,
+		NextCursor:   listRes.NextCursor,
+		Fields:       listRes.Fields,
+		Users:        make([]UserResponse, len(listRes.Data)),
+	}
+	for i := range listRes.Data {
+		res.Users[i] = *newUserResponse(&listRes.Data[i])
+		res.Users[i].fields = listRes.Fields
+	}
+	return &res
 }
 
 // ListUsersResponse represents the response format for a list of users with its query parameters.
 type ListUsersResponse struct {
-	Page         int                 `json:"page"`
-	PageSize     int                 `json:"page_size"`
-	TotalRecords int64               `json:"total_records"`
-	SortBy       string              `json:"sort_by"`
-	SortOrder    string              `json:"sort_order"`
-	Filters      map[string][]string `json:"filters"`
-	Users        []UserResponse      `json:"data"`
+	Page         int   `json:"page"`
+	PageSize     int   `json:"page_size"`
+	TotalRecords int64 `json:"total_records"`
+	// TotalMode tells how total_records was computed: exact, estimate or false when it's not computed.
+	TotalMode  query.TotalMode     `json:"total_mode"`
+	SortBy     string              `json:"sort_by"`
+	SortOrder  string              `json:"sort_order"`
+	Sort       string              `json:"sort,omitempty"`
+	Filters    map[string][]string `json:"filters"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+	Fields     []string            `json:"fields,omitempty"`
+	Users      []UserResponse      `json:"data"`
+}
+
+// HistoryResponse represents a page of the audit entries of a user.
+type HistoryResponse struct {
+	Page         int             `json:"page"`
+	PageSize     int             `json:"page_size"`
+	TotalRecords int64           `json:"total_records"`
+	SortBy       string          `json:"sort_by"`
+	SortOrder    string          `json:"sort_order"`
+	Entries      []AuditResponse `json:"data"`
+}
+
+// AuditResponse represents a change made to a user.
+type AuditResponse struct {
+	ID        uuid.UUID        `json:"id"`
+	Operation string           `json:"operation"`
+	Actor     ActorResponse    `json:"actor"`
+	TraceID   string           `json:"trace_id"`
+	Changes   []ChangeResponse `json:"changes"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// ActorResponse represents the caller that made a change, the id is omitted for anonymous callers.
+type ActorResponse struct {
+	Kind string `json:"kind"`
+	ID   string `json:"id,omitempty"`
+}
+
+// ChangeResponse represents the change of a field, the password values are always redacted.
+type ChangeResponse struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// newHistoryResponse maps the page of audit entries to its response format.
+func newHistoryResponse(history *query.PaginationResponse[user.AuditEntry]) *HistoryResponse {
+	return &HistoryResponse{
+		Page:         history.Page,
+		PageSize:     history.PageSize,
+		TotalRecords: history.TotalRecords,
+		SortBy:       history.SortBy,
+		SortOrder:    history.SortOrder,
+		Entries:      newAuditResponses(history.Data),
+	}
+}
+
+// newAuditResponses maps the audit entries to their response format.
+func newAuditResponses(entries []user.AuditEntry) []AuditResponse {
+	res := make([]AuditResponse, len(entries))
+	for i, e := range entries {
+		res[i] = AuditResponse{
+			ID:        e.ID,
+			Operation: string(e.Operation),
+			Actor:     ActorResponse{Kind: e.ActorKind, ID: e.ActorID},
+			TraceID:   e.TraceID,
+			Changes:   make([]ChangeResponse, len(e.Changes)),
+			CreatedAt: e.CreatedAt,
+		}
+		for j, c := range e.Changes {
+			res[i].Changes[j] = ChangeResponse{Field: c.Field, Before: c.Before, After: c.After}
+		}
+	}
+	return res
 }
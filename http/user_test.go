@@ -1,17 +1,22 @@
 package http_test
 
 import (
+	"context"
 	_ "embed"
 	"encoding/json"
 	"io"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/zechao/faceit-user-svc/auth"
 	"github.com/zechao/faceit-user-svc/errors"
 	api "github.com/zechao/faceit-user-svc/http"
 	"github.com/zechao/faceit-user-svc/query"
@@ -34,6 +39,7 @@ var (
 		Email:     "john.doe@example.com",
 		Password:  "securepassword123",
 		Country:   "ES",
+		Version:   1,
 	}
 
 	testCreateUserInput = user.CreateUserInput{
@@ -56,6 +62,14 @@ func TestValidateCreateUserRequest(t *testing.T) {
 		assert.NoError(t, req.Validate())
 	})
 
+	t.Run("valid request with uppercase email", func(t *testing.T) {
+		var req api.CreateUserRequest
+		err := json.Unmarshal(createRequest, &req)
+		assert.NoError(t, err)
+		req.Email = "Zechao.Jin@Gmail.COM"
+		assert.NoError(t, req.Validate())
+	})
+
 	t.Run("invalid request", func(t *testing.T) {
 		tests := []struct {
 			name              string
@@ -249,9 +263,24 @@ func setupRouter() *gin.Engine {
 	// without log
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
+	// the handlers are tested as admin, authorization is tested in middleware_test.go
+	r.Use(withIdentity(&auth.Identity{Kind: auth.UserIdentity, Subject: uuid.NewString(), Roles: []string{auth.RoleAdmin}}))
 	return r
 }
 
+// ptr returns a pointer to the value.
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// withIdentity sets the identity in the request context, as AuthenticationMiddleware does.
+func withIdentity(identity *auth.Identity) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(auth.ContextWithIdentity(c.Request.Context(), identity))
+		c.Next()
+	}
+}
+
 func TestCreateUser(t *testing.T) {
 	router := setupRouter()
 	ctrl := gomock.NewController(t)
@@ -265,6 +294,7 @@ func TestCreateUser(t *testing.T) {
 
 	tests := map[string]struct {
 		requestBody    io.Reader
+		idempotencyKey string
 		mockSetup      func()
 		expectedStatus int
 	}{
@@ -272,6 +302,21 @@ func TestCreateUser(t *testing.T) {
 			requestBody:    strings.NewReader("invalid payload"),
 			expectedStatus: http.StatusBadRequest,
 		},
+		"fail by idempotency key too long": {
+			requestBody:    strings.NewReader(string(createRequest)),
+			idempotencyKey: strings.Repeat("k", 256),
+			expectedStatus: http.StatusBadRequest,
+		},
+		"fail by idempotency key reused": {
+			requestBody:    strings.NewReader(string(createRequest)),
+			idempotencyKey: "key",
+			mockSetup: func() {
+				input := testCreateUserInput
+				input.IdempotencyKey = "key"
+				mockService.EXPECT().CreateUser(gomock.Any(), &input).Return(nil, user.ErrIdempotencyKeyReused)
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
 		"fail by validation error": {
 			requestBody: func() io.Reader {
 				invalidReq := validReq
@@ -296,6 +341,16 @@ func TestCreateUser(t *testing.T) {
 			},
 			expectedStatus: http.StatusCreated,
 		},
+		"success with idempotency key": {
+			requestBody:    strings.NewReader(string(createRequest)),
+			idempotencyKey: " key ",
+			mockSetup: func() {
+				input := testCreateUserInput
+				input.IdempotencyKey = "key"
+				mockService.EXPECT().CreateUser(gomock.Any(), &input).Return(&testUser, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
 	}
 
 	for name, tt := range tests {
@@ -304,6 +359,9 @@ func TestCreateUser(t *testing.T) {
 			ctx, _ := gin.CreateTestContext(recorder)
 			ctx.Request, err = http.NewRequest(http.MethodPost, "/users", tt.requestBody)
 			assert.NoError(t, err)
+			if tt.idempotencyKey != "" {
+				ctx.Request.Header.Set(api.IdempotencyKeyHeader, tt.idempotencyKey)
+			}
 
 			if tt.mockSetup != nil {
 				tt.mockSetup()
@@ -330,8 +388,10 @@ func TestUpdateUser(t *testing.T) {
 	tests := map[string]struct {
 		id             string
 		requestBody    io.Reader
+		ifMatch        string
 		mockSetup      func()
 		expectedStatus int
+		expectedETag   string
 	}{
 		"fail by wrong id": {
 			id:             "wrong id",
@@ -364,6 +424,21 @@ func TestUpdateUser(t *testing.T) {
 			},
 			expectedStatus: http.StatusInternalServerError,
 		},
+		"fail by invalid If-Match": {
+			id:             testUser.ID.String(),
+			requestBody:    strings.NewReader(string(createRequest)),
+			ifMatch:        `W/"3"`,
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+		"fail by version mismatch": {
+			id:          testUser.ID.String(),
+			requestBody: strings.NewReader(string(createRequest)),
+			ifMatch:     `"3"`,
+			mockSetup: func() {
+				mockService.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Return(nil, errors.ErrVersionMismatch)
+			},
+			expectedStatus: http.StatusPreconditionFailed,
+		},
 		"success valid request": {
 			id:          testUser.ID.String(),
 			requestBody: strings.NewReader(string(createRequest)),
@@ -371,6 +446,23 @@ func TestUpdateUser(t *testing.T) {
 				mockService.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Return(&testUser, nil)
 			},
 			expectedStatus: http.StatusOK,
+			expectedETag:   `"1"`,
+		},
+		"success with If-Match": {
+			id:          testUser.ID.String(),
+			requestBody: strings.NewReader(string(createRequest)),
+			ifMatch:     `"1"`,
+			mockSetup: func() {
+				mockService.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, input *user.UpdateUserInput) (*user.User, error) {
+						assert.Equal(t, int64(1), *input.Version)
+						updated := testUser
+						updated.Version = 2
+						return &updated, nil
+					})
+			},
+			expectedStatus: http.StatusOK,
+			expectedETag:   `"2"`,
 		},
 	}
 
@@ -380,6 +472,9 @@ func TestUpdateUser(t *testing.T) {
 			ctx, _ := gin.CreateTestContext(recorder)
 			ctx.Request, err = http.NewRequest(http.MethodPatch, "/users/"+tt.id, tt.requestBody)
 			assert.NoError(t, err)
+			if tt.ifMatch != "" {
+				ctx.Request.Header.Set("If-Match", tt.ifMatch)
+			}
 
 			if tt.mockSetup != nil {
 				tt.mockSetup()
@@ -388,6 +483,7 @@ func TestUpdateUser(t *testing.T) {
 			router.ServeHTTP(recorder, ctx.Request)
 
 			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			assert.Equal(t, tt.expectedETag, recorder.Header().Get("ETag"))
 		})
 	}
 }
@@ -405,7 +501,9 @@ func TestDeleteUser(t *testing.T) {
 
 	tests := map[string]struct {
 		id             string
+		mode           string
 		requestBody    io.Reader
+		ifMatch        string
 		mockSetup      func()
 		expectedStatus int
 	}{
@@ -419,7 +517,7 @@ func TestDeleteUser(t *testing.T) {
 			id:          testUser.ID.String(),
 			requestBody: strings.NewReader(string(createRequest)),
 			mockSetup: func() {
-				mockService.EXPECT().DeleteUser(gomock.Any(), testUser.ID).Return(errTest)
+				mockService.EXPECT().DeleteUser(gomock.Any(), testUser.ID, gomock.Nil()).Return(errTest)
 			},
 			expectedStatus: http.StatusInternalServerError,
 		},
@@ -427,18 +525,79 @@ func TestDeleteUser(t *testing.T) {
 			id:          testUser.ID.String(),
 			requestBody: strings.NewReader(string(createRequest)),
 			mockSetup: func() {
-				mockService.EXPECT().DeleteUser(gomock.Any(), gomock.Any()).Return(nil)
+				mockService.EXPECT().DeleteUser(gomock.Any(), gomock.Any(), gomock.Nil()).Return(nil)
 			},
 			expectedStatus: http.StatusOK,
 		},
+		"fail by version mismatch": {
+			id:      testUser.ID.String(),
+			ifMatch: `"3"`,
+			mockSetup: func() {
+				mockService.EXPECT().DeleteUser(gomock.Any(), testUser.ID, gomock.Eq(ptr(int64(3)))).Return(errors.ErrVersionMismatch)
+			},
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+		"fail with If-Match by user not found": {
+			id:      testUser.ID.String(),
+			ifMatch: `"3"`,
+			mockSetup: func() {
+				mockService.EXPECT().DeleteUser(gomock.Any(), testUser.ID, gomock.Eq(ptr(int64(3)))).Return(errors.ErrNotfound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		"success with If-Match any": {
+			id:      testUser.ID.String(),
+			ifMatch: "*",
+			mockSetup: func() {
+				mockService.EXPECT().DeleteUser(gomock.Any(), testUser.ID, gomock.Nil()).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		"success soft mode": {
+			id:   testUser.ID.String(),
+			mode: "soft",
+			mockSetup: func() {
+				mockService.EXPECT().DeleteUser(gomock.Any(), testUser.ID, gomock.Nil()).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		"success erase mode": {
+			id:   testUser.ID.String(),
+			mode: "erase",
+			mockSetup: func() {
+				mockService.EXPECT().EraseUser(gomock.Any(), testUser.ID, gomock.Nil()).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		"fail erase mode by version mismatch": {
+			id:      testUser.ID.String(),
+			mode:    "erase",
+			ifMatch: `"3"`,
+			mockSetup: func() {
+				mockService.EXPECT().EraseUser(gomock.Any(), testUser.ID, gomock.Eq(ptr(int64(3)))).Return(errors.ErrVersionMismatch)
+			},
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+		"fail by unknown mode": {
+			id:             testUser.ID.String(),
+			mode:           "hard",
+			expectedStatus: http.StatusBadRequest,
+		},
 	}
 
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
 			recorder := httptest.NewRecorder()
 			ctx, _ := gin.CreateTestContext(recorder)
-			ctx.Request, err = http.NewRequest(http.MethodDelete, "/users/"+tt.id, tt.requestBody)
+			path := "/users/" + tt.id
+			if tt.mode != "" {
+				path += "?mode=" + tt.mode
+			}
+			ctx.Request, err = http.NewRequest(http.MethodDelete, path, tt.requestBody)
 			assert.NoError(t, err)
+			if tt.ifMatch != "" {
+				ctx.Request.Header.Set("If-Match", tt.ifMatch)
+			}
 
 			if tt.mockSetup != nil {
 				tt.mockSetup()
@@ -451,6 +610,278 @@ func TestDeleteUser(t *testing.T) {
 	}
 }
 
+func TestRestoreUser(t *testing.T) {
+	router := setupRouter()
+	ctrl := gomock.NewController(t)
+	mockService := mocks.NewMockService(ctrl)
+	handler := api.NewUserHandler(mockService)
+	handler.RegisterRoutes(router)
+
+	tests := map[string]struct {
+		id             string
+		mockSetup      func()
+		expectedStatus int
+		expectedETag   string
+	}{
+		"fail by wrong id": {
+			id:             "wrong id",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"fail by not found": {
+			id: testUser.ID.String(),
+			mockSetup: func() {
+				mockService.EXPECT().RestoreUser(gomock.Any(), testUser.ID).Return(nil, errors.ErrNotfound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		"fail by email taken": {
+			id: testUser.ID.String(),
+			mockSetup: func() {
+				mockService.EXPECT().RestoreUser(gomock.Any(), testUser.ID).Return(nil, user.ErrEmailTaken)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		"fail by service error": {
+			id: testUser.ID.String(),
+			mockSetup: func() {
+				mockService.EXPECT().RestoreUser(gomock.Any(), testUser.ID).Return(nil, errTest)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		"success valid request": {
+			id: testUser.ID.String(),
+			mockSetup: func() {
+				mockService.EXPECT().RestoreUser(gomock.Any(), testUser.ID).Return(&testUser, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedETag:   `"1"`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/users/"+tt.id+"/restore", nil)
+			assert.NoError(t, err)
+
+			if tt.mockSetup != nil {
+				tt.mockSetup()
+			}
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			assert.Equal(t, tt.expectedETag, recorder.Header().Get("ETag"))
+			if tt.expectedStatus == http.StatusOK {
+				var res api.UserResponse
+				assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+				assert.Equal(t, testUser.ID, res.ID)
+			}
+		})
+	}
+}
+
+func TestListUserHistory(t *testing.T) {
+	router := setupRouter()
+	ctrl := gomock.NewController(t)
+	mockService := mocks.NewMockService(ctrl)
+	handler := api.NewUserHandler(mockService)
+	handler.RegisterRoutes(router)
+
+	entryID := uuid.MustParse("6f1f9e57-8d56-4c9c-a6b2-3f52ee0a2c1d")
+	history := &query.PaginationResponse[user.AuditEntry]{
+		Page:         2,
+		PageSize:     1,
+		TotalRecords: 2,
+		TotalMode:    query.TotalExact,
+		SortBy:       "created_at",
+		SortOrder:    "desc",
+		Filters:      map[string][]string{},
+		Data: []user.AuditEntry{
+			{
+				ID:        entryID,
+				UserID:    testUser.ID,
+				Operation: user.AuditUpdate,
+				ActorKind: "user",
+				ActorID:   "admin",
+				TraceID:   "trace",
+				Changes: []user.Change{
+					{Field: "email", Before: "old@faceit.com", After: "new@faceit.com"},
+					{Field: "password", Before: user.RedactedValue, After: user.RedactedValue},
+				},
+				CreatedAt: time.Date(2025, 2, 28, 14, 22, 16, 0, time.UTC),
+			},
+		},
+	}
+
+	tests := map[string]struct {
+		id             string
+		params         string
+		mockSetup      func()
+		expectedStatus int
+		expectedBody   string
+	}{
+		"fail by wrong id": {
+			id:             "wrong id",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"fail by invalid page": {
+			id:             testUser.ID.String(),
+			params:         "?page=0",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"fail by unsupported parameter": {
+			id:             testUser.ID.String(),
+			params:         "?sort_by=email",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"fail by not found": {
+			id: testUser.ID.String(),
+			mockSetup: func() {
+				mockService.EXPECT().ListUserHistory(gomock.Any(), testUser.ID, query.Pagination{Page: 1, PageSize: 100}).
+					Return(nil, errors.ErrNotfound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		"fail by service error": {
+			id: testUser.ID.String(),
+			mockSetup: func() {
+				mockService.EXPECT().ListUserHistory(gomock.Any(), testUser.ID, gomock.Any()).Return(nil, errTest)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		"success valid request": {
+			id:     testUser.ID.String(),
+			params: "?page=2&page_size=1",
+			mockSetup: func() {
+				mockService.EXPECT().ListUserHistory(gomock.Any(), testUser.ID, query.Pagination{Page: 2, PageSize: 1}).
+					Return(history, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: `{
+				"page": 2, "page_size": 1, "total_records": 2, "sort_by": "created_at", "sort_order": "desc",
+				"data": [{
+					"id": "6f1f9e57-8d56-4c9c-a6b2-3f52ee0a2c1d",
+					"operation": "update",
+					"actor": {"kind": "user", "id": "admin"},
+					"trace_id": "trace",
+					"changes": [
+						{"field": "email", "before": "old@faceit.com", "after": "new@faceit.com"},
+						{"field": "password", "before": "[REDACTED]", "after": "[REDACTED]"}
+					],
+					"created_at": "2025-02-28T14:22:16Z"
+				}]
+			}`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, "/users/"+tt.id+"/history"+tt.params, nil)
+			assert.NoError(t, err)
+
+			if tt.mockSetup != nil {
+				tt.mockSetup()
+			}
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	router := setupRouter()
+	ctrl := gomock.NewController(t)
+	mockService := mocks.NewMockService(ctrl)
+	handler := api.NewUserHandler(mockService)
+	handler.RegisterRoutes(router)
+
+	tests := map[string]struct {
+		id             string
+		query          string
+		mockSetup      func()
+		expectedStatus int
+		expectedFields []string
+	}{
+		"fail by wrong id": {
+			id:             "wrong id",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"fail by not found": {
+			id: testUser.ID.String(),
+			mockSetup: func() {
+				mockService.EXPECT().GetUser(gomock.Any(), testUser.ID, gomock.Nil()).Return(nil, errors.ErrNotfound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		"fail by service error": {
+			id: testUser.ID.String(),
+			mockSetup: func() {
+				mockService.EXPECT().GetUser(gomock.Any(), testUser.ID, gomock.Nil()).Return(nil, errTest)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		"fail by sensitive field": {
+			id:             testUser.ID.String(),
+			query:          "?fields=id,password",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"success valid request": {
+			id: testUser.ID.String(),
+			mockSetup: func() {
+				mockService.EXPECT().GetUser(gomock.Any(), testUser.ID, gomock.Nil()).Return(&testUser, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedFields: query.ResponseFields,
+		},
+		"success sparse fields": {
+			id:    testUser.ID.String(),
+			query: "?fields=id,nick_name",
+			mockSetup: func() {
+				// the fields are read by the service, not only filtered in the response
+				mockService.EXPECT().GetUser(gomock.Any(), testUser.ID, []string{"id", "nick_name"}).Return(&testUser, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedFields: []string{"id", "nick_name"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(recorder)
+			req, err := http.NewRequest(http.MethodGet, "/users/"+tt.id+tt.query, nil)
+			assert.NoError(t, err)
+			ctx.Request = req
+
+			if tt.mockSetup != nil {
+				tt.mockSetup()
+			}
+
+			router.ServeHTTP(recorder, ctx.Request)
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var res api.UserResponse
+				assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+				assert.Equal(t, testUser.ID, res.ID)
+				assert.Equal(t, `"1"`, recorder.Header().Get("ETag"))
+				assert.NotContains(t, recorder.Body.String(), "password")
+
+				var fields map[string]any
+				assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &fields))
+				assert.ElementsMatch(t, tt.expectedFields, slices.Collect(maps.Keys(fields)))
+			}
+		})
+	}
+}
+
 func TestListUser(t *testing.T) {
 	router := setupRouter()
 	ctrl := gomock.NewController(t)
@@ -463,6 +894,7 @@ func TestListUser(t *testing.T) {
 		requestBody    io.Reader
 		mockSetup      func()
 		expectedStatus int
+		expectedFields []string
 	}{
 		"fail by query error empty paramSortBy": {
 			params:         "page=0&page_size=0",
@@ -491,6 +923,24 @@ func TestListUser(t *testing.T) {
 				}, nil)
 			},
 			expectedStatus: http.StatusOK,
+			expectedFields: query.ResponseFields,
+		},
+		"success sparse fields": {
+			params: "fields=id,country",
+			mockSetup: func() {
+				mockService.EXPECT().ListUsers(gomock.Any(), gomock.Any()).Return(&query.PaginationResponse[user.User]{
+					Page:         1,
+					PageSize:     100,
+					TotalRecords: 1,
+					SortBy:       "created_at",
+					SortOrder:    "desc",
+					Filters:      map[string][]string{},
+					Fields:       []string{"id", "country"},
+					Data:         []user.User{testUser},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedFields: []string{"id", "country"},
 		},
 	}
 
@@ -509,6 +959,78 @@ func TestListUser(t *testing.T) {
 			router.ServeHTTP(recorder, ctx.Request)
 
 			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var res struct {
+					Data []map[string]any `json:"data"`
+				}
+				assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+				assert.Len(t, res.Data, 1)
+				assert.ElementsMatch(t, tt.expectedFields, slices.Collect(maps.Keys(res.Data[0])))
+			}
+		})
+	}
+}
+
+func TestSearchUsers(t *testing.T) {
+	router := setupRouter()
+	ctrl := gomock.NewController(t)
+	mockService := mocks.NewMockService(ctrl)
+	handler := api.NewUserHandler(mockService)
+	handler.RegisterRoutes(router)
+
+	tests := map[string]struct {
+		params         string
+		mockSetup      func()
+		expectedStatus int
+	}{
+		"fail by missing q": {
+			params:         "page=1",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"fail by service": {
+			params: "q=zechao",
+			mockSetup: func() {
+				mockService.EXPECT().SearchUsers(gomock.Any(), query.Search{Term: "zechao", Page: 1, PageSize: 100}).Return(nil, errTest)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		"success": {
+			params: "q=zechoa&page_size=10",
+			mockSetup: func() {
+				mockService.EXPECT().SearchUsers(gomock.Any(), query.Search{Term: "zechoa", Page: 1, PageSize: 10}).Return(&query.PaginationResponse[user.User]{
+					Page:         1,
+					PageSize:     10,
+					TotalRecords: 1,
+					TotalMode:    query.TotalExact,
+					SortBy:       query.SortByRelevance,
+					SortOrder:    "desc",
+					Filters:      map[string][]string{},
+					Data:         []user.User{testUser},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, "/users/search?"+tt.params, nil)
+			assert.NoError(t, err)
+
+			if tt.mockSetup != nil {
+				tt.mockSetup()
+			}
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var res api.ListUsersResponse
+				assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+				assert.Len(t, res.Users, 1)
+				assert.NotContains(t, recorder.Body.String(), testUser.Password)
+			}
 		})
 	}
 }
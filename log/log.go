@@ -12,6 +12,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/zechao/faceit-user-svc/config"
 	"github.com/zechao/faceit-user-svc/tracing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
 )
 
 var (
@@ -120,3 +122,20 @@ func GinLoggerMiddleware() gin.HandlerFunc {
 
 	}
 }
+
+// GRPCLoggerInterceptor logs every unary call, including the status code, duration and method,
+// but never logs the request or response messages.
+func GRPCLoggerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		startTime := time.Now()
+
+		res, err := handler(ctx, req)
+
+		Info(ctx, "GRPC REQUEST",
+			"status_code", status.Code(err).String(),
+			"duration", time.Since(startTime),
+			"method", info.FullMethod,
+		)
+		return res, err
+	}
+}
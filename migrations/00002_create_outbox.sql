@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- Events are written to the outbox in the same transaction as the user change,
+-- and published to the event bus later by the outbox relay.
+CREATE TABLE IF NOT EXISTS user_svc.outbox (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    -- seq keeps the order in which the events were written
+    seq BIGSERIAL NOT NULL,
+    event_type TEXT NOT NULL,
+    trace_id TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP NULL
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON user_svc.outbox (seq) WHERE sent_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE IF EXISTS user_svc.outbox;
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- Trigram indexes match partial and misspelled names, nicknames and emails.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS users_first_name_trgm_idx ON user_svc.users USING GIN (first_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_last_name_trgm_idx ON user_svc.users USING GIN (last_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_nick_name_trgm_idx ON user_svc.users USING GIN (nick_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_email_trgm_idx ON user_svc.users USING GIN (email gin_trgm_ops);
+
+-- The search vector matches whole words, the simple configuration doesn't stem names.
+ALTER TABLE user_svc.users ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', first_name || ' ' || last_name || ' ' || nick_name || ' ' || email)) STORED;
+
+CREATE INDEX IF NOT EXISTS users_search_vector_idx ON user_svc.users USING GIN (search_vector);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP INDEX IF EXISTS user_svc.users_search_vector_idx;
+ALTER TABLE user_svc.users DROP COLUMN IF EXISTS search_vector;
+DROP INDEX IF EXISTS user_svc.users_email_trgm_idx;
+DROP INDEX IF EXISTS user_svc.users_nick_name_trgm_idx;
+DROP INDEX IF EXISTS user_svc.users_last_name_trgm_idx;
+DROP INDEX IF EXISTS user_svc.users_first_name_trgm_idx;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- The version is incremented by every update, it's the ETag of the user used for optimistic concurrency.
+ALTER TABLE user_svc.users ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+ALTER TABLE user_svc.users DROP COLUMN IF EXISTS version;
+-- +goose StatementEnd
@@ -0,0 +1,54 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- Emails are unique regardless of their case, and only among the users that are not deleted,
+-- so a deleted user doesn't keep its email from being used again.
+-- The old constraint is case sensitive, so live users may have emails that differ only by case,
+-- such as John@example.com and john@example.com. They can't be merged automatically since they are
+-- different accounts, so the migration fails and is rolled back until all but one of them are
+-- renamed or deleted. They can be found with:
+--   SELECT lower(email), count(*) FROM user_svc.users WHERE deleted_at IS NULL
+--   GROUP BY lower(email) HAVING count(*) > 1;
+DO $$
+DECLARE
+    duplicated INT;
+BEGIN
+    SELECT count(*) INTO duplicated FROM (
+        SELECT lower(email) FROM user_svc.users
+        WHERE deleted_at IS NULL
+        GROUP BY lower(email)
+        HAVING count(*) > 1
+    ) d;
+    IF duplicated > 0 THEN
+        RAISE EXCEPTION '% emails are used by several live users with a different case, rename or delete all but one user of each email before migrating', duplicated;
+    END IF;
+END $$;
+ALTER TABLE user_svc.users DROP CONSTRAINT IF EXISTS users_email_key;
+UPDATE user_svc.users SET email = lower(email) WHERE email <> lower(email);
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_live_key ON user_svc.users (lower(email)) WHERE deleted_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- The old constraint is over all the users, so a deleted user and a live user that share an email since
+-- the migration keep it from being restored. The rollback fails until all but one user of each email are
+-- renamed or erased, they can be found with:
+--   SELECT email, count(*) FROM user_svc.users GROUP BY email HAVING count(*) > 1;
+DO $$
+DECLARE
+    duplicated INT;
+BEGIN
+    SELECT count(*) INTO duplicated FROM (
+        SELECT email FROM user_svc.users
+        GROUP BY email
+        HAVING count(*) > 1
+    ) d;
+    IF duplicated > 0 THEN
+        RAISE EXCEPTION '% emails are used by several users, rename or erase all but one user of each email before rolling back', duplicated;
+    END IF;
+END $$;
+DROP INDEX IF EXISTS user_svc.users_email_live_key;
+ALTER TABLE user_svc.users ADD CONSTRAINT users_email_key UNIQUE (email);
+-- +goose StatementEnd
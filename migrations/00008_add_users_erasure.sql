@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- Erased users are deleted from the table, their refresh tokens go with them.
+ALTER TABLE user_svc.refresh_tokens DROP CONSTRAINT IF EXISTS refresh_tokens_user_id_fkey;
+ALTER TABLE user_svc.refresh_tokens ADD CONSTRAINT refresh_tokens_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES user_svc.users (id) ON DELETE CASCADE;
+
+-- The retention worker purges the users deleted the longest ago first.
+CREATE INDEX IF NOT EXISTS users_deleted_at_idx ON user_svc.users (deleted_at) WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP INDEX IF EXISTS user_svc.users_deleted_at_idx;
+ALTER TABLE user_svc.refresh_tokens DROP CONSTRAINT IF EXISTS refresh_tokens_user_id_fkey;
+ALTER TABLE user_svc.refresh_tokens ADD CONSTRAINT refresh_tokens_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES user_svc.users (id);
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- Audit trail of the user changes, written in the same transaction as the change.
+-- There is no foreign key, the entries are deleted with the user when it's erased.
+CREATE TABLE IF NOT EXISTS user_svc.user_audit (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    -- seq keeps the order in which the entries were written
+    seq BIGSERIAL NOT NULL,
+    user_id UUID NOT NULL,
+    operation TEXT NOT NULL,
+    actor_kind TEXT NOT NULL,
+    actor_id TEXT NOT NULL DEFAULT '',
+    trace_id TEXT NOT NULL DEFAULT '',
+    -- changes are the changed fields with their old and new values, the password values are redacted
+    changes JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS user_audit_user_idx ON user_svc.user_audit (user_id, seq);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE IF EXISTS user_svc.user_audit;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- The ID of the entity each event is about, the user for the user events, so the events of a user
+-- are found by the index instead of reading the payload of every event of the outbox.
+-- It's NULL for the events that aren't about a single entity.
+ALTER TABLE user_svc.outbox ADD COLUMN IF NOT EXISTS aggregate_id UUID NULL;
+-- The user is the user of the UserCreated and UserRestored payloads, or the id of the other ones.
+UPDATE user_svc.outbox SET aggregate_id = COALESCE(payload->'user'->>'id', payload->>'id')::uuid
+WHERE aggregate_id IS NULL AND jsonb_typeof(payload) = 'object';
+CREATE INDEX IF NOT EXISTS outbox_aggregate_id_idx ON user_svc.outbox (aggregate_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP INDEX IF EXISTS user_svc.outbox_aggregate_id_idx;
+ALTER TABLE user_svc.outbox DROP COLUMN IF EXISTS aggregate_id;
+-- +goose StatementEnd
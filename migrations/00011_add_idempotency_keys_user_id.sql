@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- The user created by the request of the key, so the records of a user are deleted by the index when it's
+-- erased, instead of depending on the fields of the stored response.
+ALTER TABLE user_svc.idempotency_keys ADD COLUMN IF NOT EXISTS user_id UUID NULL;
+-- The records written before the column have the user id in the ID field of the response.
+UPDATE user_svc.idempotency_keys SET user_id = (response->>'ID')::uuid WHERE user_id IS NULL;
+ALTER TABLE user_svc.idempotency_keys ALTER COLUMN user_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS idempotency_keys_user_id_idx ON user_svc.idempotency_keys (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP INDEX IF EXISTS user_svc.idempotency_keys_user_id_idx;
+ALTER TABLE user_svc.idempotency_keys DROP COLUMN IF EXISTS user_id;
+-- +goose StatementEnd
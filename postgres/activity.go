@@ -0,0 +1,70 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/zechao/faceit-user-svc/auth"
+	"github.com/zechao/faceit-user-svc/user"
+	"gorm.io/gorm"
+)
+
+type activityRepository struct {
+	db *gorm.DB
+}
+
+var _ user.ActivityRepository = activityRepository{}
+
+// NewActivityRepository creates a new user.ActivityRepository backed by the user_svc.refresh_tokens,
+// user_svc.outbox and user_svc.user_audit tables.
+func NewActivityRepository(db *gorm.DB) user.ActivityRepository {
+	return activityRepository{db: db}
+}
+
+// ListUserSessions implements user.ActivityRepository. The token hashes are not selected.
+func (r activityRepository) ListUserSessions(ctx context.Context, userID uuid.UUID) ([]user.Session, error) {
+	var sessions []user.Session
+	err := conn(ctx, r.db).Model(&auth.RefreshToken{}).
+		Select("id", "created_at", "expires_at", "revoked_at").
+		Where("user_id = ?", userID).
+		Order("created_at").Order("id").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// ListUserEvents implements user.ActivityRepository.
+func (r activityRepository) ListUserEvents(ctx context.Context, userID uuid.UUID) ([]user.EventRecord, error) {
+	var messages []outboxMessage
+	err := conn(ctx, r.db).Scopes(userMessages(userID)).
+		Order("seq").
+		Find(&messages).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user events: %w", err)
+	}
+	events := make([]user.EventRecord, len(messages))
+	for i, m := range messages {
+		events[i] = user.EventRecord{
+			ID:        m.ID,
+			EventType: m.EventType,
+			TraceID:   m.TraceID,
+			Payload:   m.Payload,
+			CreatedAt: m.CreatedAt,
+			SentAt:    m.SentAt,
+		}
+	}
+	return events, nil
+}
+
+// ListUserAudit implements user.ActivityRepository.
+func (r activityRepository) ListUserAudit(ctx context.Context, userID uuid.UUID) ([]user.AuditEntry, error) {
+	var entries []auditEntry
+	err := conn(ctx, r.db).Where("user_id = ?", userID).Order("seq").Find(&entries).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user audit: %w", err)
+	}
+	return toAuditEntries(entries)
+}
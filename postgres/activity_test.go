@@ -0,0 +1,95 @@
+package postgres_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zechao/faceit-user-svc/auth"
+	"github.com/zechao/faceit-user-svc/event"
+	"github.com/zechao/faceit-user-svc/postgres"
+)
+
+func TestActivity(t *testing.T) {
+	ctx := context.Background()
+	db, err := setupTestDatabase(t)
+	require.NoError(t, err)
+
+	t.Run("list user sessions", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		users, err := createUsers(tx, 2, "UK")
+		require.NoError(t, err)
+		tokens := postgres.NewRefreshTokenRepository(tx)
+		repo := postgres.NewActivityRepository(tx)
+
+		var ids []uuid.UUID
+		for _, u := range []uuid.UUID{users[0].ID, users[0].ID, users[1].ID} {
+			_, hash, err := auth.NewRefreshToken()
+			require.NoError(t, err)
+			token := &auth.RefreshToken{
+				ID:        uuid.New(),
+				UserID:    u,
+				TokenHash: hash,
+				ExpiresAt: time.Now().UTC().Add(time.Hour).Truncate(time.Microsecond),
+			}
+			require.NoError(t, tokens.CreateRefreshToken(ctx, token))
+			ids = append(ids, token.ID)
+		}
+		require.NoError(t, tokens.RevokeRefreshToken(ctx, ids[1], time.Now().UTC()))
+
+		res, err := repo.ListUserSessions(ctx, users[0].ID)
+		assert.NoError(t, err)
+		require.Len(t, res, 2)
+		assert.ElementsMatch(t, ids[:2], []uuid.UUID{res[0].ID, res[1].ID})
+		for _, s := range res {
+			assert.False(t, s.ExpiresAt.IsZero())
+			assert.Equal(t, s.ID == ids[1], s.RevokedAt != nil)
+		}
+	})
+
+	t.Run("list no user sessions", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewActivityRepository(tx)
+
+		res, err := repo.ListUserSessions(ctx, uuid.New())
+		assert.NoError(t, err)
+		assert.Empty(t, res)
+	})
+
+	t.Run("list user events by aggregate id", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		outbox := postgres.NewOutboxRepository(tx)
+		repo := postgres.NewActivityRepository(tx)
+		userID := uuid.New()
+
+		newMessage := func(eventType string, aggregateID uuid.UUID, payload any) *event.OutboxMessage {
+			data, err := json.Marshal(payload)
+			require.NoError(t, err)
+			m := &event.OutboxMessage{ID: uuid.New(), AggregateID: aggregateID, EventType: eventType, TraceID: uuid.NewString(), Payload: data}
+			require.NoError(t, outbox.AddMessage(ctx, m))
+			return m
+		}
+		created := newMessage("UserCreated", userID, map[string]any{"user": map[string]any{"id": userID}})
+		newMessage("UserCreated", uuid.New(), map[string]any{"user": map[string]any{"id": uuid.New()}})
+		deleted := newMessage("UserDeleted", userID, map[string]any{"id": userID})
+		// only the aggregate id is used, not the payload
+		newMessage("UserDeleted", uuid.Nil, map[string]any{"id": userID})
+
+		res, err := repo.ListUserEvents(ctx, userID)
+		assert.NoError(t, err)
+		require.Len(t, res, 2)
+		assert.Equal(t, created.ID, res[0].ID)
+		assert.Equal(t, created.EventType, res[0].EventType)
+		assert.Equal(t, created.TraceID, res[0].TraceID)
+		assert.JSONEq(t, string(created.Payload), string(res[0].Payload))
+		assert.Nil(t, res[0].SentAt)
+		assert.Equal(t, deleted.ID, res[1].ID)
+	})
+}
@@ -0,0 +1,150 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zechao/faceit-user-svc/user"
+	"gorm.io/gorm"
+)
+
+// auditEntry is the database model of user.AuditEntry.
+type auditEntry struct {
+	ID        uuid.UUID
+	Seq       int64 `gorm:"->"`
+	UserID    uuid.UUID
+	Operation string
+	ActorKind string
+	ActorID   string
+	TraceID   string
+	Changes   json.RawMessage `gorm:"type:jsonb"`
+	CreatedAt time.Time
+}
+
+// TableName returns the table name for the audit entry model.
+func (auditEntry) TableName() string {
+	return "user_svc.user_audit"
+}
+
+// auditChange is the stored format of user.Change.
+type auditChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// toAuditEntry maps the database model to user.AuditEntry.
+func (e auditEntry) toAuditEntry() (user.AuditEntry, error) {
+	var changes []auditChange
+	if err := json.Unmarshal(e.Changes, &changes); err != nil {
+		return user.AuditEntry{}, fmt.Errorf("failed to decode audit changes: %w", err)
+	}
+	res := user.AuditEntry{
+		ID:        e.ID,
+		UserID:    e.UserID,
+		Operation: user.AuditOperation(e.Operation),
+		ActorKind: e.ActorKind,
+		ActorID:   e.ActorID,
+		TraceID:   e.TraceID,
+		Changes:   make([]user.Change, len(changes)),
+		CreatedAt: e.CreatedAt,
+	}
+	for i, c := range changes {
+		res.Changes[i] = user.Change{Field: c.Field, Before: c.Before, After: c.After}
+	}
+	return res, nil
+}
+
+// toAuditEntries maps the database models to user.AuditEntry.
+func toAuditEntries(entries []auditEntry) ([]user.AuditEntry, error) {
+	res := make([]user.AuditEntry, len(entries))
+	for i, e := range entries {
+		var err error
+		res[i], err = e.toAuditEntry()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+type auditRepository struct {
+	db *gorm.DB
+}
+
+var _ user.AuditRepository = auditRepository{}
+
+// NewAuditRepository creates a new user.AuditRepository backed by the user_svc.user_audit table.
+func NewAuditRepository(db *gorm.DB) user.AuditRepository {
+	return auditRepository{db: db}
+}
+
+// AddAuditEntry implements user.AuditRepository. It takes part in the transaction carried by ctx if any.
+func (r auditRepository) AddAuditEntry(ctx context.Context, e *user.AuditEntry) error {
+	changes := make([]auditChange, len(e.Changes))
+	for i, c := range e.Changes {
+		changes[i] = auditChange{Field: c.Field, Before: c.Before, After: c.After}
+	}
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit changes: %w", err)
+	}
+
+	db := conn(ctx, r.db)
+	now := db.NowFunc()
+	err = db.Create(&auditEntry{
+		ID:        e.ID,
+		UserID:    e.UserID,
+		Operation: string(e.Operation),
+		ActorKind: e.ActorKind,
+		ActorID:   e.ActorID,
+		TraceID:   e.TraceID,
+		Changes:   data,
+		CreatedAt: now,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to add audit entry: %w", err)
+	}
+	e.CreatedAt = now
+	return nil
+}
+
+// ListUserAuditEntries implements user.AuditRepository. The entries are sorted by the order they were written.
+func (r auditRepository) ListUserAuditEntries(ctx context.Context, userID uuid.UUID, page, pageSize int) ([]user.AuditEntry, error) {
+	var entries []auditEntry
+	err := conn(ctx, r.db).
+		Where("user_id = ?", userID).
+		Order("seq DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&entries).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user audit entries: %w", err)
+	}
+	return toAuditEntries(entries)
+}
+
+// CountUserAuditEntries implements user.AuditRepository.
+func (r auditRepository) CountUserAuditEntries(ctx context.Context, userID uuid.UUID) (int64, error) {
+	var count int64
+	err := conn(ctx, r.db).Model(&auditEntry{}).Where("user_id = ?", userID).Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count user audit entries: %w", err)
+	}
+	return count, nil
+}
+
+// DeleteUserAuditEntries implements user.AuditRepository.
+func (r auditRepository) DeleteUserAuditEntries(ctx context.Context, userIDs ...uuid.UUID) (int64, error) {
+	if len(userIDs) == 0 {
+		return 0, nil
+	}
+	res := conn(ctx, r.db).Where("user_id IN (?)", userIDs).Delete(&auditEntry{})
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to delete user audit entries: %w", res.Error)
+	}
+	return res.RowsAffected, nil
+}
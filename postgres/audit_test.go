@@ -0,0 +1,111 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zechao/faceit-user-svc/postgres"
+	"github.com/zechao/faceit-user-svc/user"
+)
+
+func TestAuditEntries(t *testing.T) {
+	ctx := context.Background()
+	db, err := setupTestDatabase(t)
+	require.NoError(t, err)
+
+	newEntry := func(userID uuid.UUID, op user.AuditOperation, changes ...user.Change) *user.AuditEntry {
+		return &user.AuditEntry{
+			ID:        uuid.New(),
+			UserID:    userID,
+			Operation: op,
+			ActorKind: "user",
+			ActorID:   uuid.NewString(),
+			TraceID:   uuid.NewString(),
+			Changes:   changes,
+		}
+	}
+
+	t.Run("add and list entries, the most recent first", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewAuditRepository(tx)
+		userID := uuid.New()
+
+		created := newEntry(userID, user.AuditCreate, user.Change{Field: "email", After: "a@faceit.com"})
+		updated := newEntry(userID, user.AuditUpdate,
+			user.Change{Field: "email", Before: "a@faceit.com", After: "b@faceit.com"},
+			user.Change{Field: "password", Before: user.RedactedValue, After: user.RedactedValue})
+		deleted := newEntry(userID, user.AuditDelete)
+		for _, e := range []*user.AuditEntry{created, updated, deleted, newEntry(uuid.New(), user.AuditCreate)} {
+			require.NoError(t, repo.AddAuditEntry(ctx, e))
+			assert.False(t, e.CreatedAt.IsZero())
+		}
+
+		count, err := repo.CountUserAuditEntries(ctx, userID)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), count)
+
+		res, err := repo.ListUserAuditEntries(ctx, userID, 1, 2)
+		assert.NoError(t, err)
+		require.Len(t, res, 2)
+		assert.Equal(t, deleted.ID, res[0].ID)
+		assert.Empty(t, res[0].Changes)
+		assert.Equal(t, updated.ID, res[1].ID)
+		assert.Equal(t, updated.UserID, res[1].UserID)
+		assert.Equal(t, updated.Operation, res[1].Operation)
+		assert.Equal(t, updated.ActorKind, res[1].ActorKind)
+		assert.Equal(t, updated.ActorID, res[1].ActorID)
+		assert.Equal(t, updated.TraceID, res[1].TraceID)
+		assert.Equal(t, updated.Changes, res[1].Changes)
+
+		res, err = repo.ListUserAuditEntries(ctx, userID, 2, 2)
+		assert.NoError(t, err)
+		require.Len(t, res, 1)
+		assert.Equal(t, created.ID, res[0].ID)
+
+		// the export lists them the oldest first
+		res, err = postgres.NewActivityRepository(tx).ListUserAudit(ctx, userID)
+		assert.NoError(t, err)
+		require.Len(t, res, 3)
+		assert.Equal(t, []uuid.UUID{created.ID, updated.ID, deleted.ID}, []uuid.UUID{res[0].ID, res[1].ID, res[2].ID})
+	})
+
+	t.Run("list no entries", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewAuditRepository(tx)
+
+		res, err := repo.ListUserAuditEntries(ctx, uuid.New(), 1, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, res)
+		count, err := repo.CountUserAuditEntries(ctx, uuid.New())
+		assert.NoError(t, err)
+		assert.Zero(t, count)
+	})
+
+	t.Run("delete user entries", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewAuditRepository(tx)
+		ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+		for _, id := range ids {
+			require.NoError(t, repo.AddAuditEntry(ctx, newEntry(id, user.AuditCreate)))
+			require.NoError(t, repo.AddAuditEntry(ctx, newEntry(id, user.AuditDelete)))
+		}
+
+		deleted, err := repo.DeleteUserAuditEntries(ctx, ids[0], ids[1])
+		assert.NoError(t, err)
+		assert.Equal(t, int64(4), deleted)
+
+		count, err := repo.CountUserAuditEntries(ctx, ids[2])
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), count)
+
+		deleted, err = repo.DeleteUserAuditEntries(ctx)
+		assert.NoError(t, err)
+		assert.Zero(t, deleted)
+	})
+}
@@ -0,0 +1,74 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zechao/faceit-user-svc/auth"
+	"github.com/zechao/faceit-user-svc/errors"
+	"gorm.io/gorm"
+)
+
+type refreshTokenRepository struct {
+	db *gorm.DB
+}
+
+var _ auth.Repository = refreshTokenRepository{}
+
+// NewRefreshTokenRepository creates a new auth.Repository backed by the user_svc.refresh_tokens table.
+func NewRefreshTokenRepository(db *gorm.DB) auth.Repository {
+	return refreshTokenRepository{db: db}
+}
+
+// CreateRefreshToken implements auth.Repository.
+func (r refreshTokenRepository) CreateRefreshToken(ctx context.Context, t *auth.RefreshToken) error {
+	err := conn(ctx, r.db).Create(t).Error
+	if err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+	return nil
+}
+
+// GetRefreshTokenByHash implements auth.Repository.
+func (r refreshTokenRepository) GetRefreshTokenByHash(ctx context.Context, hash string) (*auth.RefreshToken, error) {
+	var t auth.RefreshToken
+	err := conn(ctx, r.db).First(&t, "token_hash = ?", hash).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.ErrNotfound
+		}
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	return &t, nil
+}
+
+// RevokeRefreshToken implements auth.Repository. Only a not revoked token is updated,
+// so two concurrent refreshes with the same token can't both succeed.
+func (r refreshTokenRepository) RevokeRefreshToken(ctx context.Context, id uuid.UUID, revokedAt time.Time) error {
+	res := conn(ctx, r.db).Model(&auth.RefreshToken{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", revokedAt)
+	if res.Error != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return errors.ErrNotfound
+	}
+	return nil
+}
+
+// SessionActive implements auth.Repository. The refresh tokens of an erased user are deleted with it
+// by the foreign key, and the ones of a soft deleted user are kept but no longer active.
+func (r refreshTokenRepository) SessionActive(ctx context.Context, id uuid.UUID, now time.Time) (bool, error) {
+	var count int64
+	err := conn(ctx, r.db).Model(&auth.RefreshToken{}).
+		Where("id = ? AND revoked_at IS NULL AND expires_at > ?", id, now).
+		Where("EXISTS (SELECT 1 FROM user_svc.users u WHERE u.id = user_svc.refresh_tokens.user_id AND u.deleted_at IS NULL)").
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to check session: %w", err)
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,147 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zechao/faceit-user-svc/auth"
+	"github.com/zechao/faceit-user-svc/errors"
+	"github.com/zechao/faceit-user-svc/postgres"
+)
+
+func TestRefreshTokens(t *testing.T) {
+	ctx := context.Background()
+	db, err := setupTestDatabase(t)
+	require.NoError(t, err)
+
+	newToken := func(userID uuid.UUID) *auth.RefreshToken {
+		_, hash, err := auth.NewRefreshToken()
+		require.NoError(t, err)
+		return &auth.RefreshToken{
+			ID:        uuid.New(),
+			UserID:    userID,
+			TokenHash: hash,
+			ExpiresAt: time.Now().UTC().Add(time.Hour).Truncate(time.Microsecond),
+		}
+	}
+
+	t.Run("create and get by hash", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		tu := testUser
+		require.NoError(t, tx.Create(&tu).Error)
+		repo := postgres.NewRefreshTokenRepository(tx)
+		token := newToken(tu.ID)
+
+		err := repo.CreateRefreshToken(ctx, token)
+		assert.NoError(t, err)
+
+		res, err := repo.GetRefreshTokenByHash(ctx, token.TokenHash)
+		assert.NoError(t, err)
+		assert.Equal(t, token.ID, res.ID)
+		assert.Equal(t, tu.ID, res.UserID)
+		assert.True(t, token.ExpiresAt.Equal(res.ExpiresAt))
+		assert.Nil(t, res.RevokedAt)
+	})
+
+	t.Run("fail by token of unknown user", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewRefreshTokenRepository(tx)
+
+		err := repo.CreateRefreshToken(ctx, newToken(uuid.New()))
+		assert.Error(t, err)
+	})
+
+	t.Run("fail by not found hash", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewRefreshTokenRepository(tx)
+
+		res, err := repo.GetRefreshTokenByHash(ctx, "unknown")
+		assert.ErrorIs(t, err, errors.ErrNotfound)
+		assert.Nil(t, res)
+	})
+
+	t.Run("revoke only once", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		tu := testUser
+		require.NoError(t, tx.Create(&tu).Error)
+		repo := postgres.NewRefreshTokenRepository(tx)
+		token := newToken(tu.ID)
+		require.NoError(t, repo.CreateRefreshToken(ctx, token))
+
+		err := repo.RevokeRefreshToken(ctx, token.ID, time.Now().UTC())
+		assert.NoError(t, err)
+
+		res, err := repo.GetRefreshTokenByHash(ctx, token.TokenHash)
+		assert.NoError(t, err)
+		assert.NotNil(t, res.RevokedAt)
+
+		err = repo.RevokeRefreshToken(ctx, token.ID, time.Now().UTC())
+		assert.ErrorIs(t, err, errors.ErrNotfound)
+	})
+	t.Run("session active", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		tu := testUser
+		require.NoError(t, tx.Create(&tu).Error)
+		repo := postgres.NewRefreshTokenRepository(tx)
+		token := newToken(tu.ID)
+		require.NoError(t, repo.CreateRefreshToken(ctx, token))
+
+		active, err := repo.SessionActive(ctx, token.ID, time.Now().UTC())
+		assert.NoError(t, err)
+		assert.True(t, active)
+
+		// the session expires with the refresh token
+		active, err = repo.SessionActive(ctx, token.ID, token.ExpiresAt.Add(time.Second))
+		assert.NoError(t, err)
+		assert.False(t, active)
+	})
+
+	t.Run("session not active by revoked token", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		tu := testUser
+		require.NoError(t, tx.Create(&tu).Error)
+		repo := postgres.NewRefreshTokenRepository(tx)
+		token := newToken(tu.ID)
+		require.NoError(t, repo.CreateRefreshToken(ctx, token))
+		require.NoError(t, repo.RevokeRefreshToken(ctx, token.ID, time.Now().UTC()))
+
+		active, err := repo.SessionActive(ctx, token.ID, time.Now().UTC())
+		assert.NoError(t, err)
+		assert.False(t, active)
+	})
+
+	t.Run("session not active by deleted user", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		tu := testUser
+		require.NoError(t, tx.Create(&tu).Error)
+		repo := postgres.NewRefreshTokenRepository(tx)
+		token := newToken(tu.ID)
+		require.NoError(t, repo.CreateRefreshToken(ctx, token))
+		require.NoError(t, postgres.NewUserRepository(tx).DeleteUser(ctx, tu.ID, nil))
+
+		active, err := repo.SessionActive(ctx, token.ID, time.Now().UTC())
+		assert.NoError(t, err)
+		assert.False(t, active)
+	})
+
+	t.Run("session not active by unknown token", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewRefreshTokenRepository(tx)
+
+		active, err := repo.SessionActive(ctx, uuid.New(), time.Now().UTC())
+		assert.NoError(t, err)
+		assert.False(t, active)
+	})
+}
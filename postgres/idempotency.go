@@ -0,0 +1,87 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zechao/faceit-user-svc/errors"
+	"github.com/zechao/faceit-user-svc/user"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type idempotencyRepository struct {
+	db *gorm.DB
+}
+
+var _ user.IdempotencyRepository = idempotencyRepository{}
+
+// NewIdempotencyRepository creates a new user.IdempotencyRepository backed by the user_svc.idempotency_keys table.
+func NewIdempotencyRepository(db *gorm.DB) user.IdempotencyRepository {
+	return idempotencyRepository{db: db}
+}
+
+// GetIdempotencyRecord implements user.IdempotencyRepository.
+func (r idempotencyRepository) GetIdempotencyRecord(ctx context.Context, key string, now time.Time) (*user.IdempotencyRecord, error) {
+	var record user.IdempotencyRecord
+	err := conn(ctx, r.db).First(&record, "key = ? AND expires_at > ?", key, now).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.ErrNotfound
+		}
+		return nil, fmt.Errorf("failed to get idempotency record: %w", err)
+	}
+	return &record, nil
+}
+
+// CreateIdempotencyRecord implements user.IdempotencyRepository. The conflict is resolved in the insert,
+// so a duplicated key doesn't abort the transaction the record is created in.
+func (r idempotencyRepository) CreateIdempotencyRecord(ctx context.Context, record *user.IdempotencyRecord) error {
+	res := conn(ctx, r.db).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "request_hash", "password_hash", "response", "created_at", "expires_at"}),
+		// only an expired record is replaced
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "idempotency_keys.expires_at <= ?", Vars: []any{record.CreatedAt}},
+		}},
+	}).Create(record)
+	if res.Error != nil {
+		return fmt.Errorf("failed to create idempotency record: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return errors.ErrDuplicated
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyRecords implements user.IdempotencyRepository.
+func (r idempotencyRepository) DeleteExpiredIdempotencyRecords(ctx context.Context, now time.Time) (int64, error) {
+	res := conn(ctx, r.db).Where("expires_at <= ?", now).Delete(&user.IdempotencyRecord{})
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency records: %w", res.Error)
+	}
+	return res.RowsAffected, nil
+}
+
+// DeleteUserIdempotencyRecords implements user.IdempotencyRepository.
+func (r idempotencyRepository) DeleteUserIdempotencyRecords(ctx context.Context, userID uuid.UUID) (int64, error) {
+	res := conn(ctx, r.db).Where("user_id = ?", userID).Delete(&user.IdempotencyRecord{})
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to delete user idempotency records: %w", res.Error)
+	}
+	return res.RowsAffected, nil
+}
+
+// DeleteErasedUsersIdempotencyRecords implements user.IdempotencyRepository. The soft deleted users
+// still exist, so their records are kept.
+func (r idempotencyRepository) DeleteErasedUsersIdempotencyRecords(ctx context.Context) (int64, error) {
+	res := conn(ctx, r.db).
+		Where("NOT EXISTS (SELECT 1 FROM user_svc.users u WHERE u.id = user_svc.idempotency_keys.user_id)").
+		Delete(&user.IdempotencyRecord{})
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to delete erased users idempotency records: %w", res.Error)
+	}
+	return res.RowsAffected, nil
+}
@@ -0,0 +1,174 @@
+package postgres_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zechao/faceit-user-svc/errors"
+	"github.com/zechao/faceit-user-svc/postgres"
+	"github.com/zechao/faceit-user-svc/user"
+)
+
+func TestIdempotencyRecords(t *testing.T) {
+	ctx := context.Background()
+	db, err := setupTestDatabase(t)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	newRecord := func(key string, createdAt time.Time) *user.IdempotencyRecord {
+		return &user.IdempotencyRecord{
+			Key:          key,
+			UserID:       uuid.New(),
+			RequestHash:  "hash",
+			PasswordHash: "password hash",
+			Response:     []byte(`{"id":"1"}`),
+			CreatedAt:    createdAt,
+			ExpiresAt:    createdAt.Add(time.Hour),
+		}
+	}
+
+	t.Run("success create and get", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewIdempotencyRepository(tx)
+
+		record := newRecord("key", now)
+		require.NoError(t, repo.CreateIdempotencyRecord(ctx, record))
+
+		res, err := repo.GetIdempotencyRecord(ctx, "key", now)
+		assert.NoError(t, err)
+		assert.Equal(t, record.UserID, res.UserID)
+		assert.Equal(t, record.RequestHash, res.RequestHash)
+		assert.Equal(t, record.PasswordHash, res.PasswordHash)
+		assert.JSONEq(t, string(record.Response), string(res.Response))
+		assert.True(t, record.ExpiresAt.Equal(res.ExpiresAt))
+	})
+
+	t.Run("fail get by not found", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewIdempotencyRepository(tx)
+
+		res, err := repo.GetIdempotencyRecord(ctx, "key", now)
+		assert.Nil(t, res)
+		assert.ErrorIs(t, err, errors.ErrNotfound)
+	})
+
+	t.Run("fail get by expired", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewIdempotencyRepository(tx)
+
+		require.NoError(t, repo.CreateIdempotencyRecord(ctx, newRecord("key", now)))
+
+		res, err := repo.GetIdempotencyRecord(ctx, "key", now.Add(time.Hour))
+		assert.Nil(t, res)
+		assert.ErrorIs(t, err, errors.ErrNotfound)
+	})
+
+	t.Run("fail create by duplicated key", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewIdempotencyRepository(tx)
+
+		require.NoError(t, repo.CreateIdempotencyRecord(ctx, newRecord("key", now)))
+
+		record := newRecord("key", now.Add(time.Minute))
+		record.RequestHash = "other hash"
+		err := repo.CreateIdempotencyRecord(ctx, record)
+		assert.ErrorIs(t, err, errors.ErrDuplicated)
+
+		// the transaction can still be used
+		res, err := repo.GetIdempotencyRecord(ctx, "key", now)
+		assert.NoError(t, err)
+		assert.Equal(t, "hash", res.RequestHash)
+	})
+
+	t.Run("success replace expired record", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewIdempotencyRepository(tx)
+
+		require.NoError(t, repo.CreateIdempotencyRecord(ctx, newRecord("key", now)))
+
+		record := newRecord("key", now.Add(2*time.Hour))
+		record.RequestHash = "other hash"
+		require.NoError(t, repo.CreateIdempotencyRecord(ctx, record))
+
+		res, err := repo.GetIdempotencyRecord(ctx, "key", record.CreatedAt)
+		assert.NoError(t, err)
+		assert.Equal(t, "other hash", res.RequestHash)
+	})
+
+	t.Run("success delete user records", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewIdempotencyRepository(tx)
+
+		userID := uuid.New()
+		record := newRecord("user", now)
+		record.UserID = userID
+		require.NoError(t, repo.CreateIdempotencyRecord(ctx, record))
+		require.NoError(t, repo.CreateIdempotencyRecord(ctx, newRecord("other", now)))
+
+		deleted, err := repo.DeleteUserIdempotencyRecords(ctx, userID)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), deleted)
+
+		_, err = repo.GetIdempotencyRecord(ctx, "user", now)
+		assert.ErrorIs(t, err, errors.ErrNotfound)
+		_, err = repo.GetIdempotencyRecord(ctx, "other", now)
+		assert.NoError(t, err)
+	})
+
+	t.Run("success delete erased users records", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewIdempotencyRepository(tx)
+		users, err := createUsers(tx, 2, "ES")
+		require.NoError(t, err)
+		// the soft deleted users still exist
+		require.NoError(t, tx.Delete(&users[1]).Error)
+
+		for i, id := range []uuid.UUID{users[0].ID, users[1].ID, uuid.New()} {
+			record := newRecord(fmt.Sprint(i), now)
+			record.UserID = id
+			require.NoError(t, repo.CreateIdempotencyRecord(ctx, record))
+		}
+
+		deleted, err := repo.DeleteErasedUsersIdempotencyRecords(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), deleted)
+
+		_, err = repo.GetIdempotencyRecord(ctx, "0", now)
+		assert.NoError(t, err)
+		_, err = repo.GetIdempotencyRecord(ctx, "1", now)
+		assert.NoError(t, err)
+		_, err = repo.GetIdempotencyRecord(ctx, "2", now)
+		assert.ErrorIs(t, err, errors.ErrNotfound)
+	})
+
+	t.Run("success delete expired records", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewIdempotencyRepository(tx)
+
+		require.NoError(t, repo.CreateIdempotencyRecord(ctx, newRecord("old", now.Add(-2*time.Hour))))
+		require.NoError(t, repo.CreateIdempotencyRecord(ctx, newRecord("new", now)))
+
+		deleted, err := repo.DeleteExpiredIdempotencyRecords(ctx, now)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), deleted)
+
+		_, err = repo.GetIdempotencyRecord(ctx, "old", now.Add(-2*time.Hour))
+		assert.ErrorIs(t, err, errors.ErrNotfound)
+		_, err = repo.GetIdempotencyRecord(ctx, "new", now)
+		assert.NoError(t, err)
+	})
+}
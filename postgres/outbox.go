@@ -0,0 +1,167 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zechao/faceit-user-svc/event"
+	"gorm.io/gorm"
+)
+
+// outboxMessage is the database model of event.OutboxMessage.
+// AggregateID is NULL for the events that aren't about a single entity.
+type outboxMessage struct {
+	ID            uuid.UUID
+	Seq           int64 `gorm:"->"`
+	AggregateID   *uuid.UUID
+	EventType     string
+	TraceID       string
+	Payload       json.RawMessage `gorm:"type:jsonb"`
+	Attempts      int
+	LastError     *string
+	CreatedAt     time.Time
+	NextAttemptAt time.Time
+	SentAt        *time.Time
+}
+
+// TableName returns the table name for the outbox model.
+func (outboxMessage) TableName() string {
+	return "user_svc.outbox"
+}
+
+// userMessages scopes the query to the outbox messages about the users, found by the indexed aggregate_id.
+func userMessages(userIDs ...uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("aggregate_id IN ?", userIDs)
+	}
+}
+
+// deleteUserMessages deletes the outbox messages about the users, sent or not, as their payloads
+// hold the personal data of the users.
+func deleteUserMessages(db *gorm.DB, userIDs ...uuid.UUID) error {
+	err := db.Scopes(userMessages(userIDs...)).Delete(&outboxMessage{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to delete user outbox messages: %w", err)
+	}
+	return nil
+}
+
+type outboxRepository struct {
+	db *gorm.DB
+}
+
+var _ event.OutboxRepository = outboxRepository{}
+
+// NewOutboxRepository creates a new event.OutboxRepository backed by the user_svc.outbox table.
+func NewOutboxRepository(db *gorm.DB) event.OutboxRepository {
+	return outboxRepository{db: db}
+}
+
+// AddMessage implements event.OutboxRepository. It takes part in the transaction carried by ctx if any.
+func (r outboxRepository) AddMessage(ctx context.Context, m *event.OutboxMessage) error {
+	db := conn(ctx, r.db)
+	now := db.NowFunc()
+	var aggregateID *uuid.UUID
+	if m.AggregateID != uuid.Nil {
+		aggregateID = &m.AggregateID
+	}
+	err := db.Create(&outboxMessage{
+		ID:            m.ID,
+		AggregateID:   aggregateID,
+		EventType:     m.EventType,
+		TraceID:       m.TraceID,
+		Payload:       m.Payload,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to add outbox message: %w", err)
+	}
+	m.CreatedAt = now
+	return nil
+}
+
+// ClaimPending implements event.OutboxRepository. Rows locked by another relay are skipped,
+// and the claimed rows are hidden until leaseUntil by moving their next attempt.
+// The rows after a failed row waiting for its retry are skipped, the events are published in order.
+func (r outboxRepository) ClaimPending(ctx context.Context, limit int, leaseUntil time.Time) ([]event.OutboxMessage, error) {
+	db := conn(ctx, r.db)
+	now := db.NowFunc()
+	var claimed []outboxMessage
+	err := db.Raw(`UPDATE user_svc.outbox SET next_attempt_at = ?
+		WHERE id IN (
+			SELECT o.id FROM user_svc.outbox o
+			WHERE o.sent_at IS NULL AND o.next_attempt_at <= ?
+			AND NOT EXISTS (
+				SELECT 1 FROM user_svc.outbox f
+				WHERE f.sent_at IS NULL AND f.attempts > 0 AND f.next_attempt_at > ? AND f.seq < o.seq
+			)
+			ORDER BY o.seq
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`, leaseUntil, now, now, limit).Scan(&claimed).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox messages: %w", err)
+	}
+
+	// RETURNING doesn't keep the order of the sub query
+	slices.SortFunc(claimed, func(a, b outboxMessage) int {
+		return int(a.Seq - b.Seq)
+	})
+	msgs := make([]event.OutboxMessage, len(claimed))
+	for i, m := range claimed {
+		msgs[i] = event.OutboxMessage{
+			ID:        m.ID,
+			EventType: m.EventType,
+			TraceID:   m.TraceID,
+			Payload:   m.Payload,
+			Attempts:  m.Attempts,
+			CreatedAt: m.CreatedAt,
+		}
+		if m.AggregateID != nil {
+			msgs[i].AggregateID = *m.AggregateID
+		}
+	}
+	return msgs, nil
+}
+
+// MarkSent implements event.OutboxRepository.
+func (r outboxRepository) MarkSent(ctx context.Context, id uuid.UUID) error {
+	db := conn(ctx, r.db)
+	err := db.Model(&outboxMessage{}).Where("id = ?", id).
+		Update("sent_at", db.NowFunc()).Error
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox message as sent: %w", err)
+	}
+	return nil
+}
+
+// Release implements event.OutboxRepository.
+func (r outboxRepository) Release(ctx context.Context, ids ...uuid.UUID) error {
+	db := conn(ctx, r.db)
+	err := db.Model(&outboxMessage{}).Where("id IN ? AND sent_at IS NULL", ids).
+		Update("next_attempt_at", db.NowFunc()).Error
+	if err != nil {
+		return fmt.Errorf("failed to release outbox messages: %w", err)
+	}
+	return nil
+}
+
+// MarkFailed implements event.OutboxRepository.
+func (r outboxRepository) MarkFailed(ctx context.Context, id uuid.UUID, reason string, retryAt time.Time) error {
+	err := conn(ctx, r.db).Model(&outboxMessage{}).Where("id = ?", id).
+		Updates(map[string]any{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"last_error":      reason,
+			"next_attempt_at": retryAt,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox message as failed: %w", err)
+	}
+	return nil
+}
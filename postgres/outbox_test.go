@@ -0,0 +1,163 @@
+package postgres_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zechao/faceit-user-svc/event"
+	"github.com/zechao/faceit-user-svc/postgres"
+)
+
+func TestOutbox(t *testing.T) {
+	ctx := context.Background()
+	db, err := setupTestDatabase(t)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+
+	t.Run("claim pending messages in order", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		outbox := postgres.NewOutboxRepository(tx)
+		msgs := []*event.OutboxMessage{newOutboxMessage(), newOutboxMessage(), newOutboxMessage()}
+		for _, m := range msgs {
+			require.NoError(t, outbox.AddMessage(ctx, m))
+		}
+
+		res, err := outbox.ClaimPending(ctx, 2, time.Now().UTC().Add(time.Minute))
+		assert.NoError(t, err)
+		require.Len(t, res, 2)
+		assert.Equal(t, msgs[0].ID, res[0].ID)
+		assert.Equal(t, msgs[1].ID, res[1].ID)
+		assert.JSONEq(t, string(msgs[0].Payload), string(res[0].Payload))
+		assert.Equal(t, msgs[0].TraceID, res[0].TraceID)
+		assert.Equal(t, msgs[0].EventType, res[0].EventType)
+
+		// claimed messages are hidden until the lease ends
+		res, err = outbox.ClaimPending(ctx, 10, time.Now().UTC().Add(time.Minute))
+		assert.NoError(t, err)
+		require.Len(t, res, 1)
+		assert.Equal(t, msgs[2].ID, res[0].ID)
+	})
+
+	t.Run("store aggregate id", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		outbox := postgres.NewOutboxRepository(tx)
+		withAggregate := newOutboxMessage()
+		withAggregate.AggregateID = uuid.New()
+		require.NoError(t, outbox.AddMessage(ctx, withAggregate))
+		withoutAggregate := newOutboxMessage()
+		require.NoError(t, outbox.AddMessage(ctx, withoutAggregate))
+
+		res, err := outbox.ClaimPending(ctx, 10, time.Now().UTC().Add(time.Minute))
+		assert.NoError(t, err)
+		require.Len(t, res, 2)
+		assert.Equal(t, withAggregate.AggregateID, res[0].AggregateID)
+		assert.Equal(t, uuid.Nil, res[1].AggregateID)
+		var stored []*uuid.UUID
+		require.NoError(t, tx.Table("user_svc.outbox").Order("seq").Pluck("aggregate_id", &stored).Error)
+		assert.Equal(t, []*uuid.UUID{&withAggregate.AggregateID, nil}, stored)
+	})
+
+	t.Run("sent messages are not claimed again", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		outbox := postgres.NewOutboxRepository(tx)
+		m := newOutboxMessage()
+		require.NoError(t, outbox.AddMessage(ctx, m))
+
+		// lease already expired
+		res, err := outbox.ClaimPending(ctx, 10, time.Now().UTC().Add(-time.Minute))
+		assert.NoError(t, err)
+		require.Len(t, res, 1)
+		assert.NoError(t, outbox.MarkSent(ctx, m.ID))
+
+		res, err = outbox.ClaimPending(ctx, 10, time.Now().UTC())
+		assert.NoError(t, err)
+		assert.Empty(t, res)
+	})
+
+	t.Run("failed messages are retried after retry time", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		outbox := postgres.NewOutboxRepository(tx)
+		m := newOutboxMessage()
+		require.NoError(t, outbox.AddMessage(ctx, m))
+
+		assert.NoError(t, outbox.MarkFailed(ctx, m.ID, "nats down", time.Now().UTC().Add(time.Hour)))
+		res, err := outbox.ClaimPending(ctx, 10, time.Now().UTC())
+		assert.NoError(t, err)
+		assert.Empty(t, res)
+
+		assert.NoError(t, outbox.MarkFailed(ctx, m.ID, "nats down", time.Now().UTC().Add(-time.Second)))
+		res, err = outbox.ClaimPending(ctx, 10, time.Now().UTC())
+		assert.NoError(t, err)
+		require.Len(t, res, 1)
+		assert.Equal(t, 2, res[0].Attempts)
+	})
+
+	t.Run("messages after a failed message wait for its retry", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		outbox := postgres.NewOutboxRepository(tx)
+		msgs := []*event.OutboxMessage{newOutboxMessage(), newOutboxMessage(), newOutboxMessage()}
+		for _, m := range msgs {
+			require.NoError(t, outbox.AddMessage(ctx, m))
+		}
+
+		res, err := outbox.ClaimPending(ctx, 10, time.Now().UTC().Add(time.Minute))
+		assert.NoError(t, err)
+		require.Len(t, res, 3)
+
+		// the first publish fails and the rest of the batch is released
+		assert.NoError(t, outbox.MarkFailed(ctx, msgs[0].ID, "nats down", time.Now().UTC().Add(time.Hour)))
+		assert.NoError(t, outbox.Release(ctx, msgs[1].ID, msgs[2].ID))
+		require.NoError(t, outbox.AddMessage(ctx, newOutboxMessage()))
+
+		res, err = outbox.ClaimPending(ctx, 10, time.Now().UTC().Add(time.Minute))
+		assert.NoError(t, err)
+		assert.Empty(t, res)
+
+		// once the retry is due, the events are claimed in the order they were written
+		assert.NoError(t, outbox.MarkFailed(ctx, msgs[0].ID, "nats down", time.Now().UTC().Add(-time.Second)))
+		res, err = outbox.ClaimPending(ctx, 10, time.Now().UTC().Add(time.Minute))
+		assert.NoError(t, err)
+		require.Len(t, res, 4)
+		for i, m := range msgs {
+			assert.Equal(t, m.ID, res[i].ID)
+		}
+	})
+
+	t.Run("released messages can be claimed again", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		outbox := postgres.NewOutboxRepository(tx)
+		m := newOutboxMessage()
+		require.NoError(t, outbox.AddMessage(ctx, m))
+
+		res, err := outbox.ClaimPending(ctx, 10, time.Now().UTC().Add(time.Hour))
+		assert.NoError(t, err)
+		require.Len(t, res, 1)
+
+		assert.NoError(t, outbox.Release(ctx, m.ID))
+		res, err = outbox.ClaimPending(ctx, 10, time.Now().UTC().Add(time.Hour))
+		assert.NoError(t, err)
+		require.Len(t, res, 1)
+		assert.Equal(t, m.ID, res[0].ID)
+	})
+}
+
+func newOutboxMessage() *event.OutboxMessage {
+	payload, _ := json.Marshal(uuid.New())
+	return &event.OutboxMessage{
+		ID:        uuid.New(),
+		EventType: "UserCreated",
+		TraceID:   uuid.NewString(),
+		Payload:   payload,
+	}
+}
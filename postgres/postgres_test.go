@@ -2,10 +2,13 @@ package postgres_test
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/pressly/goose/v3"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go"
 	pgContainer "github.com/testcontainers/testcontainers-go/modules/postgres"
@@ -28,6 +31,19 @@ func TestContainerConnection(t *testing.T) {
 }
 
 func setupTestDatabase(t *testing.T) (*gorm.DB, error) {
+	db, err := setupEmptyTestDatabase(t)
+	if err != nil {
+		return nil, err
+	}
+	dbConn, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	return db, goose.Up(dbConn, migrationFolder)
+}
+
+// setupEmptyTestDatabase starts a database without running the migrations.
+func setupEmptyTestDatabase(t *testing.T) (*gorm.DB, error) {
 	ctx := context.Background()
 	ctr, err := pgContainer.Run(
 		ctx,
@@ -52,13 +68,90 @@ func setupTestDatabase(t *testing.T) (*gorm.DB, error) {
 			return time.Now().UTC()
 		},
 	})
-	db = db.Debug()
 	if err != nil {
 		return nil, err
 	}
+	return db.Debug(), nil
+}
+
+func TestEmailLiveUniqueMigration(t *testing.T) {
+	db, err := setupEmptyTestDatabase(t)
+	require.NoError(t, err)
 	dbConn, err := db.DB()
-	if err != nil {
-		return nil, err
+	require.NoError(t, err)
+	require.NoError(t, goose.UpTo(dbConn, migrationFolder, 6))
+
+	insertUser := func(email string) {
+		err := db.Exec(`INSERT INTO user_svc.users (first_name, last_name, nick_name, email, country, password)
+			VALUES ('john', 'doe', 'jd', ?, 'ES', 'hash')`, email).Error
+		require.NoError(t, err)
 	}
-	return db, goose.Up(dbConn, migrationFolder)
+	insertUser("John@example.com")
+	insertUser("john@example.com")
+
+	// the live users with emails that differ only by case must be fixed by hand
+	err = goose.UpTo(dbConn, migrationFolder, 7)
+	require.ErrorContains(t, err, "emails are used by several live users with a different case")
+	version, err := goose.GetDBVersion(dbConn)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), version)
+
+	require.NoError(t, db.Exec(`UPDATE user_svc.users SET deleted_at = CURRENT_TIMESTAMP WHERE email = 'John@example.com'`).Error)
+	require.NoError(t, goose.UpTo(dbConn, migrationFolder, 7))
+	var emails []string
+	require.NoError(t, db.Raw(`SELECT email FROM user_svc.users`).Scan(&emails).Error)
+	assert.Equal(t, []string{"john@example.com", "john@example.com"}, emails)
+
+	// the deleted user and the live user share the email, so the old constraint can't be restored
+	err = goose.DownTo(dbConn, migrationFolder, 6)
+	require.ErrorContains(t, err, "emails are used by several users")
+	version, err = goose.GetDBVersion(dbConn)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), version)
+
+	require.NoError(t, db.Exec(`DELETE FROM user_svc.users WHERE deleted_at IS NOT NULL`).Error)
+	require.NoError(t, goose.DownTo(dbConn, migrationFolder, 6))
+}
+
+func TestOutboxAggregateIDMigration(t *testing.T) {
+	db, err := setupEmptyTestDatabase(t)
+	require.NoError(t, err)
+	dbConn, err := db.DB()
+	require.NoError(t, err)
+	require.NoError(t, goose.UpTo(dbConn, migrationFolder, 9))
+
+	createdID, deletedID := uuid.New(), uuid.New()
+	for _, payload := range []string{
+		fmt.Sprintf(`{"user":{"id":%q}}`, createdID),
+		fmt.Sprintf(`{"id":%q}`, deletedID),
+		`"data"`,
+	} {
+		err := db.Exec(`INSERT INTO user_svc.outbox (event_type, trace_id, payload) VALUES ('test-event', 'trace', ?)`, payload).Error
+		require.NoError(t, err)
+	}
+
+	// the events written before the migration are filled from their payload
+	require.NoError(t, goose.UpTo(dbConn, migrationFolder, 10))
+	var ids []*uuid.UUID
+	require.NoError(t, db.Table("user_svc.outbox").Order("seq").Pluck("aggregate_id", &ids).Error)
+	assert.Equal(t, []*uuid.UUID{&createdID, &deletedID, nil}, ids)
+}
+
+func TestIdempotencyUserIDMigration(t *testing.T) {
+	db, err := setupEmptyTestDatabase(t)
+	require.NoError(t, err)
+	dbConn, err := db.DB()
+	require.NoError(t, err)
+	require.NoError(t, goose.UpTo(dbConn, migrationFolder, 10))
+
+	userID := uuid.New()
+	err = db.Exec(`INSERT INTO user_svc.idempotency_keys (key, request_hash, password_hash, response, expires_at)
+		VALUES ('key', 'hash', 'password hash', ?, CURRENT_TIMESTAMP)`, fmt.Sprintf(`{"ID":%q}`, userID)).Error
+	require.NoError(t, err)
+
+	// the records written before the migration are filled from their response
+	require.NoError(t, goose.UpTo(dbConn, migrationFolder, 11))
+	var ids []uuid.UUID
+	require.NoError(t, db.Table("user_svc.idempotency_keys").Pluck("user_id", &ids).Error)
+	assert.Equal(t, []uuid.UUID{userID}, ids)
 }
@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/zechao/faceit-user-svc/user"
+	"gorm.io/gorm"
+)
+
+type txKey struct{}
+
+type transactor struct {
+	db *gorm.DB
+}
+
+var _ user.Transactor = transactor{}
+
+// NewTransactor creates a new user.Transactor backed by gorm transactions.
+func NewTransactor(db *gorm.DB) user.Transactor {
+	return transactor{db: db}
+}
+
+// WithinTransaction implements user.Transactor. The transaction is stored in the context passed to fn,
+// nested calls reuse it by creating a savepoint.
+func (t transactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return conn(ctx, t.db).Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+// WithinReadOnlyTransaction implements user.Transactor, like ExportUsers it begins the transaction
+// with sql.LevelRepeatableRead and ReadOnly. A nested call is a savepoint, which can't change them.
+func (t transactor) WithinReadOnlyTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return conn(ctx, t.db).Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+}
+
+// conn returns the transaction carried by ctx if any, otherwise the given db, bound to ctx.
+func conn(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+	return db.WithContext(ctx)
+}
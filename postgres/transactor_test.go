@@ -0,0 +1,106 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/zechao/faceit-user-svc/errors"
+	"github.com/zechao/faceit-user-svc/postgres"
+)
+
+func TestWithinTransaction(t *testing.T) {
+	ctx := context.Background()
+	db, err := setupTestDatabase(t)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+
+	errTest := errors.New("test error")
+
+	t.Run("commit when fn succeeds", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		transactor := postgres.NewTransactor(tx)
+		repo := postgres.NewUserRepository(tx)
+		tu := testUser
+
+		err := transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+			_, err := repo.CreateUser(ctx, &tu)
+			return err
+		})
+		assert.NoError(t, err)
+
+		res, err := repo.GetUserByID(ctx, tu.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, tu.ID, res.ID)
+	})
+
+	t.Run("rollback when fn fails", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		transactor := postgres.NewTransactor(tx)
+		repo := postgres.NewUserRepository(tx)
+		outbox := postgres.NewOutboxRepository(tx)
+		tu := testUser
+
+		err := transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+			_, err := repo.CreateUser(ctx, &tu)
+			assert.NoError(t, err)
+			err = outbox.AddMessage(ctx, newOutboxMessage())
+			assert.NoError(t, err)
+			return errTest
+		})
+		assert.ErrorIs(t, err, errTest)
+
+		// neither the user nor the event are saved
+		_, err = repo.GetUserByID(ctx, tu.ID)
+		assert.ErrorIs(t, err, errors.ErrNotfound)
+		var count int64
+		assert.NoError(t, tx.Table("user_svc.outbox").Count(&count).Error)
+		assert.Zero(t, count)
+	})
+}
+
+func TestWithinReadOnlyTransaction(t *testing.T) {
+	ctx := context.Background()
+	db, err := setupTestDatabase(t)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+	transactor := postgres.NewTransactor(db)
+	repo := postgres.NewUserRepository(db)
+
+	t.Run("read a single snapshot", func(t *testing.T) {
+		var before, after int64
+		err := transactor.WithinReadOnlyTransaction(ctx, func(txCtx context.Context) error {
+			var err error
+			before, err = repo.CountUsers(txCtx, nil)
+			if err != nil {
+				return err
+			}
+			// the user created meanwhile by another transaction isn't seen
+			tu := testUser
+			tu.ID = uuid.New()
+			tu.Email = "snapshot@example.com"
+			if _, err := repo.CreateUser(ctx, &tu); err != nil {
+				return err
+			}
+			after, err = repo.CountUsers(txCtx, nil)
+			return err
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, before, after)
+	})
+
+	t.Run("fail writing", func(t *testing.T) {
+		tu := testUser
+		err := transactor.WithinReadOnlyTransaction(ctx, func(ctx context.Context) error {
+			_, err := repo.CreateUser(ctx, &tu)
+			return err
+		})
+		assert.ErrorContains(t, err, "read-only transaction")
+
+		_, err = repo.GetUserByID(ctx, tu.ID)
+		assert.ErrorIs(t, err, errors.ErrNotfound)
+	})
+}
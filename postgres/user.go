@@ -2,13 +2,17 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/zechao/faceit-user-svc/errors"
 	"github.com/zechao/faceit-user-svc/query"
 	"github.com/zechao/faceit-user-svc/user"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type userRepository struct {
@@ -23,7 +27,7 @@ func NewUserRepository(db *gorm.DB) user.Repository {
 
 // CreateUser creates a new user record in the database. return nil if success.
 func (r userRepository) CreateUser(ctx context.Context, u *user.User) (*user.User, error) {
-	err := r.db.Create(&u).Error
+	err := conn(ctx, r.db).Create(u).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrDuplicatedKey) {
 			return nil, errors.ErrDuplicated
@@ -34,32 +38,150 @@ func (r userRepository) CreateUser(ctx context.Context, u *user.User) (*user.Use
 }
 
 // Delete perform soft delete operation, it won't delete the record from database but will
-// set deleted_at field with a delete timestamp.
-func (r userRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
-	err := r.db.Delete(&user.User{}, id).Error
-	if err != nil {
-		return fmt.Errorf("failed to delete user: %w", err)
+// set deleted_at field with a delete timestamp. The version is checked in the same statement.
+func (r userRepository) DeleteUser(ctx context.Context, id uuid.UUID, version *int64) error {
+	db := conn(ctx, r.db).Model(&user.User{}).Where("id = ?", id)
+	if version != nil {
+		db = db.Where("version = ?", *version)
+	}
+	// the soft delete is an update, so the version is incremented with it
+	res := db.Updates(map[string]any{
+		"deleted_at": gorm.Expr("CURRENT_TIMESTAMP"),
+		"version":    gorm.Expr("version + 1"),
+	})
+	if res.Error != nil {
+		return fmt.Errorf("failed to delete user: %w", res.Error)
+	}
+	if res.RowsAffected == 0 && version != nil {
+		// nothing was deleted, either the version changed or the user doesn't exist or is deleted
+		var count int64
+		if err := conn(ctx, r.db).Model(&user.User{}).Where("id = ?", id).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+		if count > 0 {
+			return errors.ErrVersionMismatch
+		}
+	}
+	if res.RowsAffected == 0 {
+		return errors.ErrNotfound
 	}
 	return nil
 }
 
-// Update perform update the given fields and return updated user.
-func (r userRepository) UpdateUser(ctx context.Context, u *user.User) (*user.User, error) {
-	err := r.db.Save(&u).Error
+// RestoreUser clears deleted_at of the soft deleted user, the restored row is returned by the same statement.
+// The partial unique index on the email makes it fail if a live user has taken the email since the delete.
+func (r userRepository) RestoreUser(ctx context.Context, id uuid.UUID) (*user.User, error) {
+	var u user.User
+	res := conn(ctx, r.db).Unscoped().Model(&u).Clauses(clause.Returning{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Updates(map[string]any{
+			"deleted_at": nil,
+			"version":    gorm.Expr("version + 1"),
+		})
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrDuplicatedKey) {
+			return nil, errors.ErrDuplicated
+		}
+		return nil, fmt.Errorf("failed to restore user: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return nil, errors.ErrNotfound
+	}
+	return &u, nil
+}
+
+// EraseUser deletes the user row, unlike DeleteUser nothing is kept. The refresh tokens of the user are
+// deleted by the foreign key, and its events in the outbox in the same transaction.
+func (r userRepository) EraseUser(ctx context.Context, id uuid.UUID, version *int64) error {
+	db := conn(ctx, r.db).Unscoped().Where("id = ?", id)
+	if version != nil {
+		db = db.Where("version = ?", *version)
+	}
+	res := db.Delete(&user.User{})
+	if res.Error != nil {
+		return fmt.Errorf("failed to erase user: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		if version != nil {
+			return errors.ErrVersionMismatch
+		}
+		return errors.ErrNotfound
+	}
+	return deleteUserMessages(conn(ctx, r.db), id)
+}
+
+// PurgeDeletedUsers deletes a batch of the users soft deleted before deletedBefore in a single statement,
+// then their events in the outbox. The rows locked by another purge are skipped, so concurrent workers
+// don't wait for each other.
+func (r userRepository) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time, limit int) ([]uuid.UUID, error) {
+	batch := conn(ctx, r.db).Unscoped().Model(&user.User{}).Select("id").
+		Where("deleted_at < ?", deletedBefore).
+		Order("deleted_at").
+		Limit(limit).
+		Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsSkipLocked})
+
+	var purged []user.User
+	err := conn(ctx, r.db).Unscoped().Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).
+		Where("id IN (?)", batch).
+		Delete(&purged).Error
 	if err != nil {
-		if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, fmt.Errorf("failed to purge deleted users: %w", err)
+	}
+	ids := make([]uuid.UUID, len(purged))
+	for i, u := range purged {
+		ids[i] = u.ID
+	}
+	if len(ids) == 0 {
+		return ids, nil
+	}
+	if err := deleteUserMessages(conn(ctx, r.db), ids...); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Update perform update the given columns and return updated user.
+// It's a strict UPDATE ... WHERE id = ? AND deleted_at IS NULL, a missing or soft deleted user is never
+// created again. Only the columns, the version and updated_at are written. The version read with the user
+// is checked and incremented in the same statement, so concurrent updates of the same version can't
+// overwrite each other: the last one gets errors.ErrVersionMismatch.
+func (r userRepository) UpdateUser(ctx context.Context, u *user.User, columns []string) (*user.User, error) {
+	version := u.Version
+	u.Version++
+	// gorm adds deleted_at IS NULL to the updates of soft deletable models
+	res := conn(ctx, r.db).Model(u).
+		Where("version = ?", version).
+		Select(append(columns[:len(columns):len(columns)], "version", "updated_at")).
+		Updates(u)
+	if res.Error != nil {
+		u.Version = version
+		if errors.Is(res.Error, gorm.ErrDuplicatedKey) {
 			return nil, errors.ErrDuplicated
 		}
+		return nil, fmt.Errorf("failed to update user: %w", res.Error)
+	}
+	if res.RowsAffected > 0 {
+		return u, nil
+	}
+
+	// nothing was updated, either the version changed or the user doesn't exist or is deleted
+	u.Version = version
+	var count int64
+	if err := conn(ctx, r.db).Model(&user.User{}).Where("id = ?", u.ID).Count(&count).Error; err != nil {
 		return nil, fmt.Errorf("failed to update user: %w", err)
 	}
-	return u, nil
+	if count > 0 {
+		return nil, errors.ErrVersionMismatch
+	}
+	return nil, errors.ErrNotfound
 }
 
 // List list all users in the database. It should be able to filter and paginate the result based on the provided query object.
+// Only the response fields of the query are loaded, the password is never selected.
 func (r userRepository) ListUsers(ctx context.Context, q query.Query) ([]user.User, error) {
 	var users []user.User
-	queryDB := q.ApplyQuery(r.db)
-	err := queryDB.WithContext(ctx).Find(&users).Error
+	queryDB := q.ApplyQuery(conn(ctx, r.db))
+	err := queryDB.Find(&users).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrInvalidField) {
 			return nil, errors.ErrInvalidPayload
@@ -70,13 +192,8 @@ func (r userRepository) ListUsers(ctx context.Context, q query.Query) ([]user.Us
 }
 
 // Count returns the number of users in the database based on the provided filters.
-func (r userRepository) CountUsers(ctx context.Context, filters map[string][]string) (int64, error) {
-	db := r.db.WithContext(ctx).Model(&user.User{})
-	for column, values := range filters {
-		if len(values) > 0 {
-			db = db.Where(column+" IN (?)", values)
-		}
-	}
+func (r userRepository) CountUsers(ctx context.Context, filters query.Filters) (int64, error) {
+	db := query.ApplyFilters(conn(ctx, r.db).Model(&user.User{}), filters)
 	var count int64
 	err := db.Count(&count).Error
 	if err != nil {
@@ -88,15 +205,173 @@ func (r userRepository) CountUsers(ctx context.Context, filters map[string][]str
 	return count, err
 }
 
+// EstimateCountUsers returns the number of users matching the filters estimated by the query planner.
+// It doesn't scan the table, the estimate is as accurate as the table statistics of the last ANALYZE.
+func (r userRepository) EstimateCountUsers(ctx context.Context, filters query.Filters) (int64, error) {
+	// the statement is only built to get its SQL, the values stay bound in the EXPLAIN
+	stmt := query.ApplyFilters(conn(ctx, r.db).Session(&gorm.Session{DryRun: true}).Model(&user.User{}), filters).Find(&[]user.User{})
+	if stmt.Error != nil {
+		if errors.Is(stmt.Error, gorm.ErrInvalidField) {
+			return 0, errors.ErrInvalidPayload
+		}
+		return 0, fmt.Errorf("failed to build estimate: %w", stmt.Error)
+	}
+
+	var plan string
+	err := conn(ctx, r.db).Raw("EXPLAIN (FORMAT JSON) "+stmt.Statement.SQL.String(), stmt.Statement.Vars...).Row().Scan(&plan)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get estimate: %w", err)
+	}
+	var explain []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal([]byte(plan), &explain); err != nil {
+		return 0, fmt.Errorf("failed to parse estimate plan: %w", err)
+	}
+	if len(explain) == 0 {
+		return 0, fmt.Errorf("failed to parse estimate plan: empty plan")
+	}
+	return int64(explain[0].Plan.Rows), nil
+}
+
+// searchCondition matches the users whose names, nickname or email contain the words of the term (tsvector),
+// are similar to it tolerating typos (%), or contain a part similar to it (<%). All of them use the indexes.
+const searchCondition = `search_vector @@ plainto_tsquery('simple', @term)
+	OR @term % first_name OR @term % last_name OR @term % nick_name OR @term % email
+	OR @term <% first_name OR @term <% last_name OR @term <% nick_name OR @term <% email`
+
+// searchRank ranks the users by their most similar field, the users matching whole words first.
+const searchRank = `GREATEST(word_similarity(@term, first_name), word_similarity(@term, last_name),
+	word_similarity(@term, nick_name), word_similarity(@term, email))
+	+ ts_rank(search_vector, plainto_tsquery('simple', @term))`
+
+// SearchUsers implements user.Repository.
+func (r userRepository) SearchUsers(ctx context.Context, s query.Search) ([]user.User, error) {
+	var users []user.User
+	term := sql.Named("term", s.Term)
+	err := query.ApplySelect(conn(ctx, r.db), s.Fields, nil).
+		Where(searchCondition, term).
+		Order(clause.OrderBy{Expression: clause.NamedExpr{SQL: searchRank + " DESC, id", Vars: []any{term}}}).
+		Offset((s.Page - 1) * s.PageSize).
+		Limit(s.PageSize).
+		Find(&users).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrInvalidField) {
+			return nil, errors.ErrInvalidPayload
+		}
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+	return users, nil
+}
+
+// CountSearchUsers implements user.Repository.
+func (r userRepository) CountSearchUsers(ctx context.Context, term string) (int64, error) {
+	var count int64
+	err := conn(ctx, r.db).Model(&user.User{}).Where(searchCondition, sql.Named("term", term)).Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count searched users: %w", err)
+	}
+	return count, nil
+}
+
+// exportBatchSize is the number of users fetched at once from the export cursor.
+const exportBatchSize = 500
+
+// ExportUsers implements user.Repository. The users are read through a server-side cursor declared in
+// a read only repeatable read transaction, so the export is a consistent snapshot and only a batch
+// of users is held in memory at once.
+func (r userRepository) ExportUsers(ctx context.Context, e query.Export, fn func(u *user.User) error) error {
+	// the statement is only built to get its SQL, the values stay bound in the cursor declaration
+	stmt := e.ApplyExport(conn(ctx, r.db).Session(&gorm.Session{DryRun: true}).Model(&user.User{})).Find(&[]user.User{})
+	if stmt.Error != nil {
+		if errors.Is(stmt.Error, gorm.ErrInvalidField) {
+			return errors.ErrInvalidPayload
+		}
+		return fmt.Errorf("failed to build export: %w", stmt.Error)
+	}
+
+	err := conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec("DECLARE users_export NO SCROLL CURSOR FOR "+stmt.Statement.SQL.String(), stmt.Statement.Vars...).Error
+		if err != nil {
+			return err
+		}
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			var users []user.User
+			if err := tx.Raw(fmt.Sprintf("FETCH FORWARD %d FROM users_export", exportBatchSize)).Scan(&users).Error; err != nil {
+				return err
+			}
+			for i := range users {
+				if err := fn(&users[i]); err != nil {
+					return err
+				}
+			}
+			if len(users) < exportBatchSize {
+				return nil
+			}
+		}
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to export users: %w", err)
+	}
+	return nil
+}
+
+// GetUserByIDWithDeleted implements user.Repository.
+func (r userRepository) GetUserByIDWithDeleted(ctx context.Context, id uuid.UUID) (*user.User, error) {
+	var u user.User
+	err := conn(ctx, r.db).Unscoped().First(&u, "id = ?", id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.ErrNotfound
+		}
+		return nil, fmt.Errorf("failed to get user by ID: %w", err)
+	}
+	return &u, nil
+}
+
 // GetUserByID implements user.Repository.
 func (r userRepository) GetUserByID(ctx context.Context, id uuid.UUID) (*user.User, error) {
 	var u user.User
-	err := r.db.WithContext(ctx).First(&u, "id = ?", id).Error
+	err := conn(ctx, r.db).First(&u, "id = ?", id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.ErrNotfound
+		}
+		return nil, fmt.Errorf("failed to get user by ID: %w", err)
+	}
+	return &u, nil
+}
+
+// GetUserFields implements user.Repository. The version is selected with the fields, it's the ETag of the user.
+func (r userRepository) GetUserFields(ctx context.Context, id uuid.UUID, fields []string) (*user.User, error) {
+	var u user.User
+	err := query.ApplySelect(conn(ctx, r.db), fields, nil, "version").First(&u, "id = ?", id).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.ErrNotfound
 		}
+		if errors.Is(err, gorm.ErrInvalidField) {
+			return nil, errors.ErrInvalidPayload
+		}
 		return nil, fmt.Errorf("failed to get user by ID: %w", err)
 	}
 	return &u, nil
 }
+
+// GetUserByEmail implements user.Repository. The condition matches the unique index on lower(email).
+func (r userRepository) GetUserByEmail(ctx context.Context, email string) (*user.User, error) {
+	var u user.User
+	err := conn(ctx, r.db).First(&u, "lower(email) = ?", user.NormalizeEmail(email)).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.ErrNotfound
+		}
+		return nil, fmt.Errorf("failed to get user by email: %w", err)
+	}
+	return &u, nil
+}
@@ -3,12 +3,15 @@ package postgres_test
 import (
 	"context"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/zechao/faceit-user-svc/auth"
 	"github.com/zechao/faceit-user-svc/errors"
+	"github.com/zechao/faceit-user-svc/event"
 	"github.com/zechao/faceit-user-svc/postgres"
 	"github.com/zechao/faceit-user-svc/query"
 	"github.com/zechao/faceit-user-svc/user"
@@ -57,6 +60,45 @@ func TestCreateUser(t *testing.T) {
 			"should return error because of duplicated email")
 	})
 
+	t.Run("fail by duplicated email in another case", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		tu := testUser
+		_, err := repo.CreateUser(ctx, &tu)
+		assert.NoError(t, err)
+
+		tu2 := testUser
+		tu2.ID = uuid.New()
+		tu2.Email = strings.ToUpper(testUser.Email)
+		res, err := repo.CreateUser(ctx, &tu2)
+		assert.Nil(t, res)
+		assert.ErrorIs(t, err, errors.ErrDuplicated)
+	})
+
+	t.Run("success reuse email of deleted user", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		tu := testUser
+		_, err := repo.CreateUser(ctx, &tu)
+		assert.NoError(t, err)
+		err = repo.DeleteUser(ctx, tu.ID, nil)
+		assert.NoError(t, err)
+
+		tu2 := testUser
+		tu2.ID = uuid.New()
+		res, err := repo.CreateUser(ctx, &tu2)
+		assert.NoError(t, err)
+		assert.Equal(t, tu2.ID, res.ID)
+
+		// the email is unique again among the live users
+		tu3 := testUser
+		tu3.ID = uuid.New()
+		_, err = repo.CreateUser(ctx, &tu3)
+		assert.ErrorIs(t, err, errors.ErrDuplicated)
+	})
+
 	t.Run("fail by invalid input", func(t *testing.T) {
 		tx := db.Begin()
 		defer tx.Rollback()
@@ -83,23 +125,102 @@ func TestUpdateUser(t *testing.T) {
 		err := tx.Create(&tu).Error
 		assert.NoError(t, err)
 
-		tu2 := testUser
+		// the user is updated from the version it was read with
+		tu2 := tu
 		tu2.Country = "UK"
 		tu2.NickName = "nickname"
 
-		res, err := repo.UpdateUser(ctx, &tu2)
+		res, err := repo.UpdateUser(ctx, &tu2, []string{"country", "nick_name"})
 		assert.NoError(t, err)
 		assertEqualUser(t, tu2, res)
+		assert.Equal(t, tu.Version+1, res.Version)
 	})
 
-	t.Run("success create if not exist", func(t *testing.T) {
+	t.Run("success update only the columns", func(t *testing.T) {
 		tx := db.Begin()
 		defer tx.Rollback()
 		repo := postgres.NewUserRepository(tx)
 		tu := testUser
-		res, err := repo.UpdateUser(ctx, &tu)
+		err := tx.Create(&tu).Error
 		assert.NoError(t, err)
-		assertEqualUser(t, tu, res)
+
+		// the other fields are not written, even if they differ from the stored ones
+		tu2 := tu
+		tu2.NickName = "nickname"
+		tu2.Country = "UK"
+		_, err = repo.UpdateUser(ctx, &tu2, []string{"nick_name"})
+		assert.NoError(t, err)
+
+		stored, err := repo.GetUserByID(ctx, tu.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "nickname", stored.NickName)
+		assert.Equal(t, tu.Country, stored.Country)
+		assert.Equal(t, tu.Version+1, stored.Version)
+	})
+
+	t.Run("fail by concurrent update", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		tu := testUser
+		err := tx.Create(&tu).Error
+		assert.NoError(t, err)
+
+		// both updates read the same version, the second one must not overwrite the first one
+		first, second := tu, tu
+		first.NickName = "first"
+		second.NickName = "second"
+		_, err = repo.UpdateUser(ctx, &first, []string{"nick_name"})
+		assert.NoError(t, err)
+		res, err := repo.UpdateUser(ctx, &second, []string{"nick_name"})
+		assert.ErrorIs(t, err, errors.ErrVersionMismatch)
+		assert.Nil(t, res)
+		assert.Equal(t, tu.Version, second.Version)
+
+		stored, err := repo.GetUserByID(ctx, tu.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "first", stored.NickName)
+		assert.Equal(t, tu.Version+1, stored.Version)
+	})
+
+	t.Run("fail by not exist", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		tu := testUser
+		res, err := repo.UpdateUser(ctx, &tu, []string{"nick_name"})
+		assert.ErrorIs(t, err, errors.ErrNotfound)
+		assert.Nil(t, res)
+
+		// the missing user is not created
+		var count int64
+		err = tx.Model(&user.User{}).Unscoped().Where("id = ?", tu.ID).Count(&count).Error
+		assert.NoError(t, err)
+		assert.Zero(t, count)
+	})
+
+	t.Run("fail by deleted", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		tu := testUser
+		err := tx.Create(&tu).Error
+		assert.NoError(t, err)
+		err = repo.DeleteUser(ctx, tu.ID, nil)
+		assert.NoError(t, err)
+
+		// the update read the user before it was deleted
+		tu.Version++
+		tu.NickName = "nickname"
+		res, err := repo.UpdateUser(ctx, &tu, []string{"nick_name"})
+		assert.ErrorIs(t, err, errors.ErrNotfound)
+		assert.Nil(t, res)
+
+		var stored user.User
+		err = tx.Unscoped().First(&stored, "id = ?", tu.ID).Error
+		assert.NoError(t, err)
+		assert.True(t, stored.DeletedAt.Valid)
+		assert.Equal(t, testUser.NickName, stored.NickName)
 	})
 
 	t.Run("fail updating to existing email", func(t *testing.T) {
@@ -119,7 +240,7 @@ func TestUpdateUser(t *testing.T) {
 		// update to existing email
 		tu.Email = tu2.Email
 
-		res, err := repo.UpdateUser(ctx, &tu)
+		res, err := repo.UpdateUser(ctx, &tu, []string{"email"})
 		assert.ErrorIs(t, err, errors.ErrDuplicated)
 		assert.Nil(t, res)
 	})
@@ -137,7 +258,7 @@ func TestDeleteUser(t *testing.T) {
 
 		err := db.Create(&tu).Error
 		assert.NoError(t, err)
-		err = repo.DeleteUser(ctx, tu.ID)
+		err = repo.DeleteUser(ctx, tu.ID, nil)
 		assert.NoError(t, err)
 		// shouldn't return any
 		err = db.First(&tu, tu.ID).Error
@@ -149,239 +270,840 @@ func TestDeleteUser(t *testing.T) {
 		assert.Equal(t, u.ID, tu.ID)
 	})
 
-	t.Run("success nothing deleted", func(t *testing.T) {
+	t.Run("fail delete by user not found", func(t *testing.T) {
 		tx := db.Begin()
 		defer tx.Rollback()
 		repo := postgres.NewUserRepository(tx)
 
-		err = repo.DeleteUser(ctx, uuid.New())
-		assert.NoError(t, err)
+		err = repo.DeleteUser(ctx, uuid.New(), nil)
+		assert.ErrorIs(t, err, errors.ErrNotfound)
 	})
 
-}
-
-func TestListUser(t *testing.T) {
-	ctx := context.Background()
-	db, err := setupTestDatabase(t)
-	assert.NoError(t, err)
-	assert.NotNil(t, db)
-
-	t.Run("success list empty users", func(t *testing.T) {
+	t.Run("fail delete by user already deleted", func(t *testing.T) {
 		tx := db.Begin()
 		defer tx.Rollback()
 		repo := postgres.NewUserRepository(tx)
-		res, err := repo.ListUsers(ctx, query.Query{
-			PageSize: 1000,
-		})
+		tu := testUser
+		err := tx.Create(&tu).Error
 		assert.NoError(t, err)
-		assert.Empty(t, res)
+
+		assert.NoError(t, repo.DeleteUser(ctx, tu.ID, nil))
+		err = repo.DeleteUser(ctx, tu.ID, nil)
+		assert.ErrorIs(t, err, errors.ErrNotfound)
 	})
 
-	t.Run("success list all users", func(t *testing.T) {
+	t.Run("success delete with version", func(t *testing.T) {
 		tx := db.Begin()
 		defer tx.Rollback()
 		repo := postgres.NewUserRepository(tx)
-		users, err := createUsers(tx, 10, "ES")
+		tu := testUser
+		err := tx.Create(&tu).Error
 		assert.NoError(t, err)
-		assert.NotNil(t, users)
-		res, err := repo.ListUsers(ctx, query.Query{
-			PageSize: 1000,
-		})
+
+		err = repo.DeleteUser(ctx, tu.ID, &tu.Version)
 		assert.NoError(t, err)
-		assert.Len(t, res, len(users))
+		_, err = repo.GetUserByID(ctx, tu.ID)
+		assert.ErrorIs(t, err, errors.ErrNotfound)
 	})
 
-	t.Run("success list with page", func(t *testing.T) {
+	t.Run("fail delete by version mismatch", func(t *testing.T) {
 		tx := db.Begin()
 		defer tx.Rollback()
 		repo := postgres.NewUserRepository(tx)
-		users, err := createUsers(tx, 10, "ES")
+		tu := testUser
+		err := tx.Create(&tu).Error
 		assert.NoError(t, err)
-		assert.NotNil(t, users)
-		res, err := repo.ListUsers(ctx, query.Query{
-			PageSize: 3,
-			Page:     2,
-		})
+
+		staleVersion := tu.Version - 1
+		err = repo.DeleteUser(ctx, tu.ID, &staleVersion)
+		assert.ErrorIs(t, err, errors.ErrVersionMismatch)
+		_, err = repo.GetUserByID(ctx, tu.ID)
 		assert.NoError(t, err)
-		assert.Len(t, res, 3)
 	})
-	t.Run("success empty list out of page", func(t *testing.T) {
+
+	t.Run("fail delete with version by user not found", func(t *testing.T) {
 		tx := db.Begin()
 		defer tx.Rollback()
 		repo := postgres.NewUserRepository(tx)
-		users, err := createUsers(tx, 10, "ES")
-		assert.NoError(t, err)
-		assert.NotNil(t, users)
-		res, err := repo.ListUsers(ctx, query.Query{
-			PageSize: 5,
-			Page:     3,
-		})
-		assert.NoError(t, err)
-		assert.Len(t, res, 0)
+
+		version := int64(1)
+		err = repo.DeleteUser(ctx, uuid.New(), &version)
+		assert.ErrorIs(t, err, errors.ErrNotfound)
 	})
 
-	t.Run("success filter by country with page", func(t *testing.T) {
+	t.Run("fail delete with version by user already deleted", func(t *testing.T) {
 		tx := db.Begin()
 		defer tx.Rollback()
 		repo := postgres.NewUserRepository(tx)
-		users, err := createUsers(tx, 10, "ES", "GB")
-		assert.NoError(t, err)
-		assert.NotNil(t, users)
-		res, err := repo.ListUsers(ctx, query.Query{
-			PageSize: 6,
-			Page:     2,
-			Filters:  map[string][]string{"country": {"ES"}},
-		})
+		tu := testUser
+		err := tx.Create(&tu).Error
 		assert.NoError(t, err)
-		assert.Len(t, res, 4)
+
+		assert.NoError(t, repo.DeleteUser(ctx, tu.ID, nil))
+		err = repo.DeleteUser(ctx, tu.ID, &tu.Version)
+		assert.ErrorIs(t, err, errors.ErrNotfound)
 	})
 
-	t.Run("success filter by multiple filter with page", func(t *testing.T) {
+}
+
+func TestRestoreUser(t *testing.T) {
+	ctx := context.Background()
+	db, err := setupTestDatabase(t)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+
+	t.Run("success restore", func(t *testing.T) {
 		tx := db.Begin()
 		defer tx.Rollback()
 		repo := postgres.NewUserRepository(tx)
-		users, err := createUsers(tx, 10, "ES", "GB")
+		tu := testUser
+		err := tx.Create(&tu).Error
 		assert.NoError(t, err)
-		assert.NotNil(t, users)
-		res, err := repo.ListUsers(ctx, query.Query{
-			PageSize: 10,
-			Page:     1,
-			Filters: map[string][]string{
-				"country":    {"ES", "GB"},
-				"first_name": {"zechao0"},
-				"last_name":  {"jin0"},
-				"nick_name":  {"zen0"},
-				"password":   {"superpassword"},
-			},
-		})
+		err = repo.DeleteUser(ctx, tu.ID, nil)
 		assert.NoError(t, err)
-		assert.Len(t, res, 2)
-	})
 
-	t.Run("success list filter by multiple filter with order", func(t *testing.T) {
-		tx := db.Begin()
-		defer tx.Rollback()
-		repo := postgres.NewUserRepository(tx)
-		users, err := createUsers(tx, 10, "ES", "GB")
+		res, err := repo.RestoreUser(ctx, tu.ID)
 		assert.NoError(t, err)
-		assert.NotNil(t, users)
-		res, err := repo.ListUsers(ctx, query.Query{
-			PageSize:  20,
-			Page:      1,
-			SortOrder: "asc",
-			SortBy:    "first_name",
-			Filters: map[string][]string{
-				"country": {"ES", "GB"},
-			},
-		})
+		assert.Equal(t, tu.ID, res.ID)
+		assert.Equal(t, tu.Email, res.Email)
+		assert.Equal(t, tu.Password, res.Password)
+		assert.False(t, res.DeletedAt.Valid)
+		// the delete and the restore both incremented the version
+		assert.Equal(t, tu.Version+2, res.Version)
+
+		stored, err := repo.GetUserByID(ctx, tu.ID)
 		assert.NoError(t, err)
-		assert.Len(t, res, 20)
-		assert.Equal(t, res[0].FirstName, "zechao0")
-		assert.Equal(t, res[len(users)-1].FirstName, "zechao9")
+		assert.Equal(t, res.Version, stored.Version)
 	})
 
-	t.Run("success list filter by id default sort", func(t *testing.T) {
+	t.Run("fail by not deleted", func(t *testing.T) {
 		tx := db.Begin()
 		defer tx.Rollback()
 		repo := postgres.NewUserRepository(tx)
-		users, err := createUsers(tx, 10, "ES", "GB")
-		assert.NoError(t, err)
-		assert.NotNil(t, users)
-		res, err := repo.ListUsers(ctx, query.Query{
-			PageSize: 10,
-			Page:     1,
-			Filters: map[string][]string{
-				"id": {users[0].ID.String(), users[1].ID.String()},
-			},
-		})
+		tu := testUser
+		err := tx.Create(&tu).Error
 		assert.NoError(t, err)
-		assert.Len(t, res, 2)
-		assert.Equal(t, users[1].ID, res[1].ID)
-		assert.Equal(t, users[0].ID, res[0].ID)
+
+		res, err := repo.RestoreUser(ctx, tu.ID)
+		assert.ErrorIs(t, err, errors.ErrNotfound)
+		assert.Nil(t, res)
 	})
 
-	t.Run("invalid fields", func(t *testing.T) {
+	t.Run("fail by not exist", func(t *testing.T) {
 		tx := db.Begin()
 		defer tx.Rollback()
 		repo := postgres.NewUserRepository(tx)
-		res, err := repo.ListUsers(ctx, query.Query{
-			PageSize: 10,
-			Page:     1,
-			Filters: map[string][]string{
-				"dsadsa": {"ES", "GB"},
-			},
-		})
-		assert.ErrorIs(t, err, errors.ErrInvalidPayload)
+
+		res, err := repo.RestoreUser(ctx, uuid.New())
+		assert.ErrorIs(t, err, errors.ErrNotfound)
 		assert.Nil(t, res)
 	})
 
-}
-
-func TestGetUserByID(t *testing.T) {
-	ctx := context.Background()
-	db, err := setupTestDatabase(t)
-	assert.NoError(t, err)
-	assert.NotNil(t, db)
-	t.Run("success get existing user by id", func(t *testing.T) {
+	t.Run("fail by email taken", func(t *testing.T) {
 		tx := db.Begin()
 		defer tx.Rollback()
-
 		repo := postgres.NewUserRepository(tx)
 		tu := testUser
 		err := tx.Create(&tu).Error
 		assert.NoError(t, err)
-
-		res, err := repo.GetUserByID(ctx, tu.ID)
+		err = repo.DeleteUser(ctx, tu.ID, nil)
 		assert.NoError(t, err)
-		assertEqualUser(t, tu, res)
-	})
-	t.Run("fail by not found user by id", func(t *testing.T) {
-		tx := db.Begin()
-		defer tx.Rollback()
 
-		repo := postgres.NewUserRepository(tx)
+		// another user signed up with the email after the delete
+		tu2 := testUser
+		tu2.ID = uuid.New()
+		err = tx.Create(&tu2).Error
+		assert.NoError(t, err)
 
-		res, err := repo.GetUserByID(ctx, uuid.New())
-		assert.ErrorIs(t, err, errors.ErrNotfound)
+		res, err := repo.RestoreUser(ctx, tu.ID)
+		assert.ErrorIs(t, err, errors.ErrDuplicated)
 		assert.Nil(t, res)
 	})
 }
 
-func TestCountUsers(t *testing.T) {
+func TestEraseUser(t *testing.T) {
 	ctx := context.Background()
 	db, err := setupTestDatabase(t)
 	assert.NoError(t, err)
 	assert.NotNil(t, db)
-	t.Run("success count empty users", func(t *testing.T) {
+
+	t.Run("success erase with refresh tokens", func(t *testing.T) {
 		tx := db.Begin()
 		defer tx.Rollback()
 		repo := postgres.NewUserRepository(tx)
-		res, err := repo.CountUsers(ctx, nil)
+		tu := testUser
+		err := tx.Create(&tu).Error
 		assert.NoError(t, err)
-		assert.EqualValues(t, int64(0), res)
+		_, hash, err := auth.NewRefreshToken()
+		assert.NoError(t, err)
+		err = postgres.NewRefreshTokenRepository(tx).CreateRefreshToken(ctx, &auth.RefreshToken{
+			ID:        uuid.New(),
+			UserID:    tu.ID,
+			TokenHash: hash,
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		assert.NoError(t, err)
+
+		err = repo.EraseUser(ctx, tu.ID, nil)
+		assert.NoError(t, err)
+
+		// nothing is kept, not even the soft deleted row
+		var count int64
+		err = tx.Model(&user.User{}).Unscoped().Where("id = ?", tu.ID).Count(&count).Error
+		assert.NoError(t, err)
+		assert.Zero(t, count)
+		err = tx.Model(&auth.RefreshToken{}).Where("user_id = ?", tu.ID).Count(&count).Error
+		assert.NoError(t, err)
+		assert.Zero(t, count)
 	})
 
-	t.Run("success count all users", func(t *testing.T) {
+	t.Run("success erase with outbox events", func(t *testing.T) {
 		tx := db.Begin()
 		defer tx.Rollback()
 		repo := postgres.NewUserRepository(tx)
-		users, err := createUsers(tx, 10, "ES", "GB")
+		activity := postgres.NewActivityRepository(tx)
+		events := event.NewOutboxEventHandler(postgres.NewOutboxRepository(tx))
+		users, err := createUsers(tx, 2, "ES")
 		assert.NoError(t, err)
-		assert.NotNil(t, users)
-		res, err := repo.CountUsers(ctx, nil)
+		for _, u := range users {
+			assert.NoError(t, events.SendEvent(ctx, string(user.UserCreated), event.NewUserCreated(event.UserSnapshot{ID: u.ID, Email: u.Email})))
+			assert.NoError(t, events.SendEvent(ctx, string(user.UserDeleted), event.NewUserDeleted(u.ID, time.Now())))
+		}
+
+		err = repo.EraseUser(ctx, users[0].ID, nil)
 		assert.NoError(t, err)
-		assert.EqualValues(t, len(users), res)
+
+		// the events hold the personal data of the erased user, the other users keep theirs
+		res, err := activity.ListUserEvents(ctx, users[0].ID)
+		assert.NoError(t, err)
+		assert.Empty(t, res)
+		res, err = activity.ListUserEvents(ctx, users[1].ID)
+		assert.NoError(t, err)
+		assert.Len(t, res, 2)
 	})
 
-	t.Run("success count with filter users", func(t *testing.T) {
+	t.Run("success erase deleted user", func(t *testing.T) {
 		tx := db.Begin()
 		defer tx.Rollback()
 		repo := postgres.NewUserRepository(tx)
-		users, err := createUsers(tx, 10, "ES", "GB")
+		tu := testUser
+		err := tx.Create(&tu).Error
+		assert.NoError(t, err)
+		err = repo.DeleteUser(ctx, tu.ID, nil)
+		assert.NoError(t, err)
+
+		err = repo.EraseUser(ctx, tu.ID, nil)
+		assert.NoError(t, err)
+
+		var count int64
+		err = tx.Model(&user.User{}).Unscoped().Where("id = ?", tu.ID).Count(&count).Error
+		assert.NoError(t, err)
+		assert.Zero(t, count)
+	})
+
+	t.Run("fail by not exist", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+
+		err := repo.EraseUser(ctx, uuid.New(), nil)
+		assert.ErrorIs(t, err, errors.ErrNotfound)
+	})
+
+	t.Run("fail by version mismatch", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		tu := testUser
+		err := tx.Create(&tu).Error
+		assert.NoError(t, err)
+
+		stale := tu.Version + 1
+		err = repo.EraseUser(ctx, tu.ID, &stale)
+		assert.ErrorIs(t, err, errors.ErrVersionMismatch)
+
+		_, err = repo.GetUserByID(ctx, tu.ID)
+		assert.NoError(t, err)
+	})
+}
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	ctx := context.Background()
+	db, err := setupTestDatabase(t)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+
+	t.Run("success purge oldest deleted users", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		users, err := createUsers(tx, 4, "ES")
+		assert.NoError(t, err)
+		now := time.Now().UTC()
+		// users 0 and 1 were deleted long ago, 2 recently, and 3 is live
+		for i, deletedAt := range []time.Time{now.Add(-72 * time.Hour), now.Add(-48 * time.Hour), now.Add(-time.Minute)} {
+			err := tx.Model(&user.User{}).Where("id = ?", users[i].ID).Update("deleted_at", deletedAt).Error
+			assert.NoError(t, err)
+		}
+
+		ids, err := repo.PurgeDeletedUsers(ctx, now.Add(-24*time.Hour), 1)
+		assert.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{users[0].ID}, ids)
+
+		ids, err = repo.PurgeDeletedUsers(ctx, now.Add(-24*time.Hour), 10)
+		assert.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{users[1].ID}, ids)
+
+		ids, err = repo.PurgeDeletedUsers(ctx, now.Add(-24*time.Hour), 10)
+		assert.NoError(t, err)
+		assert.Empty(t, ids)
+
+		var remaining []uuid.UUID
+		err = tx.Model(&user.User{}).Unscoped().Pluck("id", &remaining).Error
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []uuid.UUID{users[2].ID, users[3].ID}, remaining)
+	})
+
+	t.Run("success purge with outbox events", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		activity := postgres.NewActivityRepository(tx)
+		events := event.NewOutboxEventHandler(postgres.NewOutboxRepository(tx))
+		users, err := createUsers(tx, 2, "ES")
+		assert.NoError(t, err)
+		now := time.Now().UTC()
+		for _, u := range users {
+			assert.NoError(t, events.SendEvent(ctx, string(user.UserDeleted), event.NewUserDeleted(u.ID, now)))
+		}
+		err = tx.Model(&user.User{}).Where("id = ?", users[0].ID).Update("deleted_at", now.Add(-48*time.Hour)).Error
+		assert.NoError(t, err)
+
+		ids, err := repo.PurgeDeletedUsers(ctx, now.Add(-24*time.Hour), 10)
+		assert.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{users[0].ID}, ids)
+
+		res, err := activity.ListUserEvents(ctx, users[0].ID)
+		assert.NoError(t, err)
+		assert.Empty(t, res)
+		res, err = activity.ListUserEvents(ctx, users[1].ID)
+		assert.NoError(t, err)
+		assert.Len(t, res, 1)
+	})
+}
+
+func TestListUser(t *testing.T) {
+	ctx := context.Background()
+	db, err := setupTestDatabase(t)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+
+	t.Run("success list empty users", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		res, err := repo.ListUsers(ctx, query.Query{
+			PageSize: 1000,
+		})
+		assert.NoError(t, err)
+		assert.Empty(t, res)
+	})
+
+	t.Run("success list all users", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		users, err := createUsers(tx, 10, "ES")
+		assert.NoError(t, err)
+		assert.NotNil(t, users)
+		res, err := repo.ListUsers(ctx, query.Query{
+			PageSize: 1000,
+		})
+		assert.NoError(t, err)
+		assert.Len(t, res, len(users))
+	})
+
+	t.Run("success list with page", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		users, err := createUsers(tx, 10, "ES")
+		assert.NoError(t, err)
+		assert.NotNil(t, users)
+		res, err := repo.ListUsers(ctx, query.Query{
+			PageSize: 3,
+			Page:     2,
+		})
+		assert.NoError(t, err)
+		assert.Len(t, res, 3)
+	})
+	t.Run("success empty list out of page", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		users, err := createUsers(tx, 10, "ES")
+		assert.NoError(t, err)
+		assert.NotNil(t, users)
+		res, err := repo.ListUsers(ctx, query.Query{
+			PageSize: 5,
+			Page:     3,
+		})
+		assert.NoError(t, err)
+		assert.Len(t, res, 0)
+	})
+
+	t.Run("success filter by country with page", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		users, err := createUsers(tx, 10, "ES", "GB")
+		assert.NoError(t, err)
+		assert.NotNil(t, users)
+		res, err := repo.ListUsers(ctx, query.Query{
+			PageSize: 6,
+			Page:     2,
+			Filters:  query.Filters{in("country", "ES")},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, res, 4)
+	})
+
+	t.Run("success filter by multiple filter with page", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		users, err := createUsers(tx, 10, "ES", "GB")
+		assert.NoError(t, err)
+		assert.NotNil(t, users)
+		res, err := repo.ListUsers(ctx, query.Query{
+			PageSize: 10,
+			Page:     1,
+			Filters: query.Filters{
+				in("country", "ES", "GB"),
+				in("first_name", "zechao0"),
+				in("last_name", "jin0"),
+				in("nick_name", "zen0"),
+			},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, res, 2)
+	})
+
+	t.Run("fail filter by sensitive field", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		_, err := createUsers(tx, 1, "ES")
+		assert.NoError(t, err)
+		res, err := repo.ListUsers(ctx, query.Query{
+			PageSize: 10,
+			Page:     1,
+			Filters: query.Filters{
+				in("password", "superpassword"),
+			},
+		})
+		assert.ErrorIs(t, err, errors.ErrInvalidPayload)
+		assert.Nil(t, res)
+	})
+
+	t.Run("success list filter by multiple filter with order", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		users, err := createUsers(tx, 10, "ES", "GB")
+		assert.NoError(t, err)
+		assert.NotNil(t, users)
+		res, err := repo.ListUsers(ctx, query.Query{
+			PageSize:  20,
+			Page:      1,
+			SortOrder: "asc",
+			SortBy:    "first_name",
+			Filters: query.Filters{
+				in("country", "ES", "GB"),
+			},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, res, 20)
+		assert.Equal(t, res[0].FirstName, "zechao0")
+		assert.Equal(t, res[len(users)-1].FirstName, "zechao9")
+	})
+
+	t.Run("success list filter by id default sort", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		users, err := createUsers(tx, 10, "ES", "GB")
+		assert.NoError(t, err)
+		assert.NotNil(t, users)
+		res, err := repo.ListUsers(ctx, query.Query{
+			PageSize: 10,
+			Page:     1,
+			Filters: query.Filters{
+				in("id", users[0].ID, users[1].ID),
+			},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, res, 2)
+		assert.Equal(t, users[1].ID, res[1].ID)
+		assert.Equal(t, users[0].ID, res[0].ID)
+	})
+
+	t.Run("invalid fields", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		res, err := repo.ListUsers(ctx, query.Query{
+			PageSize: 10,
+			Page:     1,
+			Filters: query.Filters{
+				in("dsadsa", "ES", "GB"),
+			},
+		})
+		assert.ErrorIs(t, err, errors.ErrInvalidPayload)
+		assert.Nil(t, res)
+	})
+
+	t.Run("success filter by operators", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		users, err := createUsers(tx, 12, "ES", "GB", "US")
+		assert.NoError(t, err)
+		assert.NotNil(t, users)
+		res, err := repo.ListUsers(ctx, query.Query{
+			PageSize: 100,
+			Page:     1,
+			Filters: query.Filters{
+				// zen1, zen10 and zen11
+				{Column: "nick_name", Operator: query.OpPrefix, Values: []any{"zen1"}},
+				{Column: "country", Operator: query.OpNotIn, Values: []any{"US"}},
+				{Column: "email", Operator: query.OpILike, Values: []any{"%.es@EXAMPLE.com"}},
+				{Column: "created_at", Operator: query.OpGte, Values: []any{time.Now().Add(-time.Hour)}},
+				{Column: "created_at", Operator: query.OpLt, Values: []any{time.Now().Add(time.Hour)}},
+			},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, res, 3)
+		for _, u := range res {
+			assert.Equal(t, "ES", u.Country)
+		}
+	})
+
+	t.Run("success walk pages by cursor", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		// users created in a batch share created_at, so the pages rely on the id
+		users, err := createUsers(tx, 5, "ES", "GB")
+		assert.NoError(t, err)
+
+		q := query.Query{Page: 1, PageSize: 3, Sort: query.Sort{{Column: "country"}, {Column: "created_at", Desc: true}}}
+		seen := make(map[uuid.UUID]bool)
+		for range len(users) {
+			res, err := repo.ListUsers(ctx, q)
+			assert.NoError(t, err)
+			if len(res) == 0 {
+				break
+			}
+			for _, u := range res {
+				assert.False(t, seen[u.ID], "user %s repeated", u.ID)
+				seen[u.ID] = true
+			}
+			last := res[len(res)-1]
+			q.Cursor, err = query.DecodeCursor(q.NextCursor(last.ID, last.FieldValue), q.Sort)
+			assert.NoError(t, err)
+		}
+		assert.Len(t, seen, len(users))
+	})
+
+	t.Run("success filter by prefix with wildcards", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		_, err := createUsers(tx, 2, "ES")
+		assert.NoError(t, err)
+		res, err := repo.ListUsers(ctx, query.Query{
+			PageSize: 10,
+			Page:     1,
+			Filters: query.Filters{
+				{Column: "nick_name", Operator: query.OpPrefix, Values: []any{"%en"}},
+			},
+		})
+		assert.NoError(t, err)
+		assert.Empty(t, res)
+	})
+
+	t.Run("success list sparse fields without password", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		_, err := createUsers(tx, 2, "ES")
+		assert.NoError(t, err)
+		res, err := repo.ListUsers(ctx, query.Query{
+			PageSize: 10,
+			Page:     1,
+			Fields:   []string{"nick_name"},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, res, 2)
+		for _, u := range res {
+			assert.NotEqual(t, uuid.Nil, u.ID)
+			assert.NotEmpty(t, u.NickName)
+			assert.NotEmpty(t, u.CreatedAt)
+			assert.Empty(t, u.Email)
+			assert.Empty(t, u.Password)
+		}
+	})
+
+	t.Run("fail list sensitive fields", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		_, err := repo.ListUsers(ctx, query.Query{
+			PageSize: 10,
+			Page:     1,
+			Fields:   []string{"password"},
+		})
+		assert.ErrorIs(t, err, errors.ErrInvalidPayload)
+	})
+
+}
+
+func TestGetUserByID(t *testing.T) {
+	ctx := context.Background()
+	db, err := setupTestDatabase(t)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+	t.Run("success get existing user by id", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		repo := postgres.NewUserRepository(tx)
+		tu := testUser
+		err := tx.Create(&tu).Error
+		assert.NoError(t, err)
+
+		res, err := repo.GetUserByID(ctx, tu.ID)
+		assert.NoError(t, err)
+		assertEqualUser(t, tu, res)
+	})
+	t.Run("fail by not found user by id", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		repo := postgres.NewUserRepository(tx)
+
+		res, err := repo.GetUserByID(ctx, uuid.New())
+		assert.ErrorIs(t, err, errors.ErrNotfound)
+		assert.Nil(t, res)
+	})
+	t.Run("fail by not found soft deleted user", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		repo := postgres.NewUserRepository(tx)
+		tu := testUser
+		err := tx.Create(&tu).Error
+		assert.NoError(t, err)
+		err = repo.DeleteUser(ctx, tu.ID, nil)
+		assert.NoError(t, err)
+
+		res, err := repo.GetUserByID(ctx, tu.ID)
+		assert.ErrorIs(t, err, errors.ErrNotfound)
+		assert.Nil(t, res)
+	})
+}
+
+func TestGetUserFields(t *testing.T) {
+	ctx := context.Background()
+	db, err := setupTestDatabase(t)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+	t.Run("success get all the response fields", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		repo := postgres.NewUserRepository(tx)
+		tu := testUser
+		err := tx.Create(&tu).Error
+		assert.NoError(t, err)
+
+		res, err := repo.GetUserFields(ctx, tu.ID, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, tu.Email, res.Email)
+		assert.Equal(t, tu.Version, res.Version)
+		// the password is never read
+		assert.Empty(t, res.Password)
+	})
+	t.Run("success get only the fields", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		repo := postgres.NewUserRepository(tx)
+		tu := testUser
+		err := tx.Create(&tu).Error
+		assert.NoError(t, err)
+
+		res, err := repo.GetUserFields(ctx, tu.ID, []string{"nick_name"})
+		assert.NoError(t, err)
+		assert.Equal(t, tu.ID, res.ID)
+		assert.Equal(t, tu.Version, res.Version)
+		assert.Equal(t, tu.NickName, res.NickName)
+		assert.Empty(t, res.Email)
+	})
+	t.Run("fail by not found soft deleted user", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		repo := postgres.NewUserRepository(tx)
+		tu := testUser
+		err := tx.Create(&tu).Error
+		assert.NoError(t, err)
+		err = repo.DeleteUser(ctx, tu.ID, nil)
+		assert.NoError(t, err)
+
+		res, err := repo.GetUserFields(ctx, tu.ID, nil)
+		assert.ErrorIs(t, err, errors.ErrNotfound)
+		assert.Nil(t, res)
+	})
+	t.Run("fail by sensitive field", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		repo := postgres.NewUserRepository(tx)
+
+		res, err := repo.GetUserFields(ctx, uuid.New(), []string{"password"})
+		assert.ErrorIs(t, err, errors.ErrInvalidPayload)
+		assert.Nil(t, res)
+	})
+}
+
+func TestGetUserByIDWithDeleted(t *testing.T) {
+	ctx := context.Background()
+	db, err := setupTestDatabase(t)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+	t.Run("success get soft deleted user", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		repo := postgres.NewUserRepository(tx)
+		tu := testUser
+		err := tx.Create(&tu).Error
+		assert.NoError(t, err)
+		err = repo.DeleteUser(ctx, tu.ID, nil)
+		assert.NoError(t, err)
+
+		res, err := repo.GetUserByIDWithDeleted(ctx, tu.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, tu.ID, res.ID)
+		assert.True(t, res.DeletedAt.Valid)
+	})
+	t.Run("fail by not found user by id", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		repo := postgres.NewUserRepository(tx)
+
+		res, err := repo.GetUserByIDWithDeleted(ctx, uuid.New())
+		assert.ErrorIs(t, err, errors.ErrNotfound)
+		assert.Nil(t, res)
+	})
+}
+
+func TestGetUserByEmail(t *testing.T) {
+	ctx := context.Background()
+	db, err := setupTestDatabase(t)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+	t.Run("success get existing user by email", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		repo := postgres.NewUserRepository(tx)
+		tu := testUser
+		err := tx.Create(&tu).Error
+		assert.NoError(t, err)
+
+		res, err := repo.GetUserByEmail(ctx, tu.Email)
+		assert.NoError(t, err)
+		assertEqualUser(t, tu, res)
+	})
+	t.Run("success get existing user by email in another case", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		repo := postgres.NewUserRepository(tx)
+		tu := testUser
+		err := tx.Create(&tu).Error
+		assert.NoError(t, err)
+
+		res, err := repo.GetUserByEmail(ctx, strings.ToUpper(tu.Email))
+		assert.NoError(t, err)
+		assertEqualUser(t, tu, res)
+	})
+	t.Run("fail by not found user by email", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		repo := postgres.NewUserRepository(tx)
+
+		res, err := repo.GetUserByEmail(ctx, "unknown@gmail.com")
+		assert.ErrorIs(t, err, errors.ErrNotfound)
+		assert.Nil(t, res)
+	})
+	t.Run("fail by not found soft deleted user", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		repo := postgres.NewUserRepository(tx)
+		tu := testUser
+		err := tx.Create(&tu).Error
+		assert.NoError(t, err)
+		err = repo.DeleteUser(ctx, tu.ID, nil)
+		assert.NoError(t, err)
+
+		res, err := repo.GetUserByEmail(ctx, tu.Email)
+		assert.ErrorIs(t, err, errors.ErrNotfound)
+		assert.Nil(t, res)
+	})
+}
+
+func TestCountUsers(t *testing.T) {
+	ctx := context.Background()
+	db, err := setupTestDatabase(t)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+	t.Run("success count empty users", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		res, err := repo.CountUsers(ctx, nil)
+		assert.NoError(t, err)
+		assert.EqualValues(t, int64(0), res)
+	})
+
+	t.Run("success count all users", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		users, err := createUsers(tx, 10, "ES", "GB")
+		assert.NoError(t, err)
+		assert.NotNil(t, users)
+		res, err := repo.CountUsers(ctx, nil)
+		assert.NoError(t, err)
+		assert.EqualValues(t, len(users), res)
+	})
+
+	t.Run("success count with filter users", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		users, err := createUsers(tx, 10, "ES", "GB")
 		assert.NoError(t, err)
 		assert.NotNil(t, users)
-		res, err := repo.CountUsers(ctx, map[string][]string{
-			"country": {"ES"},
+		res, err := repo.CountUsers(ctx, query.Filters{
+			in("country", "ES"),
 		})
 		assert.NoError(t, err)
 		assert.EqualValues(t, 10, res)
@@ -394,9 +1116,9 @@ func TestCountUsers(t *testing.T) {
 		users, err := createUsers(tx, 10, "ES", "GB", "US")
 		assert.NoError(t, err)
 		assert.NotNil(t, users)
-		res, err := repo.CountUsers(ctx, map[string][]string{
-			"country":    {"ES", "GB"},
-			"first_name": {"zechao0"},
+		res, err := repo.CountUsers(ctx, query.Filters{
+			in("country", "ES", "GB"),
+			in("first_name", "zechao0"),
 		})
 		assert.NoError(t, err)
 		assert.EqualValues(t, 2, res)
@@ -406,13 +1128,128 @@ func TestCountUsers(t *testing.T) {
 		tx := db.Begin()
 		defer tx.Rollback()
 		repo := postgres.NewUserRepository(tx)
-		res, err := repo.CountUsers(ctx, map[string][]string{
-			"countries": {"ES", "GB"},
+		res, err := repo.CountUsers(ctx, query.Filters{
+			in("countries", "ES", "GB"),
+		})
+		assert.ErrorIs(t, err, errors.ErrInvalidPayload)
+		assert.Zero(t, res)
+	})
+
+	t.Run("success count with range filter", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		_, err := createUsers(tx, 10, "ES", "GB")
+		assert.NoError(t, err)
+		res, err := repo.CountUsers(ctx, query.Filters{
+			{Column: "created_at", Operator: query.OpGt, Values: []any{time.Now().Add(time.Hour)}},
+		})
+		assert.NoError(t, err)
+		assert.Zero(t, res)
+	})
+
+	t.Run("fail count by unsupported operator", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		res, err := repo.CountUsers(ctx, query.Filters{
+			{Column: "country", Operator: query.OpGte, Values: []any{"ES"}},
+		})
+		assert.ErrorIs(t, err, errors.ErrInvalidPayload)
+		assert.Zero(t, res)
+	})
+}
+func TestEstimateCountUsers(t *testing.T) {
+	ctx := context.Background()
+	db, err := setupTestDatabase(t)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+
+	t.Run("success estimate users", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		_, err := createUsers(tx, 50, "ES", "GB")
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Exec("ANALYZE user_svc.users").Error)
+
+		res, err := repo.EstimateCountUsers(ctx, query.Filters{
+			in("country", "ES"),
+			{Column: "nick_name", Operator: query.OpPrefix, Values: []any{"zen"}},
+		})
+		assert.NoError(t, err)
+		// the planner never estimates less than a row
+		assert.Positive(t, res)
+	})
+
+	t.Run("invalid fields", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		res, err := repo.EstimateCountUsers(ctx, query.Filters{
+			in("password", "superpassword"),
 		})
 		assert.ErrorIs(t, err, errors.ErrInvalidPayload)
 		assert.Zero(t, res)
 	})
 }
+
+func TestSearchUsers(t *testing.T) {
+	ctx := context.Background()
+	db, err := setupTestDatabase(t)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+
+	tx := db.Begin()
+	defer tx.Rollback()
+	repo := postgres.NewUserRepository(tx)
+	users := []user.User{
+		{ID: uuid.New(), FirstName: "zechao", LastName: "jin", NickName: "zen", Email: "zechao@faceit.com", Password: "superpassword", Country: "ES"},
+		{ID: uuid.New(), FirstName: "john", LastName: "doe", NickName: "johnny", Email: "john@example.com", Password: "superpassword", Country: "GB"},
+		{ID: uuid.New(), FirstName: "jane", LastName: "doe", NickName: "zenith", Email: "jane@example.com", Password: "superpassword", Country: "GB"},
+	}
+	assert.NoError(t, tx.Create(&users).Error)
+
+	tests := map[string]struct {
+		term        string
+		expectedIDs []uuid.UUID
+	}{
+		"typo in first name": {
+			term:        "zechoa",
+			expectedIDs: []uuid.UUID{users[0].ID},
+		},
+		"part of email": {
+			term:        "faceit.com",
+			expectedIDs: []uuid.UUID{users[0].ID},
+		},
+		"whole word ranked first": {
+			term:        "zen",
+			expectedIDs: []uuid.UUID{users[0].ID, users[2].ID},
+		},
+		"no match": {
+			term: "qwxy",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			res, err := repo.SearchUsers(ctx, query.Search{Term: tt.term, Page: 1, PageSize: 10})
+			assert.NoError(t, err)
+			ids := make([]uuid.UUID, len(res))
+			for i, u := range res {
+				ids[i] = u.ID
+			}
+			assert.Equal(t, len(tt.expectedIDs), len(ids))
+			if len(tt.expectedIDs) > 0 {
+				assert.Equal(t, tt.expectedIDs[0], ids[0])
+			}
+
+			count, err := repo.CountSearchUsers(ctx, tt.term)
+			assert.NoError(t, err)
+			assert.EqualValues(t, len(tt.expectedIDs), count)
+		})
+	}
+}
+
 func assertEqualUser(t *testing.T, expected user.User, actual *user.User) {
 	assert.Equal(t, expected.ID, actual.ID)
 	assert.Equal(t, expected.FirstName, actual.FirstName)
@@ -426,6 +1263,86 @@ func assertEqualUser(t *testing.T, expected user.User, actual *user.User) {
 
 }
 
+// in returns a filter matching any of the values of the column.
+func in(column string, values ...any) query.Filter {
+	return query.Filter{Column: column, Operator: query.OpIn, Values: values}
+}
+
+func TestExportUsers(t *testing.T) {
+	ctx := context.Background()
+	db, err := setupTestDatabase(t)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+
+	t.Run("success export in batches", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		// more users than a batch, in two countries
+		users, err := createUsers(tx, 300, "ES", "GB")
+		assert.NoError(t, err)
+
+		var exported []user.User
+		err = repo.ExportUsers(ctx, query.Export{
+			Sort:    query.Sort{{Column: "email"}, {Column: "id"}},
+			Filters: query.Filters{in("country", "ES")},
+		}, func(u *user.User) error {
+			exported = append(exported, *u)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Len(t, exported, len(users)/2)
+		for i, u := range exported {
+			assert.Equal(t, "ES", u.Country)
+			assert.Empty(t, u.Password)
+			if i > 0 {
+				assert.Less(t, exported[i-1].Email, u.Email)
+			}
+		}
+	})
+
+	t.Run("fail by canceled context", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		_, err := createUsers(tx, 300, "ES", "GB")
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		var exported int
+		err = repo.ExportUsers(ctx, query.Export{Sort: query.Sort{{Column: "id"}}}, func(u *user.User) error {
+			exported++
+			cancel()
+			return nil
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Less(t, exported, 600)
+	})
+
+	t.Run("fail by fn error", func(t *testing.T) {
+		tx := db.Begin()
+		defer tx.Rollback()
+		repo := postgres.NewUserRepository(tx)
+		_, err := createUsers(tx, 2, "ES")
+		assert.NoError(t, err)
+
+		errWrite := fmt.Errorf("write failed")
+		err = repo.ExportUsers(ctx, query.Export{Sort: query.Sort{{Column: "id"}}}, func(u *user.User) error {
+			return errWrite
+		})
+		assert.ErrorIs(t, err, errWrite)
+	})
+
+	t.Run("fail by sensitive field", func(t *testing.T) {
+		repo := postgres.NewUserRepository(db)
+		err := repo.ExportUsers(ctx, query.Export{Fields: []string{"password"}}, func(u *user.User) error {
+			return nil
+		})
+		assert.ErrorIs(t, err, errors.ErrInvalidPayload)
+	})
+}
+
 func createUsers(db *gorm.DB, n int, countries ...string) ([]user.User, error) {
 	users := make([]user.User, 0, n)
 	for i := 0; i < n; i++ {
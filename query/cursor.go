@@ -0,0 +1,128 @@
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Cursor is the position of the last row of a page, the next page starts right after it.
+// Pages are keyed on the sort columns plus id, so rows created or deleted while paginating
+// don't make the next pages skip or repeat rows.
+type Cursor struct {
+	// Sort is the sort of the pages, the cursor can't be used with another sort.
+	Sort Sort
+	// Values are the values of the sort columns in the last row.
+	Values []any
+	// ID is the id of the last row, it breaks the ties between rows with the same values.
+	ID uuid.UUID
+}
+
+// cursorPayload is the encoded format of a Cursor.
+type cursorPayload struct {
+	Sort   string    `json:"s"`
+	Values []string  `json:"v"`
+	ID     uuid.UUID `json:"id"`
+}
+
+// Encode returns the cursor as an opaque URL safe string.
+func (c Cursor) Encode() string {
+	payload := cursorPayload{
+		Sort:   c.Sort.String(),
+		Values: Filter{Values: c.Values}.Strings(),
+		ID:     c.ID,
+	}
+	data, _ := json.Marshal(payload)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor decodes a cursor returned by Encode, it must have been created with the sort.
+func DecodeCursor(s string, sort Sort) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("cursor is not valid")
+	}
+	var payload cursorPayload
+	if err := json.Unmarshal(data, &payload); err != nil || len(payload.Values) != len(sort) {
+		return nil, fmt.Errorf("cursor is not valid")
+	}
+	if payload.Sort != sort.String() {
+		return nil, fmt.Errorf("cursor was created with sort %s", payload.Sort)
+	}
+
+	c := Cursor{Sort: sort, Values: make([]any, len(sort)), ID: payload.ID}
+	for i, k := range sort {
+		v, err := parseValue(supportedQuery[k.Column].filter, paramCursor, payload.Values[i])
+		if err != nil {
+			return nil, fmt.Errorf("cursor is not valid")
+		}
+		c.Values[i] = v
+	}
+	return &c, nil
+}
+
+// keys returns the sort keys of the query with the defaults applied.
+func (query Query) keys() Sort {
+	if len(query.Sort) > 0 {
+		return query.Sort
+	}
+	sortBy := query.SortBy
+	if sortBy == "" {
+		sortBy = defaultSortBy
+	}
+	sortOrder := query.SortOrder
+	if sortOrder == "" {
+		sortOrder = defaultSortOrder
+	}
+	return Sort{{Column: sortBy, Desc: strings.EqualFold(sortOrder, "desc")}}
+}
+
+// orderKeys returns the sort keys plus id in the direction of the last key, so the order is total.
+func (query Query) orderKeys() Sort {
+	keys := query.keys()
+	for _, k := range keys {
+		if k.Column == "id" {
+			return keys
+		}
+	}
+	return append(keys[:len(keys):len(keys)], SortKey{Column: "id", Desc: keys[len(keys)-1].Desc})
+}
+
+// NextCursor returns the cursor of the page after the row, value returns the value of a column in the row.
+func (query Query) NextCursor(id uuid.UUID, value func(column string) any) string {
+	keys := query.keys()
+	c := Cursor{Sort: keys, Values: make([]any, len(keys)), ID: id}
+	for i, k := range keys {
+		c.Values[i] = value(k.Column)
+	}
+	return c.Encode()
+}
+
+// applyCursor keeps the rows after the cursor in the order of the query. For the keys k1 and k2
+// sorted ascending it's (k1 > v1) OR (k1 = v1 AND k2 > v2), ids are the last key unless sorted by id.
+func (query Query) applyCursor(db *gorm.DB) *gorm.DB {
+	keys := query.orderKeys()
+	values := append(query.Cursor.Values[:len(query.Cursor.Values):len(query.Cursor.Values)], any(query.Cursor.ID))
+
+	var or []string
+	var vars []any
+	for i, k := range keys {
+		var and []string
+		for j := range i {
+			and = append(and, db.Statement.Quote(keys[j].Column)+" = ?")
+			vars = append(vars, values[j])
+		}
+		op := " > ?"
+		if k.Desc {
+			op = " < ?"
+		}
+		and = append(and, db.Statement.Quote(k.Column)+op)
+		vars = append(vars, values[i])
+		or = append(or, "("+strings.Join(and, " AND ")+")")
+	}
+	return db.Where(strings.Join(or, " OR "), vars...)
+}
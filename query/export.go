@@ -0,0 +1,100 @@
+package query
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+
+	"github.com/zechao/faceit-user-svc/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const paramFormat = "format"
+
+// ExportFormat is the encoding of the exported users.
+type ExportFormat string
+
+const (
+	// FormatNDJSON writes a JSON object per line, it's the default.
+	FormatNDJSON ExportFormat = "ndjson"
+	// FormatCSV writes a header with the fields and a row per user.
+	FormatCSV ExportFormat = "csv"
+)
+
+// Export represents the parsed parameters of a bulk export, every matching user is exported.
+type Export struct {
+	Format ExportFormat
+	// Sort is the order of the exported users, it always ends with id.
+	Sort Sort
+	// Filters are parsed as in QueryFromURL, all of them must match
+	Filters Filters
+	// Fields are the response fields of a sparse fieldset, all of them when it's empty
+	Fields []string
+}
+
+// ExportFromURL parses the export parameters from a URL and returns an Export object.
+// format is ndjson or csv, the filters, fields and sort parameters are parsed by QueryFromURL,
+// the pagination parameters are rejected since the export isn't paginated.
+// If any parameter is invalid, it returns an error with details.
+func ExportFromURL(params url.Values) (*Export, error) {
+	e := Export{Format: FormatNDJSON}
+
+	var details []errors.Detail
+	if val := params.Get(paramFormat); val != "" {
+		switch format := ExportFormat(val); format {
+		case FormatNDJSON, FormatCSV:
+			e.Format = format
+		default:
+			details = append(details, errors.Detail{
+				Field:       paramFormat,
+				Description: "format must be ndjson or csv",
+			})
+		}
+	}
+
+	queryParams := maps.Clone(params)
+	delete(queryParams, paramFormat)
+	for _, key := range slices.Sorted(maps.Keys(queryParams)) {
+		switch key {
+		case paramPage, paramPageSize, paramCursor, paramTotal:
+			details = append(details, errors.Detail{
+				Field:       key,
+				Description: fmt.Sprintf("parameter %s is not supported by exports", key),
+			})
+			delete(queryParams, key)
+		}
+	}
+
+	q, err := QueryFromURL(queryParams)
+	if err != nil {
+		queryErr := new(errors.Error)
+		if !errors.As(err, &queryErr) {
+			return nil, err
+		}
+		details = append(details, queryErr.Details...)
+	}
+
+	if len(details) != 0 {
+		return nil, errors.NewWrongInput(ErrCodeInvalidParameter, details...)
+	}
+
+	e.Sort = q.orderKeys()
+	e.Filters = q.Filters
+	e.Fields = q.Fields
+	return &e, nil
+}
+
+// ApplyExport applies the fields, filters and sort of the export to a GORM database query.
+func (e Export) ApplyExport(db *gorm.DB) *gorm.DB {
+	for _, k := range e.Sort {
+		if !sortable(k.Column) {
+			_ = db.AddError(fmt.Errorf("%w: %s can't be used to sort", gorm.ErrInvalidField, k.Column))
+			continue
+		}
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: k.Column}, Desc: k.Desc})
+	}
+	db = ApplySelect(db, e.Fields, e.Sort)
+	return ApplyFilters(db, e.Filters)
+}
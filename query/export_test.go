@@ -0,0 +1,106 @@
+package query_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zechao/faceit-user-svc/errors"
+	"github.com/zechao/faceit-user-svc/query"
+	"gorm.io/gorm"
+)
+
+func TestExportFromURL(t *testing.T) {
+	tableTest := map[string]struct {
+		params         url.Values
+		expectedExport *query.Export
+		expectedError  error
+	}{
+		"success default format": {
+			params: url.Values{},
+			expectedExport: &query.Export{
+				Format: query.FormatNDJSON,
+				Sort:   query.Sort{{Column: "created_at", Desc: true}, {Column: "id", Desc: true}},
+			},
+		},
+		"success csv with filters, fields and sort": {
+			params: url.Values{"format": {"csv"}, "country": {"ES"}, "fields": {"id,email"}, "sort": {"email"}},
+			expectedExport: &query.Export{
+				Format: query.FormatCSV,
+				Sort:   query.Sort{{Column: "email"}, {Column: "id"}},
+				Filters: query.Filters{
+					{Column: "country", Operator: query.OpIn, Values: []any{"ES"}},
+				},
+				Fields: []string{"id", "email"},
+			},
+		},
+		"fail by unknown format": {
+			params: url.Values{"format": {"xml"}},
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "format",
+				Description: "format must be ndjson or csv",
+			}),
+		},
+		"fail by pagination": {
+			params: url.Values{"page": {"2"}, "page_size": {"10"}},
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "page",
+				Description: "parameter page is not supported by exports",
+			}, errors.Detail{
+				Field:       "page_size",
+				Description: "parameter page_size is not supported by exports",
+			}),
+		},
+		"fail by invalid filter": {
+			params: url.Values{"format": {"csv"}, "created_at[gte]": {"yesterday"}},
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "created_at[gte]",
+				Description: `created_at[gte] value "yesterday" is not a valid timestamp`,
+			}),
+		},
+	}
+	for name, testCase := range tableTest {
+		t.Run(name, func(t *testing.T) {
+			e, err := query.ExportFromURL(testCase.params)
+			assert.Equal(t, testCase.expectedError, err)
+			assert.Equal(t, testCase.expectedExport, e)
+		})
+	}
+}
+
+func TestApplyExport(t *testing.T) {
+	tableTest := map[string]struct {
+		export       query.Export
+		expectedSQL  string
+		expectedVars []any
+		expectErr    bool
+	}{
+		"fields, filters and sort": {
+			export: query.Export{
+				Sort:    query.Sort{{Column: "created_at"}, {Column: "id"}},
+				Filters: query.Filters{{Column: "created_at", Operator: query.OpLt, Values: []any{time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}}},
+				Fields:  []string{"email"},
+			},
+			expectedSQL:  `SELECT "id","email","created_at" FROM "test_users" WHERE "created_at" < $1 ORDER BY "created_at","id"`,
+			expectedVars: []any{time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		"fail by sensitive sort": {
+			export:    query.Export{Sort: query.Sort{{Column: "password"}}},
+			expectErr: true,
+		},
+	}
+	for name, testCase := range tableTest {
+		t.Run(name, func(t *testing.T) {
+			var users []testUser
+			stmt := testCase.export.ApplyExport(dryRunDB(t)).Find(&users)
+			if testCase.expectErr {
+				assert.ErrorIs(t, stmt.Error, gorm.ErrInvalidField)
+				return
+			}
+			assert.NoError(t, stmt.Error)
+			assert.Equal(t, testCase.expectedSQL, stmt.Statement.SQL.String())
+			assert.Equal(t, testCase.expectedVars, stmt.Statement.Vars)
+		})
+	}
+}
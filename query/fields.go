@@ -0,0 +1,78 @@
+package query
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/zechao/faceit-user-svc/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const paramFields = "fields"
+
+// ResponseFields are the fields of the user responses, in their order. Each one is a column
+// with the same name, the sensitive columns are never part of them.
+var ResponseFields = []string{"id", "first_name", "last_name", "nick_name", "email", "country", "created_at", "updated_at"}
+
+// ParseFields parses the comma separated fields of a sparse fieldset, they must be response fields.
+// An empty value returns no fields, which stands for all the response fields.
+func ParseFields(val string) ([]string, []errors.Detail) {
+	if val == "" {
+		return nil, nil
+	}
+	var fields []string
+	var details []errors.Detail
+	for _, f := range strings.Split(val, ",") {
+		f = strings.TrimSpace(f)
+		switch {
+		case !slices.Contains(ResponseFields, f):
+			details = append(details, errors.Detail{
+				Field:       paramFields,
+				Description: fmt.Sprintf("fields %q is not a response field", f),
+			})
+		case !slices.Contains(fields, f):
+			fields = append(fields, f)
+		}
+	}
+	return fields, details
+}
+
+// ApplySelect selects the columns of the fields, all the response fields when it's empty, plus id
+// and the sort columns which are needed for the cursors. Sensitive columns are never selected,
+// fields that are not response fields add gorm.ErrInvalidField to the query.
+// The extra columns are selected too, they are read by the caller but aren't part of the response.
+func ApplySelect(db *gorm.DB, fields []string, sort Sort, extra ...string) *gorm.DB {
+	if len(fields) == 0 {
+		fields = ResponseFields
+	}
+	names := []string{"id"}
+	for _, c := range extra {
+		if supportedQuery[c].sensitive {
+			_ = db.AddError(fmt.Errorf("%w: %s can't be selected", gorm.ErrInvalidField, c))
+			continue
+		}
+		names = append(names, c)
+	}
+	for _, f := range fields {
+		if !slices.Contains(ResponseFields, f) {
+			_ = db.AddError(fmt.Errorf("%w: %s can't be selected", gorm.ErrInvalidField, f))
+			continue
+		}
+		if !slices.Contains(names, f) {
+			names = append(names, f)
+		}
+	}
+	for _, k := range sort {
+		if slices.Contains(ResponseFields, k.Column) && !slices.Contains(names, k.Column) {
+			names = append(names, k.Column)
+		}
+	}
+
+	columns := make([]clause.Column, len(names))
+	for i, name := range names {
+		columns[i] = clause.Column{Name: name}
+	}
+	return db.Clauses(clause.Select{Columns: columns})
+}
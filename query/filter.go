@@ -0,0 +1,249 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Operator is the comparison of a filter, it's set in the parameter name as column[operator].
+type Operator string
+
+const (
+	// OpIn matches any of the values, it's the operator of the parameters without operator.
+	OpIn Operator = "in"
+	// OpNotIn matches none of the values.
+	OpNotIn Operator = "nin"
+	OpGt    Operator = "gt"
+	OpGte   Operator = "gte"
+	OpLt    Operator = "lt"
+	OpLte   Operator = "lte"
+	// OpPrefix matches the strings starting with the value, it's case sensitive.
+	OpPrefix Operator = "prefix"
+	// OpILike matches the case insensitive LIKE pattern, % and _ are wildcards.
+	OpILike Operator = "ilike"
+)
+
+// ValueType is the type of the values of a filterable column.
+type ValueType string
+
+const (
+	UUIDType        ValueType = "uuid"
+	TimestampType   ValueType = "timestamp"
+	StringType      ValueType = "string"
+	CountryCodeType ValueType = "country code"
+)
+
+// operators are the operators supported by each value type.
+var operators = map[ValueType][]Operator{
+	UUIDType:        {OpIn, OpNotIn},
+	TimestampType:   {OpIn, OpNotIn, OpGt, OpGte, OpLt, OpLte},
+	StringType:      {OpIn, OpNotIn, OpPrefix, OpILike},
+	CountryCodeType: {OpIn, OpNotIn},
+}
+
+// multiValue tells whether the operator accepts several values, the others require exactly one.
+func (op Operator) multiValue() bool {
+	return op == OpIn || op == OpNotIn
+}
+
+// ValueError is returned when a filter value can't be parsed as the type of its column.
+type ValueError struct {
+	Param string
+	Value string
+	Type  ValueType
+}
+
+func (e *ValueError) Error() string {
+	return fmt.Sprintf("%s value %q is not a valid %s", e.Param, e.Value, e.Type)
+}
+
+// OperatorError is returned when the operator of a filter is unknown, not supported by the type
+// of its column, or it has a wrong number of values.
+type OperatorError struct {
+	Param    string
+	Operator Operator
+	Reason   string
+}
+
+func (e *OperatorError) Error() string {
+	return fmt.Sprintf("%s %s", e.Param, e.Reason)
+}
+
+// FieldError is returned when the column of a filter is not filterable.
+type FieldError struct {
+	Param  string
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("parameter %s %s", e.Param, e.Reason)
+}
+
+// Filter is a condition on a column, Values are parsed to the type of the column:
+// uuid.UUID, time.Time or string.
+type Filter struct {
+	Column   string
+	Operator Operator
+	Values   []any
+}
+
+// Filters are the conditions of a query, the results match all of them.
+type Filters []Filter
+
+var countryCodeRegex = regexp.MustCompile(`^[A-Za-z]{2}$`)
+
+// timestampLayouts are the accepted formats of timestamp values.
+var timestampLayouts = []string{time.RFC3339Nano, time.DateOnly}
+
+// parseValue parses the value as the type of the column.
+func parseValue(t ValueType, param, value string) (any, error) {
+	switch t {
+	case UUIDType:
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return nil, &ValueError{Param: param, Value: value, Type: t}
+		}
+		return id, nil
+	case TimestampType:
+		for _, layout := range timestampLayouts {
+			if ts, err := time.Parse(layout, value); err == nil {
+				return ts, nil
+			}
+		}
+		return nil, &ValueError{Param: param, Value: value, Type: t}
+	case CountryCodeType:
+		if !countryCodeRegex.MatchString(value) {
+			return nil, &ValueError{Param: param, Value: value, Type: t}
+		}
+		return value, nil
+	}
+	return value, nil
+}
+
+// ParseFilter parses a filter from a parameter name such as created_at[gte] and its values.
+// It returns a FieldError, OperatorError or ValueError if the filter is not valid.
+func ParseFilter(param string, values ...string) (Filter, error) {
+	column, op := param, OpIn
+	if i := strings.IndexByte(param, '['); i >= 0 && strings.HasSuffix(param, "]") {
+		column, op = param[:i], Operator(param[i+1:len(param)-1])
+	}
+	return NewFilter(column, op, values...)
+}
+
+// NewFilter creates a filter on the column, parsing the values to the type of the column.
+// It returns a FieldError, OperatorError or ValueError if the filter is not valid.
+func NewFilter(column string, op Operator, values ...string) (Filter, error) {
+	param := Filter{Column: column, Operator: op}.Param()
+	f, ok := supportedQuery[column]
+	switch {
+	case !ok:
+		return Filter{}, &FieldError{Param: param, Reason: "is not supported"}
+	case f.sensitive:
+		return Filter{}, &FieldError{Param: column, Reason: "is sensitive and can't be used as filter"}
+	case f.filter == "":
+		return Filter{}, &FieldError{Param: column, Reason: "can't be used as filter"}
+	}
+
+	if !slices.Contains(operators[f.filter], op) {
+		return Filter{}, &OperatorError{Param: param, Operator: op, Reason: fmt.Sprintf("operator %q is not supported for %s values", op, f.filter)}
+	}
+	if len(values) == 0 || (!op.multiValue() && len(values) > 1) {
+		return Filter{}, &OperatorError{Param: param, Operator: op, Reason: fmt.Sprintf("operator %q requires a single value", op)}
+	}
+
+	filter := Filter{Column: column, Operator: op, Values: make([]any, len(values))}
+	for i, v := range values {
+		parsed, err := parseValue(f.filter, param, v)
+		if err != nil {
+			return Filter{}, err
+		}
+		filter.Values[i] = parsed
+	}
+	return filter, nil
+}
+
+// Param returns the name of the query parameter of the filter, the operator is omitted for OpIn.
+func (f Filter) Param() string {
+	if f.Operator == OpIn || f.Operator == "" {
+		return f.Column
+	}
+	return fmt.Sprintf("%s[%s]", f.Column, f.Operator)
+}
+
+// Strings returns the values formatted as query parameter values.
+func (f Filter) Strings() []string {
+	values := make([]string, len(f.Values))
+	for i, v := range f.Values {
+		switch v := v.(type) {
+		case time.Time:
+			values[i] = v.Format(time.RFC3339Nano)
+		default:
+			values[i] = fmt.Sprint(v)
+		}
+	}
+	return values
+}
+
+// Params returns the filters as query parameters, it's the format echoed back in the responses.
+func (fs Filters) Params() map[string][]string {
+	params := make(map[string][]string, len(fs))
+	for _, f := range fs {
+		params[f.Param()] = append(params[f.Param()], f.Strings()...)
+	}
+	return params
+}
+
+// sorted returns the filters sorted by parameter, so the same filters always build the same statement.
+func (fs Filters) sorted() Filters {
+	res := slices.Clone(fs)
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Param() < res[j].Param()
+	})
+	return res
+}
+
+// likeEscaper escapes the LIKE wildcards, so prefix values are matched literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ApplyFilters applies the filters to a GORM database query. Filters that are not valid, such as
+// the ones on sensitive columns, add gorm.ErrInvalidField to the query instead of being applied.
+func ApplyFilters(db *gorm.DB, filters Filters) *gorm.DB {
+	for _, f := range filters.sorted() {
+		field, ok := supportedQuery[f.Column]
+		if !ok || field.sensitive || field.filter == "" || !slices.Contains(operators[field.filter], f.Operator) {
+			_ = db.AddError(fmt.Errorf("%w: %s can't be used as filter", gorm.ErrInvalidField, f.Param()))
+			continue
+		}
+		if len(f.Values) == 0 {
+			continue
+		}
+		// the column comes from the allowlist, values are always bound
+		column := db.Statement.Quote(f.Column)
+		switch f.Operator {
+		case OpIn:
+			db = db.Where(column+" IN (?)", f.Values)
+		case OpNotIn:
+			db = db.Where(column+" NOT IN (?)", f.Values)
+		case OpGt:
+			db = db.Where(column+" > ?", f.Values[0])
+		case OpGte:
+			db = db.Where(column+" >= ?", f.Values[0])
+		case OpLt:
+			db = db.Where(column+" < ?", f.Values[0])
+		case OpLte:
+			db = db.Where(column+" <= ?", f.Values[0])
+		case OpPrefix:
+			db = db.Where(column+" LIKE ?", likeEscaper.Replace(fmt.Sprint(f.Values[0]))+"%")
+		case OpILike:
+			db = db.Where(column+" ILIKE ?", f.Values[0])
+		}
+	}
+	return db
+}
@@ -0,0 +1,37 @@
+package query
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/zechao/faceit-user-svc/errors"
+)
+
+// Pagination represents the parsed page parameters of the lists that can't be sorted or filtered.
+type Pagination struct {
+	Page     int
+	PageSize int
+}
+
+// PaginationFromURL parses the page and page_size parameters from a URL and returns a Pagination object.
+// They are validated as in QueryFromURL, any other parameter is rejected.
+// If any parameter is invalid, it returns an error with details.
+func PaginationFromURL(params url.Values) (*Pagination, error) {
+	var p Pagination
+	var details []errors.Detail
+	p.Page, p.PageSize, details = parsePage(params)
+
+	for key := range params {
+		if key != paramPage && key != paramPageSize {
+			details = append(details, errors.Detail{
+				Field:       key,
+				Description: fmt.Sprintf("parameter %s is not supported", key),
+			})
+		}
+	}
+
+	if len(details) != 0 {
+		return nil, errors.NewWrongInput(ErrCodeInvalidParameter, details...)
+	}
+	return &p, nil
+}
@@ -0,0 +1,48 @@
+package query_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zechao/faceit-user-svc/errors"
+	"github.com/zechao/faceit-user-svc/query"
+)
+
+func TestPaginationFromURL(t *testing.T) {
+	tableTest := map[string]struct {
+		params             url.Values
+		expectedPagination *query.Pagination
+		expectedError      error
+	}{
+		"success default page": {
+			params:             url.Values{},
+			expectedPagination: &query.Pagination{Page: 1, PageSize: 100},
+		},
+		"success with page": {
+			params:             url.Values{"page": {"3"}, "page_size": {"20"}},
+			expectedPagination: &query.Pagination{Page: 3, PageSize: 20},
+		},
+		"fail by invalid page size": {
+			params: url.Values{"page_size": {"abc"}},
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "page_size",
+				Description: "page_size must be a number",
+			}),
+		},
+		"fail by unsupported parameter": {
+			params: url.Values{"sort_by": {"created_at"}},
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "sort_by",
+				Description: "parameter sort_by is not supported",
+			}),
+		},
+	}
+	for name, testCase := range tableTest {
+		t.Run(name, func(t *testing.T) {
+			p, err := query.PaginationFromURL(testCase.params)
+			assert.Equal(t, testCase.expectedError, err)
+			assert.Equal(t, testCase.expectedPagination, p)
+		})
+	}
+}
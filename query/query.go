@@ -3,12 +3,15 @@ package query
 
 import (
 	"fmt"
+	"maps"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/zechao/faceit-user-svc/errors"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 const (
@@ -22,27 +25,88 @@ const (
 	paramPageSize  = "page_size"
 	paramSortOrder = "sort_order"
 	paramSortBy    = "sort_by"
+	paramSort      = "sort"
+	paramCursor    = "cursor"
+	paramTotal     = "include_total"
 
 	ErrCodeInvalidParameter = "INVALID_QUERY_PARAMETERS"
 )
 
-// supportedFilter is a map of supported filter parameters, boolean value is to indicate if its filter
-var supportedQuery = map[string]bool{
-	"first_name": true,
-	"last_name":  true,
-	"nick_name":  true,
-	"password":   true,
-	"email":      true,
-	"country":    true,
-	"created_at": true,
-	"updated_at": true,
-	"id":         true,
-	"page":       false,
-	"page_size":  false,
-	"sort_order": false,
-	"sort_by":    false,
+// field describes a supported query parameter.
+type field struct {
+	// filter is the type of the column values when the parameter filters the results by the column with the same name.
+	filter ValueType
+	// sortable tells if the results can be sorted by the column.
+	sortable bool
+	// sensitive columns hold secrets such as the password hash, they can never be used as filter.
+	sensitive bool
 }
 
+// supportedQuery is the allowlist of query parameters, any other parameter is rejected.
+var supportedQuery = map[string]field{
+	"first_name":    {filter: StringType, sortable: true},
+	"last_name":     {filter: StringType, sortable: true},
+	"nick_name":     {filter: StringType, sortable: true},
+	"password":      {sensitive: true},
+	"email":         {filter: StringType, sortable: true},
+	"country":       {filter: CountryCodeType, sortable: true},
+	"created_at":    {filter: TimestampType, sortable: true},
+	"updated_at":    {filter: TimestampType, sortable: true},
+	"id":            {filter: UUIDType, sortable: true},
+	"page":          {},
+	"page_size":     {},
+	"sort_order":    {},
+	"sort_by":       {},
+	"sort":          {},
+	"cursor":        {},
+	"include_total": {},
+	"fields":        {},
+}
+
+// sortable reports whether the results can be sorted by the column.
+func sortable(column string) bool {
+	f, ok := supportedQuery[column]
+	return ok && f.sortable && !f.sensitive
+}
+
+// SortKey is a column to sort the results by.
+type SortKey struct {
+	Column string
+	Desc   bool
+}
+
+// String returns the key in the format of the sort parameter, the column prefixed by - when descending.
+func (k SortKey) String() string {
+	if k.Desc {
+		return "-" + k.Column
+	}
+	return k.Column
+}
+
+// Sort is a multi-key sort, the results are sorted by the first key, then by the next ones.
+type Sort []SortKey
+
+// String returns the sort in the format of the sort parameter, for example country,-created_at.
+func (s Sort) String() string {
+	keys := make([]string, len(s))
+	for i, k := range s {
+		keys[i] = k.String()
+	}
+	return strings.Join(keys, ",")
+}
+
+// TotalMode tells how the total number of records matching the filters is computed.
+type TotalMode string
+
+const (
+	// TotalExact counts the matching records, it's the default.
+	TotalExact TotalMode = "exact"
+	// TotalEstimate uses the planner statistics of the database, it's cheap but approximate.
+	TotalEstimate TotalMode = "estimate"
+	// TotalNone doesn't compute the total.
+	TotalNone TotalMode = "false"
+)
+
 // Query represents the parsed query parameters for pagination, sorting and filtering.
 type Query struct {
 	Page     int
@@ -51,8 +115,17 @@ type Query struct {
 	SortOrder string
 	// sort by specific field, default created_at
 	SortBy string
-	// Allow multiple values per filter
-	Filters map[string][]string
+	// Sort is set by the sort parameter, it takes precedence over SortBy and SortOrder
+	// which are set to its first key.
+	Sort Sort
+	// Filters are parsed from the filter parameters, all of them must match
+	Filters Filters
+	// Cursor is set by the cursor parameter, the page starts after it instead of at Page
+	Cursor *Cursor
+	// IncludeTotal tells how the total records are computed, default exact
+	IncludeTotal TotalMode
+	// Fields are the response fields of a sparse fieldset, all of them when it's empty
+	Fields []string
 }
 
 // PaginationResponse is a generic struct that holds the paginated data and metadata.
@@ -60,9 +133,13 @@ type PaginationResponse[T any] struct {
 	Page         int                 `json:"page"`
 	PageSize     int                 `json:"page_size"`
 	TotalRecords int64               `json:"total_records"`
+	TotalMode    TotalMode           `json:"total_mode"`
 	SortBy       string              `json:"sort_by"`
 	SortOrder    string              `json:"sort_order"`
+	Sort         string              `json:"sort,omitempty"`
 	Filters      map[string][]string `json:"filters"`
+	NextCursor   string              `json:"next_cursor,omitempty"`
+	Fields       []string            `json:"fields,omitempty"`
 	Data         []T                 `json:"data"`
 }
 
@@ -70,24 +147,133 @@ type PaginationResponse[T any] struct {
 // It validates the page, page_size, sort_order, and sort_by parameters.
 // If any parameter is invalid, it returns an error with details.
 // be aware we are not restricting the max number of page_size here.
-// the filter parameters here so that we can have flexible query options.
-// for example, /users?name=John&country=UK&country=ES
-// will be parsed as Filters: {"name": ["John"], "country": ["ES", "UK"]}
+// the filter parameters are column or column[operator], their values are parsed to the type of the column.
+// for example, /users?first_name=John&country=UK&country=ES&created_at[gte]=2025-01-01
+// will be parsed as the filters country IN (UK, ES), created_at >= 2025-01-01 and first_name IN (John).
 func QueryFromURL(params url.Values) (*Query, error) {
 	q := Query{
-		Page:      1,
-		PageSize:  defalutPageSize,
 		SortOrder: defaultSortOrder,
 		SortBy:    defaultSortBy,
-		Filters:   make(map[string][]string),
 	}
 
 	var details []errors.Detail
 
+	q.Page, q.PageSize, details = parsePage(params)
+
+	q.SortBy = params.Get(paramSortBy)
+	if q.SortBy == "" {
+		q.SortBy = defaultSortBy
+	}
+	if !sortable(q.SortBy) {
+		details = append(details, errors.Detail{
+			Field:       paramSortBy,
+			Description: fmt.Sprintf("sort_by %q is not a sortable field", q.SortBy),
+		})
+	}
+
+	sortOrder := params.Get(paramSortOrder)
+	if sortOrder == "" {
+		q.SortOrder = defaultSortOrder
+	}
+
+	if sortOrder != "" {
+		if !strings.EqualFold(sortOrder, "desc") && !strings.EqualFold(sortOrder, "asc") {
+			details = append(details, errors.Detail{
+				Field:       paramSortOrder,
+				Description: "sort_order must be desc or asc",
+			})
+		}
+		q.SortOrder = sortOrder
+	}
+
+	fields, fieldDetails := ParseFields(params.Get(paramFields))
+	q.Fields = fields
+	details = append(details, fieldDetails...)
+
+	q.IncludeTotal = TotalExact
+	if val := params.Get(paramTotal); val != "" {
+		switch mode := TotalMode(strings.ToLower(val)); mode {
+		case TotalExact, TotalEstimate, TotalNone:
+			q.IncludeTotal = mode
+		default:
+			details = append(details, errors.Detail{
+				Field:       paramTotal,
+				Description: "include_total must be false, exact or estimate",
+			})
+		}
+	}
+
+	if val := params.Get(paramSort); val != "" {
+		if params.Has(paramSortBy) || params.Has(paramSortOrder) {
+			details = append(details, errors.Detail{
+				Field:       paramSort,
+				Description: "sort can't be combined with sort_by and sort_order",
+			})
+		}
+		sort, sortDetails := parseSort(val)
+		details = append(details, sortDetails...)
+		if len(sortDetails) == 0 {
+			q.Sort = sort
+			q.SortBy = sort[0].Column
+			q.SortOrder = "asc"
+			if sort[0].Desc {
+				q.SortOrder = "desc"
+			}
+		}
+	}
+
+	// check filters, the parameters are sorted so the filters are always in the same order
+	for _, key := range slices.Sorted(maps.Keys(params)) {
+		if f, ok := supportedQuery[key]; ok && f.filter == "" && !f.sensitive {
+			continue
+		}
+		filter, err := ParseFilter(key, params[key]...)
+		if err != nil {
+			details = append(details, errors.Detail{
+				Field:       key,
+				Description: err.Error(),
+			})
+			continue
+		}
+		q.Filters = append(q.Filters, filter)
+	}
+
+	// the cursor is decoded with the sort, so it's checked last
+	if val := params.Get(paramCursor); val != "" {
+		switch {
+		case params.Has(paramPage):
+			details = append(details, errors.Detail{
+				Field:       paramCursor,
+				Description: "cursor can't be combined with page",
+			})
+		case len(details) == 0:
+			cursor, err := DecodeCursor(val, q.keys())
+			if err != nil {
+				details = append(details, errors.Detail{
+					Field:       paramCursor,
+					Description: err.Error(),
+				})
+			}
+			q.Cursor = cursor
+		}
+	}
+
+	if len(details) != 0 {
+		return nil, errors.NewWrongInput(ErrCodeInvalidParameter, details...)
+	}
+
+	return &q, nil
+}
+
+// parsePage parses and validates the page and page_size parameters, they default to the first page of 100 items.
+func parsePage(params url.Values) (int, int, []errors.Detail) {
+	page, pageSize := 1, defalutPageSize
+	var details []errors.Detail
+
 	if val := params.Get(paramPage); val != "" {
-		page, err := strconv.Atoi(val)
-		if page > 1 {
-			q.Page = page
+		p, err := strconv.Atoi(val)
+		if p > 1 {
+			page = p
 		}
 		if err != nil {
 			details = append(details, errors.Detail{
@@ -95,7 +281,7 @@ func QueryFromURL(params url.Values) (*Query, error) {
 				Description: "page must be a number",
 			})
 		}
-		if err == nil && page < 1 {
+		if err == nil && p < 1 {
 			details = append(details, errors.Detail{
 				Field:       paramPage,
 				Description: "page number must be greater than 0",
@@ -105,9 +291,9 @@ func QueryFromURL(params url.Values) (*Query, error) {
 
 	if val := params.Get(paramPageSize); val != "" {
 
-		pageSize, err := strconv.Atoi(val)
-		if pageSize > 0 {
-			q.PageSize = pageSize
+		size, err := strconv.Atoi(val)
+		if size > 0 {
+			pageSize = size
 		}
 		if err != nil {
 			details = append(details, errors.Detail{
@@ -115,78 +301,70 @@ func QueryFromURL(params url.Values) (*Query, error) {
 				Description: "page_size must be a number",
 			})
 		}
-		if err == nil && pageSize < 1 {
+		if err == nil && size < 1 {
 			details = append(details, errors.Detail{
 				Field:       paramPageSize,
 				Description: "page_size must be greater than 0",
 			})
 		}
 	}
+	return page, pageSize, details
+}
 
-	q.SortBy = params.Get(paramSortBy)
-	if q.SortBy == "" {
-		q.SortBy = defaultSortBy
-	}
-
-	sortOrder := params.Get(paramSortOrder)
-	if sortOrder == "" {
-		q.SortOrder = defaultSortOrder
-	}
-
-	if sortOrder != "" {
-		if !strings.EqualFold(sortOrder, "desc") && !strings.EqualFold(sortOrder, "asc") {
+// parseSort parses the comma separated sort keys, each key is a sortable column,
+// prefixed by - to sort descending or optionally by + to sort ascending.
+func parseSort(val string) (Sort, []errors.Detail) {
+	var sort Sort
+	var details []errors.Detail
+	seen := make(map[string]bool)
+	for _, key := range strings.Split(val, ",") {
+		k := SortKey{Column: strings.TrimSpace(key)}
+		if c, ok := strings.CutPrefix(k.Column, "-"); ok {
+			k = SortKey{Column: c, Desc: true}
+		} else {
+			k.Column = strings.TrimPrefix(k.Column, "+")
+		}
+		switch {
+		case !sortable(k.Column):
 			details = append(details, errors.Detail{
-				Field:       paramSortOrder,
-				Description: "sort_order must be desc or asc",
+				Field:       paramSort,
+				Description: fmt.Sprintf("sort %q is not a sortable field", k.Column),
 			})
-		}
-		q.SortOrder = sortOrder
-	}
-
-	// check filters
-	for key, values := range params {
-		isFilter, validQuery := supportedQuery[key]
-		if !validQuery {
+		case seen[k.Column]:
 			details = append(details, errors.Detail{
-				Field:       key,
-				Description: fmt.Sprintf("parameter %s is not supported", key),
+				Field:       paramSort,
+				Description: fmt.Sprintf("sort %q is repeated", k.Column),
 			})
+		default:
+			seen[k.Column] = true
+			sort = append(sort, k)
 		}
-		if isFilter {
-			q.Filters[key] = values
-		}
-	}
-
-	if len(details) != 0 {
-		return nil, errors.NewWrongInput(ErrCodeInvalidParameter, details...)
 	}
-
-	return &q, nil
+	return sort, details
 }
 
 // ApplyQuery applies the query parameters to a GORM database query.
+// The rows are sorted by id after the sort keys, so the pages are stable.
 func (query Query) ApplyQuery(db *gorm.DB) *gorm.DB {
-	// Default values
-	if query.SortBy == "" {
-		query.SortBy = "created_at"
-	}
-	if query.SortOrder == "" {
-		query.SortOrder = "desc"
+	// Apply sorting, the columns are checked again as the query may not come from QueryFromURL
+	for _, k := range query.orderKeys() {
+		if !sortable(k.Column) {
+			_ = db.AddError(fmt.Errorf("%w: %s can't be used to sort", gorm.ErrInvalidField, k.Column))
+			continue
+		}
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: k.Column}, Desc: k.Desc})
 	}
 
-	// Apply sorting
-	db = db.Order(query.SortBy + " " + query.SortOrder)
+	db = ApplySelect(db, query.Fields, query.orderKeys())
+	db = ApplyFilters(db, query.Filters)
 
-	// Apply filters
-	for column, values := range query.Filters {
-		if len(values) > 0 {
-			db = db.Where(column+" IN (?)", values)
-		}
+	// Apply pagination, by keyset after the cursor or by offset
+	if query.Cursor != nil {
+		db = query.applyCursor(db).Limit(query.PageSize)
+	} else {
+		offset := (query.Page - 1) * query.PageSize
+		db = db.Offset(offset).Limit(query.PageSize)
 	}
 
-	// Apply pagination
-	offset := (query.Page - 1) * query.PageSize
-	db = db.Offset(offset).Limit(query.PageSize)
-
 	return db
 }
@@ -2,11 +2,16 @@ package query_test
 
 import (
 	"net/http"
+	"net/url"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/zechao/faceit-user-svc/errors"
 	"github.com/zechao/faceit-user-svc/query"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
 )
 
 func TestQueryFromURLFail(t *testing.T) {
@@ -63,6 +68,146 @@ func TestQueryFromURLFail(t *testing.T) {
 				Description: "parameter a is not supported",
 			}),
 		},
+		"invalid include_total": {
+			inputQuery: "include_total=true",
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "include_total",
+				Description: "include_total must be false, exact or estimate",
+			}),
+		},
+		"sensitive field": {
+			inputQuery: "fields=id,password",
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "fields",
+				Description: `fields "password" is not a response field`,
+			}),
+		},
+		"unknown field": {
+			inputQuery: "fields=id,name",
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "fields",
+				Description: `fields "name" is not a response field`,
+			}),
+		},
+		"unsupported sort_by": {
+			inputQuery: "sort_by=name",
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "sort_by",
+				Description: `sort_by "name" is not a sortable field`,
+			}),
+		},
+		"sensitive sort_by": {
+			inputQuery: "sort_by=password",
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "sort_by",
+				Description: `sort_by "password" is not a sortable field`,
+			}),
+		},
+		"sort_by injection": {
+			inputQuery: "sort_by=" + url.QueryEscape("created_at; DROP TABLE user_svc.users; --"),
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "sort_by",
+				Description: `sort_by "created_at; DROP TABLE user_svc.users; --" is not a sortable field`,
+			}),
+		},
+		"sort_by subquery injection": {
+			inputQuery: "sort_by=" + url.QueryEscape("(CASE WHEN (SELECT 1)=1 THEN email ELSE id END)"),
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "sort_by",
+				Description: `sort_by "(CASE WHEN (SELECT 1)=1 THEN email ELSE id END)" is not a sortable field`,
+			}),
+		},
+		"sort injection": {
+			inputQuery: "sort=" + url.QueryEscape("country,-created_at desc; DELETE FROM user_svc.users"),
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "sort",
+				Description: `sort "created_at desc; DELETE FROM user_svc.users" is not a sortable field`,
+			}),
+		},
+		"sensitive sort": {
+			inputQuery: "sort=-password",
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "sort",
+				Description: `sort "password" is not a sortable field`,
+			}),
+		},
+		"repeated sort": {
+			inputQuery: "sort=country,-country",
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "sort",
+				Description: `sort "country" is repeated`,
+			}),
+		},
+		"sort with sort_by": {
+			inputQuery: "sort=country&sort_by=id",
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "sort",
+				Description: "sort can't be combined with sort_by and sort_order",
+			}),
+		},
+		"invalid uuid filter": {
+			inputQuery: "id=abc",
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "id",
+				Description: `id value "abc" is not a valid uuid`,
+			}),
+		},
+		"invalid timestamp filter": {
+			inputQuery: "created_at[gte]=yesterday",
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "created_at[gte]",
+				Description: `created_at[gte] value "yesterday" is not a valid timestamp`,
+			}),
+		},
+		"invalid country code filter": {
+			inputQuery: "country[nin]=USA",
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "country[nin]",
+				Description: `country[nin] value "USA" is not a valid country code`,
+			}),
+		},
+		"unsupported operator for type": {
+			inputQuery: "country[prefix]=U",
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "country[prefix]",
+				Description: `country[prefix] operator "prefix" is not supported for country code values`,
+			}),
+		},
+		"unknown operator": {
+			inputQuery: "first_name[regex]=.*",
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "first_name[regex]",
+				Description: `first_name[regex] operator "regex" is not supported for string values`,
+			}),
+		},
+		"multiple values for single value operator": {
+			inputQuery: "created_at[gte]=2025-01-01&created_at[gte]=2025-02-01",
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "created_at[gte]",
+				Description: `created_at[gte] operator "gte" requires a single value`,
+			}),
+		},
+		"operator on sensitive filter": {
+			inputQuery: "password[prefix]=$2a",
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "password[prefix]",
+				Description: "parameter password is sensitive and can't be used as filter",
+			}),
+		},
+		"operator on non filter parameter": {
+			inputQuery: "page[gte]=1",
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "page[gte]",
+				Description: "parameter page can't be used as filter",
+			}),
+		},
+		"sensitive filter": {
+			inputQuery: "password=superpassword",
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "password",
+				Description: "parameter password is sensitive and can't be used as filter",
+			}),
+		},
 	}
 	for name, testCase := range tableTest {
 		t.Run(name, func(t *testing.T) {
@@ -83,23 +228,89 @@ func TestQueryFromURLSuccess(t *testing.T) {
 		"default params": {
 			inputQuery: "page=1",
 			expectedQuery: &query.Query{
-				Page:      1,
-				PageSize:  100,
-				SortOrder: "desc",
-				SortBy:    "created_at",
-				Filters:   make(map[string][]string),
+				Page:         1,
+				PageSize:     100,
+				SortOrder:    "desc",
+				SortBy:       "created_at",
+				IncludeTotal: query.TotalExact,
 			},
 		},
 		"all set": {
-			inputQuery: "page=10&page_size=10&sort_order=asc&sort_by=name&country=UK&country=ES&first_name=zechao",
+			inputQuery: "page=10&page_size=10&sort_order=asc&sort_by=first_name&country=UK&country=ES&first_name=zechao",
+			expectedQuery: &query.Query{
+				Page:         10,
+				PageSize:     10,
+				SortOrder:    "asc",
+				SortBy:       "first_name",
+				IncludeTotal: query.TotalExact,
+				Filters: query.Filters{
+					{Column: "country", Operator: query.OpIn, Values: []any{"UK", "ES"}},
+					{Column: "first_name", Operator: query.OpIn, Values: []any{"zechao"}},
+				},
+			},
+		},
+		"filter operators": {
+			inputQuery: "created_at[gte]=2025-01-01&created_at[lt]=2025-02-01T10:00:00Z&nick_name[prefix]=zen&email[ilike]=" +
+				url.QueryEscape("%@faceit.com") + "&country[nin]=US&id[in]=c9d10cef-0766-49e6-9a19-e3508fdfb262",
+			expectedQuery: &query.Query{
+				Page:         1,
+				PageSize:     100,
+				SortOrder:    "desc",
+				SortBy:       "created_at",
+				IncludeTotal: query.TotalExact,
+				Filters: query.Filters{
+					{Column: "country", Operator: query.OpNotIn, Values: []any{"US"}},
+					{Column: "created_at", Operator: query.OpGte, Values: []any{time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}},
+					{Column: "created_at", Operator: query.OpLt, Values: []any{time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC)}},
+					{Column: "email", Operator: query.OpILike, Values: []any{"%@faceit.com"}},
+					{Column: "id", Operator: query.OpIn, Values: []any{uuid.MustParse("c9d10cef-0766-49e6-9a19-e3508fdfb262")}},
+					{Column: "nick_name", Operator: query.OpPrefix, Values: []any{"zen"}},
+				},
+			},
+		},
+		"estimated total": {
+			inputQuery: "include_total=estimate",
 			expectedQuery: &query.Query{
-				Page:      10,
-				PageSize:  10,
-				SortOrder: "asc",
-				SortBy:    "name",
-				Filters: map[string][]string{
-					"country":    {"UK", "ES"},
-					"first_name": {"zechao"},
+				Page:         1,
+				PageSize:     100,
+				SortOrder:    "desc",
+				SortBy:       "created_at",
+				IncludeTotal: query.TotalEstimate,
+			},
+		},
+		"sparse fields": {
+			inputQuery: "fields=id, nick_name,country,id",
+			expectedQuery: &query.Query{
+				Page:         1,
+				PageSize:     100,
+				SortOrder:    "desc",
+				SortBy:       "created_at",
+				IncludeTotal: query.TotalExact,
+				Fields:       []string{"id", "nick_name", "country"},
+			},
+		},
+		"without total": {
+			inputQuery: "include_total=false",
+			expectedQuery: &query.Query{
+				Page:         1,
+				PageSize:     100,
+				SortOrder:    "desc",
+				SortBy:       "created_at",
+				IncludeTotal: query.TotalNone,
+			},
+		},
+		"multi-key sort": {
+			inputQuery: "sort=country,-created_at,+id",
+			expectedQuery: &query.Query{
+				Page:         1,
+				PageSize:     100,
+				SortOrder:    "asc",
+				SortBy:       "country",
+				IncludeTotal: query.TotalExact,
+				Sort: query.Sort{
+					{Column: "country"},
+					{Column: "created_at", Desc: true},
+					{Column: "id"},
 				},
 			},
 		},
@@ -114,3 +325,179 @@ func TestQueryFromURLSuccess(t *testing.T) {
 		})
 	}
 }
+
+// dryRunDB returns a postgres GORM DB that builds the statements without connecting to a database.
+func dryRunDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	assert.NoError(t, err)
+	return db
+}
+
+type testUser struct {
+	ID string
+}
+
+func TestApplyQuery(t *testing.T) {
+	tableTest := map[string]struct {
+		query        query.Query
+		expectedSQL  string
+		expectedVars []any
+		expectErr    bool
+	}{
+		"sort by sort_by and sort_order": {
+			query:       query.Query{Page: 2, PageSize: 10, SortBy: "first_name", SortOrder: "asc"},
+			expectedSQL: `SELECT "id","first_name","last_name","nick_name","email","country","created_at","updated_at" FROM "test_users" ORDER BY "first_name","id" LIMIT $1 OFFSET $2`,
+		},
+		"multi-key sort": {
+			query: query.Query{Page: 1, PageSize: 10, SortBy: "country", SortOrder: "asc", Sort: query.Sort{
+				{Column: "country"},
+				{Column: "created_at", Desc: true},
+			}},
+			expectedSQL: `SELECT "id","first_name","last_name","nick_name","email","country","created_at","updated_at" FROM "test_users" ORDER BY "country","created_at" DESC,"id" DESC LIMIT $1`,
+		},
+		"fail by sort_by injection": {
+			query:     query.Query{Page: 1, PageSize: 10, SortBy: "created_at; DROP TABLE user_svc.users; --"},
+			expectErr: true,
+		},
+		"fail by sort injection": {
+			query:     query.Query{Page: 1, PageSize: 10, Sort: query.Sort{{Column: "(SELECT password)"}}},
+			expectErr: true,
+		},
+		"fail by sensitive sort": {
+			query:     query.Query{Page: 1, PageSize: 10, SortBy: "password"},
+			expectErr: true,
+		},
+		"filter operators": {
+			query: query.Query{Page: 1, PageSize: 10, SortBy: "id", Filters: query.Filters{
+				{Column: "nick_name", Operator: query.OpPrefix, Values: []any{"50%_off"}},
+				{Column: "country", Operator: query.OpNotIn, Values: []any{"US", "GB"}},
+				{Column: "created_at", Operator: query.OpGte, Values: []any{time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}},
+				{Column: "email", Operator: query.OpILike, Values: []any{"%@faceit.com"}},
+			}},
+			expectedSQL:  `SELECT "id","first_name","last_name","nick_name","email","country","created_at","updated_at" FROM "test_users" WHERE "country" NOT IN ($1,$2) AND "created_at" >= $3 AND "email" ILIKE $4 AND "nick_name" LIKE $5 ORDER BY "id" DESC LIMIT $6`,
+			expectedVars: []any{"US", "GB", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), "%@faceit.com", `50\%\_off%`, 10},
+		},
+		"cursor": {
+			query: query.Query{Page: 1, PageSize: 10, Sort: query.Sort{{Column: "country"}, {Column: "created_at", Desc: true}},
+				Cursor: &query.Cursor{
+					Sort:   query.Sort{{Column: "country"}, {Column: "created_at", Desc: true}},
+					Values: []any{"ES", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+					ID:     uuid.MustParse("c9d10cef-0766-49e6-9a19-e3508fdfb262"),
+				},
+			},
+			expectedSQL: `SELECT "id","first_name","last_name","nick_name","email","country","created_at","updated_at" FROM "test_users" WHERE ("country" > $1) OR ("country" = $2 AND "created_at" < $3) OR ("country" = $4 AND "created_at" = $5 AND "id" < $6) ORDER BY "country","created_at" DESC,"id" DESC LIMIT $7`,
+			expectedVars: []any{
+				"ES",
+				"ES", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+				"ES", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), uuid.MustParse("c9d10cef-0766-49e6-9a19-e3508fdfb262"),
+				10,
+			},
+		},
+		"cursor sorted by id": {
+			query: query.Query{Page: 1, PageSize: 10, SortBy: "id", SortOrder: "asc",
+				Cursor: &query.Cursor{
+					Sort:   query.Sort{{Column: "id"}},
+					Values: []any{uuid.MustParse("c9d10cef-0766-49e6-9a19-e3508fdfb262")},
+					ID:     uuid.MustParse("c9d10cef-0766-49e6-9a19-e3508fdfb262"),
+				},
+			},
+			expectedSQL: `SELECT "id","first_name","last_name","nick_name","email","country","created_at","updated_at" FROM "test_users" WHERE ("id" > $1) ORDER BY "id" LIMIT $2`,
+		},
+		"sparse fields": {
+			query:       query.Query{Page: 1, PageSize: 10, SortBy: "country", SortOrder: "asc", Fields: []string{"nick_name", "id"}},
+			expectedSQL: `SELECT "id","nick_name","country" FROM "test_users" ORDER BY "country","id" LIMIT $1`,
+		},
+		"fail by sensitive field": {
+			query:     query.Query{Page: 1, PageSize: 10, SortBy: "id", Fields: []string{"password"}},
+			expectErr: true,
+		},
+		"fail by unsupported operator": {
+			query:     query.Query{Page: 1, PageSize: 10, SortBy: "id", Filters: query.Filters{{Column: "country", Operator: query.OpGte, Values: []any{"ES"}}}},
+			expectErr: true,
+		},
+		"fail by sensitive filter": {
+			query:     query.Query{Page: 1, PageSize: 10, SortBy: "id", Filters: query.Filters{{Column: "password", Operator: query.OpIn, Values: []any{"hash"}}}},
+			expectErr: true,
+		},
+	}
+	for name, testCase := range tableTest {
+		t.Run(name, func(t *testing.T) {
+			var users []testUser
+			stmt := testCase.query.ApplyQuery(dryRunDB(t)).Find(&users)
+			if testCase.expectErr {
+				assert.ErrorIs(t, stmt.Error, gorm.ErrInvalidField)
+				return
+			}
+			assert.NoError(t, stmt.Error)
+			assert.Equal(t, testCase.expectedSQL, stmt.Statement.SQL.String())
+			if testCase.expectedVars != nil {
+				assert.Equal(t, testCase.expectedVars, stmt.Statement.Vars)
+			}
+		})
+	}
+}
+
+func TestCursor(t *testing.T) {
+	id := uuid.New()
+	createdAt := time.Date(2025, 2, 28, 14, 22, 16, 708974000, time.UTC)
+	q, err := query.QueryFromURL(url.Values{"sort": {"country,-created_at"}})
+	assert.NoError(t, err)
+
+	cursor := q.NextCursor(id, func(column string) any {
+		return map[string]any{"country": "ES", "created_at": createdAt}[column]
+	})
+
+	t.Run("success next page", func(t *testing.T) {
+		next, err := query.QueryFromURL(url.Values{"sort": {"country,-created_at"}, "cursor": {cursor}})
+		assert.NoError(t, err)
+		assert.Equal(t, &query.Cursor{
+			Sort:   query.Sort{{Column: "country"}, {Column: "created_at", Desc: true}},
+			Values: []any{"ES", createdAt},
+			ID:     id,
+		}, next.Cursor)
+	})
+
+	tableTest := map[string]struct {
+		params        url.Values
+		expectedError error
+	}{
+		"fail by malformed cursor": {
+			params: url.Values{"sort": {"country,-created_at"}, "cursor": {"not a cursor"}},
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "cursor",
+				Description: "cursor is not valid",
+			}),
+		},
+		"fail by another sort": {
+			params: url.Values{"sort": {"country"}, "cursor": {cursor}},
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "cursor",
+				Description: "cursor is not valid",
+			}),
+		},
+		"fail by another sort with same number of keys": {
+			params: url.Values{"sort": {"country,created_at"}, "cursor": {cursor}},
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "cursor",
+				Description: "cursor was created with sort country,-created_at",
+			}),
+		},
+		"fail by cursor with page": {
+			params: url.Values{"sort": {"country,-created_at"}, "cursor": {cursor}, "page": {"2"}},
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "cursor",
+				Description: "cursor can't be combined with page",
+			}),
+		},
+	}
+	for name, testCase := range tableTest {
+		t.Run(name, func(t *testing.T) {
+			q, err := query.QueryFromURL(testCase.params)
+			assert.Nil(t, q)
+			assert.Equal(t, testCase.expectedError, err)
+		})
+	}
+}
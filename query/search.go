@@ -0,0 +1,67 @@
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zechao/faceit-user-svc/errors"
+)
+
+const (
+	paramSearch = "q"
+
+	// minSearchLength is the shortest search term, trigrams need at least a couple of characters to match.
+	minSearchLength = 2
+	// maxSearchLength is the longest search term, similarity of long terms is expensive and useless.
+	maxSearchLength = 100
+
+	// SortByRelevance is the sort of the search results, the most similar first.
+	SortByRelevance = "relevance"
+)
+
+// Search represents the parsed parameters of a fuzzy search.
+type Search struct {
+	// Term is matched against the names, nickname and email, tolerating typos.
+	Term     string
+	Page     int
+	PageSize int
+	// Fields are the response fields of a sparse fieldset, all of them when it's empty
+	Fields []string
+}
+
+// SearchFromURL parses the search parameters from a URL and returns a Search object.
+// q is required, page and page_size are validated as in QueryFromURL.
+// If any parameter is invalid, it returns an error with details.
+func SearchFromURL(params url.Values) (*Search, error) {
+	s := Search{Term: strings.TrimSpace(params.Get(paramSearch))}
+
+	var details []errors.Detail
+	s.Page, s.PageSize, details = parsePage(params)
+
+	fields, fieldDetails := ParseFields(params.Get(paramFields))
+	s.Fields = fields
+	details = append(details, fieldDetails...)
+
+	if length := utf8.RuneCountInString(s.Term); length < minSearchLength || length > maxSearchLength {
+		details = append(details, errors.Detail{
+			Field:       paramSearch,
+			Description: fmt.Sprintf("q must have between %d and %d characters", minSearchLength, maxSearchLength),
+		})
+	}
+
+	for key := range params {
+		if key != paramSearch && key != paramPage && key != paramPageSize && key != paramFields {
+			details = append(details, errors.Detail{
+				Field:       key,
+				Description: fmt.Sprintf("parameter %s is not supported", key),
+			})
+		}
+	}
+
+	if len(details) != 0 {
+		return nil, errors.NewWrongInput(ErrCodeInvalidParameter, details...)
+	}
+	return &s, nil
+}
@@ -0,0 +1,67 @@
+package query_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zechao/faceit-user-svc/errors"
+	"github.com/zechao/faceit-user-svc/query"
+)
+
+func TestSearchFromURL(t *testing.T) {
+	tableTest := map[string]struct {
+		params         url.Values
+		expectedSearch *query.Search
+		expectedError  error
+	}{
+		"success default page": {
+			params:         url.Values{"q": {" zechao "}},
+			expectedSearch: &query.Search{Term: "zechao", Page: 1, PageSize: 100},
+		},
+		"success with page": {
+			params:         url.Values{"q": {"zen@faceit.com"}, "page": {"2"}, "page_size": {"20"}},
+			expectedSearch: &query.Search{Term: "zen@faceit.com", Page: 2, PageSize: 20},
+		},
+		"success with fields": {
+			params:         url.Values{"q": {"zen"}, "fields": {"id,nick_name"}},
+			expectedSearch: &query.Search{Term: "zen", Page: 1, PageSize: 100, Fields: []string{"id", "nick_name"}},
+		},
+		"fail by missing q": {
+			params: url.Values{},
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "q",
+				Description: "q must have between 2 and 100 characters",
+			}),
+		},
+		"fail by long q": {
+			params: url.Values{"q": {strings.Repeat("a", 101)}},
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "q",
+				Description: "q must have between 2 and 100 characters",
+			}),
+		},
+		"fail by invalid page": {
+			params: url.Values{"q": {"zen"}, "page": {"0"}},
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "page",
+				Description: "page number must be greater than 0",
+			}),
+		},
+		"fail by unsupported parameter": {
+			params: url.Values{"q": {"zen"}, "country": {"ES"}},
+			expectedError: errors.NewWrongInput(query.ErrCodeInvalidParameter, errors.Detail{
+				Field:       "country",
+				Description: "parameter country is not supported",
+			}),
+		},
+	}
+	for name, testCase := range tableTest {
+		t.Run(name, func(t *testing.T) {
+			s, err := query.SearchFromURL(testCase.params)
+			assert.Equal(t, testCase.expectedError, err)
+			assert.Equal(t, testCase.expectedSearch, s)
+		})
+	}
+}
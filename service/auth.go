@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zechao/faceit-user-svc/auth"
+	"github.com/zechao/faceit-user-svc/errors"
+	"github.com/zechao/faceit-user-svc/log"
+	"github.com/zechao/faceit-user-svc/user"
+)
+
+// dummyHash is compared with the password when the email is unknown, so the response time
+// doesn't tell whether the email is registered.
+var dummyHash, _ = user.HashPassword("dummy password to compare with")
+
+type authService struct {
+	userRepo   user.Repository
+	tokenRepo  auth.Repository
+	transactor user.Transactor
+	issuer     *auth.TokenIssuer
+	refreshTTL time.Duration
+	now        func() time.Time
+}
+
+// NewAuthService creates a new auth service with the provided repositories, transactor and token issuer.
+// Refresh tokens are valid for refreshTTL, and are rotated on every refresh.
+func NewAuthService(userRepo user.Repository, tokenRepo auth.Repository, transactor user.Transactor, issuer *auth.TokenIssuer, refreshTTL time.Duration) auth.Service {
+	return &authService{
+		userRepo:   userRepo,
+		tokenRepo:  tokenRepo,
+		transactor: transactor,
+		issuer:     issuer,
+		refreshTTL: refreshTTL,
+		now: func() time.Time {
+			return time.Now().UTC()
+		},
+	}
+}
+
+// Login implements auth.Service. It returns auth.ErrInvalidCredentials if the user doesn't exist,
+// was deleted or the password is wrong.
+func (s *authService) Login(ctx context.Context, email, password string) (*auth.TokenPair, error) {
+	u, err := s.userRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, errors.ErrNotfound) {
+			user.ComparePassword(dummyHash, password)
+			return nil, auth.ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("fail getting user %w", err)
+	}
+	if !user.ComparePassword(u.Password, password) {
+		log.Warn(ctx, "login with wrong password", slog.String("user_id", u.ID.String()))
+		return nil, auth.ErrInvalidCredentials
+	}
+
+	log.Info(ctx, "user logged in", slog.String("user_id", u.ID.String()))
+	return s.issueTokenPair(ctx, u.ID)
+}
+
+// Refresh implements auth.Service. The refresh token is revoked and a new token pair is issued,
+// it returns auth.ErrInvalidToken if the token is unknown, expired, revoked or its user was deleted.
+func (s *authService) Refresh(ctx context.Context, refreshToken string) (*auth.TokenPair, error) {
+	token, err := s.activeRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.userRepo.GetUserByID(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, errors.ErrNotfound) {
+			return nil, auth.ErrInvalidToken
+		}
+		return nil, fmt.Errorf("fail getting user %w", err)
+	}
+
+	var res *auth.TokenPair
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.revoke(ctx, token.ID); err != nil {
+			return err
+		}
+		res, err = s.issueTokenPair(ctx, token.UserID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Logout implements auth.Service. It returns auth.ErrInvalidToken if the token is unknown, expired or already revoked.
+func (s *authService) Logout(ctx context.Context, refreshToken string) error {
+	token, err := s.activeRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return err
+	}
+
+	log.Info(ctx, "user logged out", slog.String("user_id", token.UserID.String()))
+	return s.revoke(ctx, token.ID)
+}
+
+// ValidateAccessToken implements auth.Service.
+func (s *authService) ValidateAccessToken(_ context.Context, accessToken string) (*auth.Claims, error) {
+	return s.issuer.Parse(accessToken, s.now())
+}
+
+// activeRefreshToken returns the stored refresh token if it can still be used.
+func (s *authService) activeRefreshToken(ctx context.Context, refreshToken string) (*auth.RefreshToken, error) {
+	token, err := s.tokenRepo.GetRefreshTokenByHash(ctx, auth.HashRefreshToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, errors.ErrNotfound) {
+			return nil, auth.ErrInvalidToken
+		}
+		return nil, fmt.Errorf("fail getting refresh token %w", err)
+	}
+	if !token.Active(s.now()) {
+		if token.RevokedAt != nil {
+			log.Warn(ctx, "revoked refresh token used", slog.String("user_id", token.UserID.String()))
+		}
+		return nil, auth.ErrInvalidToken
+	}
+	return token, nil
+}
+
+// revoke revokes the refresh token, it returns auth.ErrInvalidToken if it was revoked concurrently.
+func (s *authService) revoke(ctx context.Context, id uuid.UUID) error {
+	err := s.tokenRepo.RevokeRefreshToken(ctx, id, s.now())
+	if err != nil {
+		if errors.Is(err, errors.ErrNotfound) {
+			return auth.ErrInvalidToken
+		}
+		return fmt.Errorf("fail revoking refresh token %w", err)
+	}
+	return nil
+}
+
+// issueTokenPair stores a new refresh token of the user and signs an access token for it.
+func (s *authService) issueTokenPair(ctx context.Context, userID uuid.UUID) (*auth.TokenPair, error) {
+	refreshToken, hash, err := auth.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	token := &auth.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		TokenHash: hash,
+		ExpiresAt: now.Add(s.refreshTTL),
+		CreatedAt: now,
+	}
+	if err := s.tokenRepo.CreateRefreshToken(ctx, token); err != nil {
+		return nil, fmt.Errorf("fail creating refresh token %w", err)
+	}
+
+	accessToken, expiresAt, err := s.issuer.Issue(userID, token.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	return &auth.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
@@ -0,0 +1,295 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zechao/faceit-user-svc/auth"
+	mockAuth "github.com/zechao/faceit-user-svc/auth/mocks"
+	"github.com/zechao/faceit-user-svc/errors"
+	"github.com/zechao/faceit-user-svc/service"
+	"github.com/zechao/faceit-user-svc/user"
+	"github.com/zechao/faceit-user-svc/user/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+const testPassword = "superpassword"
+
+var testIssuerConfig = auth.IssuerConfig{
+	Issuer:        "user-svc",
+	SigningMethod: "HS256",
+	SigningKey:    "test-signing-key-with-32-characters!",
+	TTL:           15 * time.Minute,
+}
+
+func newTestAuthService(t *testing.T, userRepo user.Repository, tokenRepo auth.Repository, cfg auth.IssuerConfig) auth.Service {
+	issuer, err := auth.NewTokenIssuer(cfg)
+	require.NoError(t, err)
+	return service.NewAuthService(userRepo, tokenRepo, testTransactor{}, issuer, time.Hour)
+}
+
+func newLoginUser(t *testing.T) *user.User {
+	hash, err := user.HashPassword(testPassword)
+	require.NoError(t, err)
+	u := tesUser
+	u.ID = uuid.New()
+	u.Password = hash
+	return &u
+}
+
+func TestLogin(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	u := newLoginUser(t)
+
+	tests := map[string]struct {
+		password    string
+		setupMocks  func(userRepo *mocks.MockRepository, tokenRepo *mockAuth.MockRepository)
+		expectedErr error
+	}{
+		"should login successfully": {
+			password: testPassword,
+			setupMocks: func(userRepo *mocks.MockRepository, tokenRepo *mockAuth.MockRepository) {
+				userRepo.EXPECT().GetUserByEmail(ctx, u.Email).Return(u, nil)
+				tokenRepo.EXPECT().CreateRefreshToken(ctx, gomock.Cond(func(rt *auth.RefreshToken) bool {
+					return rt.UserID == u.ID && rt.ID != uuid.Nil && rt.TokenHash != "" && rt.ExpiresAt.After(time.Now())
+				})).Return(nil)
+			},
+		},
+		"fail by wrong password": {
+			password: "wrongpassword",
+			setupMocks: func(userRepo *mocks.MockRepository, tokenRepo *mockAuth.MockRepository) {
+				userRepo.EXPECT().GetUserByEmail(ctx, u.Email).Return(u, nil)
+			},
+			expectedErr: auth.ErrInvalidCredentials,
+		},
+		"fail by unknown email": {
+			password: testPassword,
+			setupMocks: func(userRepo *mocks.MockRepository, tokenRepo *mockAuth.MockRepository) {
+				userRepo.EXPECT().GetUserByEmail(ctx, u.Email).Return(nil, errors.ErrNotfound)
+			},
+			expectedErr: auth.ErrInvalidCredentials,
+		},
+		"fail by deleted user": {
+			password: testPassword,
+			setupMocks: func(userRepo *mocks.MockRepository, tokenRepo *mockAuth.MockRepository) {
+				// soft deleted users are not returned by the repository
+				userRepo.EXPECT().GetUserByEmail(ctx, u.Email).Return(nil, errors.ErrNotfound)
+			},
+			expectedErr: auth.ErrInvalidCredentials,
+		},
+		"fail getting user": {
+			password: testPassword,
+			setupMocks: func(userRepo *mocks.MockRepository, tokenRepo *mockAuth.MockRepository) {
+				userRepo.EXPECT().GetUserByEmail(ctx, u.Email).Return(nil, errTest)
+			},
+			expectedErr: errTest,
+		},
+		"fail creating refresh token": {
+			password: testPassword,
+			setupMocks: func(userRepo *mocks.MockRepository, tokenRepo *mockAuth.MockRepository) {
+				userRepo.EXPECT().GetUserByEmail(ctx, u.Email).Return(u, nil)
+				tokenRepo.EXPECT().CreateRefreshToken(ctx, gomock.Any()).Return(errTest)
+			},
+			expectedErr: errTest,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			userRepo := mocks.NewMockRepository(ctrl)
+			tokenRepo := mockAuth.NewMockRepository(ctrl)
+			svc := newTestAuthService(t, userRepo, tokenRepo, testIssuerConfig)
+			tc.setupMocks(userRepo, tokenRepo)
+
+			res, err := svc.Login(ctx, u.Email, tc.password)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, res)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotEmpty(t, res.RefreshToken)
+
+			claims, err := svc.ValidateAccessToken(ctx, res.AccessToken)
+			assert.NoError(t, err)
+			assert.Equal(t, u.ID.String(), claims.Subject)
+		})
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	u := newLoginUser(t)
+	refreshToken, hash, err := auth.NewRefreshToken()
+	require.NoError(t, err)
+	revokedAt := time.Now().Add(-time.Minute)
+
+	newStoredToken := func() *auth.RefreshToken {
+		return &auth.RefreshToken{
+			ID:        uuid.New(),
+			UserID:    u.ID,
+			TokenHash: hash,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+	}
+
+	tests := map[string]struct {
+		setupMocks  func(userRepo *mocks.MockRepository, tokenRepo *mockAuth.MockRepository)
+		expectedErr error
+	}{
+		"should rotate the refresh token": {
+			setupMocks: func(userRepo *mocks.MockRepository, tokenRepo *mockAuth.MockRepository) {
+				stored := newStoredToken()
+				tokenRepo.EXPECT().GetRefreshTokenByHash(ctx, hash).Return(stored, nil)
+				userRepo.EXPECT().GetUserByID(ctx, u.ID).Return(u, nil)
+				tokenRepo.EXPECT().RevokeRefreshToken(ctx, stored.ID, gomock.Any()).Return(nil)
+				tokenRepo.EXPECT().CreateRefreshToken(ctx, gomock.Cond(func(rt *auth.RefreshToken) bool {
+					return rt.UserID == u.ID && rt.TokenHash != hash
+				})).Return(nil)
+			},
+		},
+		"fail by unknown token": {
+			setupMocks: func(userRepo *mocks.MockRepository, tokenRepo *mockAuth.MockRepository) {
+				tokenRepo.EXPECT().GetRefreshTokenByHash(ctx, hash).Return(nil, errors.ErrNotfound)
+			},
+			expectedErr: auth.ErrInvalidToken,
+		},
+		"fail by expired token": {
+			setupMocks: func(userRepo *mocks.MockRepository, tokenRepo *mockAuth.MockRepository) {
+				stored := newStoredToken()
+				stored.ExpiresAt = time.Now().Add(-time.Second)
+				tokenRepo.EXPECT().GetRefreshTokenByHash(ctx, hash).Return(stored, nil)
+			},
+			expectedErr: auth.ErrInvalidToken,
+		},
+		"fail by revoked token": {
+			setupMocks: func(userRepo *mocks.MockRepository, tokenRepo *mockAuth.MockRepository) {
+				stored := newStoredToken()
+				stored.RevokedAt = &revokedAt
+				tokenRepo.EXPECT().GetRefreshTokenByHash(ctx, hash).Return(stored, nil)
+			},
+			expectedErr: auth.ErrInvalidToken,
+		},
+		"fail by deleted user": {
+			setupMocks: func(userRepo *mocks.MockRepository, tokenRepo *mockAuth.MockRepository) {
+				tokenRepo.EXPECT().GetRefreshTokenByHash(ctx, hash).Return(newStoredToken(), nil)
+				userRepo.EXPECT().GetUserByID(ctx, u.ID).Return(nil, errors.ErrNotfound)
+			},
+			expectedErr: auth.ErrInvalidToken,
+		},
+		"fail by token revoked concurrently": {
+			setupMocks: func(userRepo *mocks.MockRepository, tokenRepo *mockAuth.MockRepository) {
+				stored := newStoredToken()
+				tokenRepo.EXPECT().GetRefreshTokenByHash(ctx, hash).Return(stored, nil)
+				userRepo.EXPECT().GetUserByID(ctx, u.ID).Return(u, nil)
+				tokenRepo.EXPECT().RevokeRefreshToken(ctx, stored.ID, gomock.Any()).Return(errors.ErrNotfound)
+			},
+			expectedErr: auth.ErrInvalidToken,
+		},
+		"fail getting token": {
+			setupMocks: func(userRepo *mocks.MockRepository, tokenRepo *mockAuth.MockRepository) {
+				tokenRepo.EXPECT().GetRefreshTokenByHash(ctx, hash).Return(nil, errTest)
+			},
+			expectedErr: errTest,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			userRepo := mocks.NewMockRepository(ctrl)
+			tokenRepo := mockAuth.NewMockRepository(ctrl)
+			svc := newTestAuthService(t, userRepo, tokenRepo, testIssuerConfig)
+			tc.setupMocks(userRepo, tokenRepo)
+
+			res, err := svc.Refresh(ctx, refreshToken)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, res)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotEqual(t, refreshToken, res.RefreshToken)
+			assert.NotEmpty(t, res.AccessToken)
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	refreshToken, hash, err := auth.NewRefreshToken()
+	require.NoError(t, err)
+	stored := &auth.RefreshToken{ID: uuid.New(), UserID: uuid.New(), TokenHash: hash, ExpiresAt: time.Now().Add(time.Hour)}
+
+	tests := map[string]struct {
+		setupMocks  func(tokenRepo *mockAuth.MockRepository)
+		expectedErr error
+	}{
+		"should revoke the refresh token": {
+			setupMocks: func(tokenRepo *mockAuth.MockRepository) {
+				tokenRepo.EXPECT().GetRefreshTokenByHash(ctx, hash).Return(stored, nil)
+				tokenRepo.EXPECT().RevokeRefreshToken(ctx, stored.ID, gomock.Any()).Return(nil)
+			},
+		},
+		"fail by unknown token": {
+			setupMocks: func(tokenRepo *mockAuth.MockRepository) {
+				tokenRepo.EXPECT().GetRefreshTokenByHash(ctx, hash).Return(nil, errors.ErrNotfound)
+			},
+			expectedErr: auth.ErrInvalidToken,
+		},
+		"fail revoking token": {
+			setupMocks: func(tokenRepo *mockAuth.MockRepository) {
+				tokenRepo.EXPECT().GetRefreshTokenByHash(ctx, hash).Return(stored, nil)
+				tokenRepo.EXPECT().RevokeRefreshToken(ctx, stored.ID, gomock.Any()).Return(errTest)
+			},
+			expectedErr: errTest,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tokenRepo := mockAuth.NewMockRepository(ctrl)
+			svc := newTestAuthService(t, mocks.NewMockRepository(ctrl), tokenRepo, testIssuerConfig)
+			tc.setupMocks(tokenRepo)
+
+			err := svc.Logout(ctx, refreshToken)
+			assert.ErrorIs(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestValidateAccessToken(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+
+	t.Run("fail by expired token", func(t *testing.T) {
+		cfg := testIssuerConfig
+		// tokens are already expired when issued
+		cfg.TTL = -time.Minute
+		userRepo := mocks.NewMockRepository(ctrl)
+		tokenRepo := mockAuth.NewMockRepository(ctrl)
+		svc := newTestAuthService(t, userRepo, tokenRepo, cfg)
+		u := newLoginUser(t)
+
+		userRepo.EXPECT().GetUserByEmail(ctx, u.Email).Return(u, nil)
+		tokenRepo.EXPECT().CreateRefreshToken(ctx, gomock.Any()).Return(nil)
+		tokens, err := svc.Login(ctx, u.Email, testPassword)
+		require.NoError(t, err)
+
+		claims, err := svc.ValidateAccessToken(ctx, tokens.AccessToken)
+		assert.ErrorIs(t, err, auth.ErrInvalidToken)
+		assert.Nil(t, claims)
+	})
+
+	t.Run("fail by invalid token", func(t *testing.T) {
+		svc := newTestAuthService(t, mocks.NewMockRepository(ctrl), mockAuth.NewMockRepository(ctrl), testIssuerConfig)
+		_, err := svc.ValidateAccessToken(ctx, "invalid")
+		assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	})
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zechao/faceit-user-svc/log"
+	"github.com/zechao/faceit-user-svc/user"
+)
+
+type dataExportService struct {
+	userRepo     user.Repository
+	activityRepo user.ActivityRepository
+	transactor   user.Transactor
+	now          func() time.Time
+}
+
+// NewDataExportService creates a new data export service with the provided repositories and transactor.
+// The data of a user is read in a single read only repeatable read transaction, so it's a consistent snapshot.
+func NewDataExportService(userRepo user.Repository, activityRepo user.ActivityRepository, transactor user.Transactor) user.DataExportService {
+	return &dataExportService{
+		userRepo:     userRepo,
+		activityRepo: activityRepo,
+		transactor:   transactor,
+		now: func() time.Time {
+			return time.Now().UTC()
+		},
+	}
+}
+
+// ExportUserData implements user.DataExportService. The password hash of the user is cleared,
+// the sessions, the events and the audit entries never contain secrets.
+func (s *dataExportService) ExportUserData(ctx context.Context, id uuid.UUID) (*user.DataExport, error) {
+	log.Info(ctx, "exporting user data", slog.String(
+		"user_id", id.String(),
+	))
+	export := user.DataExport{
+		Sessions: []user.Session{},
+		Events:   []user.EventRecord{},
+		Audit:    []user.AuditEntry{},
+	}
+	err := s.transactor.WithinReadOnlyTransaction(ctx, func(ctx context.Context) error {
+		u, err := s.userRepo.GetUserByIDWithDeleted(ctx, id)
+		if err != nil {
+			return err
+		}
+		export.User = *u
+		export.User.Password = ""
+
+		sessions, err := s.activityRepo.ListUserSessions(ctx, id)
+		if err != nil {
+			return err
+		}
+		export.Sessions = append(export.Sessions, sessions...)
+
+		events, err := s.activityRepo.ListUserEvents(ctx, id)
+		if err != nil {
+			return err
+		}
+		export.Events = append(export.Events, events...)
+
+		audit, err := s.activityRepo.ListUserAudit(ctx, id)
+		if err != nil {
+			return err
+		}
+		export.Audit = append(export.Audit, audit...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	export.ExportedAt = s.now()
+	return &export, nil
+}
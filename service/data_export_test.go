@@ -0,0 +1,118 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/zechao/faceit-user-svc/errors"
+	"github.com/zechao/faceit-user-svc/service"
+	"github.com/zechao/faceit-user-svc/user"
+	"github.com/zechao/faceit-user-svc/user/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestExportUserData(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	stored := tesUser
+	stored.ID = uuid.New()
+	stored.Password = "hashedpassword"
+	sessions := []user.Session{{ID: uuid.New(), CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}}
+	events := []user.EventRecord{{ID: uuid.New(), EventType: string(user.UserCreated), Payload: json.RawMessage(`{}`)}}
+	audit := []user.AuditEntry{{ID: uuid.New(), UserID: stored.ID, Operation: user.AuditCreate, ActorKind: user.AnonymousActor}}
+
+	tests := map[string]struct {
+		setupMocks     func(mockUserRepo *mocks.MockRepository, mockActivityRepo *mocks.MockActivityRepository)
+		expectedExport *user.DataExport
+		expectedErr    error
+	}{
+		"should export user data successfully": {
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockActivityRepo *mocks.MockActivityRepository) {
+				u := stored
+				mockUserRepo.EXPECT().GetUserByIDWithDeleted(ctx, stored.ID).Return(&u, nil)
+				mockActivityRepo.EXPECT().ListUserSessions(ctx, stored.ID).Return(sessions, nil)
+				mockActivityRepo.EXPECT().ListUserEvents(ctx, stored.ID).Return(events, nil)
+				mockActivityRepo.EXPECT().ListUserAudit(ctx, stored.ID).Return(audit, nil)
+			},
+			expectedExport: func() *user.DataExport {
+				u := stored
+				u.Password = ""
+				return &user.DataExport{User: u, Sessions: sessions, Events: events, Audit: audit}
+			}(),
+		},
+		"should export empty lists": {
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockActivityRepo *mocks.MockActivityRepository) {
+				u := stored
+				mockUserRepo.EXPECT().GetUserByIDWithDeleted(ctx, stored.ID).Return(&u, nil)
+				mockActivityRepo.EXPECT().ListUserSessions(ctx, stored.ID).Return(nil, nil)
+				mockActivityRepo.EXPECT().ListUserEvents(ctx, stored.ID).Return(nil, nil)
+				mockActivityRepo.EXPECT().ListUserAudit(ctx, stored.ID).Return(nil, nil)
+			},
+			expectedExport: func() *user.DataExport {
+				u := stored
+				u.Password = ""
+				return &user.DataExport{User: u, Sessions: []user.Session{}, Events: []user.EventRecord{}, Audit: []user.AuditEntry{}}
+			}(),
+		},
+		"fail by not found": {
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockActivityRepo *mocks.MockActivityRepository) {
+				mockUserRepo.EXPECT().GetUserByIDWithDeleted(ctx, stored.ID).Return(nil, errors.ErrNotfound)
+			},
+			expectedErr: errors.ErrNotfound,
+		},
+		"fail listing sessions": {
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockActivityRepo *mocks.MockActivityRepository) {
+				u := stored
+				mockUserRepo.EXPECT().GetUserByIDWithDeleted(ctx, stored.ID).Return(&u, nil)
+				mockActivityRepo.EXPECT().ListUserSessions(ctx, stored.ID).Return(nil, errTest)
+			},
+			expectedErr: errTest,
+		},
+		"fail listing events": {
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockActivityRepo *mocks.MockActivityRepository) {
+				u := stored
+				mockUserRepo.EXPECT().GetUserByIDWithDeleted(ctx, stored.ID).Return(&u, nil)
+				mockActivityRepo.EXPECT().ListUserSessions(ctx, stored.ID).Return(sessions, nil)
+				mockActivityRepo.EXPECT().ListUserEvents(ctx, stored.ID).Return(nil, errTest)
+			},
+			expectedErr: errTest,
+		},
+		"fail listing audit": {
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockActivityRepo *mocks.MockActivityRepository) {
+				u := stored
+				mockUserRepo.EXPECT().GetUserByIDWithDeleted(ctx, stored.ID).Return(&u, nil)
+				mockActivityRepo.EXPECT().ListUserSessions(ctx, stored.ID).Return(sessions, nil)
+				mockActivityRepo.EXPECT().ListUserEvents(ctx, stored.ID).Return(events, nil)
+				mockActivityRepo.EXPECT().ListUserAudit(ctx, stored.ID).Return(nil, errTest)
+			},
+			expectedErr: errTest,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockUserRepo := mocks.NewMockRepository(ctrl)
+			mockActivityRepo := mocks.NewMockActivityRepository(ctrl)
+			// the data is read from a single snapshot
+			mockTransactor := mocks.NewMockTransactor(ctrl)
+			mockTransactor.EXPECT().WithinReadOnlyTransaction(ctx, gomock.Any()).DoAndReturn(testTransactor{}.WithinReadOnlyTransaction)
+			svc := service.NewDataExportService(mockUserRepo, mockActivityRepo, mockTransactor)
+
+			tc.setupMocks(mockUserRepo, mockActivityRepo)
+
+			res, err := svc.ExportUserData(ctx, stored.ID)
+			assert.ErrorIs(t, err, tc.expectedErr)
+			if tc.expectedExport == nil {
+				assert.Nil(t, res)
+				return
+			}
+			assert.WithinDuration(t, time.Now(), res.ExportedAt, time.Minute)
+			res.ExportedAt = time.Time{}
+			assert.Equal(t, tc.expectedExport, res)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zechao/faceit-user-svc/errors"
+	"github.com/zechao/faceit-user-svc/log"
+	"github.com/zechao/faceit-user-svc/user"
+)
+
+// idempotentUserService replays the user creations sent again with the same idempotency key,
+// the other operations are served by the wrapped service.
+type idempotentUserService struct {
+	user.Service
+	records    user.IdempotencyRepository
+	transactor user.Transactor
+	ttl        time.Duration
+	now        func() time.Time
+}
+
+// NewIdempotentUserService wraps the user service, so the creations with an idempotency key are done once.
+// The record of the key is saved in the transaction of the creation, with the user and its event, and
+// it's kept for ttl: the retries in that period return the user created first without creating it again.
+func NewIdempotentUserService(svc user.Service, records user.IdempotencyRepository, transactor user.Transactor, ttl time.Duration) user.Service {
+	return &idempotentUserService{
+		Service:    svc,
+		records:    records,
+		transactor: transactor,
+		ttl:        ttl,
+		now: func() time.Time {
+			return time.Now().UTC()
+		},
+	}
+}
+
+// CreateUser implements user.Service. It returns user.ErrIdempotencyKeyReused if the key was used
+// by a different request.
+func (s *idempotentUserService) CreateUser(ctx context.Context, input *user.CreateUserInput) (*user.User, error) {
+	if input.IdempotencyKey == "" {
+		return s.Service.CreateUser(ctx, input)
+	}
+
+	// retries usually come after the first request finished, the stored user is replayed
+	if res, err := s.replay(ctx, input); !errors.Is(err, errors.ErrNotfound) {
+		return res, err
+	}
+
+	var res *user.User
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		res, err = s.Service.CreateUser(ctx, input)
+		if err != nil {
+			return err
+		}
+		record, err := s.newRecord(input, res)
+		if err != nil {
+			return err
+		}
+		return s.records.CreateIdempotencyRecord(ctx, record)
+	})
+	if errors.Is(err, errors.ErrDuplicated) {
+		// a concurrent request with the same key may have won, the user or the key is then duplicated
+		if replayed, replayErr := s.replay(ctx, input); !errors.Is(replayErr, errors.ErrNotfound) {
+			return replayed, replayErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// EraseUser implements user.Service. The stored responses of the creation of the user are deleted with it,
+// as they hold its personal data.
+func (s *idempotentUserService) EraseUser(ctx context.Context, id uuid.UUID, version *int64) error {
+	return s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.Service.EraseUser(ctx, id, version); err != nil {
+			return err
+		}
+		_, err := s.records.DeleteUserIdempotencyRecords(ctx, id)
+		return err
+	})
+}
+
+// PurgeDeletedUsers implements user.Service. The stored responses of the creation of the purged users are
+// deleted after them, as they hold their personal data. If it fails, they are deleted by the next purge.
+func (s *idempotentUserService) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time, batchSize int) (int, error) {
+	purged, err := s.Service.PurgeDeletedUsers(ctx, deletedBefore, batchSize)
+	if purged == 0 {
+		return purged, err
+	}
+	// the users purged before an error are deleted anyway
+	if _, deleteErr := s.records.DeleteErasedUsersIdempotencyRecords(ctx); deleteErr != nil {
+		return purged, errors.Join(err, deleteErr)
+	}
+	return purged, err
+}
+
+// replay returns the user stored in the record of the key, errors.ErrNotfound if there isn't any.
+func (s *idempotentUserService) replay(ctx context.Context, input *user.CreateUserInput) (*user.User, error) {
+	record, err := s.records.GetIdempotencyRecord(ctx, input.IdempotencyKey, s.now())
+	if err != nil {
+		return nil, err
+	}
+	if !record.Matches(input) {
+		return nil, user.ErrIdempotencyKeyReused
+	}
+
+	var u user.User
+	if err := json.Unmarshal(record.Response, &u); err != nil {
+		return nil, fmt.Errorf("failed to decode idempotency record: %w", err)
+	}
+	log.Info(ctx, "replaying user creation", slog.String("user_id", u.ID.String()))
+	return &u, nil
+}
+
+// newRecord returns the record of the creation of the user, the password is only kept as its hash.
+func (s *idempotentUserService) newRecord(input *user.CreateUserInput, u *user.User) (*user.IdempotencyRecord, error) {
+	snapshot := *u
+	snapshot.Password = ""
+	response, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode idempotency record: %w", err)
+	}
+	now := s.now()
+	return &user.IdempotencyRecord{
+		Key:          input.IdempotencyKey,
+		UserID:       u.ID,
+		RequestHash:  input.Fingerprint(),
+		PasswordHash: u.Password,
+		Response:     response,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(s.ttl),
+	}, nil
+}
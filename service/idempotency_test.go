@@ -0,0 +1,268 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zechao/faceit-user-svc/errors"
+	"github.com/zechao/faceit-user-svc/service"
+	"github.com/zechao/faceit-user-svc/user"
+	"github.com/zechao/faceit-user-svc/user/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestIdempotentCreateUser(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+
+	input := testCreateUserInput
+	input.IdempotencyKey = "5c1d1b4e-6f0e-4d8a-9d59-4c8e7f1f3a2b"
+
+	created := tesUser
+	created.ID = uuid.New()
+	created.Version = 1
+	passwordHash, err := user.HashPassword(input.Password)
+	require.NoError(t, err)
+	created.Password = passwordHash
+
+	// record is the record of the creation of input
+	record := func(t *testing.T) *user.IdempotencyRecord {
+		snapshot := created
+		snapshot.Password = ""
+		response, err := json.Marshal(snapshot)
+		require.NoError(t, err)
+		return &user.IdempotencyRecord{
+			Key:          input.IdempotencyKey,
+			UserID:       created.ID,
+			RequestHash:  input.Fingerprint(),
+			PasswordHash: passwordHash,
+			Response:     response,
+		}
+	}
+
+	t.Run("success without key", func(t *testing.T) {
+		mockService := mocks.NewMockService(ctrl)
+		mockRecords := mocks.NewMockIdempotencyRepository(ctrl)
+		svc := service.NewIdempotentUserService(mockService, mockRecords, testTransactor{}, time.Hour)
+
+		mockService.EXPECT().CreateUser(ctx, &testCreateUserInput).Return(&created, nil)
+
+		res, err := svc.CreateUser(ctx, &testCreateUserInput)
+		assert.NoError(t, err)
+		assert.Equal(t, &created, res)
+	})
+
+	t.Run("success first request", func(t *testing.T) {
+		mockService := mocks.NewMockService(ctrl)
+		mockRecords := mocks.NewMockIdempotencyRepository(ctrl)
+		svc := service.NewIdempotentUserService(mockService, mockRecords, testTransactor{}, time.Hour)
+
+		mockRecords.EXPECT().GetIdempotencyRecord(ctx, input.IdempotencyKey, gomock.Any()).Return(nil, errors.ErrNotfound)
+		mockService.EXPECT().CreateUser(ctx, &input).Return(&created, nil)
+		mockRecords.EXPECT().CreateIdempotencyRecord(ctx, gomock.Cond(func(r *user.IdempotencyRecord) bool {
+			return r.Key == input.IdempotencyKey &&
+				r.UserID == created.ID &&
+				r.RequestHash == input.Fingerprint() &&
+				r.PasswordHash == passwordHash &&
+				r.ExpiresAt.Sub(r.CreatedAt) == time.Hour
+		})).DoAndReturn(func(_ context.Context, r *user.IdempotencyRecord) error {
+			// the password is never part of the stored response
+			assert.NotContains(t, string(r.Response), passwordHash)
+			return nil
+		})
+
+		res, err := svc.CreateUser(ctx, &input)
+		assert.NoError(t, err)
+		assert.Equal(t, &created, res)
+	})
+
+	t.Run("success replay without creating the user", func(t *testing.T) {
+		mockService := mocks.NewMockService(ctrl)
+		mockRecords := mocks.NewMockIdempotencyRepository(ctrl)
+		svc := service.NewIdempotentUserService(mockService, mockRecords, testTransactor{}, time.Hour)
+
+		mockRecords.EXPECT().GetIdempotencyRecord(ctx, input.IdempotencyKey, gomock.Any()).Return(record(t), nil)
+
+		res, err := svc.CreateUser(ctx, &input)
+		assert.NoError(t, err)
+		assert.Equal(t, created.ID, res.ID)
+		assert.Equal(t, created.Email, res.Email)
+		assert.Equal(t, created.Version, res.Version)
+		assert.Empty(t, res.Password)
+	})
+
+	t.Run("success replay after concurrent request", func(t *testing.T) {
+		mockService := mocks.NewMockService(ctrl)
+		mockRecords := mocks.NewMockIdempotencyRepository(ctrl)
+		svc := service.NewIdempotentUserService(mockService, mockRecords, testTransactor{}, time.Hour)
+
+		// the concurrent request commits the user between the first lookup and the creation
+		gomock.InOrder(
+			mockRecords.EXPECT().GetIdempotencyRecord(ctx, input.IdempotencyKey, gomock.Any()).Return(nil, errors.ErrNotfound),
+			mockService.EXPECT().CreateUser(ctx, &input).Return(nil, errors.ErrDuplicated),
+			mockRecords.EXPECT().GetIdempotencyRecord(ctx, input.IdempotencyKey, gomock.Any()).Return(record(t), nil),
+		)
+
+		res, err := svc.CreateUser(ctx, &input)
+		assert.NoError(t, err)
+		assert.Equal(t, created.ID, res.ID)
+	})
+
+	t.Run("fail by key reused with another request", func(t *testing.T) {
+		mockService := mocks.NewMockService(ctrl)
+		mockRecords := mocks.NewMockIdempotencyRepository(ctrl)
+		svc := service.NewIdempotentUserService(mockService, mockRecords, testTransactor{}, time.Hour)
+
+		other := input
+		other.Country = "GB"
+		mockRecords.EXPECT().GetIdempotencyRecord(ctx, input.IdempotencyKey, gomock.Any()).Return(record(t), nil)
+
+		res, err := svc.CreateUser(ctx, &other)
+		assert.Nil(t, res)
+		assert.ErrorIs(t, err, user.ErrIdempotencyKeyReused)
+	})
+
+	t.Run("fail by key reused with another password", func(t *testing.T) {
+		mockService := mocks.NewMockService(ctrl)
+		mockRecords := mocks.NewMockIdempotencyRepository(ctrl)
+		svc := service.NewIdempotentUserService(mockService, mockRecords, testTransactor{}, time.Hour)
+
+		other := input
+		other.Password = "anotherpassword123"
+		mockRecords.EXPECT().GetIdempotencyRecord(ctx, input.IdempotencyKey, gomock.Any()).Return(record(t), nil)
+
+		res, err := svc.CreateUser(ctx, &other)
+		assert.Nil(t, res)
+		assert.ErrorIs(t, err, user.ErrIdempotencyKeyReused)
+	})
+
+	t.Run("fail by duplicated email without record", func(t *testing.T) {
+		mockService := mocks.NewMockService(ctrl)
+		mockRecords := mocks.NewMockIdempotencyRepository(ctrl)
+		svc := service.NewIdempotentUserService(mockService, mockRecords, testTransactor{}, time.Hour)
+
+		mockRecords.EXPECT().GetIdempotencyRecord(ctx, input.IdempotencyKey, gomock.Any()).Return(nil, errors.ErrNotfound).Times(2)
+		mockService.EXPECT().CreateUser(ctx, &input).Return(nil, errors.ErrDuplicated)
+
+		res, err := svc.CreateUser(ctx, &input)
+		assert.Nil(t, res)
+		assert.ErrorIs(t, err, errors.ErrDuplicated)
+	})
+
+	t.Run("fail by record error", func(t *testing.T) {
+		mockService := mocks.NewMockService(ctrl)
+		mockRecords := mocks.NewMockIdempotencyRepository(ctrl)
+		svc := service.NewIdempotentUserService(mockService, mockRecords, testTransactor{}, time.Hour)
+
+		mockRecords.EXPECT().GetIdempotencyRecord(ctx, input.IdempotencyKey, gomock.Any()).Return(nil, errTest)
+
+		res, err := svc.CreateUser(ctx, &input)
+		assert.Nil(t, res)
+		assert.ErrorIs(t, err, errTest)
+	})
+}
+
+func TestIdempotentEraseUser(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	id := uuid.New()
+
+	t.Run("success erase user and its records", func(t *testing.T) {
+		mockService := mocks.NewMockService(ctrl)
+		mockRecords := mocks.NewMockIdempotencyRepository(ctrl)
+		svc := service.NewIdempotentUserService(mockService, mockRecords, testTransactor{}, time.Hour)
+
+		gomock.InOrder(
+			mockService.EXPECT().EraseUser(ctx, id, nil).Return(nil),
+			mockRecords.EXPECT().DeleteUserIdempotencyRecords(ctx, id).Return(int64(1), nil),
+		)
+
+		assert.NoError(t, svc.EraseUser(ctx, id, nil))
+	})
+
+	t.Run("fail by erase error", func(t *testing.T) {
+		mockService := mocks.NewMockService(ctrl)
+		mockRecords := mocks.NewMockIdempotencyRepository(ctrl)
+		svc := service.NewIdempotentUserService(mockService, mockRecords, testTransactor{}, time.Hour)
+
+		mockService.EXPECT().EraseUser(ctx, id, nil).Return(errTest)
+
+		assert.ErrorIs(t, svc.EraseUser(ctx, id, nil), errTest)
+	})
+
+	t.Run("fail by records error", func(t *testing.T) {
+		mockService := mocks.NewMockService(ctrl)
+		mockRecords := mocks.NewMockIdempotencyRepository(ctrl)
+		svc := service.NewIdempotentUserService(mockService, mockRecords, testTransactor{}, time.Hour)
+
+		mockService.EXPECT().EraseUser(ctx, id, nil).Return(nil)
+		mockRecords.EXPECT().DeleteUserIdempotencyRecords(ctx, id).Return(int64(0), errTest)
+
+		assert.ErrorIs(t, svc.EraseUser(ctx, id, nil), errTest)
+	})
+}
+
+func TestIdempotentPurgeDeletedUsers(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	deletedBefore := time.Now().Add(-time.Hour)
+
+	t.Run("success purge users and their records", func(t *testing.T) {
+		mockService := mocks.NewMockService(ctrl)
+		mockRecords := mocks.NewMockIdempotencyRepository(ctrl)
+		svc := service.NewIdempotentUserService(mockService, mockRecords, testTransactor{}, time.Hour)
+
+		gomock.InOrder(
+			mockService.EXPECT().PurgeDeletedUsers(ctx, deletedBefore, 10).Return(3, nil),
+			mockRecords.EXPECT().DeleteErasedUsersIdempotencyRecords(ctx).Return(int64(1), nil),
+		)
+
+		purged, err := svc.PurgeDeletedUsers(ctx, deletedBefore, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, purged)
+	})
+
+	t.Run("success nothing purged", func(t *testing.T) {
+		mockService := mocks.NewMockService(ctrl)
+		mockRecords := mocks.NewMockIdempotencyRepository(ctrl)
+		svc := service.NewIdempotentUserService(mockService, mockRecords, testTransactor{}, time.Hour)
+
+		mockService.EXPECT().PurgeDeletedUsers(ctx, deletedBefore, 10).Return(0, nil)
+
+		purged, err := svc.PurgeDeletedUsers(ctx, deletedBefore, 10)
+		assert.NoError(t, err)
+		assert.Zero(t, purged)
+	})
+
+	t.Run("fail by purge error after some users are purged", func(t *testing.T) {
+		mockService := mocks.NewMockService(ctrl)
+		mockRecords := mocks.NewMockIdempotencyRepository(ctrl)
+		svc := service.NewIdempotentUserService(mockService, mockRecords, testTransactor{}, time.Hour)
+
+		// the records of the purged users are deleted anyway
+		mockService.EXPECT().PurgeDeletedUsers(ctx, deletedBefore, 10).Return(10, errTest)
+		mockRecords.EXPECT().DeleteErasedUsersIdempotencyRecords(ctx).Return(int64(1), nil)
+
+		purged, err := svc.PurgeDeletedUsers(ctx, deletedBefore, 10)
+		assert.ErrorIs(t, err, errTest)
+		assert.Equal(t, 10, purged)
+	})
+
+	t.Run("fail by records error", func(t *testing.T) {
+		mockService := mocks.NewMockService(ctrl)
+		mockRecords := mocks.NewMockIdempotencyRepository(ctrl)
+		svc := service.NewIdempotentUserService(mockService, mockRecords, testTransactor{}, time.Hour)
+
+		mockService.EXPECT().PurgeDeletedUsers(ctx, deletedBefore, 10).Return(3, nil)
+		mockRecords.EXPECT().DeleteErasedUsersIdempotencyRecords(ctx).Return(int64(0), errTest)
+
+		purged, err := svc.PurgeDeletedUsers(ctx, deletedBefore, 10)
+		assert.ErrorIs(t, err, errTest)
+		assert.Equal(t, 3, purged)
+	})
+}
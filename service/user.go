@@ -4,24 +4,38 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/zechao/faceit-user-svc/auth"
+	"github.com/zechao/faceit-user-svc/errors"
 	"github.com/zechao/faceit-user-svc/event"
 	"github.com/zechao/faceit-user-svc/log"
 	"github.com/zechao/faceit-user-svc/query"
+	"github.com/zechao/faceit-user-svc/tracing"
 	"github.com/zechao/faceit-user-svc/user"
 )
 
 type userService struct {
 	userRepo     user.Repository
+	auditRepo    user.AuditRepository
+	transactor   user.Transactor
 	eventHandler event.EventHandler
+	now          func() time.Time
 }
 
-// NewUserService creates a new user service with the provided user repository and event handler.
-func NewUserService(userRepo user.Repository, eventHandler event.EventHandler) user.Service {
+// NewUserService creates a new user service with the provided user and audit repositories, transactor and event handler.
+// Every change is saved together with its audit entry and its event in a single transaction, so the event handler
+// should take part in it, like event.OutboxEventHandler does.
+func NewUserService(userRepo user.Repository, auditRepo user.AuditRepository, transactor user.Transactor, eventHandler event.EventHandler) user.Service {
 	return &userService{
 		userRepo:     userRepo,
+		auditRepo:    auditRepo,
+		transactor:   transactor,
 		eventHandler: eventHandler,
+		now: func() time.Time {
+			return time.Now().UTC()
+		},
 	}
 }
 
@@ -36,14 +50,21 @@ func (ur *userService) CreateUser(ctx context.Context, input *user.CreateUserInp
 		"user_id", u.ID.String(),
 	))
 
-	res, err := ur.userRepo.CreateUser(ctx, u)
-	if err != nil {
-		return nil, fmt.Errorf("fail creating user %w", err)
-	}
+	var res *user.User
+	err = ur.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		res, err = ur.userRepo.CreateUser(ctx, u)
+		if err != nil {
+			return fmt.Errorf("fail creating user %w", err)
+		}
 
-	err = ur.eventHandler.SendEvent(ctx, string(user.UserCreated), res.ID)
+		err = ur.eventHandler.SendEvent(ctx, string(user.UserCreated), event.NewUserCreated(newUserSnapshot(res)))
+		if err != nil {
+			return fmt.Errorf("fail sending event %w", err)
+		}
+		return ur.audit(ctx, res.ID, user.AuditCreate, user.CreationChanges(res))
+	})
 	if err != nil {
-		return nil, fmt.Errorf("fail sending event %w", err)
+		return nil, err
 	}
 
 	return res, nil
@@ -51,86 +72,315 @@ func (ur *userService) CreateUser(ctx context.Context, input *user.CreateUserInp
 
 // UpdateUser implements will check if the user exists before updating.
 // return not found error if not exist and return duplicated error if the update cause a duplicated key.
-// otherwise update the user and return the updated user.
+// return version mismatch error if input.Version is set and the user doesn't have it, or if the user
+// is modified concurrently. otherwise update the user and return the updated user.
+// An input that doesn't change any field returns the user as it is, without event nor audit entry.
 func (ur *userService) UpdateUser(ctx context.Context, input *user.UpdateUserInput) (*user.User, error) {
 	log.Info(ctx, "updating user", slog.String(
 		"user_id", input.ID.String(),
 	))
-	
+
 	userToUpdate, err := ur.userRepo.GetUserByID(ctx, input.ID)
 	if err != nil {
 		return nil, err
 	}
+	if input.Version != nil && *input.Version != userToUpdate.Version {
+		return nil, errors.ErrVersionMismatch
+	}
 
-	err = userToUpdate.Update(input)
+	changes, err := userToUpdate.Update(input)
 	if err != nil {
 		log.Error(ctx, "failed to update user", slog.String(
 			"user_id", userToUpdate.ID.String(),
 		))
 		return nil, err
 	}
+	if len(changes) == 0 {
+		return userToUpdate, nil
+	}
+
+	var res *user.User
+	err = ur.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		res, err = ur.userRepo.UpdateUser(ctx, userToUpdate, changedColumns(changes))
+		if err != nil {
+			return err
+		}
 
-	res, err := ur.userRepo.UpdateUser(ctx, userToUpdate)
+		err = ur.eventHandler.SendEvent(ctx, string(user.UserUpdated),
+			event.NewUserUpdated(res.ID, newFieldChanges(changes), res.UpdatedAt))
+		if err != nil {
+			return fmt.Errorf("fail sending event %w", err)
+		}
+		return ur.audit(ctx, res.ID, user.AuditUpdate, changes)
+	})
 	if err != nil {
 		return nil, err
 	}
+	return res, nil
+}
 
-	err = ur.eventHandler.SendEvent(ctx, string(user.UserUpdated), res.ID)
+// DeleteUser will delete the user from the repository by ID.
+// If the user does not exist do nothing, unless version is set: the user must exist and have it,
+// otherwise it returns not found error or errors.ErrVersionMismatch.
+func (ur *userService) DeleteUser(ctx context.Context, id uuid.UUID, version *int64) error {
+	log.Info(ctx, "deleting user", slog.String(
+		"user_id", id.String(),
+	))
+	return ur.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		err := ur.userRepo.DeleteUser(ctx, id, version)
+		if errors.Is(err, errors.ErrNotfound) && version == nil {
+			// nothing was deleted, so there is no event nor audit entry
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = ur.eventHandler.SendEvent(ctx, string(user.UserDeleted), event.NewUserDeleted(id, ur.now()))
+		if err != nil {
+			return fmt.Errorf("fail sending event %w", err)
+		}
+		return ur.audit(ctx, id, user.AuditDelete, nil)
+	})
+}
+
+// RestoreUser restores the deleted user and returns it, restoring a user that isn't deleted does nothing.
+// It returns not found error if the user doesn't exist, and user.ErrEmailTaken if its email was used
+// by another user since it was deleted.
+func (ur *userService) RestoreUser(ctx context.Context, id uuid.UUID) (*user.User, error) {
+	log.Info(ctx, "restoring user", slog.String(
+		"user_id", id.String(),
+	))
+	var res *user.User
+	err := ur.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		res, err = ur.userRepo.RestoreUser(ctx, id)
+		if errors.Is(err, errors.ErrNotfound) {
+			// the user may not be deleted, then it's returned as it is
+			res, err = ur.userRepo.GetUserByID(ctx, id)
+			return err
+		}
+		if errors.Is(err, errors.ErrDuplicated) {
+			return user.ErrEmailTaken
+		}
+		if err != nil {
+			return err
+		}
+
+		err = ur.eventHandler.SendEvent(ctx, string(user.UserRestored),
+			event.NewUserRestored(newUserSnapshot(res), res.UpdatedAt))
+		if err != nil {
+			return fmt.Errorf("fail sending event %w", err)
+		}
+		return ur.audit(ctx, res.ID, user.AuditRestore, nil)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("fail sending event %w", err)
+		return nil, err
 	}
 	return res, nil
 }
 
-// DeleteUser will delete the user from the repository by ID.
-// If the user does not exist do nothing
-func (ur *userService) DeleteUser(ctx context.Context, id uuid.UUID) error {
-	log.Info(ctx, "deleting user", slog.String(
+// EraseUser permanently deletes the user, deleted or not, and sends the UserErased event, so the other
+// services forget it too. If the user does not exist do nothing, unless version is set: the user must
+// exist and have it.
+func (ur *userService) EraseUser(ctx context.Context, id uuid.UUID, version *int64) error {
+	log.Info(ctx, "erasing user", slog.String(
 		"user_id", id.String(),
 	))
-	err := ur.userRepo.DeleteUser(ctx, id)
+	return ur.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		err := ur.userRepo.EraseUser(ctx, id, version)
+		if errors.Is(err, errors.ErrNotfound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// the audit entries hold the personal data of the user too
+		if _, err = ur.auditRepo.DeleteUserAuditEntries(ctx, id); err != nil {
+			return err
+		}
+
+		// the erase deleted the previous events of the user, only this one is kept
+		err = ur.eventHandler.SendEvent(ctx, string(user.UserErased), event.NewUserErased(id, ur.now()))
+		if err != nil {
+			return fmt.Errorf("fail sending event %w", err)
+		}
+		return nil
+	})
+}
+
+// PurgeDeletedUsers erases the users soft deleted before deletedBefore until there isn't any left or ctx is done.
+// Each batch is erased with its UserErased events in its own transaction, so a failure only rolls back
+// the current batch.
+func (ur *userService) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time, batchSize int) (int, error) {
+	purged := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return purged, err
+		}
+		var ids []uuid.UUID
+		err := ur.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+			var err error
+			ids, err = ur.userRepo.PurgeDeletedUsers(ctx, deletedBefore, batchSize)
+			if err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				return nil
+			}
+			if _, err = ur.auditRepo.DeleteUserAuditEntries(ctx, ids...); err != nil {
+				return err
+			}
+			erasedAt := ur.now()
+			for _, id := range ids {
+				err = ur.eventHandler.SendEvent(ctx, string(user.UserErased), event.NewUserErased(id, erasedAt))
+				if err != nil {
+					return fmt.Errorf("fail sending event %w", err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return purged, err
+		}
+		purged += len(ids)
+		if len(ids) < batchSize {
+			return purged, nil
+		}
+	}
+}
+
+// GetUser returns the user with the given ID, only the fields are read, all the response fields when it's empty.
+// It returns not found error if the user does not exist or has been deleted.
+func (ur *userService) GetUser(ctx context.Context, id uuid.UUID, fields []string) (*user.User, error) {
+	log.Info(ctx, "getting user", slog.String(
+		"user_id", id.String(),
+	))
+	return ur.userRepo.GetUserFields(ctx, id, fields)
+}
+
+// ListUserHistory returns a page of the audit entries of the user, the most recent first.
+// The history of soft deleted users is kept, erased users don't have any.
+// If the page is out of range, it will return an empty slice and no error.
+func (ur *userService) ListUserHistory(ctx context.Context, id uuid.UUID, p query.Pagination) (*query.PaginationResponse[user.AuditEntry], error) {
+	log.Info(ctx, "listing user history", slog.String(
+		"user_id", id.String(),
+	))
+	if _, err := ur.userRepo.GetUserByIDWithDeleted(ctx, id); err != nil {
+		return nil, err
+	}
+	count, err := ur.auditRepo.CountUserAuditEntries(ctx, id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = ur.eventHandler.SendEvent(ctx, string(user.UserDeleted), id)
+	res := query.PaginationResponse[user.AuditEntry]{
+		Page:         p.Page,
+		PageSize:     p.PageSize,
+		TotalRecords: count,
+		TotalMode:    query.TotalExact,
+		SortBy:       "created_at",
+		SortOrder:    "desc",
+		Filters:      map[string][]string{},
+		Data:         []user.AuditEntry{},
+	}
+	if count <= int64((p.Page-1)*p.PageSize) {
+		return &res, nil
+	}
+
+	entries, err := ur.auditRepo.ListUserAuditEntries(ctx, id, p.Page, p.PageSize)
 	if err != nil {
-		return fmt.Errorf("fail sending event %w", err)
+		return nil, err
 	}
-	return nil
+	res.Data = entries
+	return &res, nil
 }
 
 // ListUsers lists the users from the repository based on the query.
 // If no users are found, it will return an empty slice and nil error
 // If the page is out of range, it will return an empty slice and no error.
+// The total records are counted, estimated or skipped depending on q.IncludeTotal, the page
+// range is only checked against exact counts.
 func (ur *userService) ListUsers(ctx context.Context, q query.Query) (*query.PaginationResponse[user.User], error) {
 	log.Info(ctx, "listing user with query", slog.Any(
 		"query", q,
 	))
-	count, err := ur.userRepo.CountUsers(ctx, q.Filters)
+	mode := q.IncludeTotal
+	if mode == "" {
+		mode = query.TotalExact
+	}
+
+	res := query.PaginationResponse[user.User]{
+		Page:      q.Page,
+		PageSize:  q.PageSize,
+		SortBy:    q.SortBy,
+		SortOrder: q.SortOrder,
+		Sort:      q.Sort.String(),
+		Filters:   q.Filters.Params(),
+		TotalMode: mode,
+		Fields:    q.Fields,
+		Data:      []user.User{},
+	}
+
+	var err error
+	switch mode {
+	case query.TotalEstimate:
+		res.TotalRecords, err = ur.userRepo.EstimateCountUsers(ctx, q.Filters)
+		if err != nil {
+			return nil, err
+		}
+	case query.TotalExact:
+		res.TotalRecords, err = ur.userRepo.CountUsers(ctx, q.Filters)
+		if err != nil {
+			return nil, err
+		}
+		totalPages := res.TotalRecords / int64(q.PageSize)
+		if res.TotalRecords%int64(q.PageSize) > 0 {
+			totalPages++
+		}
+		if res.TotalRecords == 0 || int64(q.Page) > totalPages {
+			return &res, nil
+		}
+	}
+
+	users, err := ur.userRepo.ListUsers(ctx, q)
 	if err != nil {
 		return nil, err
 	}
+	res.Data = users
+	// a full page may have a next one, the cursor points after its last user
+	if len(users) == q.PageSize {
+		last := users[len(users)-1]
+		res.NextCursor = q.NextCursor(last.ID, last.FieldValue)
+	}
+	return &res, nil
+}
 
-	totalPages := count / int64(q.PageSize)
-	if count%int64(q.PageSize) > 0 {
-		totalPages++
+// SearchUsers searches the users similar to the term, the most similar first.
+// If the page is out of range, it will return an empty slice and no error.
+func (ur *userService) SearchUsers(ctx context.Context, s query.Search) (*query.PaginationResponse[user.User], error) {
+	log.Info(ctx, "searching users", slog.Int("page", s.Page), slog.Int("page_size", s.PageSize))
+	count, err := ur.userRepo.CountSearchUsers(ctx, s.Term)
+	if err != nil {
+		return nil, err
 	}
 
 	res := query.PaginationResponse[user.User]{
-		Page:         q.Page,
-		PageSize:     q.PageSize,
-		SortBy:       q.SortBy,
-		SortOrder:    q.SortOrder,
-		Filters:      q.Filters,
+		Page:         s.Page,
+		PageSize:     s.PageSize,
 		TotalRecords: count,
+		TotalMode:    query.TotalExact,
+		SortBy:       query.SortByRelevance,
+		SortOrder:    "desc",
+		Filters:      map[string][]string{},
+		Fields:       s.Fields,
 		Data:         []user.User{},
 	}
-
-	if count == 0 || int64(q.Page) > totalPages {
+	if count <= int64((s.Page-1)*s.PageSize) {
 		return &res, nil
 	}
-	users, err := ur.userRepo.ListUsers(ctx, q)
+
+	users, err := ur.userRepo.SearchUsers(ctx, s)
 	if err != nil {
 		return nil, err
 	}
@@ -138,4 +388,68 @@ func (ur *userService) ListUsers(ctx context.Context, q query.Query) (*query.Pag
 	return &res, nil
 }
 
+// ExportUsers calls fn with every user matching the export, the users are streamed from the repository.
+func (ur *userService) ExportUsers(ctx context.Context, e query.Export, fn func(u *user.User) error) error {
+	log.Info(ctx, "exporting users", slog.String("format", string(e.Format)), slog.Any("filters", e.Filters.Params()))
+	return ur.userRepo.ExportUsers(ctx, e, fn)
+}
+
+// audit records the change of the user made by the caller of ctx, the password values are redacted.
+// The callers without identity, such as the sign ups, are recorded as user.AnonymousActor.
+func (ur *userService) audit(ctx context.Context, userID uuid.UUID, op user.AuditOperation, changes []user.Change) error {
+	entry := user.AuditEntry{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Operation: op,
+		ActorKind: user.AnonymousActor,
+		Changes:   user.AuditChanges(changes),
+	}
+	if identity, ok := auth.IdentityFromContext(ctx); ok && identity != nil {
+		entry.ActorKind = string(identity.Kind)
+		entry.ActorID = identity.Subject
+	}
+	entry.TraceID, _ = tracing.FromContext(ctx)
+
+	if err := ur.auditRepo.AddAuditEntry(ctx, &entry); err != nil {
+		return fmt.Errorf("fail adding audit entry %w", err)
+	}
+	return nil
+}
+
+// newUserSnapshot maps the user to its event representation, leaving the password out.
+func newUserSnapshot(u *user.User) event.UserSnapshot {
+	return event.UserSnapshot{
+		ID:        u.ID,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		NickName:  u.NickName,
+		Email:     u.Email,
+		Country:   u.Country,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+	}
+}
+
+// newFieldChanges maps the user changes to their event representation.
+func newFieldChanges(changes []user.Change) []event.FieldChange {
+	res := make([]event.FieldChange, len(changes))
+	for i, c := range changes {
+		res[i] = event.FieldChange{
+			Field:  c.Field,
+			Before: c.Before,
+			After:  c.After,
+		}
+	}
+	return res
+}
+
+// changedColumns returns the columns of the changed fields, they are the only ones written by the update.
+func changedColumns(changes []user.Change) []string {
+	res := make([]string, len(changes))
+	for i, c := range changes {
+		res[i] = c.Field
+	}
+	return res
+}
+
 var _ user.Service = (*userService)(nil)
@@ -2,14 +2,19 @@ package service_test
 
 import (
 	"context"
-	"errors"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/zechao/faceit-user-svc/auth"
+	"github.com/zechao/faceit-user-svc/errors"
+	"github.com/zechao/faceit-user-svc/event"
 	mockEvent "github.com/zechao/faceit-user-svc/event/mocks"
 	"github.com/zechao/faceit-user-svc/query"
 	"github.com/zechao/faceit-user-svc/service"
+	"github.com/zechao/faceit-user-svc/tracing"
 	"github.com/zechao/faceit-user-svc/user"
 	"github.com/zechao/faceit-user-svc/user/mocks"
 	"go.uber.org/mock/gomock"
@@ -37,14 +42,26 @@ var (
 	errTest = errors.New("test error")
 )
 
+// testTransactor runs fn without transaction, transactions are tested in the postgres package.
+type testTransactor struct{}
+
+func (testTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (testTransactor) WithinReadOnlyTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
 func TestCreateUser(t *testing.T) {
 	ctx := context.Background()
 	ctrl := gomock.NewController(t)
 
 	t.Run("should create user successfully", func(t *testing.T) {
 		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
 		eventHandler := mockEvent.NewMockEventHandler(ctrl)
-		svc := service.NewUserService(mockUserRepo, eventHandler)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, eventHandler)
 
 		reqUser := tesUser
 
@@ -63,8 +80,30 @@ func TestCreateUser(t *testing.T) {
 				user.ComparePassword(uu.Password, reqUser.Password)
 
 		})).Return(&expectedUser, nil)
-		eventHandler.EXPECT().SendEvent(ctx, string(user.UserCreated), expectedUser.ID).
+		eventHandler.EXPECT().SendEvent(ctx, string(user.UserCreated), event.NewUserCreated(event.UserSnapshot{
+			ID:        expectedUser.ID,
+			FirstName: expectedUser.FirstName,
+			LastName:  expectedUser.LastName,
+			NickName:  expectedUser.NickName,
+			Email:     expectedUser.Email,
+			Country:   expectedUser.Country,
+		})).
 			Return(nil)
+		// sign ups are anonymous, the password is redacted
+		mockAuditRepo.EXPECT().AddAuditEntry(ctx, gomock.Cond(func(e *user.AuditEntry) bool {
+			return e.UserID == expectedUser.ID &&
+				e.Operation == user.AuditCreate &&
+				e.ActorKind == user.AnonymousActor &&
+				e.ActorID == "" &&
+				assert.ObjectsAreEqual([]user.Change{
+					{Field: "first_name", After: expectedUser.FirstName},
+					{Field: "last_name", After: expectedUser.LastName},
+					{Field: "nick_name", After: expectedUser.NickName},
+					{Field: "password", Before: user.RedactedValue, After: user.RedactedValue},
+					{Field: "email", After: expectedUser.Email},
+					{Field: "country", After: expectedUser.Country},
+				}, e.Changes)
+		})).Return(nil)
 
 		res, err := svc.CreateUser(ctx, &testCreateUserInput)
 
@@ -72,10 +111,29 @@ func TestCreateUser(t *testing.T) {
 		assert.Nil(t, err)
 	})
 
+	t.Run("should fail when audit repository return error", func(t *testing.T) {
+		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+		eventHandler := mockEvent.NewMockEventHandler(ctrl)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, eventHandler)
+
+		expectedUser := tesUser
+		expectedUser.ID = uuid.New()
+
+		mockUserRepo.EXPECT().CreateUser(ctx, gomock.Any()).Return(&expectedUser, nil)
+		eventHandler.EXPECT().SendEvent(ctx, string(user.UserCreated), gomock.Any()).Return(nil)
+		mockAuditRepo.EXPECT().AddAuditEntry(ctx, gomock.Any()).Return(errTest)
+
+		res, err := svc.CreateUser(ctx, &testCreateUserInput)
+		assert.Nil(t, res)
+		assert.ErrorIs(t, err, errTest)
+	})
+
 	t.Run("should fail when repository return error", func(t *testing.T) {
 		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
 		eventHandler := mockEvent.NewMockEventHandler(ctrl)
-		svc := service.NewUserService(mockUserRepo, eventHandler)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, eventHandler)
 
 		mockUserRepo.EXPECT().CreateUser(ctx, gomock.Any()).Return(nil, errTest)
 
@@ -85,14 +143,15 @@ func TestCreateUser(t *testing.T) {
 	})
 	t.Run("should fail when event handler return error", func(t *testing.T) {
 		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
 		eventHandler := mockEvent.NewMockEventHandler(ctrl)
-		svc := service.NewUserService(mockUserRepo, eventHandler)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, eventHandler)
 
 		expectedUser := tesUser
 		expectedUser.ID = uuid.New()
 
 		mockUserRepo.EXPECT().CreateUser(ctx, gomock.Any()).Return(&expectedUser, nil)
-		eventHandler.EXPECT().SendEvent(ctx, string(user.UserCreated), expectedUser.ID).
+		eventHandler.EXPECT().SendEvent(ctx, string(user.UserCreated), gomock.Any()).
 			Return(errTest)
 
 		res, err := svc.CreateUser(ctx, &testCreateUserInput)
@@ -100,15 +159,43 @@ func TestCreateUser(t *testing.T) {
 		assert.ErrorIs(t, err, errTest)
 	})
 
+	t.Run("should fail when transaction fails", func(t *testing.T) {
+		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+		mockTransactor := mocks.NewMockTransactor(ctrl)
+		eventHandler := mockEvent.NewMockEventHandler(ctrl)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, mockTransactor, eventHandler)
+
+		expectedUser := tesUser
+		expectedUser.ID = uuid.New()
+
+		// the user and its event are saved, but the commit fails
+		mockTransactor.EXPECT().WithinTransaction(ctx, gomock.Any()).DoAndReturn(
+			func(ctx context.Context, fn func(ctx context.Context) error) error {
+				assert.NoError(t, fn(ctx))
+				return errTest
+			})
+		mockUserRepo.EXPECT().CreateUser(ctx, gomock.Any()).Return(&expectedUser, nil)
+		eventHandler.EXPECT().SendEvent(ctx, string(user.UserCreated), gomock.Any()).
+			Return(nil)
+		mockAuditRepo.EXPECT().AddAuditEntry(ctx, gomock.Any()).Return(nil)
+
+		res, err := svc.CreateUser(ctx, &testCreateUserInput)
+		assert.Nil(t, res)
+		assert.ErrorIs(t, err, errTest)
+	})
 }
 
 func TestUpdateUser(t *testing.T) {
 	ctx := context.Background()
 	ctrl := gomock.NewController(t)
 	t.Run("should update user successfully", func(t *testing.T) {
+		ctx := auth.ContextWithIdentity(tracing.ContextWithTracingID(ctx, "trace-id"),
+			&auth.Identity{Kind: auth.UserIdentity, Subject: "admin-id", Roles: []string{auth.RoleAdmin}})
 		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
 		mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
-		svc := service.NewUserService(mockUserRepo, mockEventHandler)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
 		currentUser := tesUser
 		currentUser.ID = uuid.New()
 
@@ -140,19 +227,65 @@ func TestUpdateUser(t *testing.T) {
 				// check that the password is hashed
 				user.ComparePassword(uu.Password, expectedUser.Password)
 
-		})).Return(&expectedUser, nil)
-		mockEventHandler.EXPECT().SendEvent(ctx, string(user.UserUpdated), expectedUser.ID).
+		}), []string{"first_name", "last_name", "nick_name", "password", "email", "country"}).Return(&expectedUser, nil)
+		mockEventHandler.EXPECT().SendEvent(ctx, string(user.UserUpdated), event.NewUserUpdated(expectedUser.ID,
+			[]event.FieldChange{
+				{Field: "first_name", Before: currentUser.FirstName, After: expectedUser.FirstName},
+				{Field: "last_name", Before: currentUser.LastName, After: expectedUser.LastName},
+				{Field: "nick_name", Before: currentUser.NickName, After: expectedUser.NickName},
+				// password values are never sent
+				{Field: "password"},
+				{Field: "email", Before: currentUser.Email, After: expectedUser.Email},
+				{Field: "country", Before: currentUser.Country, After: expectedUser.Country},
+			}, expectedUser.UpdatedAt)).
 			Return(nil)
+		// currentUser is updated in place, the old values are the ones of tesUser
+		mockAuditRepo.EXPECT().AddAuditEntry(ctx, gomock.Cond(func(e *user.AuditEntry) bool {
+			return e.UserID == expectedUser.ID &&
+				e.Operation == user.AuditUpdate &&
+				e.ActorKind == string(auth.UserIdentity) &&
+				e.ActorID == "admin-id" &&
+				e.TraceID == "trace-id" &&
+				assert.ObjectsAreEqual([]user.Change{
+					{Field: "first_name", Before: tesUser.FirstName, After: expectedUser.FirstName},
+					{Field: "last_name", Before: tesUser.LastName, After: expectedUser.LastName},
+					{Field: "nick_name", Before: tesUser.NickName, After: expectedUser.NickName},
+					{Field: "password", Before: user.RedactedValue, After: user.RedactedValue},
+					{Field: "email", Before: tesUser.Email, After: expectedUser.Email},
+					{Field: "country", Before: tesUser.Country, After: expectedUser.Country},
+				}, e.Changes)
+		})).Return(nil)
 		res, err := svc.UpdateUser(ctx, &updateInput)
 
 		assert.Equal(t, &expectedUser, res)
 		assert.Nil(t, err)
 	})
 
+	t.Run("should return user unchanged when nothing changes", func(t *testing.T) {
+		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+		mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
+		currentUser := tesUser
+		currentUser.ID = uuid.New()
+		// the values are the current ones, so there is no update, event nor audit entry
+		mockUserRepo.EXPECT().GetUserByID(ctx, currentUser.ID).Return(&currentUser, nil)
+
+		res, err := svc.UpdateUser(ctx, &user.UpdateUserInput{
+			ID:        currentUser.ID,
+			FirstName: &tesUser.FirstName,
+			Country:   &tesUser.Country,
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, &currentUser, res)
+	})
+
 	t.Run("should return error when get return error", func(t *testing.T) {
 		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
 		mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
-		svc := service.NewUserService(mockUserRepo, mockEventHandler)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
 		testID := uuid.New()
 		mockUserRepo.EXPECT().GetUserByID(ctx, testID).Return(nil, errTest)
 
@@ -164,16 +297,38 @@ func TestUpdateUser(t *testing.T) {
 		assert.ErrorIs(t, err, errTest)
 	})
 
+	t.Run("should return error when the version doesn't match", func(t *testing.T) {
+		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+		mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
+		currentUser := tesUser
+		currentUser.Version = 3
+		staleVersion := int64(2)
+		mockUserRepo.EXPECT().GetUserByID(ctx, currentUser.ID).Return(&currentUser, nil)
+
+		res, err := svc.UpdateUser(ctx, &user.UpdateUserInput{
+			ID:      currentUser.ID,
+			Version: &staleVersion,
+		})
+
+		assert.Nil(t, res)
+		assert.ErrorIs(t, err, errors.ErrVersionMismatch)
+	})
+
 	t.Run("should return error when uppdate return error", func(t *testing.T) {
 		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
 		mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
-		svc := service.NewUserService(mockUserRepo, mockEventHandler)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
 		currentUser := tesUser
+		country := "GB"
 		mockUserRepo.EXPECT().GetUserByID(ctx, gomock.Any()).Return(&currentUser, nil)
-		mockUserRepo.EXPECT().UpdateUser(ctx, gomock.Any()).Return(nil, errTest)
+		mockUserRepo.EXPECT().UpdateUser(ctx, gomock.Any(), []string{"country"}).Return(nil, errTest)
 
 		res, err := svc.UpdateUser(ctx, &user.UpdateUserInput{
-			ID: uuid.New(),
+			ID:      uuid.New(),
+			Country: &country,
 		})
 
 		assert.Nil(t, res)
@@ -182,15 +337,18 @@ func TestUpdateUser(t *testing.T) {
 
 	t.Run("should return error when event handler return error", func(t *testing.T) {
 		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
 		mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
-		svc := service.NewUserService(mockUserRepo, mockEventHandler)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
 		currentUser := tesUser
+		country := "GB"
 		mockUserRepo.EXPECT().GetUserByID(ctx, gomock.Any()).Return(&currentUser, nil)
-		mockUserRepo.EXPECT().UpdateUser(ctx, gomock.Any()).Return(&currentUser, nil)
-		mockEventHandler.EXPECT().SendEvent(ctx, string(user.UserUpdated), currentUser.ID).
+		mockUserRepo.EXPECT().UpdateUser(ctx, gomock.Any(), []string{"country"}).Return(&currentUser, nil)
+		mockEventHandler.EXPECT().SendEvent(ctx, string(user.UserUpdated), gomock.Any()).
 			Return(errTest)
 		res, err := svc.UpdateUser(ctx, &user.UpdateUserInput{
-			ID: uuid.New(),
+			ID:      uuid.New(),
+			Country: &country,
 		})
 
 		assert.Nil(t, res)
@@ -202,27 +360,65 @@ func TestDeleteUser(t *testing.T) {
 	ctx := context.Background()
 	ctrl := gomock.NewController(t)
 	id := uuid.New()
+	version := int64(3)
 	tests := map[string]struct {
-		setupMocks  func(mockUserRepo *mocks.MockRepository, mockEventHandler *mockEvent.MockEventHandler)
+		version     *int64
+		setupMocks  func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository, mockEventHandler *mockEvent.MockEventHandler)
 		expectedErr error
 	}{
 		"should delete user successfully": {
-			setupMocks: func(mockUserRepo *mocks.MockRepository, mockEventHandler *mockEvent.MockEventHandler) {
-				mockUserRepo.EXPECT().DeleteUser(ctx, id).Return(nil)
-				mockEventHandler.EXPECT().SendEvent(ctx, string(user.UserDeleted), id).Return(nil)
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository, mockEventHandler *mockEvent.MockEventHandler) {
+				mockUserRepo.EXPECT().DeleteUser(ctx, id, nil).Return(nil)
+				mockEventHandler.EXPECT().SendEvent(ctx, string(user.UserDeleted), gomock.Cond(func(e event.UserDeleted) bool {
+					return e.SchemaVersion == event.UserSchemaVersion &&
+						e.ID == id &&
+						time.Since(e.DeletedAt) < time.Minute
+				})).Return(nil)
+				mockAuditRepo.EXPECT().AddAuditEntry(ctx, gomock.Cond(func(e *user.AuditEntry) bool {
+					return e.UserID == id && e.Operation == user.AuditDelete && len(e.Changes) == 0
+				})).Return(nil)
+			},
+			expectedErr: nil,
+		},
+		"fail adding audit entry": {
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository, mockEventHandler *mockEvent.MockEventHandler) {
+				mockUserRepo.EXPECT().DeleteUser(ctx, id, nil).Return(nil)
+				mockEventHandler.EXPECT().SendEvent(ctx, string(user.UserDeleted), gomock.Any()).Return(nil)
+				mockAuditRepo.EXPECT().AddAuditEntry(ctx, gomock.Any()).Return(errTest)
+			},
+			expectedErr: errTest,
+		},
+		"should do nothing when the user doesn't exist or is deleted": {
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository, mockEventHandler *mockEvent.MockEventHandler) {
+				// no event nor audit entry is expected
+				mockUserRepo.EXPECT().DeleteUser(ctx, id, nil).Return(errors.ErrNotfound)
 			},
 			expectedErr: nil,
 		},
 		"fail deleting user": {
-			setupMocks: func(mockUserRepo *mocks.MockRepository, mockEventHandler *mockEvent.MockEventHandler) {
-				mockUserRepo.EXPECT().DeleteUser(ctx, id).Return(errTest)
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository, mockEventHandler *mockEvent.MockEventHandler) {
+				mockUserRepo.EXPECT().DeleteUser(ctx, id, nil).Return(errTest)
 			},
 			expectedErr: errTest,
 		},
+		"fail by version mismatch": {
+			version: &version,
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository, mockEventHandler *mockEvent.MockEventHandler) {
+				mockUserRepo.EXPECT().DeleteUser(ctx, id, &version).Return(errors.ErrVersionMismatch)
+			},
+			expectedErr: errors.ErrVersionMismatch,
+		},
+		"fail with version by user not found": {
+			version: &version,
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository, mockEventHandler *mockEvent.MockEventHandler) {
+				mockUserRepo.EXPECT().DeleteUser(ctx, id, &version).Return(errors.ErrNotfound)
+			},
+			expectedErr: errors.ErrNotfound,
+		},
 		"fail sending event": {
-			setupMocks: func(mockUserRepo *mocks.MockRepository, mockEventHandler *mockEvent.MockEventHandler) {
-				mockUserRepo.EXPECT().DeleteUser(ctx, id).Return(nil)
-				mockEventHandler.EXPECT().SendEvent(ctx, string(user.UserDeleted), id).Return(errTest)
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository, mockEventHandler *mockEvent.MockEventHandler) {
+				mockUserRepo.EXPECT().DeleteUser(ctx, id, nil).Return(nil)
+				mockEventHandler.EXPECT().SendEvent(ctx, string(user.UserDeleted), gomock.Any()).Return(errTest)
 			},
 			expectedErr: errTest,
 		},
@@ -231,36 +427,410 @@ func TestDeleteUser(t *testing.T) {
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
 			mockUserRepo := mocks.NewMockRepository(ctrl)
+			mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
 			mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
-			svc := service.NewUserService(mockUserRepo, mockEventHandler)
+			svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
 
-			tc.setupMocks(mockUserRepo, mockEventHandler)
+			tc.setupMocks(mockUserRepo, mockAuditRepo, mockEventHandler)
 
-			err := svc.DeleteUser(ctx, id)
+			err := svc.DeleteUser(ctx, id, tc.version)
 			if tc.expectedErr != nil {
 				assert.ErrorIs(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
 			}
 
 		})
 	}
 }
 
+func TestRestoreUser(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	restored := tesUser
+	restored.ID = uuid.New()
+	restored.Version = 3
+	restored.UpdatedAt = time.Now()
+
+	tests := map[string]struct {
+		setupMocks   func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository, mockEventHandler *mockEvent.MockEventHandler)
+		expectedUser *user.User
+		expectedErr  error
+	}{
+		"should restore user successfully": {
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository, mockEventHandler *mockEvent.MockEventHandler) {
+				mockUserRepo.EXPECT().RestoreUser(ctx, restored.ID).Return(&restored, nil)
+				mockEventHandler.EXPECT().SendEvent(ctx, string(user.UserRestored),
+					event.NewUserRestored(event.UserSnapshot{
+						ID:        restored.ID,
+						FirstName: restored.FirstName,
+						LastName:  restored.LastName,
+						NickName:  restored.NickName,
+						Email:     restored.Email,
+						Country:   restored.Country,
+						CreatedAt: restored.CreatedAt,
+						UpdatedAt: restored.UpdatedAt,
+					}, restored.UpdatedAt)).Return(nil)
+				mockAuditRepo.EXPECT().AddAuditEntry(ctx, gomock.Cond(func(e *user.AuditEntry) bool {
+					return e.UserID == restored.ID && e.Operation == user.AuditRestore && len(e.Changes) == 0
+				})).Return(nil)
+			},
+			expectedUser: &restored,
+		},
+		"should return user that is not deleted without event": {
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository, mockEventHandler *mockEvent.MockEventHandler) {
+				mockUserRepo.EXPECT().RestoreUser(ctx, restored.ID).Return(nil, errors.ErrNotfound)
+				mockUserRepo.EXPECT().GetUserByID(ctx, restored.ID).Return(&restored, nil)
+			},
+			expectedUser: &restored,
+		},
+		"fail by not found": {
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository, mockEventHandler *mockEvent.MockEventHandler) {
+				mockUserRepo.EXPECT().RestoreUser(ctx, restored.ID).Return(nil, errors.ErrNotfound)
+				mockUserRepo.EXPECT().GetUserByID(ctx, restored.ID).Return(nil, errors.ErrNotfound)
+			},
+			expectedErr: errors.ErrNotfound,
+		},
+		"fail by email taken": {
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository, mockEventHandler *mockEvent.MockEventHandler) {
+				mockUserRepo.EXPECT().RestoreUser(ctx, restored.ID).Return(nil, errors.ErrDuplicated)
+			},
+			expectedErr: user.ErrEmailTaken,
+		},
+		"fail restoring user": {
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository, mockEventHandler *mockEvent.MockEventHandler) {
+				mockUserRepo.EXPECT().RestoreUser(ctx, restored.ID).Return(nil, errTest)
+			},
+			expectedErr: errTest,
+		},
+		"fail sending event": {
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository, mockEventHandler *mockEvent.MockEventHandler) {
+				mockUserRepo.EXPECT().RestoreUser(ctx, restored.ID).Return(&restored, nil)
+				mockEventHandler.EXPECT().SendEvent(ctx, string(user.UserRestored), gomock.Any()).Return(errTest)
+			},
+			expectedErr: errTest,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockUserRepo := mocks.NewMockRepository(ctrl)
+			mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+			mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
+			svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
+
+			tc.setupMocks(mockUserRepo, mockAuditRepo, mockEventHandler)
+
+			res, err := svc.RestoreUser(ctx, restored.ID)
+			assert.ErrorIs(t, err, tc.expectedErr)
+			assert.Equal(t, tc.expectedUser, res)
+		})
+	}
+}
+
+func TestEraseUser(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	id := uuid.New()
+	version := int64(3)
+	tests := map[string]struct {
+		version     *int64
+		setupMocks  func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository, mockEventHandler *mockEvent.MockEventHandler)
+		expectedErr error
+	}{
+		"should erase user successfully": {
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository, mockEventHandler *mockEvent.MockEventHandler) {
+				mockUserRepo.EXPECT().EraseUser(ctx, id, nil).Return(nil)
+				mockAuditRepo.EXPECT().DeleteUserAuditEntries(ctx, id).Return(int64(2), nil)
+				mockEventHandler.EXPECT().SendEvent(ctx, string(user.UserErased), gomock.Cond(func(e event.UserErased) bool {
+					return e.SchemaVersion == event.UserSchemaVersion &&
+						e.ID == id &&
+						time.Since(e.ErasedAt) < time.Minute
+				})).Return(nil)
+			},
+		},
+		"should do nothing when user not exist": {
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository, mockEventHandler *mockEvent.MockEventHandler) {
+				mockUserRepo.EXPECT().EraseUser(ctx, id, nil).Return(errors.ErrNotfound)
+			},
+		},
+		"fail by version mismatch": {
+			version: &version,
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository, mockEventHandler *mockEvent.MockEventHandler) {
+				mockUserRepo.EXPECT().EraseUser(ctx, id, &version).Return(errors.ErrVersionMismatch)
+			},
+			expectedErr: errors.ErrVersionMismatch,
+		},
+		"fail erasing user": {
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository, mockEventHandler *mockEvent.MockEventHandler) {
+				mockUserRepo.EXPECT().EraseUser(ctx, id, nil).Return(errTest)
+			},
+			expectedErr: errTest,
+		},
+		"fail deleting audit entries": {
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository, mockEventHandler *mockEvent.MockEventHandler) {
+				mockUserRepo.EXPECT().EraseUser(ctx, id, nil).Return(nil)
+				mockAuditRepo.EXPECT().DeleteUserAuditEntries(ctx, id).Return(int64(0), errTest)
+			},
+			expectedErr: errTest,
+		},
+		"fail sending event": {
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository, mockEventHandler *mockEvent.MockEventHandler) {
+				mockUserRepo.EXPECT().EraseUser(ctx, id, nil).Return(nil)
+				mockAuditRepo.EXPECT().DeleteUserAuditEntries(ctx, id).Return(int64(0), nil)
+				mockEventHandler.EXPECT().SendEvent(ctx, string(user.UserErased), gomock.Any()).Return(errTest)
+			},
+			expectedErr: errTest,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockUserRepo := mocks.NewMockRepository(ctrl)
+			mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+			mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
+			svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
+
+			tc.setupMocks(mockUserRepo, mockAuditRepo, mockEventHandler)
+
+			err := svc.EraseUser(ctx, id, tc.version)
+			assert.ErrorIs(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	deletedBefore := time.Now().Add(-time.Hour)
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+
+	t.Run("should purge users in batches", func(t *testing.T) {
+		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+		mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
+
+		gomock.InOrder(
+			mockUserRepo.EXPECT().PurgeDeletedUsers(ctx, deletedBefore, 2).Return(ids[:2], nil),
+			mockUserRepo.EXPECT().PurgeDeletedUsers(ctx, deletedBefore, 2).Return(ids[2:], nil),
+		)
+		mockAuditRepo.EXPECT().DeleteUserAuditEntries(ctx, ids[0], ids[1]).Return(int64(0), nil)
+		mockAuditRepo.EXPECT().DeleteUserAuditEntries(ctx, ids[2]).Return(int64(0), nil)
+		for _, id := range ids {
+			mockEventHandler.EXPECT().SendEvent(ctx, string(user.UserErased), gomock.Cond(func(e event.UserErased) bool {
+				return e.ID == id
+			})).Return(nil)
+		}
+
+		purged, err := svc.PurgeDeletedUsers(ctx, deletedBefore, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, purged)
+	})
+
+	t.Run("should stop when nothing to purge", func(t *testing.T) {
+		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+		mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
+
+		mockUserRepo.EXPECT().PurgeDeletedUsers(ctx, deletedBefore, 2).Return(ids[:2], nil)
+		mockUserRepo.EXPECT().PurgeDeletedUsers(ctx, deletedBefore, 2).Return([]uuid.UUID{}, nil)
+		mockAuditRepo.EXPECT().DeleteUserAuditEntries(ctx, ids[0], ids[1]).Return(int64(0), nil)
+		mockEventHandler.EXPECT().SendEvent(ctx, string(user.UserErased), gomock.Any()).Return(nil).Times(2)
+
+		purged, err := svc.PurgeDeletedUsers(ctx, deletedBefore, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, purged)
+	})
+
+	t.Run("should return purged users before error", func(t *testing.T) {
+		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+		mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
+
+		mockUserRepo.EXPECT().PurgeDeletedUsers(ctx, deletedBefore, 2).Return(ids[:2], nil)
+		mockUserRepo.EXPECT().PurgeDeletedUsers(ctx, deletedBefore, 2).Return(ids[2:], nil)
+		mockAuditRepo.EXPECT().DeleteUserAuditEntries(ctx, gomock.Any()).Return(int64(0), nil).Times(2)
+		mockEventHandler.EXPECT().SendEvent(ctx, string(user.UserErased), gomock.Any()).Return(nil).Times(2)
+		mockEventHandler.EXPECT().SendEvent(ctx, string(user.UserErased), gomock.Any()).Return(errTest)
+
+		purged, err := svc.PurgeDeletedUsers(ctx, deletedBefore, 2)
+		assert.ErrorIs(t, err, errTest)
+		assert.Equal(t, 2, purged)
+	})
+
+	t.Run("should stop when context is done", func(t *testing.T) {
+		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+		mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		purged, err := svc.PurgeDeletedUsers(cancelled, deletedBefore, 2)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Zero(t, purged)
+	})
+}
+
+func TestGetUser(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	id := uuid.New()
+	tests := map[string]struct {
+		fields       []string
+		setupMocks   func(mockUserRepo *mocks.MockRepository)
+		expectedUser *user.User
+		expectedErr  error
+	}{
+		"should get user successfully": {
+			setupMocks: func(mockUserRepo *mocks.MockRepository) {
+				u := tesUser
+				u.ID = id
+				mockUserRepo.EXPECT().GetUserFields(ctx, id, nil).Return(&u, nil)
+			},
+			expectedUser: func() *user.User {
+				u := tesUser
+				u.ID = id
+				return &u
+			}(),
+		},
+		"should get only the fields": {
+			fields: []string{"email"},
+			setupMocks: func(mockUserRepo *mocks.MockRepository) {
+				mockUserRepo.EXPECT().GetUserFields(ctx, id, []string{"email"}).Return(&user.User{ID: id, Email: tesUser.Email}, nil)
+			},
+			expectedUser: &user.User{ID: id, Email: tesUser.Email},
+		},
+		"fail getting user": {
+			setupMocks: func(mockUserRepo *mocks.MockRepository) {
+				mockUserRepo.EXPECT().GetUserFields(ctx, id, nil).Return(nil, errTest)
+			},
+			expectedErr: errTest,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockUserRepo := mocks.NewMockRepository(ctrl)
+			mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+			mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
+			svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
+
+			tc.setupMocks(mockUserRepo)
+
+			res, err := svc.GetUser(ctx, id, tc.fields)
+			assert.Equal(t, tc.expectedUser, res)
+			assert.ErrorIs(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestListUserHistory(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	id := uuid.New()
+	entries := []user.AuditEntry{
+		{ID: uuid.New(), UserID: id, Operation: user.AuditUpdate, ActorKind: string(auth.UserIdentity), ActorID: id.String()},
+		{ID: uuid.New(), UserID: id, Operation: user.AuditCreate, ActorKind: user.AnonymousActor},
+	}
+	page := func(p query.Pagination, total int64, data []user.AuditEntry) *query.PaginationResponse[user.AuditEntry] {
+		return &query.PaginationResponse[user.AuditEntry]{
+			Page:         p.Page,
+			PageSize:     p.PageSize,
+			TotalRecords: total,
+			TotalMode:    query.TotalExact,
+			SortBy:       "created_at",
+			SortOrder:    "desc",
+			Filters:      map[string][]string{},
+			Data:         data,
+		}
+	}
+
+	tests := map[string]struct {
+		pagination      query.Pagination
+		setupMocks      func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository)
+		expectedHistory *query.PaginationResponse[user.AuditEntry]
+		expectedErr     error
+	}{
+		"should list history successfully": {
+			pagination: query.Pagination{Page: 1, PageSize: 10},
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository) {
+				mockUserRepo.EXPECT().GetUserByIDWithDeleted(ctx, id).Return(&user.User{ID: id}, nil)
+				mockAuditRepo.EXPECT().CountUserAuditEntries(ctx, id).Return(int64(2), nil)
+				mockAuditRepo.EXPECT().ListUserAuditEntries(ctx, id, 1, 10).Return(entries, nil)
+			},
+			expectedHistory: page(query.Pagination{Page: 1, PageSize: 10}, 2, entries),
+		},
+		"should return empty page out of range": {
+			pagination: query.Pagination{Page: 2, PageSize: 2},
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository) {
+				mockUserRepo.EXPECT().GetUserByIDWithDeleted(ctx, id).Return(&user.User{ID: id}, nil)
+				mockAuditRepo.EXPECT().CountUserAuditEntries(ctx, id).Return(int64(2), nil)
+			},
+			expectedHistory: page(query.Pagination{Page: 2, PageSize: 2}, 2, []user.AuditEntry{}),
+		},
+		"fail by not found": {
+			pagination: query.Pagination{Page: 1, PageSize: 10},
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository) {
+				mockUserRepo.EXPECT().GetUserByIDWithDeleted(ctx, id).Return(nil, errors.ErrNotfound)
+			},
+			expectedErr: errors.ErrNotfound,
+		},
+		"fail counting entries": {
+			pagination: query.Pagination{Page: 1, PageSize: 10},
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository) {
+				mockUserRepo.EXPECT().GetUserByIDWithDeleted(ctx, id).Return(&user.User{ID: id}, nil)
+				mockAuditRepo.EXPECT().CountUserAuditEntries(ctx, id).Return(int64(0), errTest)
+			},
+			expectedErr: errTest,
+		},
+		"fail listing entries": {
+			pagination: query.Pagination{Page: 1, PageSize: 10},
+			setupMocks: func(mockUserRepo *mocks.MockRepository, mockAuditRepo *mocks.MockAuditRepository) {
+				mockUserRepo.EXPECT().GetUserByIDWithDeleted(ctx, id).Return(&user.User{ID: id}, nil)
+				mockAuditRepo.EXPECT().CountUserAuditEntries(ctx, id).Return(int64(2), nil)
+				mockAuditRepo.EXPECT().ListUserAuditEntries(ctx, id, 1, 10).Return(nil, errTest)
+			},
+			expectedErr: errTest,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockUserRepo := mocks.NewMockRepository(ctrl)
+			mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+			svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEvent.NewMockEventHandler(ctrl))
+
+			tc.setupMocks(mockUserRepo, mockAuditRepo)
+
+			res, err := svc.ListUserHistory(ctx, id, tc.pagination)
+			assert.ErrorIs(t, err, tc.expectedErr)
+			assert.Equal(t, tc.expectedHistory, res)
+		})
+	}
+}
+
 func TestListUsers(t *testing.T) {
 	ctx := context.Background()
 	ctrl := gomock.NewController(t)
 
 	t.Run("success list user one page", func(t *testing.T) {
 		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
 		mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
-		svc := service.NewUserService(mockUserRepo, mockEventHandler)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
 
 		q := query.Query{
 			Page:      1,
 			PageSize:  10,
 			SortOrder: "asc",
 			SortBy:    "created_by",
-			Filters: map[string][]string{
-				"name": {"John Doe", "Jane Doe2"},
+			Filters: query.Filters{
+				{Column: "first_name", Operator: query.OpIn, Values: []any{"John Doe", "Jane Doe2"}},
 			},
 		}
 
@@ -275,8 +845,9 @@ func TestListUsers(t *testing.T) {
 			SortOrder:    "asc",
 			SortBy:       "created_by",
 			TotalRecords: 2,
+			TotalMode:    query.TotalExact,
 			Filters: map[string][]string{
-				"name": {"John Doe", "Jane Doe2"},
+				"first_name": {"John Doe", "Jane Doe2"},
 			},
 			Data: users,
 		}
@@ -290,10 +861,36 @@ func TestListUsers(t *testing.T) {
 		assert.NoError(t, err)
 	})
 
+	t.Run("success list sparse fields", func(t *testing.T) {
+		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+		mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
+
+		q := query.Query{
+			Page:      1,
+			PageSize:  10,
+			SortOrder: "desc",
+			SortBy:    "created_at",
+			Fields:    []string{"id", "nick_name"},
+		}
+		users := []user.User{tesUser}
+
+		mockUserRepo.EXPECT().CountUsers(ctx, q.Filters).Return(int64(len(users)), nil)
+		mockUserRepo.EXPECT().ListUsers(ctx, q).Return(users, nil)
+
+		res, err := svc.ListUsers(ctx, q)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"id", "nick_name"}, res.Fields)
+		assert.Equal(t, users, res.Data)
+	})
+
 	t.Run("success list last page", func(t *testing.T) {
 		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
 		mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
-		svc := service.NewUserService(mockUserRepo, mockEventHandler)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
 		users := []user.User{
 			tesUser,
 			tesUser,
@@ -304,8 +901,8 @@ func TestListUsers(t *testing.T) {
 			PageSize:  10,
 			SortOrder: "asc",
 			SortBy:    "created_by",
-			Filters: map[string][]string{
-				"name": {"John Doe", "Jane Doe2"},
+			Filters: query.Filters{
+				{Column: "first_name", Operator: query.OpIn, Values: []any{"John Doe", "Jane Doe2"}},
 			},
 		}
 
@@ -316,8 +913,9 @@ func TestListUsers(t *testing.T) {
 			SortOrder:    "asc",
 			SortBy:       "created_by",
 			TotalRecords: totalCount,
+			TotalMode:    query.TotalExact,
 			Filters: map[string][]string{
-				"name": {"John Doe", "Jane Doe2"},
+				"first_name": {"John Doe", "Jane Doe2"},
 			},
 			Data: users,
 		}
@@ -333,16 +931,17 @@ func TestListUsers(t *testing.T) {
 
 	t.Run("empty list when total count is zero", func(t *testing.T) {
 		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
 		mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
-		svc := service.NewUserService(mockUserRepo, mockEventHandler)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
 
 		q := query.Query{
 			Page:      1,
 			PageSize:  10,
 			SortOrder: "asc",
 			SortBy:    "created_by",
-			Filters: map[string][]string{
-				"name": {"John Doe", "Jane Doe2"},
+			Filters: query.Filters{
+				{Column: "first_name", Operator: query.OpIn, Values: []any{"John Doe", "Jane Doe2"}},
 			},
 		}
 
@@ -352,8 +951,9 @@ func TestListUsers(t *testing.T) {
 			SortOrder:    "asc",
 			SortBy:       "created_by",
 			TotalRecords: 0,
+			TotalMode:    query.TotalExact,
 			Filters: map[string][]string{
-				"name": {"John Doe", "Jane Doe2"},
+				"first_name": {"John Doe", "Jane Doe2"},
 			},
 			Data: []user.User{},
 		}
@@ -368,8 +968,9 @@ func TestListUsers(t *testing.T) {
 
 	t.Run("empty list when page requested is beyond the last page", func(t *testing.T) {
 		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
 		mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
-		svc := service.NewUserService(mockUserRepo, mockEventHandler)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
 
 		totalCount := int64(12) // Assuming there are 12 users in total
 		q := query.Query{
@@ -377,8 +978,8 @@ func TestListUsers(t *testing.T) {
 			PageSize:  10,
 			SortOrder: "asc",
 			SortBy:    "created_by",
-			Filters: map[string][]string{
-				"name": {"John Doe", "Jane Doe2"},
+			Filters: query.Filters{
+				{Column: "first_name", Operator: query.OpIn, Values: []any{"John Doe", "Jane Doe2"}},
 			},
 		}
 
@@ -389,8 +990,9 @@ func TestListUsers(t *testing.T) {
 			SortOrder:    "asc",
 			SortBy:       "created_by",
 			TotalRecords: totalCount,
+			TotalMode:    query.TotalExact,
 			Filters: map[string][]string{
-				"name": {"John Doe", "Jane Doe2"},
+				"first_name": {"John Doe", "Jane Doe2"},
 			},
 			Data: []user.User{},
 		}
@@ -405,16 +1007,17 @@ func TestListUsers(t *testing.T) {
 
 	t.Run("fail when count return error", func(t *testing.T) {
 		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
 		mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
-		svc := service.NewUserService(mockUserRepo, mockEventHandler)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
 
 		q := query.Query{
 			Page:      1,
 			PageSize:  10,
 			SortOrder: "asc",
 			SortBy:    "created_by",
-			Filters: map[string][]string{
-				"name": {"John Doe", "Jane Doe2"},
+			Filters: query.Filters{
+				{Column: "first_name", Operator: query.OpIn, Values: []any{"John Doe", "Jane Doe2"}},
 			},
 		}
 		// page request is beyond the last page, so we expect an empty list
@@ -426,16 +1029,17 @@ func TestListUsers(t *testing.T) {
 
 	t.Run("fail when list user return error", func(t *testing.T) {
 		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
 		mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
-		svc := service.NewUserService(mockUserRepo, mockEventHandler)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
 
 		q := query.Query{
 			Page:      1,
 			PageSize:  10,
 			SortOrder: "asc",
 			SortBy:    "created_by",
-			Filters: map[string][]string{
-				"name": {"John Doe", "Jane Doe2"},
+			Filters: query.Filters{
+				{Column: "first_name", Operator: query.OpIn, Values: []any{"John Doe", "Jane Doe2"}},
 			},
 		}
 		// page request is beyond the last page, so we expect an empty list
@@ -446,4 +1050,183 @@ func TestListUsers(t *testing.T) {
 		assert.ErrorIs(t, err, errTest)
 	})
 
+	t.Run("success estimated total", func(t *testing.T) {
+		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+		mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
+
+		q := query.Query{Page: 3, PageSize: 10, IncludeTotal: query.TotalEstimate}
+		users := []user.User{tesUser}
+		// estimates are not used to check the page range
+		mockUserRepo.EXPECT().EstimateCountUsers(ctx, q.Filters).Return(int64(1), nil)
+		mockUserRepo.EXPECT().ListUsers(ctx, q).Return(users, nil)
+		res, err := svc.ListUsers(ctx, q)
+		assert.NoError(t, err)
+		assert.Equal(t, query.TotalEstimate, res.TotalMode)
+		assert.EqualValues(t, 1, res.TotalRecords)
+		assert.Equal(t, users, res.Data)
+	})
+
+	t.Run("fail estimated total", func(t *testing.T) {
+		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+		mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
+
+		q := query.Query{Page: 1, PageSize: 10, IncludeTotal: query.TotalEstimate}
+		mockUserRepo.EXPECT().EstimateCountUsers(ctx, q.Filters).Return(int64(0), errTest)
+		res, err := svc.ListUsers(ctx, q)
+		assert.Nil(t, res)
+		assert.ErrorIs(t, err, errTest)
+	})
+
+	t.Run("success without total", func(t *testing.T) {
+		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+		mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
+
+		q := query.Query{Page: 1, PageSize: 10, IncludeTotal: query.TotalNone}
+		users := []user.User{tesUser}
+		mockUserRepo.EXPECT().ListUsers(ctx, q).Return(users, nil)
+		res, err := svc.ListUsers(ctx, q)
+		assert.NoError(t, err)
+		assert.Equal(t, query.TotalNone, res.TotalMode)
+		assert.Zero(t, res.TotalRecords)
+		assert.Equal(t, users, res.Data)
+	})
+
+	t.Run("success full page returns next cursor", func(t *testing.T) {
+		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+		mockEventHandler := mockEvent.NewMockEventHandler(ctrl)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEventHandler)
+
+		q := query.Query{
+			Page:      1,
+			PageSize:  2,
+			SortOrder: "asc",
+			SortBy:    "country",
+		}
+		last := tesUser
+		last.ID = uuid.New()
+		users := []user.User{tesUser, last}
+
+		mockUserRepo.EXPECT().CountUsers(ctx, q.Filters).Return(int64(5), nil)
+		mockUserRepo.EXPECT().ListUsers(ctx, q).Return(users, nil)
+		res, err := svc.ListUsers(ctx, q)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, res.NextCursor)
+
+		next, err := query.QueryFromURL(url.Values{"sort_by": {"country"}, "sort_order": {"asc"}, "cursor": {res.NextCursor}})
+		assert.NoError(t, err)
+		assert.Equal(t, &query.Cursor{
+			Sort:   query.Sort{{Column: "country"}},
+			Values: []any{last.Country},
+			ID:     last.ID,
+		}, next.Cursor)
+	})
+}
+
+func TestSearchUsers(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+
+	t.Run("success search", func(t *testing.T) {
+		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEvent.NewMockEventHandler(ctrl))
+
+		s := query.Search{Term: "zechoa", Page: 1, PageSize: 10}
+		users := []user.User{tesUser}
+		mockUserRepo.EXPECT().CountSearchUsers(ctx, "zechoa").Return(int64(1), nil)
+		mockUserRepo.EXPECT().SearchUsers(ctx, s).Return(users, nil)
+		res, err := svc.SearchUsers(ctx, s)
+		assert.NoError(t, err)
+		assert.Equal(t, &query.PaginationResponse[user.User]{
+			Page:         1,
+			PageSize:     10,
+			TotalRecords: 1,
+			TotalMode:    query.TotalExact,
+			SortBy:       query.SortByRelevance,
+			SortOrder:    "desc",
+			Filters:      map[string][]string{},
+			Data:         users,
+		}, res)
+	})
+
+	t.Run("empty when page is beyond the last page", func(t *testing.T) {
+		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEvent.NewMockEventHandler(ctrl))
+
+		s := query.Search{Term: "zechoa", Page: 2, PageSize: 10}
+		mockUserRepo.EXPECT().CountSearchUsers(ctx, "zechoa").Return(int64(10), nil)
+		res, err := svc.SearchUsers(ctx, s)
+		assert.NoError(t, err)
+		assert.Empty(t, res.Data)
+		assert.EqualValues(t, 10, res.TotalRecords)
+	})
+
+	t.Run("fail by count error", func(t *testing.T) {
+		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEvent.NewMockEventHandler(ctrl))
+
+		s := query.Search{Term: "zechoa", Page: 1, PageSize: 10}
+		mockUserRepo.EXPECT().CountSearchUsers(ctx, "zechoa").Return(int64(0), errTest)
+		res, err := svc.SearchUsers(ctx, s)
+		assert.Nil(t, res)
+		assert.ErrorIs(t, err, errTest)
+	})
+
+	t.Run("fail by search error", func(t *testing.T) {
+		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEvent.NewMockEventHandler(ctrl))
+
+		s := query.Search{Term: "zechoa", Page: 1, PageSize: 10}
+		mockUserRepo.EXPECT().CountSearchUsers(ctx, "zechoa").Return(int64(3), nil)
+		mockUserRepo.EXPECT().SearchUsers(ctx, s).Return(nil, errTest)
+		res, err := svc.SearchUsers(ctx, s)
+		assert.Nil(t, res)
+		assert.ErrorIs(t, err, errTest)
+	})
+}
+
+func TestExportUsers(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+
+	t.Run("success export", func(t *testing.T) {
+		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEvent.NewMockEventHandler(ctrl))
+
+		e := query.Export{Format: query.FormatCSV, Sort: query.Sort{{Column: "id"}}}
+		mockUserRepo.EXPECT().ExportUsers(ctx, e, gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ query.Export, fn func(*user.User) error) error {
+				return fn(&tesUser)
+			})
+
+		var exported []user.User
+		err := svc.ExportUsers(ctx, e, func(u *user.User) error {
+			exported = append(exported, *u)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []user.User{tesUser}, exported)
+	})
+
+	t.Run("fail by repository error", func(t *testing.T) {
+		mockUserRepo := mocks.NewMockRepository(ctrl)
+		mockAuditRepo := mocks.NewMockAuditRepository(ctrl)
+		svc := service.NewUserService(mockUserRepo, mockAuditRepo, testTransactor{}, mockEvent.NewMockEventHandler(ctrl))
+
+		e := query.Export{Format: query.FormatNDJSON}
+		mockUserRepo.EXPECT().ExportUsers(ctx, e, gomock.Any()).Return(errTest)
+		err := svc.ExportUsers(ctx, e, func(u *user.User) error { return nil })
+		assert.ErrorIs(t, err, errTest)
+	})
 }
@@ -9,23 +9,28 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 const (
 	// TracingIDKey is the key that should be sent in the request header to set the tracing ID.
 	TracingIDKey = "X-Trace-Id"
+	// TracingIDMetadataKey is the gRPC metadata key used to carry the tracing ID, metadata keys are always lowercase.
+	TracingIDMetadataKey = "x-trace-id"
 )
 
-var tracingIDKey = &struct{}{}
+// tracingIDKey is the context key of the tracing ID, a distinct type so it can't collide with other keys.
+type tracingIDKey struct{}
 
 // ContextWithTracingID returns a new context with a tracing ID.
 func ContextWithTracingID(ctx context.Context, tracingID string) context.Context {
-	return context.WithValue(ctx, tracingIDKey, tracingID)
+	return context.WithValue(ctx, tracingIDKey{}, tracingID)
 }
 
 // FromContext retrieves the tracing ID from the context.
 func FromContext(ctx context.Context) (string, bool) {
-	tracingID, ok := ctx.Value(tracingIDKey).(string)
+	tracingID, ok := ctx.Value(tracingIDKey{}).(string)
 	return tracingID, ok
 }
 
@@ -44,3 +49,34 @@ func TracingMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// UnaryServerInterceptor is the gRPC counterpart of TracingMiddleware.
+// It reads the tracing ID from the incoming metadata, generates a new one if not provided,
+// and sends it back to the client in the response header.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var tracingID string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(TracingIDMetadataKey); len(values) > 0 {
+				tracingID = values[0]
+			}
+		}
+		if tracingID == "" {
+			tracingID = uuid.NewString()
+		}
+		// failing to set the header must not fail the call, the ID is still propagated in context
+		_ = grpc.SetHeader(ctx, metadata.Pairs(TracingIDMetadataKey, tracingID))
+		return handler(ContextWithTracingID(ctx, tracingID), req)
+	}
+}
+
+// UnaryClientInterceptor propagates the tracing ID found in the context to the outgoing metadata,
+// so that the called service keeps the same tracing ID.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if tracingID, ok := FromContext(ctx); ok {
+			ctx = metadata.AppendToOutgoingContext(ctx, TracingIDMetadataKey, tracingID)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/zechao/faceit-user-svc/tracing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 func TestContextWithTracingID(t *testing.T) {
@@ -83,3 +85,54 @@ func TestTracingMiddleware(t *testing.T) {
 		assert.Equal(t, providedTracingID, w.Header().Get(tracing.TracingIDKey))
 	})
 }
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Test"}
+
+	t.Run("sets new tracing ID if not provided", func(t *testing.T) {
+		_, err := tracing.UnaryServerInterceptor()(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+			traceIDFromContext, ok := tracing.FromContext(ctx)
+			assert.True(t, ok)
+			assert.NotEmpty(t, traceIDFromContext)
+			return nil, nil
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("uses provided tracing ID", func(t *testing.T) {
+		providedTracingID := uuid.NewString()
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(tracing.TracingIDMetadataKey, providedTracingID))
+		_, err := tracing.UnaryServerInterceptor()(ctx, nil, info, func(ctx context.Context, req any) (any, error) {
+			traceIDFromContext, ok := tracing.FromContext(ctx)
+			assert.True(t, ok)
+			assert.Equal(t, providedTracingID, traceIDFromContext)
+			return nil, nil
+		})
+		assert.NoError(t, err)
+	})
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	t.Run("propagates tracing ID from context", func(t *testing.T) {
+		tracingID := uuid.NewString()
+		ctx := tracing.ContextWithTracingID(context.Background(), tracingID)
+		err := tracing.UnaryClientInterceptor()(ctx, "/test.Service/Test", nil, nil, nil,
+			func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				md, ok := metadata.FromOutgoingContext(ctx)
+				assert.True(t, ok)
+				assert.Equal(t, []string{tracingID}, md.Get(tracing.TracingIDMetadataKey))
+				return nil
+			})
+		assert.NoError(t, err)
+	})
+
+	t.Run("does nothing without tracing ID", func(t *testing.T) {
+		err := tracing.UnaryClientInterceptor()(context.Background(), "/test.Service/Test", nil, nil, nil,
+			func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				_, ok := metadata.FromOutgoingContext(ctx)
+				assert.False(t, ok)
+				return nil
+			})
+		assert.NoError(t, err)
+	})
+}
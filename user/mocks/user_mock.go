@@ -12,6 +12,7 @@ package mocks
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	uuid "github.com/google/uuid"
 	query "github.com/zechao/faceit-user-svc/query"
@@ -43,8 +44,23 @@ func (m *MockRepository) EXPECT() *MockRepositoryMockRecorder {
 	return m.recorder
 }
 
+// CountSearchUsers mocks base method.
+func (m *MockRepository) CountSearchUsers(ctx context.Context, term string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountSearchUsers", ctx, term)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountSearchUsers indicates an expected call of CountSearchUsers.
+func (mr *MockRepositoryMockRecorder) CountSearchUsers(ctx, term any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountSearchUsers", reflect.TypeOf((*MockRepository)(nil).CountSearchUsers), ctx, term)
+}
+
 // CountUsers mocks base method.
-func (m *MockRepository) CountUsers(ctx context.Context, filters map[string][]string) (int64, error) {
+func (m *MockRepository) CountUsers(ctx context.Context, filters query.Filters) (int64, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "CountUsers", ctx, filters)
 	ret0, _ := ret[0].(int64)
@@ -74,17 +90,75 @@ func (mr *MockRepositoryMockRecorder) CreateUser(ctx, u any) *gomock.Call {
 }
 
 // DeleteUser mocks base method.
-func (m *MockRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
+func (m *MockRepository) DeleteUser(ctx context.Context, id uuid.UUID, version *int64) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteUser", ctx, id)
+	ret := m.ctrl.Call(m, "DeleteUser", ctx, id, version)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteUser indicates an expected call of DeleteUser.
-func (mr *MockRepositoryMockRecorder) DeleteUser(ctx, id any) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) DeleteUser(ctx, id, version any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockRepository)(nil).DeleteUser), ctx, id, version)
+}
+
+// EraseUser mocks base method.
+func (m *MockRepository) EraseUser(ctx context.Context, id uuid.UUID, version *int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EraseUser", ctx, id, version)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EraseUser indicates an expected call of EraseUser.
+func (mr *MockRepositoryMockRecorder) EraseUser(ctx, id, version any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EraseUser", reflect.TypeOf((*MockRepository)(nil).EraseUser), ctx, id, version)
+}
+
+// EstimateCountUsers mocks base method.
+func (m *MockRepository) EstimateCountUsers(ctx context.Context, filters query.Filters) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EstimateCountUsers", ctx, filters)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EstimateCountUsers indicates an expected call of EstimateCountUsers.
+func (mr *MockRepositoryMockRecorder) EstimateCountUsers(ctx, filters any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EstimateCountUsers", reflect.TypeOf((*MockRepository)(nil).EstimateCountUsers), ctx, filters)
+}
+
+// ExportUsers mocks base method.
+func (m *MockRepository) ExportUsers(ctx context.Context, e query.Export, fn func(*user.User) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportUsers", ctx, e, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExportUsers indicates an expected call of ExportUsers.
+func (mr *MockRepositoryMockRecorder) ExportUsers(ctx, e, fn any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportUsers", reflect.TypeOf((*MockRepository)(nil).ExportUsers), ctx, e, fn)
+}
+
+// GetUserByEmail mocks base method.
+func (m *MockRepository) GetUserByEmail(ctx context.Context, email string) (*user.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByEmail", ctx, email)
+	ret0, _ := ret[0].(*user.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByEmail indicates an expected call of GetUserByEmail.
+func (mr *MockRepositoryMockRecorder) GetUserByEmail(ctx, email any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockRepository)(nil).DeleteUser), ctx, id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByEmail", reflect.TypeOf((*MockRepository)(nil).GetUserByEmail), ctx, email)
 }
 
 // GetUserByID mocks base method.
@@ -102,6 +176,36 @@ func (mr *MockRepositoryMockRecorder) GetUserByID(ctx, id any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByID", reflect.TypeOf((*MockRepository)(nil).GetUserByID), ctx, id)
 }
 
+// GetUserByIDWithDeleted mocks base method.
+func (m *MockRepository) GetUserByIDWithDeleted(ctx context.Context, id uuid.UUID) (*user.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByIDWithDeleted", ctx, id)
+	ret0, _ := ret[0].(*user.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByIDWithDeleted indicates an expected call of GetUserByIDWithDeleted.
+func (mr *MockRepositoryMockRecorder) GetUserByIDWithDeleted(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByIDWithDeleted", reflect.TypeOf((*MockRepository)(nil).GetUserByIDWithDeleted), ctx, id)
+}
+
+// GetUserFields mocks base method.
+func (m *MockRepository) GetUserFields(ctx context.Context, id uuid.UUID, fields []string) (*user.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserFields", ctx, id, fields)
+	ret0, _ := ret[0].(*user.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserFields indicates an expected call of GetUserFields.
+func (mr *MockRepositoryMockRecorder) GetUserFields(ctx, id, fields any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserFields", reflect.TypeOf((*MockRepository)(nil).GetUserFields), ctx, id, fields)
+}
+
 // ListUsers mocks base method.
 func (m *MockRepository) ListUsers(ctx context.Context, q query.Query) ([]user.User, error) {
 	m.ctrl.T.Helper()
@@ -117,19 +221,371 @@ func (mr *MockRepositoryMockRecorder) ListUsers(ctx, q any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUsers", reflect.TypeOf((*MockRepository)(nil).ListUsers), ctx, q)
 }
 
+// PurgeDeletedUsers mocks base method.
+func (m *MockRepository) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time, limit int) ([]uuid.UUID, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeDeletedUsers", ctx, deletedBefore, limit)
+	ret0, _ := ret[0].([]uuid.UUID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeDeletedUsers indicates an expected call of PurgeDeletedUsers.
+func (mr *MockRepositoryMockRecorder) PurgeDeletedUsers(ctx, deletedBefore, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeDeletedUsers", reflect.TypeOf((*MockRepository)(nil).PurgeDeletedUsers), ctx, deletedBefore, limit)
+}
+
+// RestoreUser mocks base method.
+func (m *MockRepository) RestoreUser(ctx context.Context, id uuid.UUID) (*user.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreUser", ctx, id)
+	ret0, _ := ret[0].(*user.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreUser indicates an expected call of RestoreUser.
+func (mr *MockRepositoryMockRecorder) RestoreUser(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreUser", reflect.TypeOf((*MockRepository)(nil).RestoreUser), ctx, id)
+}
+
+// SearchUsers mocks base method.
+func (m *MockRepository) SearchUsers(ctx context.Context, s query.Search) ([]user.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchUsers", ctx, s)
+	ret0, _ := ret[0].([]user.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchUsers indicates an expected call of SearchUsers.
+func (mr *MockRepositoryMockRecorder) SearchUsers(ctx, s any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchUsers", reflect.TypeOf((*MockRepository)(nil).SearchUsers), ctx, s)
+}
+
 // UpdateUser mocks base method.
-func (m *MockRepository) UpdateUser(ctx context.Context, u *user.User) (*user.User, error) {
+func (m *MockRepository) UpdateUser(ctx context.Context, u *user.User, columns []string) (*user.User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateUser", ctx, u)
+	ret := m.ctrl.Call(m, "UpdateUser", ctx, u, columns)
 	ret0, _ := ret[0].(*user.User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // UpdateUser indicates an expected call of UpdateUser.
-func (mr *MockRepositoryMockRecorder) UpdateUser(ctx, u any) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) UpdateUser(ctx, u, columns any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockRepository)(nil).UpdateUser), ctx, u, columns)
+}
+
+// MockIdempotencyRepository is a mock of IdempotencyRepository interface.
+type MockIdempotencyRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockIdempotencyRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockIdempotencyRepositoryMockRecorder is the mock recorder for MockIdempotencyRepository.
+type MockIdempotencyRepositoryMockRecorder struct {
+	mock *MockIdempotencyRepository
+}
+
+// NewMockIdempotencyRepository creates a new mock instance.
+func NewMockIdempotencyRepository(ctrl *gomock.Controller) *MockIdempotencyRepository {
+	mock := &MockIdempotencyRepository{ctrl: ctrl}
+	mock.recorder = &MockIdempotencyRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIdempotencyRepository) EXPECT() *MockIdempotencyRepositoryMockRecorder {
+	return m.recorder
+}
+
+// CreateIdempotencyRecord mocks base method.
+func (m *MockIdempotencyRepository) CreateIdempotencyRecord(ctx context.Context, r *user.IdempotencyRecord) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateIdempotencyRecord", ctx, r)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateIdempotencyRecord indicates an expected call of CreateIdempotencyRecord.
+func (mr *MockIdempotencyRepositoryMockRecorder) CreateIdempotencyRecord(ctx, r any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateIdempotencyRecord", reflect.TypeOf((*MockIdempotencyRepository)(nil).CreateIdempotencyRecord), ctx, r)
+}
+
+// DeleteErasedUsersIdempotencyRecords mocks base method.
+func (m *MockIdempotencyRepository) DeleteErasedUsersIdempotencyRecords(ctx context.Context) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteErasedUsersIdempotencyRecords", ctx)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteErasedUsersIdempotencyRecords indicates an expected call of DeleteErasedUsersIdempotencyRecords.
+func (mr *MockIdempotencyRepositoryMockRecorder) DeleteErasedUsersIdempotencyRecords(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteErasedUsersIdempotencyRecords", reflect.TypeOf((*MockIdempotencyRepository)(nil).DeleteErasedUsersIdempotencyRecords), ctx)
+}
+
+// DeleteExpiredIdempotencyRecords mocks base method.
+func (m *MockIdempotencyRepository) DeleteExpiredIdempotencyRecords(ctx context.Context, now time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteExpiredIdempotencyRecords", ctx, now)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteExpiredIdempotencyRecords indicates an expected call of DeleteExpiredIdempotencyRecords.
+func (mr *MockIdempotencyRepositoryMockRecorder) DeleteExpiredIdempotencyRecords(ctx, now any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExpiredIdempotencyRecords", reflect.TypeOf((*MockIdempotencyRepository)(nil).DeleteExpiredIdempotencyRecords), ctx, now)
+}
+
+// DeleteUserIdempotencyRecords mocks base method.
+func (m *MockIdempotencyRepository) DeleteUserIdempotencyRecords(ctx context.Context, userID uuid.UUID) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUserIdempotencyRecords", ctx, userID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteUserIdempotencyRecords indicates an expected call of DeleteUserIdempotencyRecords.
+func (mr *MockIdempotencyRepositoryMockRecorder) DeleteUserIdempotencyRecords(ctx, userID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUserIdempotencyRecords", reflect.TypeOf((*MockIdempotencyRepository)(nil).DeleteUserIdempotencyRecords), ctx, userID)
+}
+
+// GetIdempotencyRecord mocks base method.
+func (m *MockIdempotencyRepository) GetIdempotencyRecord(ctx context.Context, key string, now time.Time) (*user.IdempotencyRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetIdempotencyRecord", ctx, key, now)
+	ret0, _ := ret[0].(*user.IdempotencyRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetIdempotencyRecord indicates an expected call of GetIdempotencyRecord.
+func (mr *MockIdempotencyRepositoryMockRecorder) GetIdempotencyRecord(ctx, key, now any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetIdempotencyRecord", reflect.TypeOf((*MockIdempotencyRepository)(nil).GetIdempotencyRecord), ctx, key, now)
+}
+
+// MockActivityRepository is a mock of ActivityRepository interface.
+type MockActivityRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockActivityRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockActivityRepositoryMockRecorder is the mock recorder for MockActivityRepository.
+type MockActivityRepositoryMockRecorder struct {
+	mock *MockActivityRepository
+}
+
+// NewMockActivityRepository creates a new mock instance.
+func NewMockActivityRepository(ctrl *gomock.Controller) *MockActivityRepository {
+	mock := &MockActivityRepository{ctrl: ctrl}
+	mock.recorder = &MockActivityRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockActivityRepository) EXPECT() *MockActivityRepositoryMockRecorder {
+	return m.recorder
+}
+
+// ListUserAudit mocks base method.
+func (m *MockActivityRepository) ListUserAudit(ctx context.Context, userID uuid.UUID) ([]user.AuditEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUserAudit", ctx, userID)
+	ret0, _ := ret[0].([]user.AuditEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUserAudit indicates an expected call of ListUserAudit.
+func (mr *MockActivityRepositoryMockRecorder) ListUserAudit(ctx, userID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUserAudit", reflect.TypeOf((*MockActivityRepository)(nil).ListUserAudit), ctx, userID)
+}
+
+// ListUserEvents mocks base method.
+func (m *MockActivityRepository) ListUserEvents(ctx context.Context, userID uuid.UUID) ([]user.EventRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUserEvents", ctx, userID)
+	ret0, _ := ret[0].([]user.EventRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUserEvents indicates an expected call of ListUserEvents.
+func (mr *MockActivityRepositoryMockRecorder) ListUserEvents(ctx, userID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUserEvents", reflect.TypeOf((*MockActivityRepository)(nil).ListUserEvents), ctx, userID)
+}
+
+// ListUserSessions mocks base method.
+func (m *MockActivityRepository) ListUserSessions(ctx context.Context, userID uuid.UUID) ([]user.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUserSessions", ctx, userID)
+	ret0, _ := ret[0].([]user.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUserSessions indicates an expected call of ListUserSessions.
+func (mr *MockActivityRepositoryMockRecorder) ListUserSessions(ctx, userID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUserSessions", reflect.TypeOf((*MockActivityRepository)(nil).ListUserSessions), ctx, userID)
+}
+
+// MockAuditRepository is a mock of AuditRepository interface.
+type MockAuditRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockAuditRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockAuditRepositoryMockRecorder is the mock recorder for MockAuditRepository.
+type MockAuditRepositoryMockRecorder struct {
+	mock *MockAuditRepository
+}
+
+// NewMockAuditRepository creates a new mock instance.
+func NewMockAuditRepository(ctrl *gomock.Controller) *MockAuditRepository {
+	mock := &MockAuditRepository{ctrl: ctrl}
+	mock.recorder = &MockAuditRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAuditRepository) EXPECT() *MockAuditRepositoryMockRecorder {
+	return m.recorder
+}
+
+// AddAuditEntry mocks base method.
+func (m *MockAuditRepository) AddAuditEntry(ctx context.Context, e *user.AuditEntry) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddAuditEntry", ctx, e)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddAuditEntry indicates an expected call of AddAuditEntry.
+func (mr *MockAuditRepositoryMockRecorder) AddAuditEntry(ctx, e any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddAuditEntry", reflect.TypeOf((*MockAuditRepository)(nil).AddAuditEntry), ctx, e)
+}
+
+// CountUserAuditEntries mocks base method.
+func (m *MockAuditRepository) CountUserAuditEntries(ctx context.Context, userID uuid.UUID) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountUserAuditEntries", ctx, userID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountUserAuditEntries indicates an expected call of CountUserAuditEntries.
+func (mr *MockAuditRepositoryMockRecorder) CountUserAuditEntries(ctx, userID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountUserAuditEntries", reflect.TypeOf((*MockAuditRepository)(nil).CountUserAuditEntries), ctx, userID)
+}
+
+// DeleteUserAuditEntries mocks base method.
+func (m *MockAuditRepository) DeleteUserAuditEntries(ctx context.Context, userIDs ...uuid.UUID) (int64, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx}
+	for _, a := range userIDs {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "DeleteUserAuditEntries", varargs...)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteUserAuditEntries indicates an expected call of DeleteUserAuditEntries.
+func (mr *MockAuditRepositoryMockRecorder) DeleteUserAuditEntries(ctx any, userIDs ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx}, userIDs...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUserAuditEntries", reflect.TypeOf((*MockAuditRepository)(nil).DeleteUserAuditEntries), varargs...)
+}
+
+// ListUserAuditEntries mocks base method.
+func (m *MockAuditRepository) ListUserAuditEntries(ctx context.Context, userID uuid.UUID, page, pageSize int) ([]user.AuditEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUserAuditEntries", ctx, userID, page, pageSize)
+	ret0, _ := ret[0].([]user.AuditEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUserAuditEntries indicates an expected call of ListUserAuditEntries.
+func (mr *MockAuditRepositoryMockRecorder) ListUserAuditEntries(ctx, userID, page, pageSize any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUserAuditEntries", reflect.TypeOf((*MockAuditRepository)(nil).ListUserAuditEntries), ctx, userID, page, pageSize)
+}
+
+// MockTransactor is a mock of Transactor interface.
+type MockTransactor struct {
+	ctrl     *gomock.Controller
+	recorder *MockTransactorMockRecorder
+	isgomock struct{}
+}
+
+// MockTransactorMockRecorder is the mock recorder for MockTransactor.
+type MockTransactorMockRecorder struct {
+	mock *MockTransactor
+}
+
+// NewMockTransactor creates a new mock instance.
+func NewMockTransactor(ctrl *gomock.Controller) *MockTransactor {
+	mock := &MockTransactor{ctrl: ctrl}
+	mock.recorder = &MockTransactorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTransactor) EXPECT() *MockTransactorMockRecorder {
+	return m.recorder
+}
+
+// WithinReadOnlyTransaction mocks base method.
+func (m *MockTransactor) WithinReadOnlyTransaction(ctx context.Context, fn func(context.Context) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithinReadOnlyTransaction", ctx, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WithinReadOnlyTransaction indicates an expected call of WithinReadOnlyTransaction.
+func (mr *MockTransactorMockRecorder) WithinReadOnlyTransaction(ctx, fn any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithinReadOnlyTransaction", reflect.TypeOf((*MockTransactor)(nil).WithinReadOnlyTransaction), ctx, fn)
+}
+
+// WithinTransaction mocks base method.
+func (m *MockTransactor) WithinTransaction(ctx context.Context, fn func(context.Context) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithinTransaction", ctx, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WithinTransaction indicates an expected call of WithinTransaction.
+func (mr *MockTransactorMockRecorder) WithinTransaction(ctx, fn any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockRepository)(nil).UpdateUser), ctx, u)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithinTransaction", reflect.TypeOf((*MockTransactor)(nil).WithinTransaction), ctx, fn)
 }
 
 // MockService is a mock of Service interface.
@@ -172,17 +628,75 @@ func (mr *MockServiceMockRecorder) CreateUser(ctx, u any) *gomock.Call {
 }
 
 // DeleteUser mocks base method.
-func (m *MockService) DeleteUser(ctx context.Context, id uuid.UUID) error {
+func (m *MockService) DeleteUser(ctx context.Context, id uuid.UUID, version *int64) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteUser", ctx, id)
+	ret := m.ctrl.Call(m, "DeleteUser", ctx, id, version)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteUser indicates an expected call of DeleteUser.
-func (mr *MockServiceMockRecorder) DeleteUser(ctx, id any) *gomock.Call {
+func (mr *MockServiceMockRecorder) DeleteUser(ctx, id, version any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockService)(nil).DeleteUser), ctx, id, version)
+}
+
+// EraseUser mocks base method.
+func (m *MockService) EraseUser(ctx context.Context, id uuid.UUID, version *int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EraseUser", ctx, id, version)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EraseUser indicates an expected call of EraseUser.
+func (mr *MockServiceMockRecorder) EraseUser(ctx, id, version any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EraseUser", reflect.TypeOf((*MockService)(nil).EraseUser), ctx, id, version)
+}
+
+// ExportUsers mocks base method.
+func (m *MockService) ExportUsers(ctx context.Context, e query.Export, fn func(*user.User) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportUsers", ctx, e, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExportUsers indicates an expected call of ExportUsers.
+func (mr *MockServiceMockRecorder) ExportUsers(ctx, e, fn any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportUsers", reflect.TypeOf((*MockService)(nil).ExportUsers), ctx, e, fn)
+}
+
+// GetUser mocks base method.
+func (m *MockService) GetUser(ctx context.Context, id uuid.UUID, fields []string) (*user.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUser", ctx, id, fields)
+	ret0, _ := ret[0].(*user.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUser indicates an expected call of GetUser.
+func (mr *MockServiceMockRecorder) GetUser(ctx, id, fields any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockService)(nil).DeleteUser), ctx, id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockService)(nil).GetUser), ctx, id, fields)
+}
+
+// ListUserHistory mocks base method.
+func (m *MockService) ListUserHistory(ctx context.Context, id uuid.UUID, p query.Pagination) (*query.PaginationResponse[user.AuditEntry], error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUserHistory", ctx, id, p)
+	ret0, _ := ret[0].(*query.PaginationResponse[user.AuditEntry])
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUserHistory indicates an expected call of ListUserHistory.
+func (mr *MockServiceMockRecorder) ListUserHistory(ctx, id, p any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUserHistory", reflect.TypeOf((*MockService)(nil).ListUserHistory), ctx, id, p)
 }
 
 // ListUsers mocks base method.
@@ -200,6 +714,51 @@ func (mr *MockServiceMockRecorder) ListUsers(ctx, q any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUsers", reflect.TypeOf((*MockService)(nil).ListUsers), ctx, q)
 }
 
+// PurgeDeletedUsers mocks base method.
+func (m *MockService) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time, batchSize int) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeDeletedUsers", ctx, deletedBefore, batchSize)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeDeletedUsers indicates an expected call of PurgeDeletedUsers.
+func (mr *MockServiceMockRecorder) PurgeDeletedUsers(ctx, deletedBefore, batchSize any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeDeletedUsers", reflect.TypeOf((*MockService)(nil).PurgeDeletedUsers), ctx, deletedBefore, batchSize)
+}
+
+// RestoreUser mocks base method.
+func (m *MockService) RestoreUser(ctx context.Context, id uuid.UUID) (*user.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreUser", ctx, id)
+	ret0, _ := ret[0].(*user.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreUser indicates an expected call of RestoreUser.
+func (mr *MockServiceMockRecorder) RestoreUser(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreUser", reflect.TypeOf((*MockService)(nil).RestoreUser), ctx, id)
+}
+
+// SearchUsers mocks base method.
+func (m *MockService) SearchUsers(ctx context.Context, s query.Search) (*query.PaginationResponse[user.User], error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchUsers", ctx, s)
+	ret0, _ := ret[0].(*query.PaginationResponse[user.User])
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchUsers indicates an expected call of SearchUsers.
+func (mr *MockServiceMockRecorder) SearchUsers(ctx, s any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchUsers", reflect.TypeOf((*MockService)(nil).SearchUsers), ctx, s)
+}
+
 // UpdateUser mocks base method.
 func (m *MockService) UpdateUser(ctx context.Context, input *user.UpdateUserInput) (*user.User, error) {
 	m.ctrl.T.Helper()
@@ -214,3 +773,42 @@ func (mr *MockServiceMockRecorder) UpdateUser(ctx, input any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockService)(nil).UpdateUser), ctx, input)
 }
+
+// MockDataExportService is a mock of DataExportService interface.
+type MockDataExportService struct {
+	ctrl     *gomock.Controller
+	recorder *MockDataExportServiceMockRecorder
+	isgomock struct{}
+}
+
+// MockDataExportServiceMockRecorder is the mock recorder for MockDataExportService.
+type MockDataExportServiceMockRecorder struct {
+	mock *MockDataExportService
+}
+
+// NewMockDataExportService creates a new mock instance.
+func NewMockDataExportService(ctrl *gomock.Controller) *MockDataExportService {
+	mock := &MockDataExportService{ctrl: ctrl}
+	mock.recorder = &MockDataExportServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDataExportService) EXPECT() *MockDataExportServiceMockRecorder {
+	return m.recorder
+}
+
+// ExportUserData mocks base method.
+func (m *MockDataExportService) ExportUserData(ctx context.Context, id uuid.UUID) (*user.DataExport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportUserData", ctx, id)
+	ret0, _ := ret[0].(*user.DataExport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExportUserData indicates an expected call of ExportUserData.
+func (mr *MockDataExportServiceMockRecorder) ExportUserData(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportUserData", reflect.TypeOf((*MockDataExportService)(nil).ExportUserData), ctx, id)
+}
@@ -4,7 +4,11 @@ package user
 //go:generate mockgen -source=user.go -destination=mocks/user_mock.go -package=mocks
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,16 +19,41 @@ import (
 	"gorm.io/gorm"
 )
 
-// ErrPasswordTooLong is an error returned when the password is too long to hash.
-var ErrPasswordTooLong = errors.NewWrongInput("can't hash password")
+var (
+	// ErrPasswordTooLong is an error returned when the password is too long to hash.
+	ErrPasswordTooLong = errors.NewWrongInput("can't hash password")
+	// ErrIdempotencyKeyReused is returned when an idempotency key is sent again with a different request.
+	ErrIdempotencyKeyReused = errors.NewUnprocessableEntity("idempotency key was already used with a different request")
+	// ErrEmailTaken is returned when a deleted user can't be restored because a live user has its email.
+	ErrEmailTaken = errors.NewConflict("email is used by another user")
+)
 
 // EventType represents the type of event related to a user.
 type EventType string
 
 const (
-	UserCreated EventType = "UserCreated"
-	UserUpdated EventType = "UserUpdated"
-	UserDeleted EventType = "UserDeleted"
+	UserCreated  EventType = "UserCreated"
+	UserUpdated  EventType = "UserUpdated"
+	UserDeleted  EventType = "UserDeleted"
+	UserRestored EventType = "UserRestored"
+	UserErased   EventType = "UserErased"
+)
+
+// AuditOperation is the change of a user recorded by an audit entry.
+type AuditOperation string
+
+const (
+	AuditCreate  AuditOperation = "create"
+	AuditUpdate  AuditOperation = "update"
+	AuditDelete  AuditOperation = "delete"
+	AuditRestore AuditOperation = "restore"
+)
+
+const (
+	// AnonymousActor is the actor kind of the changes made by unauthenticated callers, such as the sign ups.
+	AnonymousActor = "anonymous"
+	// RedactedValue replaces the values of the sensitive fields in the audit entries.
+	RedactedValue = "[REDACTED]"
 )
 
 // User represents a user domain model.
@@ -39,6 +68,32 @@ type User struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt
+	// Version is incremented by every update, updates and deletes can require the version they expect.
+	Version int64 `gorm:"default:1"`
+}
+
+// FieldValue returns the value of the column of the user, it's used to build the pagination cursors.
+// The password is never returned.
+func (u *User) FieldValue(column string) any {
+	switch column {
+	case "id":
+		return u.ID
+	case "first_name":
+		return u.FirstName
+	case "last_name":
+		return u.LastName
+	case "nick_name":
+		return u.NickName
+	case "email":
+		return u.Email
+	case "country":
+		return u.Country
+	case "created_at":
+		return u.CreatedAt
+	case "updated_at":
+		return u.UpdatedAt
+	}
+	return nil
 }
 
 // CreateUserInput represents the input for creating a user.
@@ -49,10 +104,122 @@ type CreateUserInput struct {
 	Password  string
 	Email     string
 	Country   string
+	// IdempotencyKey is optional, the retries of a creation with the same key return the user created first.
+	IdempotencyKey string
+}
+
+// Fingerprint returns the hash of the input fields, the password and the idempotency key are left out.
+// It tells whether two requests sent with the same idempotency key are the same request.
+func (input *CreateUserInput) Fingerprint() string {
+	h := sha256.New()
+	for _, v := range []string{input.FirstName, input.LastName, input.NickName, input.Email, input.Country} {
+		// the length prefix keeps the fields apart, so moving characters between them changes the hash
+		fmt.Fprintf(h, "%d:%s", len(v), v)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Session is a refresh token issued to the user, the token hash is never part of it.
+type Session struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+}
+
+// EventRecord is an event sent about the user, as it's kept in the outbox.
+type EventRecord struct {
+	ID        uuid.UUID
+	EventType string
+	TraceID   string
+	Payload   json.RawMessage
+	CreatedAt time.Time
+	// SentAt is nil while the event is waiting to be published.
+	SentAt *time.Time
+}
+
+// AuditEntry records a change made to a user: who made it, in which request and what changed.
+type AuditEntry struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Operation AuditOperation
+	// ActorKind is the auth.IdentityKind of the caller, or AnonymousActor when it wasn't authenticated.
+	ActorKind string
+	// ActorID is the subject of the caller, the user ID or the API key name. It's empty for anonymous callers.
+	ActorID string
+	TraceID string
+	// Changes are the changed fields, the values of the sensitive ones are redacted.
+	Changes   []Change
+	CreatedAt time.Time
+}
+
+// AuditChanges returns the changes as they are recorded by the audit, the password values are
+// replaced by RedactedValue, so a password change is recorded without its hashes.
+func AuditChanges(changes []Change) []Change {
+	res := make([]Change, len(changes))
+	for i, c := range changes {
+		if c.Field == "password" {
+			c.Before, c.After = RedactedValue, RedactedValue
+		}
+		res[i] = c
+	}
+	return res
+}
+
+// CreationChanges returns the fields set by the creation of the user, from empty to their value.
+func CreationChanges(u *User) []Change {
+	return []Change{
+		{Field: "first_name", After: u.FirstName},
+		{Field: "last_name", After: u.LastName},
+		{Field: "nick_name", After: u.NickName},
+		{Field: "password", After: u.Password},
+		{Field: "email", After: u.Email},
+		{Field: "country", After: u.Country},
+	}
+}
+
+// DataExport is everything the service holds about a user, it answers the data subject access requests.
+type DataExport struct {
+	// User is the profile of the user, deleted or not, its password hash is always cleared.
+	User       User
+	Sessions   []Session
+	Events     []EventRecord
+	Audit      []AuditEntry
+	ExportedAt time.Time
+}
+
+// IdempotencyRecord is the outcome of a user creation sent with an idempotency key,
+// it's replayed to the retries of the creation until it expires.
+type IdempotencyRecord struct {
+	Key string `gorm:"primaryKey"`
+	// UserID is the created user, the records of a user are deleted when it's erased.
+	UserID uuid.UUID
+	// RequestHash is the Fingerprint of the input, PasswordHash the bcrypt hash of its password.
+	RequestHash  string
+	PasswordHash string
+	// Response is the created user encoded as JSON, without the password.
+	Response  []byte
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// TableName returns the table name for the idempotency record model.
+func (IdempotencyRecord) TableName() string {
+	return "user_svc.idempotency_keys"
+}
+
+// Matches reports whether the input is the request that created the record.
+func (r IdempotencyRecord) Matches(input *CreateUserInput) bool {
+	return r.RequestHash == input.Fingerprint() && ComparePassword(r.PasswordHash, input.Password)
+}
+
+// NormalizeEmail returns the email in the form it's stored, emails are unique regardless of their case.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
 
 // NewUser creates a new user with the provided input. It hashes the password before storing it.
-// it also generates a new UUID for the user.
+// it also generates a new UUID for the user, and normalizes the email.
 func NewUser(input *CreateUserInput) (*User, error) {
 	hashedPassword, err := HashPassword(input.Password)
 	if err != nil {
@@ -64,14 +231,16 @@ func NewUser(input *CreateUserInput) (*User, error) {
 		LastName:  input.LastName,
 		NickName:  input.NickName,
 		Password:  hashedPassword,
-		Email:     input.Email,
+		Email:     NormalizeEmail(input.Email),
 		Country:   input.Country,
 	}
 	return &u, nil
 }
 
 type UpdateUserInput struct {
-	ID        uuid.UUID
+	ID uuid.UUID
+	// Version is the version of the user expected by the caller, the user is only updated if it still has it.
+	Version   *int64
 	FirstName *string
 	LastName  *string
 	NickName  *string
@@ -80,32 +249,43 @@ type UpdateUserInput struct {
 	Country   *string
 }
 
-// Update updates the user fields with the provided input.
-func (u *User) Update(input *UpdateUserInput) error {
+// Change represents the change of a user field, Field is the column name of the field.
+type Change struct {
+	Field  string
+	Before string
+	After  string
+}
 
-	if input.FirstName != nil {
-		u.FirstName = *input.FirstName
-	}
-	if input.LastName != nil {
-		u.LastName = *input.LastName
-	}
-	if input.NickName != nil {
-		u.NickName = *input.NickName
+// Update updates the user fields with the provided input, and returns the fields that changed.
+// The password values are never returned, a password change only reports the field. The email is
+// normalized, so changing only its case is not a change.
+func (u *User) Update(input *UpdateUserInput) ([]Change, error) {
+	changes := []Change{}
+	set := func(field string, current *string, value *string) {
+		if value == nil || *value == *current {
+			return
+		}
+		changes = append(changes, Change{Field: field, Before: *current, After: *value})
+		*current = *value
 	}
+
+	set("first_name", &u.FirstName, input.FirstName)
+	set("last_name", &u.LastName, input.LastName)
+	set("nick_name", &u.NickName, input.NickName)
 	if input.Password != nil {
 		hashedPassword, err := HashPassword(*input.Password)
 		if err != nil {
-			return fmt.Errorf("failed to hash password: %w", err)
+			return nil, fmt.Errorf("failed to hash password: %w", err)
 		}
 		u.Password = hashedPassword
+		changes = append(changes, Change{Field: "password"})
 	}
 	if input.Email != nil {
-		u.Email = *input.Email
-	}
-	if input.Country != nil {
-		u.Country = *input.Country
+		email := NormalizeEmail(*input.Email)
+		set("email", &u.Email, &email)
 	}
-	return nil
+	set("country", &u.Country, input.Country)
+	return changes, nil
 }
 
 // TableName returns the table name for the user model.
@@ -116,19 +296,124 @@ func (User) TableName() string {
 // Repository defines the interface for user data access operations.
 type Repository interface {
 	CreateUser(ctx context.Context, u *User) (*User, error)
-	UpdateUser(ctx context.Context, u *User) (*User, error)
-	DeleteUser(ctx context.Context, id uuid.UUID) error
+	// UpdateUser writes the columns of the user, usually the fields of the Changes returned by Update,
+	// and increments its version. Only the stored user that isn't soft deleted and still has u.Version is
+	// updated, a missing user is never created: it returns errors.ErrNotfound if the user doesn't exist
+	// or is deleted, and errors.ErrVersionMismatch if it was modified since it was read.
+	UpdateUser(ctx context.Context, u *User, columns []string) (*User, error)
+	// DeleteUser soft deletes the user and increments its version. It returns errors.ErrNotfound if the user
+	// doesn't exist or is already deleted. If version is set, the user is only deleted if it has it,
+	// otherwise errors.ErrVersionMismatch is returned if the user exists.
+	DeleteUser(ctx context.Context, id uuid.UUID, version *int64) error
+	// RestoreUser undoes the soft delete of the user, increments its version and returns the restored user.
+	// It returns errors.ErrNotfound if there isn't a deleted user with the id, and errors.ErrDuplicated
+	// if a live user has its email.
+	RestoreUser(ctx context.Context, id uuid.UUID) (*User, error)
+	// EraseUser permanently deletes the user, deleted or not, with its refresh tokens and the events about it
+	// stored in the outbox, it must take part in the transaction carried by ctx. It returns errors.ErrNotfound
+	// if there isn't any user with the id. If version is set, the user is only erased if it has it, otherwise
+	// errors.ErrVersionMismatch is returned.
+	EraseUser(ctx context.Context, id uuid.UUID, version *int64) error
+	// PurgeDeletedUsers permanently deletes up to limit users soft deleted before deletedBefore, the ones deleted
+	// the longest ago first, with the same data as EraseUser, and returns their ids.
+	PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time, limit int) ([]uuid.UUID, error)
 	ListUsers(ctx context.Context, q query.Query) ([]User, error)
 	GetUserByID(ctx context.Context, id uuid.UUID) (*User, error)
-	CountUsers(ctx context.Context, filters map[string][]string) (int64, error)
+	// GetUserFields returns the user with only its version and the columns of the response fields loaded,
+	// all of them when fields is empty. It returns errors.ErrNotfound if the user doesn't exist or is deleted.
+	GetUserFields(ctx context.Context, id uuid.UUID, fields []string) (*User, error)
+	// GetUserByIDWithDeleted returns the user even if it's soft deleted, errors.ErrNotfound if it doesn't exist.
+	GetUserByIDWithDeleted(ctx context.Context, id uuid.UUID) (*User, error)
+	// GetUserByEmail returns the user with the email regardless of its case, soft deleted users are not returned.
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	CountUsers(ctx context.Context, filters query.Filters) (int64, error)
+	// EstimateCountUsers returns an estimate of CountUsers from the database statistics, without scanning the users.
+	EstimateCountUsers(ctx context.Context, filters query.Filters) (int64, error)
+	// SearchUsers returns the page of the users matching the search term, the most similar first.
+	SearchUsers(ctx context.Context, s query.Search) ([]User, error)
+	// CountSearchUsers returns the number of users matching the search term.
+	CountSearchUsers(ctx context.Context, term string) (int64, error)
+	// ExportUsers calls fn with every user matching the export, in order, from a single consistent snapshot.
+	// The users are read in batches, it stops at the first error of fn or when ctx is done.
+	ExportUsers(ctx context.Context, e query.Export, fn func(u *User) error) error
+}
+
+// IdempotencyRepository stores the idempotency records of the user creations.
+type IdempotencyRepository interface {
+	// GetIdempotencyRecord returns the record of the key, errors.ErrNotfound if there isn't any or it expired at now.
+	GetIdempotencyRecord(ctx context.Context, key string, now time.Time) (*IdempotencyRecord, error)
+	// CreateIdempotencyRecord stores the record, replacing an expired one with the same key.
+	// It returns errors.ErrDuplicated if a record of the key that isn't expired exists.
+	CreateIdempotencyRecord(ctx context.Context, r *IdempotencyRecord) error
+	// DeleteExpiredIdempotencyRecords deletes the records expired at now and returns how many were deleted.
+	DeleteExpiredIdempotencyRecords(ctx context.Context, now time.Time) (int64, error)
+	// DeleteUserIdempotencyRecords deletes the records of the creation of the user, expired or not,
+	// and returns how many were deleted.
+	DeleteUserIdempotencyRecords(ctx context.Context, userID uuid.UUID) (int64, error)
+	// DeleteErasedUsersIdempotencyRecords deletes the records of the creation of the users that don't exist
+	// anymore, expired or not, and returns how many were deleted.
+	DeleteErasedUsersIdempotencyRecords(ctx context.Context) (int64, error)
+}
+
+// ActivityRepository reads the records kept about a user besides its profile.
+type ActivityRepository interface {
+	// ListUserSessions returns the refresh tokens issued to the user, the oldest first.
+	ListUserSessions(ctx context.Context, userID uuid.UUID) ([]Session, error)
+	// ListUserEvents returns the events sent about the user, in the order they were written.
+	ListUserEvents(ctx context.Context, userID uuid.UUID) ([]EventRecord, error)
+	// ListUserAudit returns the audit entries of the user, the oldest first.
+	ListUserAudit(ctx context.Context, userID uuid.UUID) ([]AuditEntry, error)
+}
+
+// AuditRepository stores the audit trail of the changes made to the users.
+type AuditRepository interface {
+	// AddAuditEntry stores the entry and sets its CreatedAt, it must take part in the transaction carried by ctx if any.
+	AddAuditEntry(ctx context.Context, e *AuditEntry) error
+	// ListUserAuditEntries returns a page of the audit entries of the user, the most recent first.
+	ListUserAuditEntries(ctx context.Context, userID uuid.UUID, page, pageSize int) ([]AuditEntry, error)
+	CountUserAuditEntries(ctx context.Context, userID uuid.UUID) (int64, error)
+	// DeleteUserAuditEntries deletes the audit entries of the users, they are erased with the users.
+	DeleteUserAuditEntries(ctx context.Context, userIDs ...uuid.UUID) (int64, error)
+}
+
+// Transactor runs operations in a single transaction.
+type Transactor interface {
+	// WithinTransaction runs fn in a transaction, repositories called with the ctx given to fn take part in it.
+	// The transaction is rolled back if fn returns an error, and committed otherwise.
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+	// WithinReadOnlyTransaction runs fn in a read only repeatable read transaction, so all the reads of fn
+	// see the same snapshot. Nested in another transaction, fn runs in the outer transaction as it is.
+	WithinReadOnlyTransaction(ctx context.Context, fn func(ctx context.Context) error) error
 }
 
 // Service defines the interface for user business logic operations.
 type Service interface {
 	CreateUser(ctx context.Context, u *CreateUserInput) (*User, error)
 	UpdateUser(ctx context.Context, input *UpdateUserInput) (*User, error)
-	DeleteUser(ctx context.Context, id uuid.UUID) error
+	// DeleteUser soft deletes the user, if version is set the user must exist and have it.
+	DeleteUser(ctx context.Context, id uuid.UUID, version *int64) error
+	// RestoreUser restores the deleted user, it returns ErrEmailTaken if a live user has its email.
+	RestoreUser(ctx context.Context, id uuid.UUID) (*User, error)
+	// EraseUser permanently deletes the user and its personal data, if version is set the user must have it.
+	EraseUser(ctx context.Context, id uuid.UUID, version *int64) error
+	// PurgeDeletedUsers erases the users soft deleted before deletedBefore, batchSize users per transaction,
+	// and returns how many were erased.
+	PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time, batchSize int) (int, error)
+	// GetUser returns the user with only the response fields loaded, all of them when fields is empty.
+	GetUser(ctx context.Context, id uuid.UUID, fields []string) (*User, error)
+	// ListUserHistory returns a page of the audit entries of the user, deleted or not, the most recent first.
+	// It returns errors.ErrNotfound if the user doesn't exist or was erased.
+	ListUserHistory(ctx context.Context, id uuid.UUID, p query.Pagination) (*query.PaginationResponse[AuditEntry], error)
 	ListUsers(ctx context.Context, q query.Query) (*query.PaginationResponse[User], error)
+	SearchUsers(ctx context.Context, s query.Search) (*query.PaginationResponse[User], error)
+	ExportUsers(ctx context.Context, e query.Export, fn func(u *User) error) error
+}
+
+// DataExportService assembles the data held about the users.
+type DataExportService interface {
+	// ExportUserData returns everything held about the user, soft deleted or not. It returns
+	// errors.ErrNotfound if the user doesn't exist or was erased.
+	ExportUserData(ctx context.Context, id uuid.UUID) (*DataExport, error)
 }
 
 // HashPassword hashes a password using bcrypt.
@@ -3,6 +3,7 @@ package user_test
 import (
 	"testing"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/zechao/faceit-user-svc/user"
 	"golang.org/x/crypto/bcrypt"
@@ -52,3 +53,164 @@ func TestComparePassword(t *testing.T) {
 		assert.False(t, user.ComparePassword(string("invalidhash"), "superpassword"))
 	})
 }
+
+func TestNewUser(t *testing.T) {
+	u, err := user.NewUser(&user.CreateUserInput{
+		FirstName: "john",
+		LastName:  "doe",
+		NickName:  "j.d",
+		Email:     " John.Doe@Gmail.COM ",
+		Password:  "superpassword",
+		Country:   "ES",
+	})
+	assert.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, u.ID)
+	assert.Equal(t, "john.doe@gmail.com", u.Email)
+	assert.True(t, user.ComparePassword(u.Password, "superpassword"))
+}
+
+func TestUpdate(t *testing.T) {
+	newUser := func() *user.User {
+		return &user.User{
+			FirstName: "john",
+			LastName:  "doe",
+			NickName:  "j.d",
+			Email:     "j.d@gmail.com",
+			Password:  "hashedpassword",
+			Country:   "ES",
+		}
+	}
+
+	t.Run("should return changed fields only", func(t *testing.T) {
+		u := newUser()
+		sameNickName := "j.d"
+		country := "GB"
+		changes, err := u.Update(&user.UpdateUserInput{
+			NickName: &sameNickName,
+			Country:  &country,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []user.Change{
+			{Field: "country", Before: "ES", After: "GB"},
+		}, changes)
+		assert.Equal(t, "GB", u.Country)
+	})
+
+	t.Run("should not return password values", func(t *testing.T) {
+		u := newUser()
+		password := "newsuperpassword"
+		changes, err := u.Update(&user.UpdateUserInput{
+			Password: &password,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []user.Change{
+			{Field: "password"},
+		}, changes)
+		assert.True(t, user.ComparePassword(u.Password, password))
+	})
+
+	t.Run("should normalize the email", func(t *testing.T) {
+		u := newUser()
+		sameEmail := " J.D@Gmail.com"
+		changes, err := u.Update(&user.UpdateUserInput{
+			Email: &sameEmail,
+		})
+		assert.NoError(t, err)
+		assert.Empty(t, changes, "changing only the case is not a change")
+
+		email := "John.Doe@Gmail.com"
+		changes, err = u.Update(&user.UpdateUserInput{
+			Email: &email,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []user.Change{
+			{Field: "email", Before: "j.d@gmail.com", After: "john.doe@gmail.com"},
+		}, changes)
+		assert.Equal(t, "john.doe@gmail.com", u.Email)
+	})
+
+	t.Run("should return empty changes when nothing changes", func(t *testing.T) {
+		u := newUser()
+		changes, err := u.Update(&user.UpdateUserInput{})
+		assert.NoError(t, err)
+		assert.Empty(t, changes)
+		assert.Equal(t, newUser(), u)
+	})
+
+	t.Run("should return error when password too long", func(t *testing.T) {
+		u := newUser()
+		var password string
+		for i := 0; i < 20; i++ {
+			password += "password1234567890000000"
+		}
+		changes, err := u.Update(&user.UpdateUserInput{
+			Password: &password,
+		})
+		assert.ErrorIs(t, err, user.ErrPasswordTooLong)
+		assert.Nil(t, changes)
+	})
+}
+
+func TestIdempotencyRecordMatches(t *testing.T) {
+	input := user.CreateUserInput{
+		FirstName: "jin",
+		LastName:  "zechao",
+		NickName:  "zen",
+		Email:     "zechao@gmail.com",
+		Password:  "superpassword",
+		Country:   "ES",
+	}
+	hash, err := user.HashPassword(input.Password)
+	assert.NoError(t, err)
+	record := user.IdempotencyRecord{RequestHash: input.Fingerprint(), PasswordHash: hash}
+
+	tests := map[string]struct {
+		update func(in *user.CreateUserInput)
+		want   bool
+	}{
+		"same request": {
+			update: func(in *user.CreateUserInput) {},
+			want:   true,
+		},
+		"another key": {
+			update: func(in *user.CreateUserInput) { in.IdempotencyKey = "other" },
+			want:   true,
+		},
+		"another field": {
+			update: func(in *user.CreateUserInput) { in.Country = "GB" },
+			want:   false,
+		},
+		"characters moved between fields": {
+			update: func(in *user.CreateUserInput) { in.FirstName, in.LastName = "jinz", "echao" },
+			want:   false,
+		},
+		"another password": {
+			update: func(in *user.CreateUserInput) { in.Password = "otherpassword" },
+			want:   false,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			in := input
+			tt.update(&in)
+			assert.Equal(t, tt.want, record.Matches(&in))
+		})
+	}
+}
+
+func TestAuditChanges(t *testing.T) {
+	changes := []user.Change{
+		{Field: "email", Before: "a@faceit.com", After: "b@faceit.com"},
+		{Field: "password", After: "$2a$10$hash"},
+		{Field: "password"},
+	}
+
+	res := user.AuditChanges(changes)
+	assert.Equal(t, []user.Change{
+		{Field: "email", Before: "a@faceit.com", After: "b@faceit.com"},
+		{Field: "password", Before: user.RedactedValue, After: user.RedactedValue},
+		{Field: "password", Before: user.RedactedValue, After: user.RedactedValue},
+	}, res)
+	// the input is not modified
+	assert.Equal(t, "$2a$10$hash", changes[1].After)
+}